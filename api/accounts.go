@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/notify"
+)
+
+// Account is a user of the API. When a server has accounts every request
+// must carry one of their tokens as a bearer token (Authorization header)
+type Account struct {
+	// Name identifies the user, e.g. in the audit log
+	Name string `json:"name"`
+	// TokenSHA256 is the hex encoded SHA-256 hash of the user's API token,
+	// e.g. the output of `printf %s "$TOKEN" | sha256sum`
+	TokenSHA256 string `json:"token_sha256,omitempty"`
+	// Admin users can access all cameras, the audit log and the profiling
+	// handlers
+	Admin bool `json:"admin,omitempty"`
+	// Cameras are the names of the cameras users who aren't admins can
+	// access, none when empty
+	Cameras []string `json:"cameras,omitempty"`
+	// Notify are the notification channels the user wants to receive alerts
+	// on, e.g. "email", see SubscriberNotifier
+	Notify []string `json:"notify,omitempty"`
+	// Addresses are where the user receives alerts on each channel, e.g.
+	// {"email": "ana@example.com"}
+	Addresses map[string]string `json:"addresses,omitempty"`
+}
+
+// CanAccess returns whether the user can access the named camera
+func (a Account) CanAccess(camera string) bool {
+	if a.Admin {
+		return true
+	}
+	for _, c := range a.Cameras {
+		if c == camera {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsNotification returns whether the user wants alerts on the channel
+func (a Account) wantsNotification(channel string) bool {
+	for _, c := range a.Notify {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribers returns the accounts which can access the named camera and
+// want to be notified of its events on the given channel
+func Subscribers(accounts []Account, camera, channel string) []Account {
+	subs := []Account{}
+	for _, a := range accounts {
+		if a.CanAccess(camera) && a.wantsNotification(channel) {
+			subs = append(subs, a)
+		}
+	}
+	return subs
+}
+
+// SubscriberNotifier returns a notifier for a channel, e.g. to add to a
+// notify.Dispatcher under the channel's name, which delivers each event to
+// the accounts which can access its camera and want to be notified on the
+// channel, see Subscribers, with the given function. Events nobody
+// subscribed to aren't delivered
+func SubscriberNotifier(accounts []Account, channel string, deliver func(ctx context.Context, r *events.Record, subscribers []Account) error) notify.Notifier {
+	return notify.NotifierFunc(func(ctx context.Context, r *events.Record) error {
+		camera := r.Camera
+		if camera == "" {
+			camera = DefaultCamera
+		}
+		subs := Subscribers(accounts, camera, channel)
+		if len(subs) == 0 {
+			return nil
+		}
+		return deliver(ctx, r, subs)
+	})
+}
+
+// LoadAccounts reads a JSON encoded list of accounts from a file. Accounts
+// which aren't admins must list the cameras they can access
+func LoadAccounts(path string) ([]Account, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	accounts := []Account{}
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("invalid accounts file %s: %w", path, err)
+	}
+	for _, a := range accounts {
+		if sum, err := hex.DecodeString(a.TokenSHA256); err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("account %q has an invalid token hash", a.Name)
+		}
+		if !a.Admin && len(a.Cameras) == 0 {
+			return nil, fmt.Errorf("account %q can't access any camera, list its cameras or make it an admin", a.Name)
+		}
+	}
+	return accounts, nil
+}
+
+// WithAccounts requires every request to be authenticated as one of the
+// given accounts, and restricts each to the cameras it can access
+func WithAccounts(accounts ...Account) Option {
+	return func(s *Server) {
+		s.accounts = append(s.accounts, accounts...)
+		s.mux.HandleFunc("/me", s.handleMe)
+	}
+}
+
+// accountKey is the context key of the account which made a request
+type accountKey struct{}
+
+// requestAccount returns the account which made a request, nil when the
+// server has no accounts
+func requestAccount(r *http.Request) *Account {
+	acct, _ := r.Context().Value(accountKey{}).(*Account)
+	return acct
+}
+
+// authenticate returns the account whose token a request carries as a
+// bearer token
+func (s *Server) authenticate(r *http.Request) (*Account, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if token == "" {
+		return nil, false
+	}
+	sum := sha256.Sum256([]byte(token))
+	for i := range s.accounts {
+		want, _ := hex.DecodeString(s.accounts[i].TokenSHA256)
+		if subtle.ConstantTimeCompare(sum[:], want) == 1 {
+			return &s.accounts[i], true
+		}
+	}
+	return nil, false
+}
+
+// adminOnly restricts a handler to admin users, or to anyone when the server
+// has no accounts and WithoutAuthentication is set
+func (s *Server) adminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if acct := requestAccount(r); (acct == nil && !s.open) || (acct != nil && !acct.Admin) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	acct := *requestAccount(r)
+	acct.TokenSHA256 = ""
+	writeJSON(w, acct)
+}
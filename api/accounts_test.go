@@ -0,0 +1,215 @@
+//go:build purego || nogui
+// +build purego nogui
+
+package api_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/adrianosela/GoAway/api"
+	"github.com/adrianosela/GoAway/audit"
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/detector/sourcetest"
+	"github.com/adrianosela/GoAway/events"
+)
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+var accounts = []api.Account{
+	{Name: "alice", TokenSHA256: hash("alice-token"), Admin: true},
+	{Name: "bob", TokenSHA256: hash("bob-token"), Cameras: []string{"storage-room"}, Notify: []string{"email"}},
+	{Name: "carol", TokenSHA256: hash("carol-token"), Cameras: []string{api.DefaultCamera, "storage-room"}},
+}
+
+func server(t *testing.T, opts ...api.Option) *api.Server {
+	t.Helper()
+	cameras := []*detector.Detector{}
+	for i := 0; i < 2; i++ {
+		d, err := detector.NewMotionDetectorFromSource(sourcetest.New(64, 48, 1), "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cameras = append(cameras, d)
+	}
+	return api.NewServer(cameras[0], append([]api.Option{api.WithCamera("storage-room", cameras[1])}, opts...)...)
+}
+
+func get(s *api.Server, path, auth string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if auth != "" {
+		r.Header.Set("Authorization", auth)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthentication(t *testing.T) {
+	s := server(t, api.WithAccounts(accounts...))
+	tests := []struct {
+		name string
+		auth string
+		want int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"bare token", "alice-token", http.StatusUnauthorized},
+		{"other scheme", "Basic alice-token", http.StatusUnauthorized},
+		{"empty bearer token", "Bearer ", http.StatusUnauthorized},
+		{"unknown token", "Bearer mallory-token", http.StatusUnauthorized},
+		{"bearer token", "Bearer alice-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := get(s, "/status", tt.auth); w.Code != tt.want {
+			t.Errorf("%s: got status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestCameraAccess(t *testing.T) {
+	s := server(t, api.WithAccounts(accounts...))
+	tests := []struct {
+		token string
+		path  string
+		want  int
+	}{
+		{"alice-token", "/status", http.StatusOK},
+		{"alice-token", "/cameras/storage-room/status", http.StatusOK},
+		{"bob-token", "/status", http.StatusNotFound},
+		{"bob-token", "/cameras/" + api.DefaultCamera + "/status", http.StatusNotFound},
+		{"bob-token", "/cameras/storage-room/status", http.StatusOK},
+		{"bob-token", "/cameras/garage/status", http.StatusNotFound},
+		{"carol-token", "/status", http.StatusOK},
+		{"carol-token", "/cameras/storage-room/status", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := get(s, tt.path, "Bearer "+tt.token); w.Code != tt.want {
+			t.Errorf("%s on %s: got status %d, want %d", tt.token, tt.path, w.Code, tt.want)
+		}
+	}
+
+	lists := map[string][]string{
+		"alice-token": {api.DefaultCamera, "storage-room"},
+		"bob-token":   {"storage-room"},
+	}
+	for token, want := range lists {
+		w := get(s, "/cameras", "Bearer "+token)
+		got := []string{}
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got cameras %v, want %v", token, got, want)
+		}
+	}
+}
+
+func TestAccountWithoutCamerasCantAccessAny(t *testing.T) {
+	acct := api.Account{Name: "dave"}
+	for _, camera := range []string{api.DefaultCamera, "storage-room"} {
+		if acct.CanAccess(camera) {
+			t.Errorf("an account listing no cameras can access %s", camera)
+		}
+	}
+}
+
+func do(s *api.Server, method, path string) int {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w.Code
+}
+
+func TestNoAccountsIsReadOnly(t *testing.T) {
+	l, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	tests := []struct {
+		method, path string
+		want         int
+		open         int
+	}{
+		{http.MethodGet, "/status", http.StatusOK, http.StatusOK},
+		{http.MethodGet, "/cameras/storage-room/status", http.StatusOK, http.StatusOK},
+		{http.MethodGet, "/cameras", http.StatusOK, http.StatusOK},
+		{http.MethodPost, "/disarm", http.StatusForbidden, http.StatusNoContent},
+		{http.MethodPost, "/cameras/storage-room/arm", http.StatusForbidden, http.StatusNoContent},
+		{http.MethodPost, "/sensitivity?min_area=3000", http.StatusForbidden, http.StatusNoContent},
+		{http.MethodPut, "/controls", http.StatusForbidden, http.StatusBadRequest},
+		{http.MethodGet, "/audit", http.StatusForbidden, http.StatusOK},
+		{http.MethodGet, "/debug/pprof/", http.StatusForbidden, http.StatusOK},
+	}
+	closed := server(t, api.WithAuditLog(l), api.WithPprof())
+	open := server(t, api.WithAuditLog(l), api.WithPprof(), api.WithoutAuthentication())
+	for _, tt := range tests {
+		if got := do(closed, tt.method, tt.path); got != tt.want {
+			t.Errorf("%s %s: got status %d without accounts, want %d", tt.method, tt.path, got, tt.want)
+		}
+		if got := do(open, tt.method, tt.path); got != tt.open {
+			t.Errorf("%s %s: got status %d without authentication, want %d", tt.method, tt.path, got, tt.open)
+		}
+	}
+}
+
+func TestLoadAccounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		account api.Account
+		valid   bool
+	}{
+		{"admin", api.Account{Name: "alice", TokenSHA256: hash("a"), Admin: true}, true},
+		{"cameras", api.Account{Name: "bob", TokenSHA256: hash("b"), Cameras: []string{"garage"}}, true},
+		{"no cameras", api.Account{Name: "dave", TokenSHA256: hash("d")}, false},
+		{"invalid hash", api.Account{Name: "erin", TokenSHA256: "e", Admin: true}, false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "accounts.json")
+		data, err := json.Marshal([]api.Account{tt.account})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.LoadAccounts(path); (err == nil) != tt.valid {
+			t.Errorf("%s: got error %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+	if _, err := api.LoadAccounts(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("got error %v for a missing file", err)
+	}
+}
+
+func TestSubscriberNotifier(t *testing.T) {
+	got := map[string][]string{}
+	n := api.SubscriberNotifier(accounts, "email", func(ctx context.Context, r *events.Record, subs []api.Account) error {
+		for _, sub := range subs {
+			got[r.ID] = append(got[r.ID], sub.Name)
+		}
+		return nil
+	})
+	for _, r := range []*events.Record{
+		{ID: "default"},
+		{ID: "storage", Camera: "storage-room"},
+	} {
+		if err := n.Notify(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string][]string{"storage": {"bob"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got subscribers %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,976 @@
+// Package api exposes a motion detector over HTTP
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/audit"
+	"github.com/adrianosela/GoAway/cluster"
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/export"
+	"github.com/adrianosela/GoAway/nodered"
+	"github.com/adrianosela/GoAway/notify"
+	"github.com/adrianosela/GoAway/rules"
+	"github.com/adrianosela/GoAway/storage"
+	"github.com/adrianosela/GoAway/sysinfo"
+	"github.com/adrianosela/GoAway/tune"
+)
+
+// DefaultCamera is the name of the camera a Server is created with, its
+// endpoints are served both at the root and under /cameras/default/
+const DefaultCamera = "default"
+
+// Server is an HTTP API for one or more motion detectors
+type Server struct {
+	cameras   map[string]*detector.Detector
+	mux       *http.ServeMux
+	audit     *audit.Log
+	accounts  []Account
+	events    events.Store
+	notifiers *notify.Dispatcher
+	rules     *rules.Engine
+	devices   *notify.Devices
+	media     storage.Storage
+	recording string
+	letters   *cluster.DeadLetters
+	// open lets anyone control the cameras and use the admin endpoints
+	// when the server has no accounts, see WithoutAuthentication
+	open bool
+}
+
+// cameraHandler handles a request for one of a server's cameras
+type cameraHandler func(w http.ResponseWriter, r *http.Request, c camera)
+
+// camera is a named detector served by a Server
+type camera struct {
+	name     string
+	detector *detector.Detector
+}
+
+// Option configures optional behaviour of a Server
+type Option func(*Server)
+
+// WithoutAuthentication lets anyone who can reach a server without accounts
+// control its cameras and use its admin endpoints, e.g. on a trusted network
+// or behind an authenticating proxy. Without it, and without WithAccounts,
+// the API is read only and its admin endpoints are refused
+func WithoutAuthentication() Option {
+	return func(s *Server) {
+		s.open = true
+	}
+}
+
+// WithPprof exposes the net/http/pprof profiling handlers under
+// /debug/pprof/. Profiles can reveal internals of the process so this
+// should only be enabled on trusted networks
+func WithPprof() Option {
+	return func(s *Server) {
+		s.mux.HandleFunc("/debug/pprof/", s.adminOnly(pprof.Index))
+		s.mux.HandleFunc("/debug/pprof/cmdline", s.adminOnly(pprof.Cmdline))
+		s.mux.HandleFunc("/debug/pprof/profile", s.adminOnly(pprof.Profile))
+		s.mux.HandleFunc("/debug/pprof/symbol", s.adminOnly(pprof.Symbol))
+		s.mux.HandleFunc("/debug/pprof/trace", s.adminOnly(pprof.Trace))
+	}
+}
+
+// WithAuditLog records every control action taken through the API in the
+// given audit log, which is served under /audit
+func WithAuditLog(l *audit.Log) Option {
+	return func(s *Server) {
+		s.audit = l
+		s.mux.HandleFunc("/audit", s.adminOnly(s.handleAudit))
+	}
+}
+
+// WithEventStore enables marking the events in the given store as false
+// positives, with POST /feedback?event=<id>, tuning the cameras' sensitivity
+// from that feedback with /tune, and placing legal holds on them with /hold
+func WithEventStore(store events.Store) Option {
+	return func(s *Server) {
+		s.events = store
+	}
+}
+
+// WithMedia serves incident bundles of stored events, with WithEventStore,
+// read from the storage their media was saved to, with
+// GET /export?event=<id>, see export.Bundle
+func WithMedia(media storage.Storage) Option {
+	return func(s *Server) {
+		s.media = media
+	}
+}
+
+// WithRecordingDir reports the usage of the disk the directory clips and
+// recordings are saved to is on in /status, for a dashboard to warn before
+// it fills up
+func WithRecordingDir(dir string) Option {
+	return func(s *Server) {
+		s.recording = dir
+	}
+}
+
+// WithNotifiers adds the delivery statistics of the dispatcher's notifiers,
+// and the state of their circuit breakers, to /metrics. Stored events can be
+// delivered to them again with POST /replay?event=<id>, with WithEventStore,
+// and a test event with POST /simulate
+func WithNotifiers(d *notify.Dispatcher) Option {
+	return func(s *Server) {
+		s.notifiers = d
+	}
+}
+
+// WithDeadLetters serves the notifications the dispatcher gave up on, see
+// notify.Dispatcher.DeadLetters, under /dead-letters, to admins: GET lists
+// them and POST resends the one whose ID is in the "id" form value, or all
+// of them, through the dispatcher of WithNotifiers
+func WithDeadLetters(letters *cluster.DeadLetters) Option {
+	return func(s *Server) {
+		s.letters = letters
+		s.mux.HandleFunc("/dead-letters", s.adminOnly(s.handleDeadLetters))
+	}
+}
+
+// WithRules serves the rules engine's rules under /rules, to admins, for a
+// dashboard to show them with GET and replace them with PUT, e.g.
+// [{"name": "night door", "when": "zone == 'door' && hour >= 22", "actions": ["sms"]}]
+func WithRules(e *rules.Engine) Option {
+	return func(s *Server) {
+		s.rules = e
+		s.mux.HandleFunc("/rules", s.adminOnly(s.handleRules))
+	}
+}
+
+// WithDevices lets mobile apps register the devices push notifications are
+// sent to, see notify.Push, with POST /devices and a JSON body, e.g.
+// {"token": "...", "platform": "fcm", "name": "Ana's phone"}, and unregister
+// them with DELETE /devices?token=<token>. Admins can list them with GET
+func WithDevices(d *notify.Devices) Option {
+	return func(s *Server) {
+		s.devices = d
+		s.mux.HandleFunc("/devices", s.handleDevices)
+	}
+}
+
+// WithCamera serves an additional detector under /cameras/<name>/, e.g.
+// /cameras/garage/snapshot
+func WithCamera(name string, d *detector.Detector) Option {
+	return func(s *Server) {
+		s.cameras[name] = d
+	}
+}
+
+// NewServer is the constructor for a Server, the given detector is served
+// as the DefaultCamera
+func NewServer(d *detector.Detector, opts ...Option) *Server {
+	s := &Server{
+		cameras: map[string]*detector.Detector{DefaultCamera: d},
+		mux:     http.NewServeMux(),
+	}
+	endpoints := map[string]cameraHandler{
+		"status":      s.handleStatus,
+		"snapshot":    s.handleSnapshot,
+		"memstats":    s.handleMemStats,
+		"tracks":      s.handleTracks,
+		"stats":       s.handleStats,
+		"config":      s.handleConfig,
+		"arm":         s.handleArm,
+		"disarm":      s.handleDisarm,
+		"sensitivity": s.handleSensitivity,
+		"dry-run":     s.handleDryRun,
+		"capture":     s.handleCapture,
+		"trigger":     s.handleTrigger,
+		"sleep":       s.handleSleep,
+		"wake":        s.handleWake,
+		"command":     s.handleCommand,
+		"replay":      s.handleReplay,
+		"simulate":    s.handleSimulate,
+		"feedback":    s.handleFeedback,
+		"hold":        s.handleHold,
+		"export":      s.handleExport,
+		"tune":        s.handleTune,
+		"controls":    s.handleControls,
+	}
+	for endpoint, h := range endpoints {
+		h := h
+		s.mux.HandleFunc("/"+endpoint, func(w http.ResponseWriter, r *http.Request) {
+			s.serveCamera(w, r, DefaultCamera, h)
+		})
+	}
+	s.mux.HandleFunc("/cameras/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/cameras/"), "/")
+		if len(parts) != 2 || endpoints[parts[1]] == nil {
+			http.NotFound(w, r)
+			return
+		}
+		s.serveCamera(w, r, parts[0], endpoints[parts[1]])
+	})
+	s.mux.HandleFunc("/cameras", s.handleCameras)
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(s.accounts) > 0 {
+		acct, ok := s.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), accountKey{}, acct))
+	} else if !s.open && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "read only, the server has no accounts", http.StatusForbidden)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// serveCamera handles a request for a camera if the account making it, if
+// any, has access to the camera
+func (s *Server) serveCamera(w http.ResponseWriter, r *http.Request, name string, h cameraHandler) {
+	d, ok := s.cameras[name]
+	if acct := requestAccount(r); !ok || (acct != nil && !acct.CanAccess(name)) {
+		// cameras the account can't access are indistinguishable from
+		// cameras which don't exist
+		http.Error(w, "unknown camera", http.StatusNotFound)
+		return
+	}
+	h(w, r, camera{name: name, detector: d})
+}
+
+func (s *Server) handleCameras(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	acct := requestAccount(r)
+	names := []string{}
+	for name := range s.cameras {
+		if acct == nil || acct.CanAccess(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	writeJSON(w, names)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("could not write response: %s", err)
+	}
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := map[string]interface{}{
+		"status":      c.detector.Status(),
+		"armed":       c.detector.Armed(),
+		"sensitivity": c.detector.Sensitivity(),
+		"profile":     c.detector.Profile(),
+		"night":       c.detector.Night(),
+		"dry_run":     c.detector.DryRun(),
+		"flickering":  c.detector.Flickering(),
+		"frame":       c.detector.FrameInfo(),
+		"fps":         c.detector.FrameRate(),
+		"process":     sysinfo.ReadProcess(),
+	}
+	if s.recording != "" {
+		disk, err := sysinfo.ReadDisk(s.recording)
+		if err != nil {
+			log.Printf("could not read the disk usage of %s: %s", s.recording, err)
+		} else {
+			status["disk"] = disk
+		}
+	}
+	writeJSON(w, status)
+}
+
+// snapshotOptions parses the width, height and crop (zone name) query
+// parameters of a snapshot request
+func snapshotOptions(q url.Values) (detector.SnapshotOptions, error) {
+	opts := detector.SnapshotOptions{Zone: q.Get("crop")}
+	for _, dim := range []struct {
+		name string
+		val  *int
+	}{{"width", &opts.Width}, {"height", &opts.Height}} {
+		v := q.Get(dim.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("%s must be a positive integer", dim.name)
+		}
+		*dim.val = n
+	}
+	return opts, nil
+}
+
+// snapshotBuffers are reused across snapshot requests, which dashboards
+// polling a camera make several times a second
+var snapshotBuffers = sync.Pool{New: func() interface{} { return new([]byte) }}
+
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	opts, err := snapshotOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	buf := snapshotBuffers.Get().(*[]byte)
+	defer snapshotBuffers.Put(buf)
+	img, err := c.detector.AppendSnapshot((*buf)[:0], opts)
+	if err == nil {
+		*buf = img
+	}
+	switch {
+	case errors.Is(err, detector.ErrUnknownZone):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, detector.ErrInvalidSnapshotOptions):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "could not take snapshot", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(img)
+}
+
+func (s *Server) handleMemStats(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, c.detector.MemStats())
+}
+
+func (s *Server) handleTracks(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, c.detector.Tracks())
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, c.detector.Config())
+}
+
+// record adds a control action taken through the API to the audit log, the
+// actor is the account which took it or, without accounts, the client address
+func (s *Server) record(r *http.Request, c camera, action, detail string) {
+	if s.audit == nil {
+		return
+	}
+	err := s.audit.Record(audit.Entry{
+		Action: action,
+		Source: audit.SourceAPI,
+		Actor:  requestActor(r),
+		Camera: c.name,
+		Detail: detail,
+	})
+	if err != nil {
+		log.Printf("could not record %s in audit log: %s", action, err)
+	}
+}
+
+// requestActor identifies who made a request, the name of its account or
+// its remote address
+func requestActor(r *http.Request) string {
+	if acct := requestAccount(r); acct != nil {
+		return acct.Name
+	}
+	return r.RemoteAddr
+}
+
+func (s *Server) handleArm(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c.detector.Arm()
+	s.record(r, c, audit.ActionArm, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDisarm(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c.detector.Disarm()
+	s.record(r, c, audit.ActionDisarm, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSensitivity(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	v := r.FormValue("min_area")
+	minArea, err := strconv.ParseFloat(v, 64)
+	if err != nil || minArea <= 0 {
+		http.Error(w, "min_area must be a positive number", http.StatusBadRequest)
+		return
+	}
+	c.detector.SetSensitivity(minArea)
+	s.record(r, c, audit.ActionSetSensitivity, v)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDryRun lists the events of dry run mode, or switches it on or off
+// with e.g. POST /dry-run?enabled=true
+func (s *Server) handleDryRun(w http.ResponseWriter, r *http.Request, c camera) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, map[string]interface{}{
+			"dry_run": c.detector.DryRun(),
+			"events":  c.detector.DryRunEvents(),
+		})
+	case http.MethodPost:
+		v := r.FormValue("enabled")
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+			return
+		}
+		c.detector.SetDryRun(enabled)
+		s.record(r, c, audit.ActionSetDryRun, v)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleCapture(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reason := r.FormValue("reason")
+	if reason == "" {
+		reason = "api"
+	}
+	c.detector.CaptureEvent(reason)
+	s.record(r, c, audit.ActionCaptureEvent, reason)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTrigger is the webhook for external sensors, e.g. a PIR sensor
+// calling POST /trigger?sensor=pir, see detector.WithSensorFusion
+func (s *Server) handleTrigger(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sensor := r.FormValue("sensor")
+	if sensor == "" {
+		http.Error(w, "sensor is required", http.StatusBadRequest)
+		return
+	}
+	c.detector.Trigger(sensor)
+	s.record(r, c, audit.ActionTrigger, sensor)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSleep puts a detector with a sleep mode to sleep, see
+// detector.WithSleepMode
+func (s *Server) handleSleep(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c.detector.Sleep()
+	s.record(r, c, audit.ActionSleep, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleWake is the webhook waking a sleeping detector up, e.g. for a
+// sensor which can't report its triggers with POST /trigger
+func (s *Server) handleWake(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c.detector.Wake()
+	s.record(r, c, audit.ActionWake, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleControls returns the values of the camera's controls it supports,
+// or sets controls with e.g. PUT /controls {"auto_exposure": 1, "exposure": 150}
+func (s *Server) handleControls(w http.ResponseWriter, r *http.Request, c camera) {
+	switch r.Method {
+	case http.MethodGet:
+		controls := map[detector.CameraControl]float64{}
+		for _, control := range detector.CameraControls {
+			if v, err := c.detector.CameraControl(control); err == nil {
+				controls[control] = v
+			}
+		}
+		writeJSON(w, controls)
+	case http.MethodPut:
+		controls := map[detector.CameraControl]float64{}
+		if err := json.NewDecoder(r.Body).Decode(&controls); err != nil {
+			http.Error(w, "invalid camera controls", http.StatusBadRequest)
+			return
+		}
+		known := map[detector.CameraControl]bool{}
+		for _, control := range detector.CameraControls {
+			known[control] = true
+		}
+		for control := range controls {
+			if !known[control] {
+				http.Error(w, fmt.Sprintf("unknown camera control %q, expected %v", control, detector.CameraControls), http.StatusBadRequest)
+				return
+			}
+		}
+		// auto modes are switched off before their manual values are set
+		for _, control := range detector.CameraControls {
+			v, ok := controls[control]
+			if !ok {
+				continue
+			}
+			if err := c.detector.SetCameraControl(control, v); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.record(r, c, audit.ActionSetControl, fmt.Sprintf("%s=%g", control, v))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// commandActions are the audit log actions of commands
+var commandActions = map[string]string{
+	nodered.CommandArm:         audit.ActionArm,
+	nodered.CommandDisarm:      audit.ActionDisarm,
+	nodered.CommandSensitivity: audit.ActionSetSensitivity,
+	nodered.CommandDryRun:      audit.ActionSetDryRun,
+}
+
+// handleCommand executes a command in any form nodered.ParseCommand takes,
+// e.g. from a Node-RED http request node, and responds with its
+// acknowledgement, as the MQTT bridge does
+func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<16))
+	if err != nil {
+		http.Error(w, "could not read command", http.StatusBadRequest)
+		return
+	}
+	cmd, err := nodered.ParseCommand(body)
+	if err == nil {
+		err = cmd.Execute(c.detector)
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(nodered.AckMessage(c.name, cmd, err))
+		return
+	}
+	if action, ok := commandActions[strings.ToLower(cmd.Command)]; ok {
+		detail := ""
+		if cmd.Value != nil {
+			detail = fmt.Sprint(cmd.Value)
+		}
+		s.record(r, c, action, detail)
+	}
+	writeJSON(w, nodered.AckMessage(c.name, cmd, nil))
+}
+
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	entries, err := s.audit.Entries()
+	if err != nil {
+		log.Printf("could not read audit log: %s", err)
+		http.Error(w, "could not read audit log", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, entries)
+}
+
+func (s *Server) handleDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters, err := s.letters.List()
+	if err != nil {
+		log.Printf("could not list dead letters: %s", err)
+		http.Error(w, "could not list dead letters", http.StatusInternalServerError)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, letters)
+	case http.MethodPost:
+		if s.notifiers == nil {
+			http.Error(w, "events aren't notified", http.StatusNotFound)
+			return
+		}
+		ids := []string{}
+		if id := r.FormValue("id"); id != "" {
+			ids = append(ids, id)
+		} else {
+			for _, l := range letters {
+				if len(l.Notifiers) > 0 {
+					ids = append(ids, l.Record.ID)
+				}
+			}
+		}
+		failed := map[string]string{}
+		for _, id := range ids {
+			s.record(r, camera{}, audit.ActionResendLetter, id)
+			err := s.letters.Resend(r.Context(), id, s.notifiers)
+			if errors.Is(err, events.ErrNotFound) || errors.Is(err, events.ErrInvalidID) || errors.Is(err, cluster.ErrNotNotification) {
+				http.Error(w, fmt.Sprintf("no dead letter %q", id), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				failed[id] = err.Error()
+			}
+		}
+		writeJSON(w, map[string]interface{}{"resent": ids, "failed": failed})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.rules.Rules())
+	case http.MethodPut:
+		rs := []rules.Rule{}
+		if err := json.NewDecoder(r.Body).Decode(&rs); err != nil {
+			http.Error(w, "invalid rules", http.StatusBadRequest)
+			return
+		}
+		if err := s.rules.Set(rs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.record(r, camera{}, audit.ActionSetRules, fmt.Sprintf("%d rules", len(rs)))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.adminOnly(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, s.devices.List())
+		})(w, r)
+	case http.MethodPost:
+		dev := notify.Device{}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&dev); err != nil {
+			http.Error(w, "invalid device", http.StatusBadRequest)
+			return
+		}
+		dev.Registered = time.Time{}
+		if err := s.devices.Register(dev); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		err := s.devices.Unregister(r.FormValue("token"))
+		if errors.Is(err, events.ErrNotFound) {
+			http.Error(w, "unknown device", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("could not unregister device: %s", err)
+			http.Error(w, "could not unregister device", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// cameraRecords returns the stored records of a camera's events, records
+// without a camera are the DefaultCamera's
+func (s *Server) cameraRecords(c camera) ([]*events.Record, error) {
+	records, err := s.events.List()
+	if err != nil {
+		return nil, err
+	}
+	kept := []*events.Record{}
+	for _, r := range records {
+		if r.Camera == c.name || (r.Camera == "" && c.name == DefaultCamera) {
+			kept = append(kept, r)
+		}
+	}
+	return kept, nil
+}
+
+// handleFeedback marks an event as a false positive, or clears the mark
+// with false_positive=false
+func (s *Server) handleFeedback(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.events == nil {
+		http.Error(w, "events aren't stored", http.StatusNotFound)
+		return
+	}
+	falsePositive := true
+	if v := r.FormValue("false_positive"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "false_positive must be true or false", http.StatusBadRequest)
+			return
+		}
+		falsePositive = b
+	}
+	id := r.FormValue("event")
+	rec, err := s.events.Get(id)
+	if err == nil && rec.Camera != c.name && !(rec.Camera == "" && c.name == DefaultCamera) {
+		err = events.ErrNotFound
+	}
+	if err == nil {
+		rec, err = events.SetFalsePositive(s.events, id, falsePositive)
+	}
+	switch {
+	case errors.Is(err, events.ErrNotFound), errors.Is(err, events.ErrInvalidID):
+		http.Error(w, "unknown event", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("could not mark event %s: %s", id, err)
+		http.Error(w, "could not mark event", http.StatusInternalServerError)
+		return
+	}
+	s.record(r, c, audit.ActionFalsePositive, fmt.Sprintf("%s=%t", id, falsePositive))
+	writeJSON(w, rec)
+}
+
+// handleHold lists the held events of the camera, places a legal hold on an
+// event with POST, e.g. event=<id>&reason=<report>, or releases it with
+// DELETE, which is restricted to admins
+func (s *Server) handleHold(w http.ResponseWriter, r *http.Request, c camera) {
+	if s.events == nil {
+		http.Error(w, "events aren't stored", http.StatusNotFound)
+		return
+	}
+	var hold *events.Hold
+	switch r.Method {
+	case http.MethodGet:
+		records, err := s.cameraRecords(c)
+		if err != nil {
+			log.Printf("could not list events: %s", err)
+			http.Error(w, "could not list events", http.StatusInternalServerError)
+			return
+		}
+		held := []*events.Record{}
+		for _, rec := range records {
+			if rec.Hold != nil {
+				held = append(held, rec)
+			}
+		}
+		writeJSON(w, held)
+		return
+	case http.MethodPost:
+		hold = &events.Hold{Reason: r.FormValue("reason"), By: requestActor(r), Since: time.Now()}
+	case http.MethodDelete:
+		if acct := requestAccount(r); acct != nil && !acct.Admin {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.FormValue("event")
+	rec, err := s.events.Get(id)
+	if err == nil && rec.Camera != c.name && !(rec.Camera == "" && c.name == DefaultCamera) {
+		err = events.ErrNotFound
+	}
+	if err == nil {
+		rec, err = events.SetHold(s.events, id, hold)
+	}
+	switch {
+	case errors.Is(err, events.ErrNotFound), errors.Is(err, events.ErrInvalidID):
+		http.Error(w, "unknown event", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("could not hold event %s: %s", id, err)
+		http.Error(w, "could not hold event", http.StatusInternalServerError)
+		return
+	}
+	if hold != nil {
+		s.record(r, c, audit.ActionHold, fmt.Sprintf("%s: %s", id, hold.Reason))
+	} else {
+		s.record(r, c, audit.ActionReleaseHold, id)
+	}
+	writeJSON(w, rec)
+}
+
+// handleExport responds with the incident bundle of an event of the camera,
+// a zip archive
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.events == nil || s.media == nil {
+		http.Error(w, "events and their media aren't stored", http.StatusNotFound)
+		return
+	}
+	id := r.FormValue("event")
+	rec, err := s.events.Get(id)
+	if err == nil && rec.Camera != c.name && !(rec.Camera == "" && c.name == DefaultCamera) {
+		err = events.ErrNotFound
+	}
+	switch {
+	case errors.Is(err, events.ErrNotFound), errors.Is(err, events.ErrInvalidID):
+		http.Error(w, "unknown event", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("could not read event %s: %s", id, err)
+		http.Error(w, "could not read event", http.StatusInternalServerError)
+		return
+	}
+	// the bundle is built before responding, so that failures are reported
+	// rather than cut short
+	buf := &bytes.Buffer{}
+	if err := export.Bundle(buf, rec, s.media, time.Now()); err != nil {
+		log.Printf("could not export event %s: %s", id, err)
+		http.Error(w, "could not export event", http.StatusInternalServerError)
+		return
+	}
+	s.record(r, c, audit.ActionExportEvent, id)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "goaway-"+id+".zip"))
+	w.Write(buf.Bytes())
+}
+
+// handleReplay delivers a stored event of the camera to the notifiers again
+func (s *Server) handleReplay(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.notifiers == nil || s.events == nil {
+		http.Error(w, "events aren't stored and notified", http.StatusNotFound)
+		return
+	}
+	id := r.FormValue("event")
+	rec, err := s.events.Get(id)
+	if err == nil && rec.Camera != c.name && !(rec.Camera == "" && c.name == DefaultCamera) {
+		err = events.ErrNotFound
+	}
+	if err == nil {
+		s.record(r, c, audit.ActionReplayEvent, id)
+		err = s.notifiers.ReplayEvent(r.Context(), s.events, id)
+	}
+	s.writeNotifyResult(w, err, nil)
+}
+
+// handleSimulate delivers a fabricated event of the camera to the notifiers,
+// and responds with it
+func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.notifiers == nil {
+		http.Error(w, "events aren't notified", http.StatusNotFound)
+		return
+	}
+	s.record(r, c, audit.ActionSimulateEvent, "")
+	rec, err := s.notifiers.SimulateEvent(r.Context(), c.name)
+	s.writeNotifyResult(w, err, rec)
+}
+
+// writeNotifyResult responds with the outcome of delivering an event to the
+// notifiers, and the event if any
+func (s *Server) writeNotifyResult(w http.ResponseWriter, err error, rec *events.Record) {
+	notifyErr := &notify.Error{}
+	switch {
+	case errors.Is(err, events.ErrNotFound), errors.Is(err, events.ErrInvalidID):
+		http.Error(w, "unknown event", http.StatusNotFound)
+	case errors.As(err, &notifyErr):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	case err != nil:
+		log.Printf("could not notify event: %s", err)
+		http.Error(w, "could not notify event", http.StatusInternalServerError)
+	case rec != nil:
+		writeJSON(w, rec)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleTune returns the sensitivities suggested by the false positive
+// feedback on GET, and applies them on POST
+func (s *Server) handleTune(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.events == nil {
+		http.Error(w, "events aren't stored", http.StatusNotFound)
+		return
+	}
+	records, err := s.cameraRecords(c)
+	if err != nil {
+		log.Printf("could not list events: %s", err)
+		http.Error(w, "could not list events", http.StatusInternalServerError)
+		return
+	}
+	suggestions := tune.Suggest(c.detector, records)
+	if r.Method == http.MethodPost {
+		if err := tune.Apply(c.detector, suggestions); err != nil {
+			log.Printf("could not apply suggested sensitivities: %s", err)
+			http.Error(w, "could not apply suggested sensitivities", http.StatusInternalServerError)
+			return
+		}
+		for _, sg := range suggestions {
+			s.record(r, c, audit.ActionSetSensitivity, fmt.Sprintf("zone=%q min_area=%g", sg.Zone, sg.Suggested))
+		}
+	}
+	writeJSON(w, suggestions)
+}
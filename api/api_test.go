@@ -0,0 +1,62 @@
+//go:build purego || nogui
+// +build purego nogui
+
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/adrianosela/GoAway/api"
+	"github.com/adrianosela/GoAway/audit"
+)
+
+func TestCaptureAndTriggerAreAudited(t *testing.T) {
+	l, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := server(t, api.WithAccounts(accounts...), api.WithAuditLog(l))
+
+	requests := []struct {
+		path  string
+		token string
+		want  int
+	}{
+		{"/capture?reason=doorbell", "alice-token", http.StatusNoContent},
+		{"/cameras/storage-room/trigger?sensor=pir", "bob-token", http.StatusNoContent},
+		// neither rejected requests nor requests for cameras the account
+		// can't access are recorded
+		{"/trigger", "alice-token", http.StatusBadRequest},
+		{"/capture", "bob-token", http.StatusNotFound},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest(http.MethodPost, req.path, nil)
+		r.Header.Set("Authorization", "Bearer "+req.token)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != req.want {
+			t.Errorf("%s: got status %d, want %d", req.path, w.Code, req.want)
+		}
+	}
+
+	entries, err := l.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []audit.Entry{}
+	for _, e := range entries {
+		got = append(got, audit.Entry{Action: e.Action, Source: e.Source, Actor: e.Actor, Camera: e.Camera, Detail: e.Detail})
+	}
+	want := []audit.Entry{
+		{Action: audit.ActionCaptureEvent, Source: audit.SourceAPI, Actor: "alice", Camera: api.DefaultCamera, Detail: "doorbell"},
+		{Action: audit.ActionTrigger, Source: audit.SourceAPI, Actor: "bob", Camera: "storage-room", Detail: "pir"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got audit entries %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/notify"
+)
+
+// labelNameInvalid matches the characters Prometheus doesn't allow in label
+// names
+var labelNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// labelEscaper escapes label values for the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metric is a Prometheus metric family
+type metric struct {
+	name, help, typ string
+	samples         []sample
+}
+
+// sample is a value of a metric with its labels, in the order they are
+// written in
+type sample struct {
+	labels [][2]string
+	value  float64
+}
+
+// handleMetrics serves the stats of the cameras the account making the
+// request can access in the Prometheus text exposition format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	frames := &metric{name: "goaway_frames_total", help: "Frames processed.", typ: "counter"}
+	dropped := &metric{name: "goaway_dropped_frames_total", help: "Frames dropped because processing couldn't keep up with capture.", typ: "counter"}
+	skipped := &metric{name: "goaway_skipped_frames_total", help: "Frames skipped while the scene was quiet.", typ: "counter"}
+	latency := &metric{name: "goaway_stage_latency_seconds", help: "Latency percentiles of the stages of the frame pipeline over the latest frames.", typ: "gauge"}
+	tracks := &metric{name: "goaway_tracked_objects", help: "Objects currently tracked.", typ: "gauge"}
+	occupancy := &metric{name: "goaway_zone_occupancy", help: "Distinct objects currently in a zone.", typ: "gauge"}
+	crossings := &metric{name: "goaway_line_crossings_total", help: "Objects which crossed a counting line.", typ: "counter"}
+	info := &metric{name: "goaway_camera_info", help: "Identity of cameras, their ID, name and labels.", typ: "gauge"}
+	acct := requestAccount(r)
+	names := []string{}
+	for name := range s.cameras {
+		if acct == nil || acct.CanAccess(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		stats := s.cameras[name].Stats()
+		cam := [2]string{"camera", name}
+		if id := s.cameras[name].Identity(); id.ID != "" {
+			info.samples = append(info.samples, sample{identityLabels(cam, id), 1})
+		}
+		frames.samples = append(frames.samples, sample{[][2]string{cam}, float64(stats.Frames)})
+		dropped.samples = append(dropped.samples, sample{[][2]string{cam}, float64(stats.DroppedFrames)})
+		skipped.samples = append(skipped.samples, sample{[][2]string{cam}, float64(stats.SkippedFrames)})
+		for _, stage := range detector.Stages {
+			l, ok := stats.Latency[stage]
+			if !ok {
+				continue
+			}
+			for _, q := range []struct {
+				quantile string
+				value    time.Duration
+			}{{"0.5", l.P50}, {"0.9", l.P90}, {"0.99", l.P99}, {"1", l.Max}} {
+				latency.samples = append(latency.samples, sample{[][2]string{cam, {"stage", string(stage)}, {"quantile", q.quantile}}, q.value.Seconds()})
+			}
+		}
+		tracks.samples = append(tracks.samples, sample{[][2]string{cam}, float64(stats.Tracks)})
+		zones := []string{}
+		for zone := range stats.Occupancy {
+			zones = append(zones, zone)
+		}
+		sort.Strings(zones)
+		for _, zone := range zones {
+			occupancy.samples = append(occupancy.samples, sample{[][2]string{cam, {"zone", zone}}, float64(stats.Occupancy[zone])})
+		}
+		for _, l := range stats.Lines {
+			line := [2]string{"line", l.Line}
+			crossings.samples = append(crossings.samples,
+				sample{[][2]string{cam, line, {"direction", "in"}}, float64(l.In)},
+				sample{[][2]string{cam, line, {"direction", "out"}}, float64(l.Out)},
+			)
+		}
+	}
+	metrics := []*metric{frames, dropped, skipped, latency, tracks, occupancy, crossings, info}
+	if s.notifiers != nil && (acct == nil || acct.Admin) {
+		metrics = append(metrics, notifierMetrics(s.notifiers.Stats())...)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, smp := range m.samples {
+			fmt.Fprint(w, m.name, "{")
+			for i, l := range smp.labels {
+				if i > 0 {
+					fmt.Fprint(w, ",")
+				}
+				fmt.Fprintf(w, "%s=\"%s\"", l[0], labelEscaper.Replace(l[1]))
+			}
+			fmt.Fprintf(w, "} %v\n", smp.value)
+		}
+	}
+}
+
+// identityLabels returns the labels of a camera's info sample, its
+// identity's labels prefixed with label_ and with characters Prometheus
+// doesn't allow in label names replaced by _
+func identityLabels(cam [2]string, id detector.Identity) [][2]string {
+	labels := [][2]string{cam, {"id", id.ID}, {"name", id.Name}}
+	keys := []string{}
+	for k := range id.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		labels = append(labels, [2]string{"label_" + labelNameInvalid.ReplaceAllString(k, "_"), id.Labels[k]})
+	}
+	return labels
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request, c camera) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, c.detector.Stats())
+}
+
+// notifierMetrics returns the metrics of notifiers, their breakers' state is
+// 1 for the state they are in and 0 for the others
+func notifierMetrics(stats []notify.Stats) []*metric {
+	sent := &metric{name: "goaway_notifications_total", help: "Notifications by outcome.", typ: "counter"}
+	state := &metric{name: "goaway_notifier_breaker_state", help: "State of notifiers' circuit breakers.", typ: "gauge"}
+	for _, st := range stats {
+		n := [2]string{"notifier", st.Name}
+		for _, r := range []struct {
+			result string
+			count  int
+		}{{"sent", st.Sent}, {"failed", st.Failed}, {"rate_limited", st.RateLimited}, {"rejected", st.Rejected}} {
+			sent.samples = append(sent.samples, sample{[][2]string{n, {"result", r.result}}, float64(r.count)})
+		}
+		for _, b := range []string{notify.BreakerClosed, notify.BreakerOpen, notify.BreakerHalfOpen} {
+			v := 0.0
+			if st.Breaker == b {
+				v = 1
+			}
+			state.samples = append(state.samples, sample{[][2]string{n, {"state", b}}, v})
+		}
+	}
+	return []*metric{sent, state}
+}
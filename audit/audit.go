@@ -0,0 +1,120 @@
+// Package audit keeps an append-only log of the actions taken to control a
+// motion detector, so that it is known who disabled it and when
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Actions recorded by the packages of this module, callers are free to
+// record their own
+const (
+	ActionArm            = "arm"
+	ActionDisarm         = "disarm"
+	ActionSetSensitivity = "set_sensitivity"
+	ActionSetProfile     = "set_profile"
+	ActionFalsePositive  = "false_positive"
+	ActionSetDryRun      = "set_dry_run"
+	ActionSetRules       = "set_rules"
+	ActionReplayEvent    = "replay_event"
+	ActionSimulateEvent  = "simulate_event"
+	ActionSetControl     = "set_camera_control"
+	ActionSleep          = "sleep"
+	ActionWake           = "wake"
+	ActionHold           = "hold"
+	ActionReleaseHold    = "release_hold"
+	ActionExportEvent    = "export_event"
+	ActionResendLetter   = "resend_dead_letter"
+	ActionCaptureEvent   = "capture_event"
+	ActionTrigger        = "sensor_trigger"
+)
+
+// Sources of actions
+const (
+	SourceAPI      = "api"
+	SourceCLI      = "cli"
+	SourceSchedule = "schedule"
+)
+
+// Entry is a single action in the audit log
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Action is what was done, e.g. ActionDisarm
+	Action string `json:"action"`
+	// Source is how it was done, e.g. SourceAPI
+	Source string `json:"source"`
+	// Actor identifies who did it within the source, e.g. the API user or
+	// the remote address of the request
+	Actor string `json:"actor,omitempty"`
+	// Camera is the name of the camera the action was taken on, if any
+	Camera string `json:"camera,omitempty"`
+	// Detail holds action specific information, e.g. the new sensitivity
+	Detail string `json:"detail,omitempty"`
+}
+
+// Log is an audit log stored as a file of JSON encoded entries, one per
+// line. Entries are only ever appended to the file
+type Log struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// Open opens the audit log at the given path, creating it if necessary
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path, f: f}, nil
+}
+
+// Record appends an entry to the log, the time is set to the current time
+// if it is zero
+func (l *Log) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not write audit log entry: %w", err)
+	}
+	// entries are flushed to disk so they survive a crash or power cut
+	return l.f.Sync()
+}
+
+// Entries returns all the entries in the log, oldest first
+func (l *Log) Entries() ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries := []Entry{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		e := Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid audit log entry on line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// Close closes the log's file
+func (l *Log) Close() error {
+	return l.f.Close()
+}
@@ -0,0 +1,144 @@
+// Package classify recognizes what caused motion, e.g. a person, a car or a
+// cat, in snapshots of the motion. Classifiers are pluggable: adapters are
+// provided for cloud vision providers, for edge devices which can't run
+// neural networks locally
+package classify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"net/http"
+)
+
+// DefaultMaxLabels is the default maximum number of labels a classifier
+// returns per image
+const DefaultMaxLabels = 10
+
+// Label is something recognized in an image
+type Label struct {
+	Name string `json:"name"`
+	// Confidence is the classifier's confidence in the label, from 0 to 1
+	Confidence float64 `json:"confidence"`
+	// Bounds is where in the image the label was recognized, empty when the
+	// label applies to the image as a whole
+	Bounds image.Rectangle `json:"bounds"`
+}
+
+// Classifier recognizes what is shown in jpg encoded images
+type Classifier interface {
+	Classify(ctx context.Context, jpg []byte) ([]Label, error)
+}
+
+// Find returns the most confident label with the given name with at least
+// the given confidence, and whether there is one
+func Find(labels []Label, name string, minConfidence float64) (Label, bool) {
+	best, found := Label{}, false
+	for _, l := range labels {
+		if l.Name == name && l.Confidence >= minConfidence && (!found || l.Confidence > best.Confidence) {
+			best, found = l, true
+		}
+	}
+	return best, found
+}
+
+// Agreement returns the highest confidence among the labels with any of the
+// given names, zero if there is none, e.g. for Event.SetClassifierAgreement
+func Agreement(labels []Label, names ...string) float64 {
+	agreement := 0.0
+	for _, name := range names {
+		if l, ok := Find(labels, name, 0); ok && l.Confidence > agreement {
+			agreement = l.Confidence
+		}
+	}
+	return agreement
+}
+
+// VehicleLabels and PedestrianLabels are the labels of vehicles and
+// pedestrians of common models and providers, e.g. for
+// Event.SetClassifierClasses with Agreement
+var (
+	VehicleLabels    = []string{"car", "truck", "bus", "motorcycle", "Car", "Truck", "Bus", "Motorcycle", "Vehicle"}
+	PedestrianLabels = []string{"person", "Person", "Pedestrian"}
+)
+
+// Crop crops a jpg encoded image, e.g. a snapshot to the bounds of the
+// motion in an event, so that only the motion is classified
+func Crop(jpg []byte, r image.Rectangle) ([]byte, error) {
+	img, err := jpeg.Decode(bytes.NewReader(jpg))
+	if err != nil {
+		return nil, err
+	}
+	if r = r.Intersect(img.Bounds()); r.Empty() {
+		return nil, fmt.Errorf("crop %s is outside of the image", r)
+	}
+	cropped := image.NewRGBA(image.Rectangle{Max: r.Size()})
+	draw.Draw(cropped, cropped.Rect, img, r.Min, draw.Src)
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, cropped, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// imageSize returns the size of a jpg encoded image, to convert the relative
+// bounds returned by providers
+func imageSize(jpg []byte) (image.Point, error) {
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(jpg))
+	if err != nil {
+		return image.Point{}, err
+	}
+	return image.Pt(cfg.Width, cfg.Height), nil
+}
+
+// relativeRect returns the rectangle of an image of the given size with
+// bounds given as fractions of its width and height
+func relativeRect(size image.Point, left, top, right, bottom float64) image.Rectangle {
+	return image.Rect(
+		int(left*float64(size.X)), int(top*float64(size.Y)),
+		int(right*float64(size.X)), int(bottom*float64(size.Y)),
+	).Intersect(image.Rectangle{Max: size})
+}
+
+// client holds the settings shared by the cloud adapters
+type client struct {
+	http      *http.Client
+	endpoint  string
+	maxLabels int
+}
+
+// Option configures optional behaviour of a cloud Classifier
+type Option func(*client)
+
+// WithHTTPClient sets the client used to call the provider's API
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *client) {
+		cl.http = c
+	}
+}
+
+// WithEndpoint overrides the URL of the provider's API, e.g. for a VPC
+// endpoint or a proxy
+func WithEndpoint(url string) Option {
+	return func(cl *client) {
+		cl.endpoint = url
+	}
+}
+
+// WithMaxLabels sets the maximum number of labels returned per image
+func WithMaxLabels(n int) Option {
+	return func(cl *client) {
+		cl.maxLabels = n
+	}
+}
+
+func newClient(endpoint string, opts []Option) client {
+	c := client{http: http.DefaultClient, endpoint: endpoint, maxLabels: DefaultMaxLabels}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
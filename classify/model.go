@@ -0,0 +1,278 @@
+package classify
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultModelMinConfidence is the default minimum confidence of the labels
+// returned by local models
+const DefaultModelMinConfidence = 0.5
+
+// errClosed is returned when classifying with a model which was closed
+var errClosed = errors.New("model is closed")
+
+// modelConfig holds the settings shared by the local model adapters
+type modelConfig struct {
+	labels        []string
+	minConfidence float64
+	maxLabels     int
+	threads       int
+	mean, std     float32
+	edgeTPU       bool
+}
+
+// ModelOption configures optional behaviour of a local model Classifier
+type ModelOption func(*modelConfig)
+
+// WithLabels sets the names of the model's classes, indexed by class id,
+// see LoadLabels. Without them labels are named after the class ids
+func WithLabels(labels []string) ModelOption {
+	return func(c *modelConfig) {
+		c.labels = labels
+	}
+}
+
+// WithMinConfidence sets the minimum confidence of the labels returned
+func WithMinConfidence(confidence float64) ModelOption {
+	return func(c *modelConfig) {
+		c.minConfidence = confidence
+	}
+}
+
+// WithModelMaxLabels sets the maximum number of labels returned per image
+func WithModelMaxLabels(n int) ModelOption {
+	return func(c *modelConfig) {
+		c.maxLabels = n
+	}
+}
+
+// WithThreads sets the number of CPU threads inference runs on, zero leaves
+// it to the runtime
+func WithThreads(n int) ModelOption {
+	return func(c *modelConfig) {
+		c.threads = n
+	}
+}
+
+// WithNormalization sets how pixels are normalized for models with float
+// inputs, each channel value v becomes (v - mean) / std. The default maps
+// them to [-1, 1], as most MobileNet based models expect
+func WithNormalization(mean, std float32) ModelOption {
+	return func(c *modelConfig) {
+		c.mean, c.std = mean, std
+	}
+}
+
+// WithEdgeTPU runs TensorFlow Lite models compiled for the Edge TPU on a
+// Coral accelerator. It requires building with the "edgetpu" tag, along with
+// the "tflite" tag, and libedgetpu
+func WithEdgeTPU() ModelOption {
+	return func(c *modelConfig) {
+		c.edgeTPU = true
+	}
+}
+
+func newModelConfig(opts []ModelOption) modelConfig {
+	c := modelConfig{
+		minConfidence: DefaultModelMinConfidence,
+		maxLabels:     DefaultMaxLabels,
+		mean:          127.5,
+		std:           127.5,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// LoadLabels reads the names of a model's classes from a text file with one
+// class per line, either as the class name alone, the class id being the
+// line number from zero, or as the class id followed by the name, as in the
+// label files shipped with Coral models
+func LoadLabels(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	labels := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 0; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		id, name := line, text
+		if fields := strings.SplitN(text, " ", 2); len(fields) == 2 {
+			if n, err := strconv.Atoi(fields[0]); err == nil {
+				id, name = n, strings.TrimSpace(fields[1])
+			}
+		}
+		if id < 0 {
+			return nil, fmt.Errorf("invalid class id %d on line %d of %s", id, line+1, path)
+		}
+		for len(labels) <= id {
+			labels = append(labels, "")
+		}
+		labels[id] = name
+	}
+	return labels, scanner.Err()
+}
+
+// labelName returns the name of a class
+func (c *modelConfig) labelName(class int) string {
+	if class >= 0 && class < len(c.labels) && c.labels[class] != "" {
+		return c.labels[class]
+	}
+	return fmt.Sprintf("class %d", class)
+}
+
+// inputPixels decodes a jpg encoded image and scales it to the given size,
+// returning its RGB values in row order along with its original size
+func inputPixels(jpg []byte, width, height int) ([]uint8, image.Point, error) {
+	img, err := jpeg.Decode(bytes.NewReader(jpg))
+	if err != nil {
+		return nil, image.Point{}, err
+	}
+	b := img.Bounds()
+	pix := make([]uint8, 0, 3*width*height)
+	for y := 0; y < height; y++ {
+		sy := b.Min.Y + (2*y+1)*b.Dy()/(2*height)
+		for x := 0; x < width; x++ {
+			sx := b.Min.X + (2*x+1)*b.Dx()/(2*width)
+			r, g, bl, _ := img.At(sx, sy).RGBA()
+			pix = append(pix, uint8(r>>8), uint8(g>>8), uint8(bl>>8))
+		}
+	}
+	return pix, b.Size(), nil
+}
+
+// normalized returns the pixels normalized for a float input, in channel
+// planes rather than interleaved when planar is set
+func (c *modelConfig) normalized(pix []uint8, planar bool) []float32 {
+	out := make([]float32, len(pix))
+	n := len(pix) / 3
+	for i, v := range pix {
+		j := i
+		if planar {
+			j = (i%3)*n + i/3
+		}
+		out[j] = (float32(v) - c.mean) / c.std
+	}
+	return out
+}
+
+// planarPixels returns the pixels in channel planes rather than interleaved
+func planarPixels(pix []uint8) []uint8 {
+	out := make([]uint8, len(pix))
+	n := len(pix) / 3
+	for i, v := range pix {
+		out[(i%3)*n+i/3] = v
+	}
+	return out
+}
+
+// tensor is a model output, converted to floats
+type tensor struct {
+	name  string
+	shape []int
+	data  []float32
+}
+
+// interpret interprets the outputs of a model. Detection models have four
+// outputs, the boxes, classes, scores and number of detections, either
+// named after them or in that order, as TensorFlow Lite's detection post
+// processing outputs them. Classification models have a single output with
+// a score per class
+func (c *modelConfig) interpret(outputs []tensor, size image.Point) ([]Label, error) {
+	switch len(outputs) {
+	case 1:
+		return c.classificationLabels(outputs[0]), nil
+	case 4:
+		return c.detectionLabels(outputs, size)
+	}
+	return nil, fmt.Errorf("unsupported model with %d outputs, expected a detection or classification model", len(outputs))
+}
+
+func (c *modelConfig) classificationLabels(scores tensor) []Label {
+	probs := scores.data
+	// logits rather than probabilities
+	for _, p := range probs {
+		if p < 0 || p > 1 {
+			probs = softmax(probs)
+			break
+		}
+	}
+	labels := []Label{}
+	for class, p := range probs {
+		if float64(p) >= c.minConfidence {
+			labels = append(labels, Label{Name: c.labelName(class), Confidence: float64(p)})
+		}
+	}
+	sort.SliceStable(labels, func(i, j int) bool { return labels[i].Confidence > labels[j].Confidence })
+	if len(labels) > c.maxLabels {
+		labels = labels[:c.maxLabels]
+	}
+	return labels
+}
+
+func softmax(logits []float32) []float32 {
+	max := float32(math.Inf(-1))
+	for _, l := range logits {
+		if l > max {
+			max = l
+		}
+	}
+	sum := 0.0
+	out := make([]float32, len(logits))
+	for i, l := range logits {
+		e := math.Exp(float64(l - max))
+		out[i], sum = float32(e), sum+e
+	}
+	for i := range out {
+		out[i] /= float32(sum)
+	}
+	return out
+}
+
+func (c *modelConfig) detectionLabels(outputs []tensor, size image.Point) ([]Label, error) {
+	boxes, classes, scores, count := outputs[0], outputs[1], outputs[2], outputs[3]
+	named := map[string]*tensor{}
+	for i := range outputs {
+		for _, kind := range []string{"boxes", "classes", "scores", "num"} {
+			if strings.Contains(strings.ToLower(outputs[i].name), kind) {
+				named[kind] = &outputs[i]
+			}
+		}
+	}
+	if len(named) == 4 {
+		boxes, classes, scores, count = *named["boxes"], *named["classes"], *named["scores"], *named["num"]
+	}
+	n := len(scores.data)
+	if len(count.data) == 1 && int(count.data[0]) < n {
+		n = int(count.data[0])
+	}
+	if len(classes.data) < n || len(boxes.data) < 4*n {
+		return nil, fmt.Errorf("unexpected detection outputs with shapes %v, %v, %v and %v", boxes.shape, classes.shape, scores.shape, count.shape)
+	}
+	labels := []Label{}
+	for i := 0; i < n && len(labels) < c.maxLabels; i++ {
+		if float64(scores.data[i]) < c.minConfidence {
+			continue
+		}
+		// boxes are ymin, xmin, ymax, xmax relative to the image size
+		b := boxes.data[4*i : 4*i+4]
+		labels = append(labels, Label{
+			Name:       c.labelName(int(classes.data[i])),
+			Confidence: float64(scores.data[i]),
+			Bounds:     relativeRect(size, float64(b[1]), float64(b[0]), float64(b[3]), float64(b[2])),
+		})
+	}
+	return labels, nil
+}
@@ -0,0 +1,350 @@
+//go:build onnx
+// +build onnx
+
+package classify
+
+/*
+#cgo LDFLAGS: -lonnxruntime
+#include <stdlib.h>
+#include <string.h>
+#include <onnxruntime_c_api.h>
+
+// the API is a table of function pointers, which Go can't call directly
+
+static const OrtApi* ort;
+
+static int ortInit() {
+	const OrtApiBase* base = OrtGetApiBase();
+	ort = base == NULL ? NULL : base->GetApi(ORT_API_VERSION);
+	return ort != NULL;
+}
+
+static const char* ortMessage(OrtStatus* s) { return ort->GetErrorMessage(s); }
+static void ortReleaseStatus(OrtStatus* s) { ort->ReleaseStatus(s); }
+static void ortReleaseEnv(OrtEnv* e) { ort->ReleaseEnv(e); }
+static void ortReleaseSessionOptions(OrtSessionOptions* o) { ort->ReleaseSessionOptions(o); }
+static void ortReleaseSession(OrtSession* s) { ort->ReleaseSession(s); }
+static void ortReleaseValue(OrtValue* v) { ort->ReleaseValue(v); }
+
+static OrtStatus* ortCreateEnv(OrtEnv** env) {
+	return ort->CreateEnv(ORT_LOGGING_LEVEL_WARNING, "goaway", env);
+}
+
+static OrtStatus* ortCreateSessionOptions(int threads, OrtSessionOptions** options) {
+	OrtStatus* s = ort->CreateSessionOptions(options);
+	if (s == NULL && threads > 0) {
+		s = ort->SetIntraOpNumThreads(*options, threads);
+	}
+	return s;
+}
+
+static OrtStatus* ortCreateSession(OrtEnv* env, const char* path, OrtSessionOptions* options, OrtSession** session) {
+	return ort->CreateSession(env, path, options, session);
+}
+
+static OrtStatus* ortCount(OrtSession* session, int output, size_t* n) {
+	return output ? ort->SessionGetOutputCount(session, n) : ort->SessionGetInputCount(session, n);
+}
+
+// ortName returns the name of an input or output, which must be freed
+static OrtStatus* ortName(OrtSession* session, int output, size_t i, char** name) {
+	OrtAllocator* allocator;
+	OrtStatus* s = ort->GetAllocatorWithDefaultOptions(&allocator);
+	if (s != NULL) {
+		return s;
+	}
+	char* n;
+	s = output ? ort->SessionGetOutputName(session, i, allocator, &n) : ort->SessionGetInputName(session, i, allocator, &n);
+	if (s != NULL) {
+		return s;
+	}
+	*name = strdup(n);
+	return ort->AllocatorFree(allocator, n);
+}
+
+static OrtStatus* ortShape(const OrtTensorTypeAndShapeInfo* info, ONNXTensorElementDataType* type, int64_t* dims, size_t* n) {
+	OrtStatus* s = ort->GetTensorElementType(info, type);
+	if (s == NULL) {
+		s = ort->GetDimensionsCount(info, n);
+	}
+	if (s == NULL && *n > 8) {
+		return ort->CreateStatus(ORT_INVALID_ARGUMENT, "tensor has more than 8 dimensions");
+	}
+	if (s == NULL) {
+		s = ort->GetDimensions(info, dims, *n);
+	}
+	return s;
+}
+
+// ortInputShape returns the type and shape of the first input, dims must
+// hold 8 dimensions
+static OrtStatus* ortInputShape(OrtSession* session, ONNXTensorElementDataType* type, int64_t* dims, size_t* n) {
+	OrtTypeInfo* info;
+	OrtStatus* s = ort->SessionGetInputTypeInfo(session, 0, &info);
+	if (s != NULL) {
+		return s;
+	}
+	const OrtTensorTypeAndShapeInfo* tensor;
+	s = ort->CastTypeInfoToTensorInfo(info, &tensor);
+	if (s == NULL) {
+		s = ortShape(tensor, type, dims, n);
+	}
+	ort->ReleaseTypeInfo(info);
+	return s;
+}
+
+static OrtStatus* ortRun(OrtSession* session, const char* input, void* data, size_t size, int64_t* dims, size_t n, ONNXTensorElementDataType type, const char** outputNames, size_t outputs, OrtValue** values) {
+	OrtMemoryInfo* memory;
+	OrtStatus* s = ort->CreateCpuMemoryInfo(OrtArenaAllocator, OrtMemTypeDefault, &memory);
+	if (s != NULL) {
+		return s;
+	}
+	OrtValue* value = NULL;
+	s = ort->CreateTensorWithDataAsOrtValue(memory, data, size, dims, n, type, &value);
+	ort->ReleaseMemoryInfo(memory);
+	if (s != NULL) {
+		return s;
+	}
+	const OrtValue* inputs[1] = {value};
+	s = ort->Run(session, NULL, &input, inputs, 1, outputNames, outputs, values);
+	ort->ReleaseValue(value);
+	return s;
+}
+
+// ortOutput returns the type, shape, number of elements and data of an
+// output, dims must hold 8 dimensions
+static OrtStatus* ortOutput(OrtValue* value, ONNXTensorElementDataType* type, int64_t* dims, size_t* n, size_t* count, void** data) {
+	OrtTensorTypeAndShapeInfo* info;
+	OrtStatus* s = ort->GetTensorTypeAndShape(value, &info);
+	if (s != NULL) {
+		return s;
+	}
+	s = ortShape(info, type, dims, n);
+	if (s == NULL) {
+		s = ort->GetTensorShapeElementCount(info, count);
+	}
+	ort->ReleaseTensorTypeAndShapeInfo(info);
+	if (s == NULL) {
+		s = ort->GetTensorMutableData(value, data);
+	}
+	return s;
+}
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// maxArray is the length of the arrays C buffers are viewed as
+const maxArray = 1 << 28
+
+// ONNX classifies images locally with an ONNX model on ONNX Runtime. It
+// requires building with the "onnx" tag and the ONNX Runtime C library.
+// Models must take a single RGB image input, either NCHW or NHWC, and be
+// either detection or classification models
+type ONNX struct {
+	mu            sync.Mutex
+	cfg           modelConfig
+	env           *C.OrtEnv
+	options       *C.OrtSessionOptions
+	session       *C.OrtSession
+	input         *C.char
+	outputs       []*C.char
+	inputType     C.ONNXTensorElementDataType
+	shape         []C.int64_t
+	planar        bool
+	width, height int
+}
+
+// ortError converts a status to an error, releasing it
+func ortError(s *C.OrtStatus) error {
+	if s == nil {
+		return nil
+	}
+	defer C.ortReleaseStatus(s)
+	return errors.New(C.GoString(C.ortMessage(s)))
+}
+
+// NewONNX is the constructor for an ONNX classifier running the model at the
+// given path
+func NewONNX(modelPath string, opts ...ModelOption) (*ONNX, error) {
+	if C.ortInit() == 0 {
+		return nil, errors.New("unsupported ONNX Runtime version")
+	}
+	o := &ONNX{cfg: newModelConfig(opts)}
+	if err := o.load(modelPath); err != nil {
+		o.Close()
+		return nil, fmt.Errorf("could not load model %s: %s", modelPath, err)
+	}
+	return o, nil
+}
+
+func (o *ONNX) load(modelPath string) error {
+	if err := ortError(C.ortCreateEnv(&o.env)); err != nil {
+		return err
+	}
+	if err := ortError(C.ortCreateSessionOptions(C.int(o.cfg.threads), &o.options)); err != nil {
+		return err
+	}
+	path := C.CString(modelPath)
+	defer C.free(unsafe.Pointer(path))
+	if err := ortError(C.ortCreateSession(o.env, path, o.options, &o.session)); err != nil {
+		return err
+	}
+	if err := ortError(C.ortName(o.session, 0, 0, &o.input)); err != nil {
+		return err
+	}
+	var n C.size_t
+	if err := ortError(C.ortCount(o.session, 1, &n)); err != nil {
+		return err
+	}
+	o.outputs = make([]*C.char, int(n))
+	for i := range o.outputs {
+		if err := ortError(C.ortName(o.session, 1, C.size_t(i), &o.outputs[i])); err != nil {
+			return err
+		}
+	}
+	dims := make([]C.int64_t, 8)
+	if err := ortError(C.ortInputShape(o.session, &o.inputType, &dims[0], &n)); err != nil {
+		return err
+	}
+	o.shape = dims[:n]
+	if len(o.shape) != 4 {
+		return errors.New("model doesn't take an RGB image input")
+	}
+	// a dynamic batch size
+	o.shape[0] = 1
+	switch {
+	case o.shape[1] == 3:
+		o.planar, o.height, o.width = true, int(o.shape[2]), int(o.shape[3])
+	case o.shape[3] == 3:
+		o.height, o.width = int(o.shape[1]), int(o.shape[2])
+	default:
+		return errors.New("model doesn't take an RGB image input")
+	}
+	if o.width <= 0 || o.height <= 0 {
+		return errors.New("models with a dynamic image size aren't supported")
+	}
+	return nil
+}
+
+// Classify implements Classifier, inference runs on one image at a time
+func (o *ONNX) Classify(ctx context.Context, jpg []byte) ([]Label, error) {
+	pix, size, err := inputPixels(jpg, o.width, o.height)
+	if err != nil {
+		return nil, err
+	}
+	var data unsafe.Pointer
+	var bytes int
+	switch o.inputType {
+	case C.ONNX_TENSOR_ELEMENT_DATA_TYPE_UINT8:
+		if o.planar {
+			pix = planarPixels(pix)
+		}
+		data, bytes = unsafe.Pointer(&pix[0]), len(pix)
+	case C.ONNX_TENSOR_ELEMENT_DATA_TYPE_FLOAT:
+		floats := o.cfg.normalized(pix, o.planar)
+		data, bytes = unsafe.Pointer(&floats[0]), 4*len(floats)
+	default:
+		return nil, fmt.Errorf("unsupported input type %d", o.inputType)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.session == nil {
+		return nil, errClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	values := make([]*C.OrtValue, len(o.outputs))
+	err = ortError(C.ortRun(
+		o.session, o.input, data, C.size_t(bytes), &o.shape[0], C.size_t(len(o.shape)), o.inputType,
+		&o.outputs[0], C.size_t(len(o.outputs)), &values[0],
+	))
+	defer func() {
+		for _, v := range values {
+			if v != nil {
+				C.ortReleaseValue(v)
+			}
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]tensor, len(values))
+	for i, v := range values {
+		if outputs[i], err = onnxTensor(v, C.GoString(o.outputs[i])); err != nil {
+			return nil, err
+		}
+	}
+	return o.cfg.interpret(outputs, size)
+}
+
+// onnxTensor copies an output value
+func onnxTensor(v *C.OrtValue, name string) (tensor, error) {
+	out := tensor{name: name}
+	var typ C.ONNXTensorElementDataType
+	dims := make([]C.int64_t, 8)
+	var n, count C.size_t
+	var data unsafe.Pointer
+	if err := ortError(C.ortOutput(v, &typ, &dims[0], &n, &count, &data)); err != nil {
+		return out, fmt.Errorf("could not read output %s: %s", name, err)
+	}
+	for _, d := range dims[:n] {
+		out.shape = append(out.shape, int(d))
+	}
+	out.data = make([]float32, int(count))
+	if count == 0 {
+		return out, nil
+	}
+	switch typ {
+	case C.ONNX_TENSOR_ELEMENT_DATA_TYPE_FLOAT:
+		for i, x := range (*[maxArray]C.float)(data)[:count:count] {
+			out.data[i] = float32(x)
+		}
+	case C.ONNX_TENSOR_ELEMENT_DATA_TYPE_DOUBLE:
+		for i, x := range (*[maxArray]C.double)(data)[:count:count] {
+			out.data[i] = float32(x)
+		}
+	case C.ONNX_TENSOR_ELEMENT_DATA_TYPE_INT32:
+		for i, x := range (*[maxArray]C.int32_t)(data)[:count:count] {
+			out.data[i] = float32(x)
+		}
+	case C.ONNX_TENSOR_ELEMENT_DATA_TYPE_INT64:
+		for i, x := range (*[maxArray]C.int64_t)(data)[:count:count] {
+			out.data[i] = float32(x)
+		}
+	default:
+		return out, fmt.Errorf("unsupported type of output %s", name)
+	}
+	return out, nil
+}
+
+// Close releases the model, it can't be used afterwards
+func (o *ONNX) Close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.session != nil {
+		C.ortReleaseSession(o.session)
+		o.session = nil
+	}
+	if o.options != nil {
+		C.ortReleaseSessionOptions(o.options)
+		o.options = nil
+	}
+	if o.env != nil {
+		C.ortReleaseEnv(o.env)
+		o.env = nil
+	}
+	C.free(unsafe.Pointer(o.input))
+	o.input = nil
+	for _, name := range o.outputs {
+		C.free(unsafe.Pointer(name))
+	}
+	o.outputs = nil
+}
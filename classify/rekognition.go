@@ -0,0 +1,179 @@
+package classify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSCredentials are the credentials used to sign requests to AWS
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only set for temporary credentials
+	SessionToken string
+}
+
+// Rekognition classifies images with AWS Rekognition's DetectLabels
+type Rekognition struct {
+	client
+	region string
+	creds  AWSCredentials
+}
+
+// NewRekognition is the constructor for a Rekognition classifier in the
+// given AWS region, e.g. "us-west-2"
+func NewRekognition(region string, creds AWSCredentials, opts ...Option) *Rekognition {
+	return &Rekognition{
+		client: newClient(fmt.Sprintf("https://rekognition.%s.amazonaws.com/", region), opts),
+		region: region,
+		creds:  creds,
+	}
+}
+
+type rekognitionBox struct {
+	Width  float64
+	Height float64
+	Left   float64
+	Top    float64
+}
+
+type rekognitionResponse struct {
+	Labels []struct {
+		Name       string
+		Confidence float64
+		Instances  []struct {
+			BoundingBox rekognitionBox
+			Confidence  float64
+		}
+	}
+}
+
+// Classify implements Classifier
+func (r *Rekognition) Classify(ctx context.Context, jpg []byte) ([]Label, error) {
+	size, err := imageSize(jpg)
+	if err != nil {
+		return nil, err
+	}
+	// []byte is encoded as base64, as the API expects
+	body, err := json.Marshal(map[string]interface{}{
+		"Image":     map[string][]byte{"Bytes": jpg},
+		"MaxLabels": r.maxLabels,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "RekognitionService.DetectLabels")
+	signV4(req, body, "rekognition", r.region, r.creds, time.Now())
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rekognition: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	parsed := rekognitionResponse{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("rekognition: invalid response: %s", err)
+	}
+	labels := []Label{}
+	for _, l := range parsed.Labels {
+		if len(l.Instances) == 0 {
+			labels = append(labels, Label{Name: l.Name, Confidence: l.Confidence / 100})
+		}
+		for _, in := range l.Instances {
+			b := in.BoundingBox
+			labels = append(labels, Label{
+				Name:       l.Name,
+				Confidence: in.Confidence / 100,
+				Bounds:     relativeRect(size, b.Left, b.Top, b.Left+b.Width, b.Top+b.Height),
+			})
+		}
+	}
+	return labels, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// signV4 signs a request to an AWS service with Signature Version 4, see
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html. All the
+// request's headers are signed
+func signV4(req *http.Request, body []byte, service, region string, creds AWSCredentials, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders,
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
@@ -0,0 +1,195 @@
+//go:build tflite
+// +build tflite
+
+package classify
+
+/*
+#cgo LDFLAGS: -ltensorflowlite_c
+#include <stdlib.h>
+#include <tensorflow/lite/c/c_api.h>
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// TFLite classifies images locally with a TensorFlow Lite model, optionally
+// on a Coral Edge TPU (see WithEdgeTPU). It requires building with the
+// "tflite" tag and the TensorFlow Lite C library. Models must take a single
+// RGB image input and be either detection or classification models
+type TFLite struct {
+	mu            sync.Mutex
+	cfg           modelConfig
+	model         *C.TfLiteModel
+	options       *C.TfLiteInterpreterOptions
+	interpreter   *C.TfLiteInterpreter
+	freeDelegate  func()
+	width, height int
+	inputType     C.TfLiteType
+}
+
+// NewTFLite is the constructor for a TFLite classifier running the model at
+// the given path
+func NewTFLite(modelPath string, opts ...ModelOption) (*TFLite, error) {
+	t := &TFLite{cfg: newModelConfig(opts)}
+	path := C.CString(modelPath)
+	defer C.free(unsafe.Pointer(path))
+	if t.model = C.TfLiteModelCreateFromFile(path); t.model == nil {
+		return nil, fmt.Errorf("could not load model %s", modelPath)
+	}
+	t.options = C.TfLiteInterpreterOptionsCreate()
+	if t.cfg.threads > 0 {
+		C.TfLiteInterpreterOptionsSetNumThreads(t.options, C.int32_t(t.cfg.threads))
+	}
+	if t.cfg.edgeTPU {
+		delegate, free, err := edgeTPUDelegate()
+		if err != nil {
+			t.Close()
+			return nil, err
+		}
+		t.freeDelegate = free
+		C.TfLiteInterpreterOptionsAddDelegate(t.options, delegate)
+	}
+	if t.interpreter = C.TfLiteInterpreterCreate(t.model, t.options); t.interpreter == nil {
+		t.Close()
+		return nil, fmt.Errorf("could not create interpreter for model %s", modelPath)
+	}
+	if C.TfLiteInterpreterAllocateTensors(t.interpreter) != C.kTfLiteOk {
+		t.Close()
+		return nil, fmt.Errorf("could not allocate tensors for model %s", modelPath)
+	}
+	input := C.TfLiteInterpreterGetInputTensor(t.interpreter, 0)
+	if C.TfLiteTensorNumDims(input) != 4 || C.TfLiteTensorDim(input, 3) != 3 {
+		t.Close()
+		return nil, fmt.Errorf("model %s doesn't take an RGB image input", modelPath)
+	}
+	t.height, t.width = int(C.TfLiteTensorDim(input, 1)), int(C.TfLiteTensorDim(input, 2))
+	t.inputType = C.TfLiteTensorType(input)
+	return t, nil
+}
+
+// Classify implements Classifier, inference runs on one image at a time
+func (t *TFLite) Classify(ctx context.Context, jpg []byte) ([]Label, error) {
+	pix, size, err := inputPixels(jpg, t.width, t.height)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.interpreter == nil {
+		return nil, errClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	input := C.TfLiteInterpreterGetInputTensor(t.interpreter, 0)
+	var status C.TfLiteStatus
+	switch t.inputType {
+	case C.kTfLiteUInt8:
+		status = C.TfLiteTensorCopyFromBuffer(input, unsafe.Pointer(&pix[0]), C.size_t(len(pix)))
+	case C.kTfLiteInt8:
+		signed := make([]int8, len(pix))
+		for i, v := range pix {
+			signed[i] = int8(int(v) - 128)
+		}
+		status = C.TfLiteTensorCopyFromBuffer(input, unsafe.Pointer(&signed[0]), C.size_t(len(signed)))
+	case C.kTfLiteFloat32:
+		floats := t.cfg.normalized(pix, false)
+		status = C.TfLiteTensorCopyFromBuffer(input, unsafe.Pointer(&floats[0]), C.size_t(4*len(floats)))
+	default:
+		return nil, fmt.Errorf("unsupported input type %d", t.inputType)
+	}
+	if status != C.kTfLiteOk {
+		return nil, errors.New("could not set the model's input")
+	}
+	if C.TfLiteInterpreterInvoke(t.interpreter) != C.kTfLiteOk {
+		return nil, errors.New("could not run the model")
+	}
+	outputs := make([]tensor, int(C.TfLiteInterpreterGetOutputTensorCount(t.interpreter)))
+	for i := range outputs {
+		if outputs[i], err = tfliteTensor(C.TfLiteInterpreterGetOutputTensor(t.interpreter, C.int32_t(i))); err != nil {
+			return nil, err
+		}
+	}
+	return t.cfg.interpret(outputs, size)
+}
+
+// tfliteTensor copies an output tensor, dequantizing it
+func tfliteTensor(t *C.TfLiteTensor) (tensor, error) {
+	out := tensor{name: C.GoString(C.TfLiteTensorName(t))}
+	n := 1
+	for i := 0; i < int(C.TfLiteTensorNumDims(t)); i++ {
+		out.shape = append(out.shape, int(C.TfLiteTensorDim(t, C.int32_t(i))))
+		n *= out.shape[i]
+	}
+	out.data = make([]float32, n)
+	if n == 0 {
+		return out, nil
+	}
+	size := C.TfLiteTensorByteSize(t)
+	q := C.TfLiteTensorQuantizationParams(t)
+	scale, zero := float32(q.scale), float32(q.zero_point)
+	var status C.TfLiteStatus
+	switch C.TfLiteTensorType(t) {
+	case C.kTfLiteFloat32:
+		status = C.TfLiteTensorCopyToBuffer(t, unsafe.Pointer(&out.data[0]), size)
+	case C.kTfLiteUInt8:
+		buf := make([]uint8, n)
+		status = C.TfLiteTensorCopyToBuffer(t, unsafe.Pointer(&buf[0]), size)
+		for i, v := range buf {
+			out.data[i] = scale * (float32(v) - zero)
+		}
+	case C.kTfLiteInt8:
+		buf := make([]int8, n)
+		status = C.TfLiteTensorCopyToBuffer(t, unsafe.Pointer(&buf[0]), size)
+		for i, v := range buf {
+			out.data[i] = scale * (float32(v) - zero)
+		}
+	case C.kTfLiteInt32:
+		buf := make([]int32, n)
+		status = C.TfLiteTensorCopyToBuffer(t, unsafe.Pointer(&buf[0]), size)
+		for i, v := range buf {
+			out.data[i] = float32(v)
+		}
+	case C.kTfLiteInt64:
+		buf := make([]int64, n)
+		status = C.TfLiteTensorCopyToBuffer(t, unsafe.Pointer(&buf[0]), size)
+		for i, v := range buf {
+			out.data[i] = float32(v)
+		}
+	default:
+		return out, fmt.Errorf("unsupported type of output %s", out.name)
+	}
+	if status != C.kTfLiteOk {
+		return out, fmt.Errorf("could not read output %s", out.name)
+	}
+	return out, nil
+}
+
+// Close releases the model, it can't be used afterwards
+func (t *TFLite) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.interpreter != nil {
+		C.TfLiteInterpreterDelete(t.interpreter)
+		t.interpreter = nil
+	}
+	if t.options != nil {
+		C.TfLiteInterpreterOptionsDelete(t.options)
+		t.options = nil
+	}
+	if t.model != nil {
+		C.TfLiteModelDelete(t.model)
+		t.model = nil
+	}
+	// the delegate must outlive the interpreter
+	if t.freeDelegate != nil {
+		t.freeDelegate()
+		t.freeDelegate = nil
+	}
+}
@@ -0,0 +1,18 @@
+//go:build tflite && !edgetpu
+// +build tflite,!edgetpu
+
+package classify
+
+/*
+#include <tensorflow/lite/c/c_api.h>
+*/
+import "C"
+
+import (
+	"errors"
+)
+
+// edgeTPUDelegate fails, as Edge TPU support requires the "edgetpu" tag
+func edgeTPUDelegate() (*C.TfLiteDelegate, func(), error) {
+	return nil, nil, errors.New("built without Edge TPU support, build with the edgetpu tag")
+}
@@ -0,0 +1,31 @@
+//go:build tflite && edgetpu
+// +build tflite,edgetpu
+
+package classify
+
+/*
+#cgo LDFLAGS: -ledgetpu
+#include <tensorflow/lite/c/c_api.h>
+#include <edgetpu_c.h>
+*/
+import "C"
+
+import (
+	"errors"
+)
+
+// edgeTPUDelegate returns a delegate running models on the first Edge TPU
+// found, along with the function releasing it
+func edgeTPUDelegate() (*C.TfLiteDelegate, func(), error) {
+	var n C.size_t
+	devices := C.edgetpu_list_devices(&n)
+	if devices == nil || n == 0 {
+		return nil, nil, errors.New("no Edge TPU found")
+	}
+	defer C.edgetpu_free_devices(devices)
+	delegate := C.edgetpu_create_delegate(devices._type, devices.path, nil, 0)
+	if delegate == nil {
+		return nil, nil, errors.New("could not create Edge TPU delegate")
+	}
+	return delegate, func() { C.edgetpu_free_delegate(delegate) }, nil
+}
@@ -0,0 +1,136 @@
+package classify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GoogleVision classifies images with Google Cloud Vision's label detection
+// and object localization
+type GoogleVision struct {
+	client
+	apiKey string
+}
+
+// NewGoogleVision is the constructor for a GoogleVision classifier which
+// authenticates with the given API key
+func NewGoogleVision(apiKey string, opts ...Option) *GoogleVision {
+	return &GoogleVision{
+		client: newClient("https://vision.googleapis.com/v1/images:annotate", opts),
+		apiKey: apiKey,
+	}
+}
+
+type visionFeature struct {
+	Type       string `json:"type"`
+	MaxResults int    `json:"maxResults"`
+}
+
+type visionImage struct {
+	Content []byte `json:"content"`
+}
+
+type visionImageRequest struct {
+	Image    visionImage     `json:"image"`
+	Features []visionFeature `json:"features"`
+}
+
+type visionRequest struct {
+	Requests []visionImageRequest `json:"requests"`
+}
+
+type visionResponse struct {
+	Responses []struct {
+		LabelAnnotations []struct {
+			Description string  `json:"description"`
+			Score       float64 `json:"score"`
+		} `json:"labelAnnotations"`
+		LocalizedObjectAnnotations []struct {
+			Name         string  `json:"name"`
+			Score        float64 `json:"score"`
+			BoundingPoly struct {
+				NormalizedVertices []struct {
+					X float64 `json:"x"`
+					Y float64 `json:"y"`
+				} `json:"normalizedVertices"`
+			} `json:"boundingPoly"`
+		} `json:"localizedObjectAnnotations"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"responses"`
+}
+
+// Classify implements Classifier, localized objects are returned with their
+// bounds, followed by labels for the image as a whole
+func (g *GoogleVision) Classify(ctx context.Context, jpg []byte) ([]Label, error) {
+	size, err := imageSize(jpg)
+	if err != nil {
+		return nil, err
+	}
+	// []byte is encoded as base64, as the API expects
+	body, err := json.Marshal(visionRequest{Requests: []visionImageRequest{{
+		Image: visionImage{Content: jpg},
+		Features: []visionFeature{
+			{Type: "OBJECT_LOCALIZATION", MaxResults: g.maxLabels},
+			{Type: "LABEL_DETECTION", MaxResults: g.maxLabels},
+		},
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	endpoint := g.endpoint + "?key=" + url.QueryEscape(g.apiKey)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("google vision: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	parsed := visionResponse{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("google vision: invalid response: %s", err)
+	}
+	if len(parsed.Responses) != 1 {
+		return nil, fmt.Errorf("google vision: expected 1 response, got %d", len(parsed.Responses))
+	}
+	r := parsed.Responses[0]
+	if r.Error != nil {
+		return nil, fmt.Errorf("google vision: error %d: %s", r.Error.Code, r.Error.Message)
+	}
+	labels := []Label{}
+	for _, o := range r.LocalizedObjectAnnotations {
+		l := Label{Name: o.Name, Confidence: o.Score}
+		if vs := o.BoundingPoly.NormalizedVertices; len(vs) > 0 {
+			left, top, right, bottom := vs[0].X, vs[0].Y, vs[0].X, vs[0].Y
+			for _, v := range vs[1:] {
+				left, right = math.Min(left, v.X), math.Max(right, v.X)
+				top, bottom = math.Min(top, v.Y), math.Max(bottom, v.Y)
+			}
+			l.Bounds = relativeRect(size, left, top, right, bottom)
+		}
+		labels = append(labels, l)
+	}
+	for _, a := range r.LabelAnnotations {
+		labels = append(labels, Label{Name: a.Description, Confidence: a.Score})
+	}
+	return labels, nil
+}
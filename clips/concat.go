@@ -0,0 +1,96 @@
+package clips
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultConcatWidth is the default width of concatenated clips
+const DefaultConcatWidth = 640
+
+// Part is a part of a clip on disk, see Concat
+type Part struct {
+	Path string
+	// Offset is where the part starts in the clip, and Duration how long
+	// it is, the rest of the clip when 0
+	Offset   time.Duration
+	Duration time.Duration
+}
+
+// Concat encodes parts of clips, one after the other, into a single MP4
+// clip written to w, e.g. a digest of the clips of a day. Parts are scaled
+// to fit the given width, DefaultConcatWidth when 0, and a 16:9 frame, so
+// that clips of cameras of different resolutions can be joined, and
+// encoded at the options' frame rate
+func Concat(ctx context.Context, w io.Writer, parts []Part, width int, opts EncoderOptions) error {
+	if len(parts) == 0 {
+		return errors.New("no clips to concatenate")
+	}
+	enc, err := encoderName(opts.Codec, opts.HWAccel)
+	if err != nil {
+		return err
+	}
+	if width <= 0 {
+		width = DefaultConcatWidth
+	}
+	// encoders want even sizes
+	width -= width % 2
+	height := width * 9 / 16
+	height -= height % 2
+	fps := opts.FPS
+	if fps <= 0 {
+		fps = DefaultFPS
+	}
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if opts.HWAccel == HWVAAPI {
+		device := opts.VAAPIDevice
+		if device == "" {
+			device = DefaultVAAPIDevice
+		}
+		args = append(args, "-vaapi_device", device)
+	}
+	filters, labels := []string{}, ""
+	for i, p := range parts {
+		args = append(args, "-ss", seconds(p.Offset))
+		if p.Duration > 0 {
+			args = append(args, "-t", seconds(p.Duration))
+		}
+		args = append(args, "-i", p.Path)
+		filters = append(filters, fmt.Sprintf("[%d:v]scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=%s,format=yuv420p[v%d]",
+			i, width, height, width, height, strconv.FormatFloat(fps, 'f', -1, 64), i))
+		labels += fmt.Sprintf("[v%d]", i)
+	}
+	out := fmt.Sprintf("%sconcat=n=%d:v=1:a=0", labels, len(parts))
+	if opts.HWAccel == HWVAAPI {
+		out += ",format=nv12,hwupload"
+	}
+	filters = append(filters, out+"[out]")
+	args = append(args, "-filter_complex", strings.Join(filters, ";"), "-map", "[out]")
+	args = append(append(args, opts.codecArgs(enc)...), "-an", "-movflags", "frag_keyframe+empty_moov+default_base_moof", "-f", "mp4", "pipe:1")
+	ffmpeg := opts.FFmpeg
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	}
+	cmd := exec.CommandContext(ctx, ffmpeg, args...)
+	stderr := &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = w, stderr
+	if err := cmd.Run(); err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return fmt.Errorf("ffmpeg: %w: %s", err, msg)
+		}
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return nil
+}
+
+// seconds formats a duration in seconds for ffmpeg
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
@@ -0,0 +1,240 @@
+package clips
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+const (
+	// DefaultSegmentLength is the default length of the segments of a
+	// continuous recording
+	DefaultSegmentLength = 10 * time.Minute
+
+	// keptSegments is the number of finalized segments events can still be
+	// pointed into, events longer than that are cut short
+	keptSegments = 3
+)
+
+// segment is a segment of a continuous recording
+type segment struct {
+	name   string
+	file   storage.ObjectWriter
+	enc    *Encoder
+	index  *Index
+	frames []time.Time
+}
+
+// offset returns the offset into the segment's video of the frame recorded
+// at the given time, frames are encoded at a constant rate whatever the
+// rate they were written at
+func (s *segment) offset(t time.Time, fps float64) time.Duration {
+	i := sort.Search(len(s.frames), func(i int) bool { return !s.frames[i].Before(t) })
+	return time.Duration(float64(i) / fps * float64(time.Second))
+}
+
+// Continuous records continuously, NVR style, into segments of a fixed
+// length aligned to the clock, e.g. recordings/front-door/20240101T101000Z.mp4.
+// Events point into the segments (see AddEvent) rather than having clips of
+// their own, and are indexed as chapters of the segments they are in
+type Continuous struct {
+	mu      sync.Mutex
+	store   storage.Storage
+	camera  string
+	length  time.Duration
+	encoder EncoderOptions
+	hooks   []Hook
+	onError func(error)
+	current *segment
+	// recent are the last finalized segments, oldest first
+	recent []*segment
+}
+
+// ContinuousOption configures optional behaviour of a Continuous recording
+type ContinuousOption func(*Continuous)
+
+// WithSegmentLength sets the length of the segments
+func WithSegmentLength(length time.Duration) ContinuousOption {
+	return func(c *Continuous) {
+		c.length = length
+	}
+}
+
+// WithEncoderOptions sets how segments are encoded
+func WithEncoderOptions(opts EncoderOptions) ContinuousOption {
+	return func(c *Continuous) {
+		c.encoder = opts
+	}
+}
+
+// WithHooks sets hooks invoked, in the background, after every segment is
+// finalized
+func WithHooks(hooks ...Hook) ContinuousOption {
+	return func(c *Continuous) {
+		c.hooks = append(c.hooks, hooks...)
+	}
+}
+
+// WithErrorHandler sets a function to be called with the errors finalizing
+// segments, which are logged otherwise
+func WithErrorHandler(onError func(error)) ContinuousOption {
+	return func(c *Continuous) {
+		c.onError = onError
+	}
+}
+
+// NewContinuous is the constructor for a Continuous recording of the given
+// camera into the given storage
+func NewContinuous(store storage.Storage, camera string, opts ...ContinuousOption) *Continuous {
+	c := &Continuous{
+		store:   store,
+		camera:  camera,
+		length:  DefaultSegmentLength,
+		onError: func(err error) { log.Printf("continuous recording: %s", err) },
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.encoder.FPS <= 0 {
+		c.encoder.FPS = DefaultFPS
+	}
+	return c
+}
+
+// WriteFrame records a jpg frame recorded at the given time, it should be
+// called at the encoder's frame rate. A new segment is started when the
+// frame is past the end of the current one, or after the encoder failed
+func (c *Continuous) WriteFrame(jpg []byte, t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	start := t.Truncate(c.length)
+	if c.current != nil && !c.current.index.Start.Truncate(c.length).Equal(start) {
+		c.finalize()
+	}
+	if c.current == nil {
+		if err := c.startSegment(t); err != nil {
+			return err
+		}
+	}
+	c.current.frames = append(c.current.frames, t)
+	if err := c.current.enc.WriteFrame(jpg); err != nil {
+		// ffmpeg exited and won't take any more frames, the segment is cut
+		// short, with why reported to the error handler, so that the next
+		// frame starts a new one rather than failing until the segment's end
+		c.finalize()
+		return err
+	}
+	return nil
+}
+
+// startSegment starts a segment with a frame recorded at the given time
+func (c *Continuous) startSegment(t time.Time) error {
+	name := path.Join("recordings", c.camera, t.UTC().Format("20060102T150405Z")+".mp4")
+	f, err := c.store.PutClip(name)
+	if err != nil {
+		return err
+	}
+	enc, err := NewEncoder(f, c.encoder)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	c.current = &segment{name: name, file: f, enc: enc, index: NewIndex(name, t)}
+	return nil
+}
+
+// finalize finalizes the current segment, the hooks run in the background
+func (c *Continuous) finalize() error {
+	s := c.current
+	c.current = nil
+	err := s.enc.Close()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		err = fmt.Errorf("could not finalize segment %s: %w", s.name, err)
+		c.onError(err)
+		return err
+	}
+	if _, err := s.index.Save(c.store); err != nil {
+		c.onError(err)
+	}
+	if c.recent = append(c.recent, s); len(c.recent) > keptSegments {
+		c.recent = c.recent[1:]
+	}
+	// events may still be added to the segment's index while hooks run
+	index := *s.index
+	index.Chapters = append([]Chapter{}, s.index.Chapters...)
+	clip := Clip{
+		Object: s.file.Object(),
+		Camera: c.camera,
+		Start:  s.index.Start,
+		End:    s.frames[len(s.frames)-1],
+		Index:  &index,
+	}
+	if dir, ok := c.store.(*storage.Dir); ok {
+		clip.Path = dir.Path(s.name)
+	}
+	if len(c.hooks) > 0 {
+		go func() {
+			if err := Finalize(context.Background(), clip, c.hooks...); err != nil {
+				c.onError(err)
+			}
+		}()
+	}
+	return nil
+}
+
+// AddEvent marks an event as a chapter of the segments it was recorded in,
+// and returns where in them it is, e.g. for events.Record.Recording
+func (c *Continuous) AddEvent(e detector.Event, eventID string) []events.RecordingRef {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	refs := []events.RecordingRef{}
+	segments := c.recent
+	if c.current != nil {
+		segments = append(append([]*segment{}, c.recent...), c.current)
+	}
+	for _, s := range segments {
+		first, last := s.frames[0], s.frames[len(s.frames)-1]
+		if e.End.Before(first) || e.Start.After(last) {
+			continue
+		}
+		ref := events.RecordingRef{Segment: s.name, Offset: s.offset(e.Start, c.encoder.FPS)}
+		ref.Duration = s.offset(e.End, c.encoder.FPS) - ref.Offset
+		refs = append(refs, ref)
+		s.index.Chapters = append(s.index.Chapters, Chapter{
+			Offset:     ref.Offset,
+			Duration:   ref.Duration,
+			Title:      chapterTitle(e),
+			EventID:    eventID,
+			Bounds:     e.Bounds,
+			Confidence: e.Confidence,
+		})
+		if s != c.current {
+			// the index of a finalized segment was already saved
+			if _, err := s.index.Save(c.store); err != nil {
+				c.onError(err)
+			}
+		}
+	}
+	return refs
+}
+
+// Close finalizes the current segment, if any
+func (c *Continuous) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current == nil {
+		return nil
+	}
+	return c.finalize()
+}
@@ -0,0 +1,207 @@
+package clips
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+)
+
+const (
+	// DefaultFPS is the default frame rate of encoded clips
+	DefaultFPS = 15
+
+	// DefaultVAAPIDevice is the default render node used for VAAPI encoding
+	DefaultVAAPIDevice = "/dev/dri/renderD128"
+)
+
+// Codec is the video codec clips are encoded with
+type Codec string
+
+const (
+	// H264 is the most widely playable codec
+	H264 Codec = "h264"
+
+	// H265 makes clips about half the size of H264 ones at the same quality,
+	// but not every browser plays it
+	H265 Codec = "h265"
+)
+
+// HWAccel is a hardware encoder
+type HWAccel string
+
+const (
+	// HWNone encodes in software, with libx264 or libx265
+	HWNone HWAccel = ""
+
+	// HWVAAPI encodes with Intel and AMD GPUs
+	HWVAAPI HWAccel = "vaapi"
+
+	// HWNVENC encodes with NVIDIA GPUs
+	HWNVENC HWAccel = "nvenc"
+
+	// HWV4L2M2M encodes with V4L2 memory to memory encoders, e.g. that of
+	// the Raspberry Pi
+	HWV4L2M2M HWAccel = "v4l2m2m"
+)
+
+// EncoderOptions configure how an Encoder runs ffmpeg
+type EncoderOptions struct {
+	// FFmpeg is the path of the ffmpeg binary, "ffmpeg" looks it up in PATH
+	FFmpeg  string
+	Codec   Codec
+	HWAccel HWAccel
+	// VAAPIDevice is the render node used with HWVAAPI, DefaultVAAPIDevice
+	// when empty
+	VAAPIDevice string
+	// FPS is the rate frames are written at, DefaultFPS when zero
+	FPS float64
+	// Quality is the encoder's constant quality setting, lower is better
+	// and larger, e.g. 23 for libx264. Zero uses the encoder's default
+	Quality int
+}
+
+// Encoder encodes jpg frames into an H.264 or H.265 MP4 clip with ffmpeg,
+// which is much smaller than MJPEG. The MP4 is fragmented so that it can be
+// written to any io.Writer, e.g. a storage.File which encrypts and hashes it
+type Encoder struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *bytes.Buffer
+	copied chan error
+	once   sync.Once
+	err    error
+}
+
+// encoderName returns the name of ffmpeg's encoder for a codec and hardware
+// encoder
+func encoderName(codec Codec, hw HWAccel) (string, error) {
+	names := map[Codec]map[HWAccel]string{
+		H264: {HWNone: "libx264", HWVAAPI: "h264_vaapi", HWNVENC: "h264_nvenc", HWV4L2M2M: "h264_v4l2m2m"},
+		H265: {HWNone: "libx265", HWVAAPI: "hevc_vaapi", HWNVENC: "hevc_nvenc", HWV4L2M2M: "hevc_v4l2m2m"},
+	}
+	if codec == "" {
+		codec = H264
+	}
+	name, ok := names[codec][hw]
+	if !ok {
+		return "", fmt.Errorf("unsupported codec %q with hardware encoder %q", codec, hw)
+	}
+	return name, nil
+}
+
+// args returns ffmpeg's arguments to encode jpg frames read from its
+// standard input into a fragmented MP4 written to its standard output
+func (o EncoderOptions) args() ([]string, error) {
+	enc, err := encoderName(o.Codec, o.HWAccel)
+	if err != nil {
+		return nil, err
+	}
+	fps := o.FPS
+	if fps <= 0 {
+		fps = DefaultFPS
+	}
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if o.HWAccel == HWVAAPI {
+		device := o.VAAPIDevice
+		if device == "" {
+			device = DefaultVAAPIDevice
+		}
+		args = append(args, "-vaapi_device", device)
+	}
+	args = append(args, "-f", "image2pipe", "-framerate", strconv.FormatFloat(fps, 'f', -1, 64), "-c:v", "mjpeg", "-i", "pipe:0")
+	if o.HWAccel == HWVAAPI {
+		args = append(args, "-vf", "format=nv12,hwupload")
+	} else {
+		args = append(args, "-pix_fmt", "yuv420p")
+	}
+	return append(append(args, o.codecArgs(enc)...), "-an", "-movflags", "frag_keyframe+empty_moov+default_base_moof", "-f", "mp4", "pipe:1"), nil
+}
+
+// codecArgs returns ffmpeg's output arguments to encode with the given
+// encoder, at the options' quality
+func (o EncoderOptions) codecArgs(enc string) []string {
+	args := []string{"-c:v", enc}
+	if o.Quality > 0 {
+		q := strconv.Itoa(o.Quality)
+		switch o.HWAccel {
+		case HWNone:
+			args = append(args, "-crf", q)
+		case HWNVENC:
+			args = append(args, "-cq", q)
+		case HWVAAPI:
+			args = append(args, "-qp", q)
+		}
+	}
+	if o.Codec == H265 {
+		// for Apple players
+		args = append(args, "-tag:v", "hvc1")
+	}
+	return args
+}
+
+// NewEncoder starts ffmpeg to encode a clip written to w
+func NewEncoder(w io.Writer, opts EncoderOptions) (*Encoder, error) {
+	args, err := opts.args()
+	if err != nil {
+		return nil, err
+	}
+	ffmpeg := opts.FFmpeg
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	}
+	e := &Encoder{cmd: exec.Command(ffmpeg, args...), stderr: &bytes.Buffer{}, copied: make(chan error, 1)}
+	e.cmd.Stderr = e.stderr
+	if e.stdin, err = e.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := e.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := e.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start ffmpeg: %w", err)
+	}
+	go func() {
+		_, err := io.Copy(w, stdout)
+		if err != nil {
+			// keep ffmpeg from blocking on a full pipe
+			io.Copy(io.Discard, stdout)
+		}
+		e.copied <- err
+	}()
+	return e, nil
+}
+
+// WriteFrame encodes a jpg frame, e.g. from detector.SnapshotJPG
+func (e *Encoder) WriteFrame(jpg []byte) error {
+	if _, err := e.stdin.Write(jpg); err != nil {
+		// ffmpeg exited, Close reports why
+		return fmt.Errorf("could not write frame to ffmpeg: %w", err)
+	}
+	return nil
+}
+
+// fail returns an error of ffmpeg with what it reported, once it exited
+func (e *Encoder) fail(err error) error {
+	if msg := bytes.TrimSpace(e.stderr.Bytes()); len(msg) > 0 {
+		return fmt.Errorf("ffmpeg: %w: %s", err, msg)
+	}
+	return fmt.Errorf("ffmpeg: %w", err)
+}
+
+// Close finishes the clip, once it returns the whole clip was written
+func (e *Encoder) Close() error {
+	e.once.Do(func() {
+		e.stdin.Close()
+		copyErr := <-e.copied
+		if err := e.cmd.Wait(); err != nil {
+			e.err = e.fail(err)
+		} else if copyErr != nil {
+			e.err = copyErr
+		}
+	})
+	return e.err
+}
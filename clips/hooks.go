@@ -0,0 +1,92 @@
+package clips
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/adrianosela/GoAway/storage"
+)
+
+// Clip is a clip which was finalized, i.e. completely written to storage
+type Clip struct {
+	Object storage.Object `json:"object"`
+	// Path is where the clip is on local disk, empty for other storage. It
+	// is encrypted when its storage encrypts files, see storage.Dir.Open
+	Path   string    `json:"path"`
+	Camera string    `json:"camera,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	// Index is the motion in the clip, if it was indexed
+	Index *Index `json:"index,omitempty"`
+}
+
+// Hook is invoked after a clip is finalized, e.g. to transcode it, upload it
+// or run external analysis on it
+type Hook interface {
+	ClipFinalized(ctx context.Context, c Clip) error
+}
+
+// HookFunc is a function used as a Hook
+type HookFunc func(ctx context.Context, c Clip) error
+
+// ClipFinalized implements Hook
+func (f HookFunc) ClipFinalized(ctx context.Context, c Clip) error {
+	return f(ctx, c)
+}
+
+// commandHook runs an external program for every clip
+type commandHook struct {
+	name string
+	args []string
+}
+
+// CommandHook runs the given program with the given arguments for every
+// clip, e.g. a script, without forking the recorder. The clip is described
+// in JSON on the program's standard input and in the environment variables
+// GOAWAY_CLIP_PATH, GOAWAY_CLIP_NAME, GOAWAY_CLIP_CAMERA, GOAWAY_CLIP_START
+// and GOAWAY_CLIP_END (RFC 3339 times). The program is killed when the
+// context is done, and fails the hook when it exits with a non-zero status
+func CommandHook(name string, args ...string) Hook {
+	return &commandHook{name: name, args: args}
+}
+
+// ClipFinalized implements Hook
+func (h *commandHook) ClipFinalized(ctx context.Context, c Clip) error {
+	meta, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, h.name, h.args...)
+	cmd.Stdin = bytes.NewReader(meta)
+	cmd.Env = append(os.Environ(),
+		"GOAWAY_CLIP_PATH="+c.Path,
+		"GOAWAY_CLIP_NAME="+c.Object.Name,
+		"GOAWAY_CLIP_CAMERA="+c.Camera,
+		"GOAWAY_CLIP_START="+c.Start.Format(time.RFC3339),
+		"GOAWAY_CLIP_END="+c.End.Format(time.RFC3339),
+	)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", h.name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// Finalize invokes the hooks, in order, for a clip which was finalized. A
+// failing hook doesn't keep the ones after it from running, the first error
+// is returned
+func Finalize(ctx context.Context, c Clip, hooks ...Hook) error {
+	var first error
+	for _, h := range hooks {
+		if err := h.ClipFinalized(ctx, c); err != nil && first == nil {
+			first = fmt.Errorf("clip %s: %w", c.Object.Name, err)
+		}
+	}
+	return first
+}
@@ -0,0 +1,127 @@
+// Package clips indexes and processes the video clips recorded of events,
+// e.g. marking where in a clip motion occurred so that players and
+// dashboards can jump straight to it
+package clips
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+// Chapter marks motion within a clip
+type Chapter struct {
+	// Offset is where the motion starts relative to the start of the clip
+	Offset   time.Duration `json:"offset"`
+	Duration time.Duration `json:"duration"`
+	// Title is the reason of a forced event, "motion" otherwise
+	Title      string          `json:"title"`
+	EventID    string          `json:"event_id,omitempty"`
+	Bounds     image.Rectangle `json:"bounds"`
+	Confidence float64         `json:"confidence"`
+}
+
+// Index is the index of the motion in a clip, stored next to the clip as a
+// sidecar JSON file (see IndexName)
+type Index struct {
+	// Clip is the name of the clip in its storage
+	Clip string `json:"clip"`
+	// Start is the time of the clip's first frame
+	Start    time.Time `json:"start"`
+	Chapters []Chapter `json:"chapters"`
+}
+
+// NewIndex is the constructor for the Index of a clip whose first frame was
+// recorded at the given time
+func NewIndex(clip string, start time.Time) *Index {
+	return &Index{Clip: clip, Start: start, Chapters: []Chapter{}}
+}
+
+// Add marks the motion of an event in the clip, the record ID of the event,
+// if any, lets players link back to it
+func (i *Index) Add(e detector.Event, eventID string) {
+	c := Chapter{
+		Offset:     e.Start.Sub(i.Start),
+		Duration:   e.End.Sub(e.Start),
+		Title:      chapterTitle(e),
+		EventID:    eventID,
+		Bounds:     e.Bounds,
+		Confidence: e.Confidence,
+	}
+	if c.Offset < 0 {
+		// the event started before the clip did
+		c.Duration += c.Offset
+		c.Offset = 0
+	}
+	if c.Duration < 0 {
+		c.Duration = 0
+	}
+	i.Chapters = append(i.Chapters, c)
+	sort.SliceStable(i.Chapters, func(a, b int) bool { return i.Chapters[a].Offset < i.Chapters[b].Offset })
+}
+
+// chapterTitle returns the title of the chapter of an event
+func chapterTitle(e detector.Event) string {
+	if e.Reason != "" {
+		return e.Reason
+	}
+	return "motion"
+}
+
+// IndexName returns the name of the sidecar index of a clip, the clip's name
+// with a .json extension, e.g. clips/front-door.json for clips/front-door.mp4
+func IndexName(clip string) string {
+	return strings.TrimSuffix(clip, path.Ext(clip)) + ".json"
+}
+
+// Save writes the index to the storage the clip is in
+func (i *Index) Save(store storage.Storage) (storage.Object, error) {
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return storage.Object{}, err
+	}
+	return store.PutSnapshot(IndexName(i.Clip), data)
+}
+
+// LoadIndex reads the sidecar index of a clip
+func LoadIndex(store storage.Storage, clip string) (*Index, error) {
+	r, err := store.Open(IndexName(clip))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	i := &Index{}
+	if err := json.Unmarshal(data, i); err != nil {
+		return nil, fmt.Errorf("invalid index of clip %s: %w", clip, err)
+	}
+	return i, nil
+}
+
+// metadataEscaper escapes values in ffmpeg's metadata format
+var metadataEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+
+// FFMetadata returns the chapters in ffmpeg's metadata format, to embed them
+// in the clip itself, e.g. for MP4 and MKV players:
+//
+//	ffmpeg -i clip.mp4 -i chapters.txt -map_metadata 1 -codec copy out.mp4
+func (i *Index) FFMetadata() string {
+	b := &strings.Builder{}
+	b.WriteString(";FFMETADATA1\n")
+	for _, c := range i.Chapters {
+		fmt.Fprintf(b, "\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			c.Offset.Milliseconds(), (c.Offset + c.Duration).Milliseconds(), metadataEscaper.Replace(c.Title))
+	}
+	return b.String()
+}
@@ -0,0 +1,293 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+// DefaultRetryInterval is how long an agent waits before retrying uploads
+// after failing to reach the central server
+const DefaultRetryInterval = 30 * time.Second
+
+// Agent forwards the events detected at the edge to a central server. Events
+// are buffered on disk until they have been uploaded, so none are lost while
+// the central server is unreachable
+type Agent struct {
+	name          string
+	url           string
+	token         string
+	spool         *events.DirStore
+	media         storage.Storage
+	client        *http.Client
+	retryInterval time.Duration
+	wake          chan struct{}
+	metered       bool
+	payload       PayloadPolicy
+	queueLimit    int
+
+	deadLetters        *DeadLetters
+	deadLetterAttempts int
+	// failures counts the uploads of records which the central server
+	// failed in a row
+	failures map[string]int
+
+	mu         sync.Mutex
+	throughput float64
+}
+
+// AgentOption configures optional behaviour of an Agent
+type AgentOption func(*Agent)
+
+// WithRetryInterval sets how long the agent waits before retrying uploads
+// after failing to reach the central server
+func WithRetryInterval(interval time.Duration) AgentOption {
+	return func(a *Agent) {
+		a.retryInterval = interval
+	}
+}
+
+// WithHTTPClient sets the client used to upload events, e.g. to configure
+// TLS client certificates
+func WithHTTPClient(client *http.Client) AgentOption {
+	return func(a *Agent) {
+		a.client = client
+	}
+}
+
+// WithQueueLimit caps the number of records queued while the central server
+// can't be reached, e.g. to bound the disk used by a long outage. Once the
+// cap is reached, the oldest records are dropped with their media to make
+// room for new ones
+func WithQueueLimit(records int) AgentOption {
+	return func(a *Agent) {
+		a.queueLimit = records
+	}
+}
+
+// NewAgent is the constructor for an Agent. Records added to the agent are
+// kept in the spool, and their media is read from the media directory, until
+// they have been uploaded to the central server at the given URL, after
+// which both are removed
+func NewAgent(name, centralURL, token string, spool *events.DirStore, media storage.Storage, opts ...AgentOption) (*Agent, error) {
+	if !validAgentName(name) {
+		return nil, fmt.Errorf("invalid agent name %q", name)
+	}
+	if u, err := url.Parse(centralURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid central server URL %q, expected e.g. https://central.example.com", centralURL)
+	}
+	if token == "" {
+		return nil, errNoToken
+	}
+	a := &Agent{
+		name:          name,
+		url:           strings.TrimSuffix(centralURL, "/") + eventsPath,
+		token:         token,
+		spool:         spool,
+		media:         media,
+		client:        http.DefaultClient,
+		retryInterval: DefaultRetryInterval,
+		wake:          make(chan struct{}, 1),
+		failures:      map[string]int{},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a, nil
+}
+
+// Add queues a record, whose media has been written to the agent's media
+// directory, to be uploaded
+func (a *Agent) Add(r *events.Record) error {
+	if err := a.spool.Add(r); err != nil {
+		return err
+	}
+	if a.queueLimit > 0 {
+		if err := a.trim(); err != nil {
+			log.Printf("could not trim the event queue: %s", err)
+		}
+	}
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Queued returns the number of records waiting to be uploaded
+func (a *Agent) Queued() (int, error) {
+	records, err := a.spool.List()
+	return len(records), err
+}
+
+// trim drops the oldest records past the queue limit
+func (a *Agent) trim() error {
+	records, err := a.spool.List()
+	if err != nil || len(records) <= a.queueLimit {
+		return err
+	}
+	for _, r := range records[:len(records)-a.queueLimit] {
+		log.Printf("event queue is full, dropping event %s", r.ID)
+		if err := a.remove(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove removes a queued record and its media
+func (a *Agent) remove(r *events.Record) error {
+	for _, obj := range r.Media {
+		if err := a.media.Delete(obj.Name); err != nil && !os.IsNotExist(err) {
+			log.Printf("could not remove media %s: %s", obj.Name, err)
+		}
+	}
+	if err := a.spool.Delete(r.ID); err != nil && !errors.Is(err, events.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Run uploads queued records until the context is done, records queued
+// before the agent was (re)started are uploaded first
+func (a *Agent) Run(ctx context.Context) error {
+	for {
+		if err := a.flush(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("could not upload events, retrying in %s: %s", a.retryInterval, err)
+		}
+		// the spool is checked every retry interval even when everything
+		// was uploaded, for records queued by others, e.g. replayed dead
+		// letters
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-a.wake:
+		case <-time.After(a.retryInterval):
+		}
+	}
+}
+
+var (
+	// errUploadRejected is returned when the central server rejects a
+	// record, retrying it won't help
+	errUploadRejected = errors.New("central server rejected upload")
+
+	// errServerFailure is returned when the central server fails to store a
+	// record, e.g. as its disk is full
+	errServerFailure = errors.New("central server failed")
+)
+
+// flush uploads all queued records, oldest first. It stops at the first
+// record which can't be uploaded due to a network or server error, to keep
+// them in order, but skips records which were rejected, or moves them to the
+// dead letters
+func (a *Agent) flush(ctx context.Context) error {
+	records, err := a.spool.List()
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		err := a.upload(ctx, r)
+		if err != nil {
+			dead, dErr := a.deadLetter(r, err)
+			if dErr != nil {
+				return dErr
+			}
+			if dead {
+				continue
+			}
+		}
+		if errors.Is(err, errUploadRejected) {
+			log.Printf("could not upload event %s: %s", r.ID, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		delete(a.failures, r.ID)
+		// the record may have been dropped from a full queue meanwhile
+		if err := a.remove(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upload sends a record and its media to the central server
+func (a *Agent) upload(ctx context.Context, r *events.Record) error {
+	sent := *r
+	if a.payload != nil {
+		sent.Media = a.payload(a.Link(), r.Media)
+	}
+	body, w := io.Pipe()
+	counter := &countingWriter{w: w}
+	mw := multipart.NewWriter(counter)
+	go func() {
+		w.CloseWithError(a.writeUpload(mw, &sent))
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, body)
+	if err != nil {
+		body.Close()
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	start := time.Now()
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode == http.StatusBadRequest:
+		return fmt.Errorf("%w: %s", errUploadRejected, strings.TrimSpace(string(msg)))
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("%w: responded with %s", errServerFailure, resp.Status)
+	}
+	a.measure(counter.written(), time.Since(start))
+	return nil
+}
+
+// writeUpload writes the multipart body of an upload
+func (a *Agent) writeUpload(mw *multipart.Writer, r *events.Record) error {
+	if err := mw.WriteField("agent", a.name); err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := mw.WriteField("record", string(data)); err != nil {
+		return err
+	}
+	for _, obj := range r.Media {
+		part, err := mw.CreateFormFile("media", obj.Name)
+		if err != nil {
+			return err
+		}
+		f, err := a.media.Open(obj.Name)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(part, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
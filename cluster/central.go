@@ -0,0 +1,154 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+// Central is the HTTP server which agents upload their events to, it also
+// serves the aggregated events of all agents for dashboards
+type Central struct {
+	token   string
+	records events.Store
+	media   storage.Storage
+}
+
+// NewCentral is the constructor for a Central, uploaded records are added to
+// the given store and their media written to the given directory, under a
+// directory per agent. Agents must authenticate with the given token, which
+// can't be empty
+func NewCentral(token string, records events.Store, media storage.Storage) (*Central, error) {
+	if token == "" {
+		return nil, errNoToken
+	}
+	return &Central{token: token, records: records, media: media}, nil
+}
+
+// ServeHTTP implements http.Handler
+func (c *Central) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != eventsPath {
+		http.NotFound(w, r)
+		return
+	}
+	if !authorized(r, c.token) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		c.handleList(w, r)
+	case http.MethodPost:
+		c.handleUpload(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *Central) handleList(w http.ResponseWriter, r *http.Request) {
+	records, err := c.records.List()
+	if err != nil {
+		log.Printf("could not list events: %s", err)
+		http.Error(w, "could not list events", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, records)
+}
+
+// errRejected marks upload errors caused by the agent rather than the server
+var errRejected = errors.New("upload rejected")
+
+func (c *Central) handleUpload(w http.ResponseWriter, r *http.Request) {
+	err := c.receive(r)
+	switch {
+	case errors.Is(err, errRejected):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		log.Printf("could not store uploaded event: %s", err)
+		http.Error(w, "could not store event", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// receive stores the event uploaded in a request
+func (c *Central) receive(r *http.Request) error {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return fmt.Errorf("%w: %s", errRejected, err)
+	}
+	// fields must come in order, before the media
+	field := func(name string) ([]byte, error) {
+		part, err := mr.NextPart()
+		if err != nil || part.FormName() != name {
+			return nil, fmt.Errorf("%w: expected %s field", errRejected, name)
+		}
+		return io.ReadAll(io.LimitReader(part, 1<<20))
+	}
+	agent, err := field("agent")
+	if err != nil {
+		return err
+	}
+	if !validAgentName(string(agent)) {
+		return fmt.Errorf("%w: invalid agent name", errRejected)
+	}
+	data, err := field("record")
+	if err != nil {
+		return err
+	}
+	record := &events.Record{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return fmt.Errorf("%w: invalid record: %s", errRejected, err)
+	}
+	for i, obj := range record.Media {
+		part, err := mr.NextPart()
+		if err != nil || part.FormName() != "media" {
+			return fmt.Errorf("%w: missing media %s", errRejected, obj.Name)
+		}
+		if !validMediaName(obj.Name) {
+			return fmt.Errorf("%w: invalid media name %s", errRejected, obj.Name)
+		}
+		if record.Media[i], err = c.store(string(agent)+"/"+obj.Name, part, obj); err != nil {
+			return err
+		}
+	}
+	if record.Camera == "" {
+		record.Camera = string(agent)
+	} else {
+		record.Camera = string(agent) + "-" + record.Camera
+	}
+	return c.records.Add(record)
+}
+
+// store writes an uploaded media file, checking it against the hash the
+// agent recorded for it
+func (c *Central) store(name string, r io.Reader, sent storage.Object) (storage.Object, error) {
+	f, err := c.media.PutClip(name)
+	if err != nil {
+		return storage.Object{}, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		c.media.Delete(name)
+		return storage.Object{}, fmt.Errorf("%w: could not read media %s: %s", errRejected, sent.Name, err)
+	}
+	if err := f.Close(); err != nil {
+		return storage.Object{}, err
+	}
+	obj := f.Object()
+	if obj.SHA256 != sent.SHA256 {
+		c.media.Delete(name)
+		return storage.Object{}, fmt.Errorf("%w: media %s: %s", errRejected, sent.Name, storage.ErrHashMismatch)
+	}
+	// the agent's signature covers the name the media had at the edge, it is
+	// signed again under its new name when the central storage has a
+	// signing key
+	return obj, nil
+}
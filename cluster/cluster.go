@@ -0,0 +1,51 @@
+// Package cluster splits a deployment into edge agents, which capture and
+// detect motion next to the cameras, and a central server which aggregates
+// the events and media of all agents. Agents buffer events on disk while
+// the central server can't be reached, so flaky links between buildings
+// don't lose footage
+//
+// Agents upload each event as a multipart/form-data POST to /v1/events on
+// the central server, with an "agent" field naming the agent, a "record"
+// field holding the JSON encoded event record and a "media" file for each of
+// the record's media, in order
+package cluster
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const eventsPath = "/v1/events"
+
+var agentNamePattern = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+// validAgentName returns whether an agent name is safe to use in file names
+func validAgentName(name string) bool {
+	return agentNamePattern.MatchString(name)
+}
+
+// validMediaName returns whether a media file name stays within the
+// directory it is stored in
+func validMediaName(name string) bool {
+	clean := path.Clean(name)
+	return clean == name && clean != "." && !path.IsAbs(clean) && clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+// errNoToken is returned by the constructors given an empty token, which
+// would let anyone in
+var errNoToken = errors.New("a token is required")
+
+// authorized returns whether a request carries the given bearer token, an
+// empty token authorizes nothing
+func authorized(r *http.Request, token string) bool {
+	got := r.Header.Get("Authorization")
+	if token == "" || !strings.HasPrefix(got, "Bearer ") {
+		return false
+	}
+	got = strings.TrimPrefix(got, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
@@ -0,0 +1,312 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/events"
+)
+
+// DefaultDeadLetterAttempts is the default number of uploads of a record the
+// central server fails in a row before it is moved to the dead letters
+const DefaultDeadLetterAttempts = 10
+
+var idPattern = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+// DeadLetter is a record which could not be uploaded, or notified, and won't
+// be retried until it is replayed
+type DeadLetter struct {
+	Record events.Record `json:"record"`
+	// Error is the last error uploading the record, or the error of the
+	// first notifier which failed to deliver it
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Time     time.Time `json:"time"`
+	// Notifiers are the notifiers which failed to deliver the record, for
+	// notifications, see AddNotification
+	Notifiers []string `json:"notifiers,omitempty"`
+}
+
+var (
+	// ErrNotUpload is returned when replaying the dead letter of a
+	// notification into an agent's spool, see Resend
+	ErrNotUpload = errors.New("the dead letter is a notification, resend it through the notifiers")
+
+	// ErrNotNotification is returned when resending the dead letter of an
+	// upload through notifiers, see Replay
+	ErrNotNotification = errors.New("the dead letter is an upload, replay it into the agent's spool")
+)
+
+// DeadLetters keeps the records an agent gave up on, each as a JSON file in
+// a directory, so that no event is lost silently. Their media is left in the
+// agent's media directory until they are replayed. DeadLetters also keep the
+// notifications a notify.Dispatcher gave up on, in a directory of their own,
+// see AddNotification
+type DeadLetters struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewDeadLetters is the constructor for DeadLetters, the directory is
+// created if it doesn't exist
+func NewDeadLetters(path string) (*DeadLetters, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+	return &DeadLetters{path: path}, nil
+}
+
+func (d *DeadLetters) letterPath(id string) string {
+	return filepath.Join(d.path, id+".json")
+}
+
+// Add keeps a dead letter, replacing any with the same record ID
+func (d *DeadLetters) Add(l *DeadLetter) error {
+	if !idPattern.MatchString(l.Record.ID) {
+		return events.ErrInvalidID
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tmp := d.letterPath(l.Record.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.letterPath(l.Record.ID))
+}
+
+// Get returns the dead letter of the record with the given ID
+func (d *DeadLetters) Get(id string) (*DeadLetter, error) {
+	if !idPattern.MatchString(id) {
+		return nil, events.ErrInvalidID
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.read(d.letterPath(id))
+}
+
+func (d *DeadLetters) read(path string) (*DeadLetter, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, events.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	l := &DeadLetter{}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// List returns all dead letters, oldest event first
+func (d *DeadLetters) List() ([]*DeadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries, err := os.ReadDir(d.path)
+	if err != nil {
+		return nil, err
+	}
+	letters := []*DeadLetter{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		l, err := d.read(filepath.Join(d.path, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, l)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].Record.ID < letters[j].Record.ID
+	})
+	return letters, nil
+}
+
+// AddNotification keeps the record of an event the named notifiers failed
+// to deliver, replacing any dead letter of the record, it implements
+// notify.DeadLetterQueue
+func (d *DeadLetters) AddNotification(r *events.Record, notifiers []string, attempts int, err error) error {
+	log.Printf("giving up on notifying event %s through %s, moved to the dead letters: %s", r.ID, strings.Join(notifiers, ", "), err)
+	return d.Add(&DeadLetter{Record: *r, Error: err.Error(), Attempts: attempts, Time: time.Now(), Notifiers: notifiers})
+}
+
+// Resender delivers events to named notifiers, e.g. a notify.Dispatcher
+type Resender interface {
+	NotifyOnly(ctx context.Context, r *events.Record, names ...string) error
+}
+
+// Resend delivers the record of a dead letter of a notification again to
+// the notifiers which failed to, through the dispatcher, and removes the
+// dead letter once they all succeeded. It is kept when they fail again,
+// replaced by the dispatcher's if it keeps its dead letters here
+func (d *DeadLetters) Resend(ctx context.Context, id string, n Resender) error {
+	l, err := d.Get(id)
+	if err != nil {
+		return err
+	}
+	if len(l.Notifiers) == 0 {
+		return ErrNotNotification
+	}
+	if err := n.NotifyOnly(ctx, &l.Record, l.Notifiers...); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := os.Remove(d.letterPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Replay queues the record of a dead letter in an agent's spool again, to be
+// uploaded next time the agent retries, and removes the dead letter
+func (d *DeadLetters) Replay(id string, spool events.Store) error {
+	l, err := d.Get(id)
+	if err != nil {
+		return err
+	}
+	if len(l.Notifiers) > 0 {
+		return ErrNotUpload
+	}
+	if err := spool.Add(&l.Record); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return os.Remove(d.letterPath(id))
+}
+
+// WithDeadLetters moves the records the central server rejects, or fails to
+// store the given number of times in a row, to the dead letters rather than
+// retrying them forever, see DefaultDeadLetterAttempts. Records which can't
+// be uploaded because the central server can't be reached are kept queued
+func WithDeadLetters(d *DeadLetters, attempts int) AgentOption {
+	return func(a *Agent) {
+		a.deadLetters = d
+		if a.deadLetterAttempts = attempts; attempts < 1 {
+			a.deadLetterAttempts = DefaultDeadLetterAttempts
+		}
+	}
+}
+
+// deadLetter moves a record the agent gives up on to the dead letters, it
+// returns false if the record should be retried
+func (a *Agent) deadLetter(r *events.Record, err error) (bool, error) {
+	if a.deadLetters == nil {
+		return false, nil
+	}
+	if !errors.Is(err, errUploadRejected) {
+		if !errors.Is(err, errServerFailure) {
+			return false, nil
+		}
+		if a.failures[r.ID]++; a.failures[r.ID] < a.deadLetterAttempts {
+			return false, nil
+		}
+	}
+	attempts := a.failures[r.ID]
+	if attempts == 0 {
+		attempts = 1
+	}
+	delete(a.failures, r.ID)
+	log.Printf("giving up on uploading event %s, moved to the dead letters: %s", r.ID, err)
+	l := &DeadLetter{Record: *r, Error: err.Error(), Attempts: attempts, Time: time.Now()}
+	if err := a.deadLetters.Add(l); err != nil {
+		return false, err
+	}
+	return true, a.spool.Delete(r.ID)
+}
+
+// DeadLetters returns the records the agent gave up on
+func (a *Agent) DeadLetters() ([]*DeadLetter, error) {
+	if a.deadLetters == nil {
+		return []*DeadLetter{}, nil
+	}
+	return a.deadLetters.List()
+}
+
+// Replay queues the record of a dead letter again, and uploads it
+func (a *Agent) Replay(id string) error {
+	if a.deadLetters == nil {
+		return events.ErrNotFound
+	}
+	if err := a.deadLetters.Replay(id, a.spool); err != nil {
+		return err
+	}
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// DeadLetterHandler returns a handler for inspecting and replaying the
+// agent's dead letters, which requires the agent's token: GET lists them and
+// POST replays the one whose ID is in the "id" form value, or all of them
+func (a *Agent) DeadLetterHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, a.token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		letters, err := a.DeadLetters()
+		if err != nil {
+			log.Printf("could not list dead letters: %s", err)
+			http.Error(w, "could not list dead letters", http.StatusInternalServerError)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, letters)
+		case http.MethodPost:
+			ids := []string{}
+			if id := r.FormValue("id"); id != "" {
+				ids = append(ids, id)
+			} else {
+				for _, l := range letters {
+					ids = append(ids, l.Record.ID)
+				}
+			}
+			for _, id := range ids {
+				err := a.Replay(id)
+				if errors.Is(err, events.ErrNotFound) || errors.Is(err, events.ErrInvalidID) {
+					http.Error(w, fmt.Sprintf("no dead letter %q", id), http.StatusNotFound)
+					return
+				}
+				if err != nil {
+					log.Printf("could not replay dead letter %s: %s", id, err)
+					http.Error(w, "could not replay dead letter", http.StatusInternalServerError)
+					return
+				}
+			}
+			writeJSON(w, map[string][]string{"replayed": ids})
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("could not write response: %s", err)
+	}
+}
@@ -0,0 +1,121 @@
+package cluster
+
+import (
+	"io"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/adrianosela/GoAway/storage"
+)
+
+const (
+	// minMeasuredBytes is the least media an upload must carry for its
+	// throughput to be measured, smaller uploads mostly measure latency
+	minMeasuredBytes = 32 << 10
+
+	// throughputWeight is the weight of the last upload in the measured
+	// throughput, older uploads fade out
+	throughputWeight = 0.3
+)
+
+// Link is what an agent knows of its link to the central server
+type Link struct {
+	// Metered links, e.g. cellular, are charged by the byte, see
+	// WithMeteredLink
+	Metered bool `json:"metered"`
+	// Throughput is the recent upload throughput in bytes per second, 0
+	// until an upload with enough media to measure it
+	Throughput float64 `json:"throughput"`
+}
+
+// PayloadPolicy chooses which of a record's media are uploaded with it,
+// given the agent's link. Media which isn't chosen is dropped once the
+// record is uploaded
+type PayloadPolicy func(link Link, media []storage.Object) []storage.Object
+
+// AdaptivePayload uploads only the snapshots of events, which are small, on
+// metered links and on links measured slower than the given throughput in
+// bytes per second, and all their media, e.g. clips, otherwise
+func AdaptivePayload(minThroughput float64) PayloadPolicy {
+	return func(link Link, media []storage.Object) []storage.Object {
+		slow := link.Throughput > 0 && link.Throughput < minThroughput
+		if !link.Metered && !slow {
+			return media
+		}
+		snapshots := []storage.Object{}
+		for _, obj := range media {
+			if isSnapshot(obj.Name) {
+				snapshots = append(snapshots, obj)
+			}
+		}
+		return snapshots
+	}
+}
+
+// isSnapshot returns whether a media file is an image
+func isSnapshot(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// WithMeteredLink marks the agent's link to the central server as metered,
+// e.g. cellular, for its payload policy
+func WithMeteredLink() AgentOption {
+	return func(a *Agent) {
+		a.metered = true
+	}
+}
+
+// WithPayloadPolicy sets the policy choosing which media are uploaded with
+// each record, e.g. AdaptivePayload, all of them are by default
+func WithPayloadPolicy(p PayloadPolicy) AgentOption {
+	return func(a *Agent) {
+		a.payload = p
+	}
+}
+
+// Link returns what the agent knows of its link to the central server
+func (a *Agent) Link() Link {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return Link{Metered: a.metered, Throughput: a.throughput}
+}
+
+// measure records the throughput of an upload
+func (a *Agent) measure(bytes int64, elapsed time.Duration) {
+	if bytes < minMeasuredBytes || elapsed <= 0 {
+		return
+	}
+	sample := float64(bytes) / elapsed.Seconds()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.throughput == 0 {
+		a.throughput = sample
+		return
+	}
+	a.throughput = throughputWeight*sample + (1-throughputWeight)*a.throughput
+}
+
+// countingWriter counts the bytes written through it, it can be read while
+// being written to
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write implements io.Writer
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// written returns the number of bytes written so far
+func (c *countingWriter) written() int64 {
+	return atomic.LoadInt64(&c.n)
+}
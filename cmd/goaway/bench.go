@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/detector/sourcetest"
+	"github.com/adrianosela/GoAway/sysinfo"
+)
+
+// benchResult is the outcome of running the pipeline at one configuration
+type benchResult struct {
+	fps      float64
+	perFrame time.Duration
+	cpu      float64
+}
+
+// runBench processes the given number of synthetic frames of the given size
+// and reports the achieved frame rate and the CPU used to achieve it
+func runBench(res image.Point, sensitivity float64, frames int) (benchResult, error) {
+	src := sourcetest.New(res.X, res.Y, 0, sourcetest.Rect{
+		Start:    0,
+		End:      60,
+		Bounds:   image.Rect(0, res.Y/4, res.X/4, res.Y*3/4),
+		Velocity: image.Pt(res.X/80, 0),
+	})
+	md, err := detector.NewMotionDetectorFromSource(sourcetest.NewReplay(src, 60, frames), "", nil,
+		detector.WithSensitivity(sensitivity),
+		detector.WithoutWindow(),
+	)
+	if err != nil {
+		return benchResult{}, err
+	}
+	defer md.Close()
+
+	start, startCPU := time.Now(), sysinfo.CPUTime()
+	md.Start()
+	elapsed, usedCPU := time.Since(start), sysinfo.CPUTime()-startCPU
+	return benchResult{
+		fps:      float64(frames) / elapsed.Seconds(),
+		perFrame: elapsed / time.Duration(frames),
+		cpu:      100 * usedCPU.Seconds() / elapsed.Seconds(),
+	}, nil
+}
+
+func parseResolutions(s string) ([]image.Point, error) {
+	res := []image.Point{}
+	for _, r := range strings.Split(s, ",") {
+		var p image.Point
+		if _, err := fmt.Sscanf(strings.TrimSpace(r), "%dx%d", &p.X, &p.Y); err != nil || p.X <= 0 || p.Y <= 0 {
+			return nil, fmt.Errorf("invalid resolution %q, expected WIDTHxHEIGHT", r)
+		}
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+func parseSensitivities(s string) ([]float64, error) {
+	sens := []float64{}
+	for _, v := range strings.Split(s, ",") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || f < 0 {
+			return nil, fmt.Errorf("invalid sensitivity %q, expected a minimum contour area", v)
+		}
+		sens = append(sens, f)
+	}
+	return sens, nil
+}
+
+func bench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	resolutions := fs.String("resolutions", "320x240,640x480,1280x720", "comma separated frame sizes to measure")
+	sensitivities := fs.String("sensitivities", fmt.Sprintf("%d,%d,%d", detector.VerySensitive, detector.DefaultSensitive, detector.NotSensitive), "comma separated minimum contour areas to measure")
+	frames := fs.Int("frames", 300, "number of frames to process per measurement")
+	fs.Parse(args)
+
+	res, err := parseResolutions(*resolutions)
+	if err != nil {
+		return err
+	}
+	sens, err := parseSensitivities(*sensitivities)
+	if err != nil {
+		return err
+	}
+	if *frames <= 0 {
+		return fmt.Errorf("frames must be positive")
+	}
+
+	// rows are printed as soon as they are measured, so columns are fixed width
+	fmt.Printf("%-12s %-12s %8s %12s %6s\n", "RESOLUTION", "SENSITIVITY", "FPS", "TIME/FRAME", "CPU")
+	for _, r := range res {
+		for _, s := range sens {
+			result, err := runBench(r, s, *frames)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-12s %-12v %8.1f %12s %5.0f%%\n", fmt.Sprintf("%dx%d", r.X, r.Y), s,
+				result.fps, result.perFrame.Round(time.Microsecond), result.cpu)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+)
+
+func calibrate(args []string) error {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	camera := fs.String("camera", "0", "camera ID, device path, e.g. /dev/v4l/by-id/..., or USB serial of the camera to calibrate")
+	duration := fs.Duration("duration", 3*time.Minute, "how long to watch the scene for, it should have no motion of interest meanwhile")
+	configPath := fs.String("config", "goaway.json", "configuration file to start from, if it exists, and to write the suggested configuration to")
+	yes := fs.Bool("y", false, "write the suggested configuration without asking")
+	fs.Parse(args)
+
+	config, err := detector.LoadConfig(*configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// zones suggested by an earlier calibration are replaced
+	zones := []detector.Zone{}
+	for _, z := range config.Zones {
+		if !strings.HasPrefix(z.Name, detector.CalibratedZonePrefix) {
+			zones = append(zones, z)
+		}
+	}
+	config.Zones = zones
+	threshold := config.Threshold
+	if threshold == 0 {
+		threshold = detector.DefaultThreshold
+	}
+	md, err := detector.NewMotionDetectorForDevice(*camera, "", nil, detector.WithConfig(config), detector.WithoutWindow())
+	if err != nil {
+		return err
+	}
+	defer md.Close()
+
+	fmt.Printf("watching camera %s for %s, keep the scene free of motion of interest...\n", *camera, *duration)
+	c, err := md.Calibrate(*duration)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nnoise measured on %d frames:\n%-22s %10s %8s\n", c.Frames, "CELL", "AREA", "ACTIVE")
+	for _, cell := range c.Cells {
+		fmt.Printf("%-22s %10.0f %7.0f%%\n", cell.Bounds, cell.Area, 100*cell.Active)
+	}
+	s := c.Suggested
+	fmt.Printf("\nsuggested sensitivity %.0f (was %.0f), threshold %.0f (was %.0f)\n",
+		s.Sensitivity, md.Sensitivity(), s.Threshold, threshold)
+	for _, z := range s.Zones[len(config.Zones):] {
+		fmt.Printf("suggested zone %s %s with sensitivity %.0f\n", z.Name, z.Bounds, z.MinArea)
+	}
+
+	if !*yes {
+		fmt.Printf("\nwrite the suggested configuration to %s? [y/N] ", *configPath)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return nil
+		}
+	}
+	if err := s.Save(*configPath); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s\n", *configPath)
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+func cleanup(args []string) error {
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	eventsDir := fs.String("events", "events", "directory of event records")
+	dir := fs.String("dir", ".", "storage directory the media was saved to")
+	keep := fs.Duration("keep", 0, "how long events without a retention class are kept for, e.g. 720h, forever when 0")
+	classes := fs.String("classes", "", "how long events of each retention class are kept for, e.g. person-at-night=2160h,daytime-vehicle=168h")
+	fs.Parse(args)
+
+	retention, err := parseRetention(*keep, *classes)
+	if err != nil {
+		return err
+	}
+	store, err := storage.NewDir(*dir)
+	if err != nil {
+		return err
+	}
+	records, err := events.NewDirStore(*eventsDir)
+	if err != nil {
+		return err
+	}
+	deleted, err := events.NewCleaner(records, store, retention).Clean(time.Now())
+	for _, r := range deleted {
+		fmt.Printf("deleted event %s (%s) and %d files\n", r.ID, retentionClass(r), len(r.Media))
+	}
+	return err
+}
+
+// parseRetention parses a comma separated list of class=duration pairs into
+// a retention, events of other classes are kept for keep
+func parseRetention(keep time.Duration, s string) (events.Retention, error) {
+	retention := events.Retention{Default: keep, Classes: map[string]time.Duration{}}
+	if s == "" {
+		return retention, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return retention, fmt.Errorf("invalid retention class %q, expected class=duration", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return retention, fmt.Errorf("invalid duration of retention class %s: %w", kv[0], err)
+		}
+		retention.Classes[strings.TrimSpace(kv[0])] = d
+	}
+	return retention, nil
+}
+
+// retentionClass returns the retention class of a record for display
+func retentionClass(r *events.Record) string {
+	if r.Retention == "" {
+		return "default retention"
+	}
+	return r.Retention
+}
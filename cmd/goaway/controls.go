@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/adrianosela/GoAway/audit"
+	"github.com/adrianosela/GoAway/detector"
+)
+
+func controls(args []string) error {
+	fs := flag.NewFlagSet("controls", flag.ExitOnError)
+	camera := fs.String("camera", "0", "camera ID, device path, e.g. /dev/v4l/by-id/..., or USB serial")
+	set := fs.String("set", "", "controls to set, e.g. auto_exposure=1,exposure=150,gain=0")
+	auditPath := fs.String("audit", "", "audit log to record the controls set in, e.g. audit.log")
+	fs.Parse(args)
+
+	values, err := parseControls(*set)
+	if err != nil {
+		return err
+	}
+	md, err := detector.NewMotionDetectorForDevice(*camera, "", nil, detector.WithCameraControls(values), detector.WithoutWindow())
+	if err != nil {
+		return err
+	}
+	defer md.Close()
+	for c, v := range values {
+		if err := recordCLI(*auditPath, audit.ActionSetControl, *camera, fmt.Sprintf("%s=%g", c, v)); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%-20s %s\n", "CONTROL", "VALUE")
+	for _, c := range detector.CameraControls {
+		v, err := md.CameraControl(c)
+		if err != nil {
+			fmt.Printf("%-20s %s\n", c, err)
+			continue
+		}
+		fmt.Printf("%-20s %g\n", c, v)
+	}
+	return nil
+}
+
+// recordCLI records an action taken from the command line in the audit log
+// at path, if any, under the name of the user running the command
+func recordCLI(path, action, camera, detail string) error {
+	if path == "" {
+		return nil
+	}
+	l, err := audit.Open(path)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	actor := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		actor = u.Username
+	}
+	return l.Record(audit.Entry{Action: action, Source: audit.SourceCLI, Actor: actor, Camera: camera, Detail: detail})
+}
+
+// parseControls parses a comma separated list of control=value pairs
+func parseControls(s string) (map[detector.CameraControl]float64, error) {
+	values := map[detector.CameraControl]float64{}
+	if s == "" {
+		return values, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid control %q, expected control=value", pair)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of control %s: %w", kv[0], err)
+		}
+		values[detector.CameraControl(strings.TrimSpace(kv[0]))] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/adrianosela/GoAway/cluster"
+	"github.com/adrianosela/GoAway/events"
+)
+
+func deadLetters(args []string) error {
+	fs := flag.NewFlagSet("dead-letters", flag.ExitOnError)
+	dir := fs.String("dir", "spool/dead-letters", "directory of the agent's dead letters")
+	spoolDir := fs.String("spool", "spool/events", "directory of the agent's event queue, replayed events are queued there")
+	replay := fs.String("replay", "", "ID of the event to replay, or all")
+	fs.Parse(args)
+
+	letters, err := cluster.NewDeadLetters(*dir)
+	if err != nil {
+		return err
+	}
+	list, err := letters.List()
+	if err != nil {
+		return err
+	}
+	if *replay == "" {
+		fmt.Printf("%-30s %-20s %8s  %-15s %s\n", "EVENT", "GAVE UP", "ATTEMPTS", "NOTIFIERS", "ERROR")
+		for _, l := range list {
+			notifiers := strings.Join(l.Notifiers, ",")
+			if notifiers == "" {
+				notifiers = "-"
+			}
+			fmt.Printf("%-30s %-20s %8d  %-15s %s\n", l.Record.ID, l.Time.Format("2006-01-02 15:04:05"), l.Attempts, notifiers, l.Error)
+		}
+		return nil
+	}
+
+	spool, err := events.NewDirStore(*spoolDir)
+	if err != nil {
+		return err
+	}
+	ids := []string{*replay}
+	if strings.EqualFold(*replay, "all") {
+		ids = []string{}
+		for _, l := range list {
+			if len(l.Notifiers) == 0 {
+				ids = append(ids, l.Record.ID)
+			}
+		}
+	}
+	for _, id := range ids {
+		if err := letters.Replay(id, spool); err != nil {
+			return fmt.Errorf("could not replay event %s: %w", id, err)
+		}
+		fmt.Printf("queued event %s, the agent uploads it on its next retry\n", id)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/adrianosela/GoAway/storage"
+)
+
+func decrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	keyFile := fs.String("key-file", "", "file with the hex encoded encryption key (required)")
+	out := fs.String("o", "-", "file to write the decrypted footage to, - for stdout")
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: goaway decrypt -key-file <key> [-o <out>] <file>\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *keyFile == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a key file and a single file to decrypt are required")
+	}
+
+	key, err := storage.ReadKeyFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	r, err := storage.Decrypt(f, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w := io.Writer(os.Stdout)
+	if *out != "-" {
+		o, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer o.Close()
+		w = o
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
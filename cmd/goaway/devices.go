@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrianosela/GoAway/v4l2"
+)
+
+func devices(args []string) error {
+	fs := flag.NewFlagSet("devices", flag.ExitOnError)
+	fs.Parse(args)
+
+	found, err := v4l2.Devices()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-4s %-14s %-28s %-16s %s\n", "ID", "DEVICE", "NAME", "SERIAL", "BY-ID")
+	for _, d := range found {
+		ids := []string{}
+		for _, link := range d.IDs {
+			ids = append(ids, filepath.Base(link))
+		}
+		serial := d.Serial
+		if serial == "" {
+			serial = "-"
+		}
+		fmt.Printf("%-4d %-14s %-28s %-16s %s\n", d.Index, d.Path, d.Name, serial, strings.Join(ids, " "))
+	}
+	return nil
+}
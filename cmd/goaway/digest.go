@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/adrianosela/GoAway/clips"
+	"github.com/adrianosela/GoAway/digest"
+	"github.com/adrianosela/GoAway/events"
+)
+
+func makeDigest(args []string) error {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	eventsDir := fs.String("events", "events", "directory of event records")
+	dir := fs.String("dir", ".", "storage directory the media was saved to, the digest is stored there too")
+	keyFile := fs.String("key-file", "", "file with the hex encoded encryption key, if the media is encrypted")
+	camera := fs.String("camera", "", "camera whose events are digested, all cameras' when empty")
+	period := fs.Duration("period", 24*time.Hour, "period up to now whose events are digested")
+	perEvent := fs.Duration("per-event", digest.DefaultPerEvent, "length of the part of each event's clip in the video")
+	width := fs.Int("width", clips.DefaultConcatWidth, "width of the video")
+	ffmpeg := fs.String("ffmpeg", "ffmpeg", "path of the ffmpeg binary")
+	codec := fs.String("codec", string(clips.H264), "codec of the video: h264 or h265")
+	noVideo := fs.Bool("no-video", false, "only summarize the events, without a video")
+	fs.Parse(args)
+
+	store, err := openStorage(*dir, *keyFile)
+	if err != nil {
+		return err
+	}
+	records, err := events.NewDirStore(*eventsDir)
+	if err != nil {
+		return err
+	}
+	end := time.Now()
+	record, err := digest.Make(context.Background(), records, store, end.Add(-*period), end, digest.Options{
+		Camera:   *camera,
+		PerEvent: *perEvent,
+		Width:    *width,
+		Encoder:  clips.EncoderOptions{FFmpeg: *ffmpeg, Codec: clips.Codec(*codec)},
+		NoVideo:  *noVideo,
+	})
+	if err != nil {
+		return err
+	}
+	s := record.Summary
+	fmt.Printf("%d events from %s to %s\n", s.Events, s.Start.Format("2006-01-02 15:04"), s.End.Format("2006-01-02 15:04"))
+	for _, counts := range []map[string]int{s.Cameras, s.Classes} {
+		names := []string{}
+		for name := range counts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  %-20s %d\n", name, counts[name])
+		}
+	}
+	if s.BusiestHour >= 0 {
+		fmt.Printf("busiest hour: %02d:00\n", s.BusiestHour)
+	}
+	for _, obj := range record.Media {
+		fmt.Printf("video: %s\n", obj.Name)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/export"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+func exportEvents(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "", "layout to export to: motioneye or frigate (required without -event)")
+	event := fs.String("event", "", "ID of an event to export as an incident bundle, a zip of its media, record, hashes and summary")
+	eventsDir := fs.String("events", "events", "directory of event records")
+	dir := fs.String("dir", ".", "storage directory the media was saved to")
+	keyFile := fs.String("key-file", "", "file with the hex encoded encryption key, if the media is encrypted")
+	camera := fs.String("camera", "goaway", "camera name for events recorded without one (frigate)")
+	out := fs.String("o", "", "directory to export to, or zip file with -event (required)")
+	fs.Parse(args)
+	if *event != "" {
+		return exportBundle(*event, *eventsDir, *dir, *keyFile, *out)
+	}
+
+	var layout export.Layout
+	switch *format {
+	case "motioneye":
+		layout = export.MotionEye{}
+	case "frigate":
+		layout = export.Frigate{Camera: *camera}
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if *out == "" {
+		fs.Usage()
+		return errors.New("a directory to export to is required")
+	}
+
+	store, err := openStorage(*dir, *keyFile)
+	if err != nil {
+		return err
+	}
+	records, err := events.NewDirStore(*eventsDir)
+	if err != nil {
+		return err
+	}
+	list, err := records.List()
+	if err != nil {
+		return err
+	}
+	if err := export.Export(list, store, layout, *out); err != nil {
+		return err
+	}
+	fmt.Printf("exported %d events to %s\n", len(list), *out)
+	return nil
+}
+
+// exportBundle writes the incident bundle of an event to a zip file
+func exportBundle(id, eventsDir, dir, keyFile, out string) error {
+	if out == "" {
+		return errors.New("a zip file to export to is required")
+	}
+	store, err := openStorage(dir, keyFile)
+	if err != nil {
+		return err
+	}
+	records, err := events.NewDirStore(eventsDir)
+	if err != nil {
+		return err
+	}
+	record, err := records.Get(id)
+	if err != nil {
+		return fmt.Errorf("could not read event %s: %w", id, err)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := export.Bundle(f, record, store, time.Now()); err != nil {
+		f.Close()
+		os.Remove(out)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("exported event %s to %s\n", id, out)
+	return nil
+}
+
+// openStorage opens a storage directory, decrypting with the key in the key
+// file, if any
+func openStorage(dir, keyFile string) (*storage.Dir, error) {
+	opts := []storage.Option{}
+	if keyFile != "" {
+		key, err := storage.ReadKeyFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, storage.WithEncryptionKey(key))
+	}
+	return storage.NewDir(dir, opts...)
+}
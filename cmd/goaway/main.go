@@ -0,0 +1,56 @@
+// Command goaway is a command line tool for running and operating GoAway
+// motion detectors
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// command is a goaway subcommand
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{name: "bench", usage: "measure achievable frame rates and CPU usage on this machine", run: bench},
+	{name: "calibrate", usage: "measure a camera's noise and suggest a configuration for it", run: calibrate},
+	{name: "cleanup", usage: "delete stored events, and their media, whose retention expired", run: cleanup},
+	{name: "controls", usage: "show or set a camera's exposure, gain, white balance and other controls", run: controls},
+	{name: "dead-letters", usage: "list the events an edge agent or the notifiers gave up on, or replay uploads", run: deadLetters},
+	{name: "decrypt", usage: "decrypt a snapshot or clip stored with an encryption key", run: decrypt},
+	{name: "devices", usage: "list the video capture devices on Linux, with their serials and persistent paths", run: devices},
+	{name: "digest", usage: "make a video of the day's events, and count them by camera", run: makeDigest},
+	{name: "export", usage: "export stored events in a motionEye or Frigate compatible layout, or an incident bundle", run: exportEvents},
+	{name: "selftest", usage: "check camera access, frame rate, disk write speed and notifiers", run: selftest},
+	{name: "v4l2", usage: "list or set the raw V4L2 controls of a camera on Linux", run: v4l2Controls},
+	{name: "verify", usage: "verify the hashes and signatures of an event's stored media", run: verify},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: goaway <command> [flags]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun `goaway <command> -h` for a command's flags\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "goaway %s: %s\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+	os.Exit(2)
+}
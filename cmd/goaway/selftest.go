@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/notify"
+	"github.com/adrianosela/GoAway/plugins"
+)
+
+// selftestWriteSize is the amount of data written to measure the disk's
+// write speed
+const selftestWriteSize = 64 << 20
+
+// check is the outcome of a self-test check
+type check struct {
+	name   string
+	err    error
+	detail string
+}
+
+func selftest(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	camera := fs.String("camera", "0", "camera ID, device path, e.g. /dev/v4l/by-id/..., or USB serial of the camera to test")
+	configPath := fs.String("config", "goaway.json", "configuration file of the camera, if it exists")
+	duration := fs.Duration("duration", 5*time.Second, "how long to measure the frame rate for")
+	minFPS := fs.Float64("min-fps", 10, "minimum frame rate to pass")
+	dir := fs.String("dir", "recordings", "recording directory to measure the write speed of")
+	minWrite := fs.Float64("min-write", 5, "minimum write speed to pass, in MB/s")
+	notifiersPath := fs.String("notifiers", "", "notifiers file (see plugins.LoadNotifiers) whose notifiers are sent a test message")
+	fs.Parse(args)
+
+	checks := []check{}
+	checks = append(checks, checkCamera(*camera, *configPath, *duration, *minFPS)...)
+	checks = append(checks, checkDisk(*dir, *minWrite))
+	if *notifiersPath != "" {
+		checks = append(checks, checkNotifiers(*notifiersPath)...)
+	}
+
+	failed := 0
+	fmt.Printf("%-28s %-6s %s\n", "CHECK", "RESULT", "DETAIL")
+	for _, c := range checks {
+		result, detail := "PASS", c.detail
+		if c.err != nil {
+			result, detail = "FAIL", c.err.Error()
+			failed++
+		}
+		fmt.Printf("%-28s %-6s %s\n", c.name, result, detail)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// checkCamera opens the camera, waits for its first frame and measures its
+// frame rate
+func checkCamera(device string, configPath string, duration time.Duration, minFPS float64) []check {
+	access := check{name: "camera " + device}
+	rate := check{name: "frame rate"}
+	// fail fails camera access, the frame rate can't be measured then
+	fail := func(err error) []check {
+		access.err, rate.err = err, errors.New("camera not tested")
+		return []check{access, rate}
+	}
+	config, err := detector.LoadConfig(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fail(err)
+	}
+	start := time.Now()
+	md, err := detector.NewMotionDetectorForDevice(device, "", nil, detector.WithConfig(config), detector.WithoutWindow())
+	if err != nil {
+		return fail(err)
+	}
+	defer md.Close()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- md.Start()
+	}()
+
+	// the first frame can take a while as the camera adjusts its exposure
+	for md.Stats().Frames == 0 {
+		select {
+		case err := <-stopped:
+			if err == nil {
+				err = errors.New("camera stopped before its first frame")
+			}
+			return fail(err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Since(start) > 10*time.Second {
+			return fail(errors.New("no frame within 10s"))
+		}
+	}
+	first := md.Stats()
+	size := md.FrameInfo().Size
+	access.detail = fmt.Sprintf("first frame after %s, %dx%d", time.Since(start).Round(time.Millisecond), size.X, size.Y)
+	measureStart := time.Now()
+	select {
+	case err := <-stopped:
+		if err == nil {
+			err = errors.New("camera stopped while measuring")
+		}
+		rate.err = err
+		return []check{access, rate}
+	case <-time.After(duration):
+	}
+	fps := float64(md.Stats().Frames-first.Frames) / time.Since(measureStart).Seconds()
+	rate.detail = fmt.Sprintf("%.1f fps (minimum %g)", fps, minFPS)
+	if fps < minFPS {
+		rate.err = errors.New(rate.detail)
+	}
+	return []check{access, rate}
+}
+
+// checkDisk measures the write speed of the recording directory, synced to
+// the disk
+func checkDisk(dir string, minWrite float64) check {
+	c := check{name: "disk write " + filepath.Clean(dir)}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		c.err = err
+		return c
+	}
+	f, err := os.CreateTemp(dir, ".goaway-selftest-*")
+	if err != nil {
+		c.err = err
+		return c
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	// random data, as some filesystems compress
+	buf := make([]byte, 1<<20)
+	rand.Read(buf)
+	start := time.Now()
+	for written := 0; written < selftestWriteSize; written += len(buf) {
+		if _, err := f.Write(buf); err != nil {
+			c.err = err
+			return c
+		}
+	}
+	if err := f.Sync(); err != nil {
+		c.err = err
+		return c
+	}
+	speed := selftestWriteSize / float64(1<<20) / time.Since(start).Seconds()
+	c.detail = fmt.Sprintf("%.1f MB/s (minimum %g)", speed, minWrite)
+	if speed < minWrite {
+		c.err = errors.New(c.detail)
+	}
+	return c
+}
+
+// checkNotifiers sends a simulated event to every configured notifier
+func checkNotifiers(path string) []check {
+	configs, err := plugins.LoadNotifiers(path)
+	if err != nil {
+		return []check{{name: "notifiers", err: err}}
+	}
+	checks := []check{}
+	for _, nc := range configs {
+		c := check{name: "notifier " + nc.Name}
+		n, err := plugins.NewNotifier(nc.Plugin, nc.Config)
+		if err != nil {
+			c.err = err
+			checks = append(checks, c)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		start := time.Now()
+		if c.err = n.Notify(ctx, notify.SimulatedEvent("selftest")); c.err == nil {
+			c.detail = fmt.Sprintf("test message sent in %s", time.Since(start).Round(time.Millisecond))
+		}
+		cancel()
+		checks = append(checks, c)
+	}
+	return checks
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adrianosela/GoAway/audit"
+	"github.com/adrianosela/GoAway/v4l2"
+)
+
+func v4l2Controls(args []string) error {
+	fs := flag.NewFlagSet("v4l2", flag.ExitOnError)
+	camera := fs.Int("camera", 0, "ID of the camera, whose device is /dev/video<ID>")
+	device := fs.String("device", "", "device path, e.g. /dev/v4l/by-id/..., or USB serial of the camera, instead of its ID")
+	set := fs.String("set", "", "controls to set by name or ID, e.g. power_line_frequency=1,0x009a0901=0")
+	auditPath := fs.String("audit", "", "audit log to record the controls set in, e.g. audit.log")
+	fs.Parse(args)
+
+	path := v4l2.DevicePath(*camera)
+	if *device != "" {
+		info, err := v4l2.Resolve(*device)
+		if err != nil {
+			return err
+		}
+		path = info.Path
+	}
+	dev, err := v4l2.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+	if *set != "" {
+		for _, pair := range strings.Split(*set, ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("invalid control %q, expected control=value", pair)
+			}
+			v, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 0, 32)
+			if err != nil {
+				return fmt.Errorf("invalid value of control %s: %w", kv[0], err)
+			}
+			if err := dev.Set(strings.TrimSpace(kv[0]), int32(v)); err != nil {
+				return err
+			}
+			if err := recordCLI(*auditPath, audit.ActionSetControl, path, fmt.Sprintf("%s=%d", strings.TrimSpace(kv[0]), v)); err != nil {
+				return err
+			}
+		}
+	}
+	controls, err := dev.Controls()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-32s %-10s %-8s %-8s %s\n", "CONTROL", "ID", "TYPE", "VALUE", "RANGE")
+	for _, c := range controls {
+		value := "-"
+		if c.Type != v4l2.TypeButton && c.Type != v4l2.TypeInteger64 && c.Type != v4l2.TypeString {
+			if v, err := dev.Get(fmt.Sprint(c.ID)); err == nil {
+				value = fmt.Sprint(v)
+			}
+		}
+		if c.Inactive {
+			value += " (inactive)"
+		}
+		fmt.Printf("%-32s 0x%08x %-8s %-8s %s\n", c.Name, c.ID, c.Type, value, controlRange(c))
+	}
+	return nil
+}
+
+// controlRange describes the values a control takes
+func controlRange(c v4l2.Control) string {
+	if len(c.Menu) > 0 {
+		indexes := []int{}
+		for i := range c.Menu {
+			indexes = append(indexes, int(i))
+		}
+		sort.Ints(indexes)
+		items := []string{}
+		for _, i := range indexes {
+			items = append(items, fmt.Sprintf("%d=%s", i, c.Menu[int32(i)]))
+		}
+		return fmt.Sprintf("%s (default %d)", strings.Join(items, " "), c.Default)
+	}
+	return fmt.Sprintf("%d..%d step %d (default %d)", c.Min, c.Max, c.Step, c.Default)
+}
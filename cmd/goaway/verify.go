@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+func verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	recordFile := fs.String("record", "", "event record (json) listing the media to verify (required)")
+	dir := fs.String("dir", ".", "storage directory the media was saved to")
+	keyFile := fs.String("key-file", "", "file with the hex encoded encryption key, if the media is encrypted")
+	pubKeyFile := fs.String("pubkey-file", "", "PEM encoded Ed25519 public key to check signatures with")
+	fs.Parse(args)
+	if *recordFile == "" {
+		fs.Usage()
+		return errors.New("an event record is required")
+	}
+
+	data, err := os.ReadFile(*recordFile)
+	if err != nil {
+		return err
+	}
+	var record events.Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return fmt.Errorf("invalid event record: %w", err)
+	}
+	opts := []storage.Option{}
+	if *keyFile != "" {
+		key, err := storage.ReadKeyFile(*keyFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, storage.WithEncryptionKey(key))
+	}
+	var pub ed25519.PublicKey
+	if *pubKeyFile != "" {
+		if pub, err = storage.ReadPublicKeyFile(*pubKeyFile); err != nil {
+			return err
+		}
+	}
+	store, err := storage.NewDir(*dir, opts...)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, obj := range record.Media {
+		if err := verifyObject(store, obj, pub); err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %s\n", obj.Name, err)
+			continue
+		}
+		fmt.Printf("OK    %s\n", obj.Name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, len(record.Media))
+	}
+	return nil
+}
+
+func verifyObject(store storage.Storage, obj storage.Object, pub ed25519.PublicKey) error {
+	r, err := store.Open(obj.Name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return obj.Verify(r, pub)
+}
@@ -0,0 +1,103 @@
+// Package daynight switches motion detectors between day and night profiles
+// at civil twilight, computed from the camera's latitude and longitude
+package daynight
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/audit"
+	"github.com/adrianosela/GoAway/detector"
+)
+
+// checkInterval is how often the scheduler checks whether it is day or night
+const checkInterval = time.Minute
+
+// Scheduler applies the day profile to a detector between civil dawn and
+// dusk and the night profile otherwise, unless a profile is forced
+type Scheduler struct {
+	mu       sync.Mutex
+	detector *detector.Detector
+	lat, lon float64
+	day      detector.Profile
+	night    detector.Profile
+	override *detector.Profile
+	audit    *audit.Log
+}
+
+// Option configures optional behaviour of a Scheduler
+type Option func(*Scheduler)
+
+// WithAuditLog records every profile switch in the given audit log
+func WithAuditLog(l *audit.Log) Option {
+	return func(s *Scheduler) {
+		s.audit = l
+	}
+}
+
+// NewScheduler is the constructor for a Scheduler, the latitude and longitude
+// are in degrees, north and east positive
+func NewScheduler(d *detector.Detector, lat, lon float64, day, night detector.Profile, opts ...Option) *Scheduler {
+	s := &Scheduler{detector: d, lat: lat, lon: lon, day: day, night: night}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Override forces a profile regardless of the time of day, e.g. the night
+// profile on a dark stormy afternoon, until the override is cleared with nil.
+// The source of the override, e.g. audit.SourceAPI, is recorded in the
+// audit log
+func (s *Scheduler) Override(p *detector.Profile, source string) {
+	s.mu.Lock()
+	s.override = p
+	s.mu.Unlock()
+	s.apply(time.Now(), source)
+}
+
+// Run applies the profile for the time of day until the context is done
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		s.apply(time.Now(), audit.SourceSchedule)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// current returns the profile which should be applied at the given time
+func (s *Scheduler) current(t time.Time) detector.Profile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.override != nil {
+		return *s.override
+	}
+	if IsDay(t, s.lat, s.lon) {
+		return s.day
+	}
+	return s.night
+}
+
+// apply switches the detector to the profile for the given time if it isn't
+// already using it
+func (s *Scheduler) apply(t time.Time, source string) {
+	p := s.current(t)
+	if s.detector.Profile() == p.Name {
+		return
+	}
+	s.detector.ApplyProfile(p)
+	if s.audit == nil {
+		return
+	}
+	err := s.audit.Record(audit.Entry{Action: audit.ActionSetProfile, Source: source, Detail: p.Name})
+	if err != nil {
+		log.Printf("could not record profile switch in audit log: %s", err)
+	}
+}
@@ -0,0 +1,69 @@
+package daynight
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// civilTwilight is the elevation of the sun's center at civil dawn and
+	// dusk, in degrees
+	civilTwilight = -6.0
+
+	julianUnixEpoch = 2440587.5
+	julian2000      = 2451545.0
+)
+
+func toJulian(t time.Time) float64 {
+	return float64(t.Unix())/86400 + julianUnixEpoch
+}
+
+func fromJulian(j float64) time.Time {
+	return time.Unix(int64(math.Round((j-julianUnixEpoch)*86400)), 0).UTC()
+}
+
+func sin(deg float64) float64 { return math.Sin(deg * math.Pi / 180) }
+func cos(deg float64) float64 { return math.Cos(deg * math.Pi / 180) }
+
+// CivilTwilight returns the times of civil dawn and dusk, when the sun is 6
+// degrees below the horizon, on the given day (UTC) at the given latitude
+// and longitude (degrees, north and east positive). Near the poles, where
+// the sun may not cross that elevation, polarDay reports whether it stays
+// above it all day, and dawn and dusk are zero
+func CivilTwilight(day time.Time, lat, lon float64) (dawn, dusk time.Time, polarDay bool) {
+	// the sunrise equation, see https://en.wikipedia.org/wiki/Sunrise_equation
+	day = day.UTC()
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	n := math.Ceil(toJulian(midnight) - julian2000 + 0.0008)
+	meanNoon := n - lon/360
+	anomaly := math.Mod(357.5291+0.98560028*meanNoon, 360)
+	center := 1.9148*sin(anomaly) + 0.02*sin(2*anomaly) + 0.0003*sin(3*anomaly)
+	longitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := julian2000 + meanNoon + 0.0053*sin(anomaly) - 0.0069*sin(2*longitude)
+	declination := math.Asin(sin(longitude)*sin(23.4397)) * 180 / math.Pi
+	cosHourAngle := (sin(civilTwilight) - sin(lat)*sin(declination)) / (cos(lat) * cos(declination))
+	switch {
+	case cosHourAngle < -1:
+		return time.Time{}, time.Time{}, true
+	case cosHourAngle > 1:
+		return time.Time{}, time.Time{}, false
+	}
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+	return fromJulian(transit - hourAngle/360), fromJulian(transit + hourAngle/360), false
+}
+
+// IsDay returns whether it is between civil dawn and dusk at the given time
+// and place
+func IsDay(t time.Time, lat, lon float64) bool {
+	// the local day may span two UTC days, so check the days around it
+	for offset := -1; offset <= 1; offset++ {
+		dawn, dusk, polarDay := CivilTwilight(t.UTC().AddDate(0, 0, offset), lat, lon)
+		if offset == 0 && dawn.IsZero() {
+			return polarDay
+		}
+		if !t.Before(dawn) && t.Before(dusk) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package detector
+
+import (
+	"image"
+	"image/color"
+)
+
+// backend is the frame processing implementation behind a Detector. The
+// default backend is built on OpenCV (gocv), building with the "purego" tag
+// selects a slower but dependency free implementation using only the
+// standard library's image package
+type backend interface {
+	// readFrame blocks until the next non-empty frame has been read into a
+	// staging buffer, it must not touch the current frame
+	readFrame() error
+	// grabFrame reads the next non-empty frame into a new buffer rather
+	// than the staging one, so that frames can be read while others are
+	// processed, see WithFrameQueue. stageFrame makes a grabbed frame the
+	// staging one, as if readFrame had read it, and discardFrame releases a
+	// grabbed frame which was dropped
+	grabFrame() (interface{}, error)
+	stageFrame(frame interface{})
+	discardFrame(frame interface{})
+	// prepareCurrentFrame makes the last frame read the current frame, hides
+	// its privacy zones and computes its foreground mask, excluding them.
+	// Pixels differing from the background by more than the threshold are
+	// foreground. It returns whether the night processing was used
+	prepareCurrentFrame(p frameParams) bool
+	// findContours returns the regions of the foreground mask which cover
+	// an area of at least minArea, along with the total area of the smaller
+	// ones, which is noise
+	findContours(minArea float64) ([]region, float64)
+	// drawRegion outlines a region on the current frame
+	drawRegion(r region, c color.RGBA)
+	// displayResult renders the status onto the current frame, runs the
+	// frame hook, if any, and shows it, it returns true if the user asked
+	// for the detector to stop
+	displayResult(status string, c color.RGBA, info FrameInfo) bool
+	// sampleFrame appends the brightness of a sample of the pixels of the
+	// last frame read, see sampleBrightness, to dst. Frames which can't be
+	// sampled have no samples
+	sampleFrame(dst []uint8) []uint8
+	// brightness returns the mean brightness of the current frame, out of
+	// 255, before the night processing
+	brightness() float64
+	// frameSize returns the size of the current frame, zero before the
+	// first frame has been processed
+	frameSize() image.Point
+	// snapshotJPG appends the crop of the current frame, resized to the
+	// given size, encoded as a jpg, to dst and returns the extended buffer.
+	// The crop is within the frame and the size is no larger than the crop
+	snapshotJPG(dst []byte, crop image.Rectangle, size image.Point) ([]byte, error)
+	// setControl and control set and get a camera control, of the camera or
+	// of a ControllableSource
+	setControl(c CameraControl, value float64) error
+	control(c CameraControl) (float64, error)
+	// reopenCamera closes the camera and opens the one with the given ID,
+	// after it was disconnected, the background is learned again
+	reopenCamera(camID int) error
+	// suspend stops capture while the detector sleeps, closing the camera
+	// or suspending a SuspendableSource, see WithSleepMode. Suspended
+	// cameras are opened again with reopenCamera, and sources resumed with
+	// resume, after which the background is learned again
+	suspend() error
+	resume() error
+	// memStats reports the memory held by the backend's frame buffers
+	memStats() MemStats
+	// close releases all the resources held by the backend, returning an
+	// error for each resource which could not be closed
+	close() []error
+}
+
+// region is an area of a frame in which motion was detected
+type region struct {
+	bounds image.Rectangle
+	area   float64
+	// contour is the outline of the region, or, when the backend doesn't
+	// trace outlines, any points with the same convex hull
+	contour []image.Point
+}
+
+// backendConfig holds the detector options which backends are built with
+type backendConfig struct {
+	winTitle     string
+	noWindow     bool
+	privacyZones []Zone
+	privacyMode  PrivacyMode
+	maxShift     int
+	fisheye      *Fisheye
+	frameHook    FrameHook
+	workers      *workerPool
+	slowSubjects bool
+}
@@ -0,0 +1,551 @@
+//go:build !purego
+// +build !purego
+
+package detector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// display shows annotated frames to the user, the OpenCV window is only
+// compiled in when the "nogui" build tag is not set
+type display interface {
+	// show displays a frame, it returns true if the user asked to quit
+	show(img gocv.Mat) bool
+	close() error
+}
+
+// headless is the display used when the window is disabled, frames are
+// never shown so the detector only stops when its camera or source does
+type headless struct{}
+
+func (headless) show(img gocv.Mat) bool {
+	return false
+}
+
+func (headless) close() error {
+	return nil
+}
+
+type gocvBackend struct {
+	cfg           backendConfig
+	camera        *gocv.VideoCapture
+	source        Source
+	window        display
+	readMatrix    gocv.Mat
+	baseImgMatrix gocv.Mat
+	diffMatrix    gocv.Mat
+	threshMatrix  gocv.Mat
+	nightMatrix   gocv.Mat
+	preMatrix     gocv.Mat
+	night         bool
+	// lastBrightness is the mean brightness of the current frame
+	lastBrightness float64
+	grayMatrix     gocv.Mat
+	refMatrix      gocv.Mat
+	matchMatrix    gocv.Mat
+	mapX, mapY     gocv.Mat
+	bgSubtractor   gocv.BackgroundSubtractorMOG2
+	// resizeMatrix is the resized frame of the last snapshot
+	resizeMatrix gocv.Mat
+	// kernel is the structuring element foreground masks are dilated with
+	kernel gocv.Mat
+	// privacy are the bounds of the privacy zones within frames of
+	// privacySize and privacyMask masks them out of foreground masks, they
+	// are computed again when the frame size changes
+	privacy     []image.Rectangle
+	privacySize image.Point
+	privacyMask gocv.Mat
+	// suspended is whether the camera was closed while the detector sleeps
+	suspended bool
+}
+
+func newGocvBackend(cam *gocv.VideoCapture, src Source, cfg backendConfig) *gocvBackend {
+	var window display = headless{}
+	if !cfg.noWindow {
+		window = newDisplay(cfg.winTitle)
+	}
+	return &gocvBackend{
+		cfg:           cfg,
+		camera:        cam,
+		source:        src,
+		window:        window,
+		readMatrix:    gocv.NewMat(),
+		baseImgMatrix: gocv.NewMat(),
+		diffMatrix:    gocv.NewMat(),
+		threshMatrix:  gocv.NewMat(),
+		nightMatrix:   gocv.NewMat(),
+		preMatrix:     gocv.NewMat(),
+		grayMatrix:    gocv.NewMat(),
+		refMatrix:     gocv.NewMat(),
+		matchMatrix:   gocv.NewMat(),
+		mapX:          gocv.NewMat(),
+		mapY:          gocv.NewMat(),
+		bgSubtractor:  gocv.NewBackgroundSubtractorMOG2(),
+		kernel:        gocv.GetStructuringElement(gocv.MorphRect, image.Pt(3, 3)),
+		privacyMask:   gocv.NewMat(),
+		resizeMatrix:  gocv.NewMat(),
+	}
+}
+
+func newCameraBackend(camID int, cfg backendConfig) (backend, error) {
+	cam, err := gocv.OpenVideoCapture(camID)
+	if err != nil {
+		return nil, err
+	}
+	return newGocvBackend(cam, nil, cfg), nil
+}
+
+func newSourceBackend(src Source, cfg backendConfig) (backend, error) {
+	return newGocvBackend(nil, src, cfg), nil
+}
+
+func (b *gocvBackend) readSourceFrame() error {
+	img, err := b.source.Read()
+	if err != nil {
+		return err
+	}
+	mat, err := gocv.ImageToMatRGB(img)
+	if err != nil {
+		return err
+	}
+	b.readMatrix.Close()
+	b.readMatrix = mat
+	return nil
+}
+
+func (b *gocvBackend) readFrame() error {
+	for {
+		if b.source != nil {
+			if err := b.readSourceFrame(); err != nil {
+				return err
+			}
+		} else if ok := b.camera.Read(&b.readMatrix); !ok {
+			return fmt.Errorf("Video Device Closed")
+		}
+		if !b.readMatrix.Empty() {
+			return nil
+		}
+	}
+}
+
+func (b *gocvBackend) grabFrame() (interface{}, error) {
+	for {
+		var mat gocv.Mat
+		if b.source != nil {
+			img, err := b.source.Read()
+			if err != nil {
+				return nil, err
+			}
+			if mat, err = gocv.ImageToMatRGB(img); err != nil {
+				return nil, err
+			}
+		} else {
+			mat = gocv.NewMat()
+			if ok := b.camera.Read(&mat); !ok {
+				mat.Close()
+				return nil, fmt.Errorf("Video Device Closed")
+			}
+		}
+		if !mat.Empty() {
+			return mat, nil
+		}
+		mat.Close()
+	}
+}
+
+func (b *gocvBackend) stageFrame(frame interface{}) {
+	b.readMatrix.Close()
+	b.readMatrix = frame.(gocv.Mat)
+}
+
+func (b *gocvBackend) discardFrame(frame interface{}) {
+	mat := frame.(gocv.Mat)
+	mat.Close()
+}
+
+// hidePrivacyZones blacks out or pixelates the privacy zones of the
+// current frame
+func (b *gocvBackend) hidePrivacyZones(rects []image.Rectangle) {
+	for _, r := range rects {
+		if b.cfg.privacyMode == PrivacyBlackout {
+			gocv.Rectangle(&b.baseImgMatrix, r, color.RGBA{0, 0, 0, 0}, -1)
+			continue
+		}
+		zone := b.baseImgMatrix.Region(r)
+		small := gocv.NewMat()
+		blocks := image.Pt((r.Dx()+pixelateBlockSize-1)/pixelateBlockSize, (r.Dy()+pixelateBlockSize-1)/pixelateBlockSize)
+		gocv.Resize(zone, &small, blocks, 0, 0, gocv.InterpolationArea)
+		// the zone shares its data with the frame, so this writes the
+		// pixelated zone back into the frame
+		gocv.Resize(small, &zone, r.Size(), 0, 0, gocv.InterpolationNearestNeighbor)
+		small.Close()
+		zone.Close()
+	}
+}
+
+// floatMat returns a single channel matrix of 32-bit floats
+func floatMat(rows, cols int, data []float32) (gocv.Mat, error) {
+	buf := make([]byte, 4*len(data))
+	for i, f := range data {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return gocv.NewMatFromBytes(rows, cols, gocv.MatTypeCV32F, buf)
+}
+
+// dewarp de-warps the current frame, the remap tables are computed on the
+// first frame and whenever the frame size changes
+func (b *gocvBackend) dewarp() {
+	size := b.frameSize()
+	if b.mapX.Cols() != size.X || b.mapX.Rows() != size.Y {
+		f := b.cfg.fisheye.scaled(size)
+		xs, ys := f.remapTable()
+		mapX, err := floatMat(size.Y, size.X, xs)
+		if err != nil {
+			return
+		}
+		mapY, err := floatMat(size.Y, size.X, ys)
+		if err != nil {
+			mapX.Close()
+			return
+		}
+		b.mapX.Close()
+		b.mapY.Close()
+		b.mapX, b.mapY = mapX, mapY
+	}
+	// the read matrix is free until the next frame is read
+	gocv.Remap(b.baseImgMatrix, &b.readMatrix, &b.mapX, &b.mapY, gocv.InterpolationLinear, gocv.BorderConstant, color.RGBA{})
+	b.baseImgMatrix, b.readMatrix = b.readMatrix, b.baseImgMatrix
+}
+
+// stabilize shifts the current frame to align it with the previous one, the
+// shift is found by matching the center of the previous frame within the
+// current one
+func (b *gocvBackend) stabilize() {
+	s := b.cfg.maxShift
+	gocv.CvtColor(b.baseImgMatrix, &b.grayMatrix, gocv.ColorBGRToGray)
+	size := b.frameSize()
+	if b.refMatrix.Cols() == size.X && b.refMatrix.Rows() == size.Y && size.X > 2*s && size.Y > 2*s {
+		tmpl := b.refMatrix.Region(image.Rect(s, s, size.X-s, size.Y-s))
+		noMask := gocv.NewMat()
+		gocv.MatchTemplate(b.grayMatrix, tmpl, &b.matchMatrix, gocv.TmSqdiff, noMask)
+		noMask.Close()
+		tmpl.Close()
+		_, _, best, _ := gocv.MinMaxLoc(b.matchMatrix)
+		if dx, dy := best.X-s, best.Y-s; dx != 0 || dy != 0 {
+			m := gocv.NewMatWithSize(2, 3, gocv.MatTypeCV64F)
+			m.SetDoubleAt(0, 0, 1)
+			m.SetDoubleAt(0, 2, float64(-dx))
+			m.SetDoubleAt(1, 1, 1)
+			m.SetDoubleAt(1, 2, float64(-dy))
+			// the read matrix is free until the next frame is read
+			gocv.WarpAffineWithParams(b.baseImgMatrix, &b.readMatrix, m, size, gocv.InterpolationNearestNeighbor, gocv.BorderReplicate, color.RGBA{})
+			m.Close()
+			b.baseImgMatrix, b.readMatrix = b.readMatrix, b.baseImgMatrix
+			gocv.CvtColor(b.baseImgMatrix, &b.grayMatrix, gocv.ColorBGRToGray)
+		}
+	}
+	b.grayMatrix.CopyTo(&b.refMatrix)
+}
+
+// prepareNightFrame equalizes and denoises the luminance of the frame motion
+// is detected on into the night matrix
+func (b *gocvBackend) prepareNightFrame(src gocv.Mat) {
+	gocv.CvtColor(src, &b.nightMatrix, gocv.ColorBGRToGray)
+	gocv.EqualizeHist(b.nightMatrix, &b.nightMatrix)
+	size := 2*nightBlurRadius + 1
+	gocv.GaussianBlur(b.nightMatrix, &b.nightMatrix, image.Pt(size, size), 0, 0, gocv.BorderDefault)
+	// the background subtractor expects the same number of channels
+	gocv.CvtColor(b.nightMatrix, &b.nightMatrix, gocv.ColorGrayToBGR)
+}
+
+func (b *gocvBackend) prepareCurrentFrame(p frameParams) bool {
+	b.baseImgMatrix, b.readMatrix = b.readMatrix, b.baseImgMatrix
+	if b.cfg.fisheye != nil {
+		b.dewarp()
+	}
+	if b.cfg.maxShift > 0 {
+		b.stabilize()
+	}
+	b.updatePrivacyMask()
+	b.hidePrivacyZones(b.privacy)
+	src := b.baseImgMatrix
+	if p.preprocess != nil {
+		// the hook changes a copy, which motion is detected on, so that the
+		// frame shown is left as it is
+		b.baseImgMatrix.CopyTo(&b.preMatrix)
+		info := p.info
+		info.Size = b.frameSize()
+		p.preprocess(&b.preMatrix, info)
+		src = b.preMatrix
+	}
+	p.clock.mark(StagePreprocess)
+	// frames read from cameras and sources are continuous BGR matrices
+	night := src.Channels() == 3 && p.useNight(src.DataPtrUint8(), 3)
+	if src.Channels() == 3 {
+		b.lastBrightness = meanBrightness(src.DataPtrUint8(), 3)
+	}
+	if night != b.night {
+		// the night frames aren't comparable to the daylight ones, so the
+		// background has to be learned again
+		b.resetBackground()
+		b.night = night
+	}
+	threshold := p.threshold
+	if night {
+		b.prepareNightFrame(src)
+		src, threshold = b.nightMatrix, p.nightThreshold
+	}
+	// foreground (diff matrix) = curFrame - prevFrame
+	b.bgSubtractor.Apply(src, &b.diffMatrix)
+	p.clock.mark(StageSubtraction)
+	// get rid of pixels with too small or too large values
+	gocv.Threshold(b.diffMatrix, &b.threshMatrix, float32(threshold), 255, gocv.ThresholdBinary)
+	// Dilate: transformation that produces an image that is the same shape as the
+	// original, but is a different size
+	gocv.Dilate(b.threshMatrix, &b.threshMatrix, b.kernel)
+	// exclude privacy zones from detection
+	if !b.privacyMask.Empty() {
+		gocv.BitwiseAnd(b.threshMatrix, b.privacyMask, &b.threshMatrix)
+	}
+	p.clock.mark(StageThreshold)
+	return night
+}
+
+// updatePrivacyMask computes the privacy zones' bounds and mask for the
+// current frame's size, if it changed
+func (b *gocvBackend) updatePrivacyMask() {
+	size := b.frameSize()
+	if size == b.privacySize && b.privacy != nil {
+		return
+	}
+	b.privacy, b.privacySize = privacyRects(b.cfg.privacyZones, size, b.cfg.fisheye), size
+	b.privacyMask.Close()
+	if len(b.privacy) == 0 {
+		b.privacyMask = gocv.NewMat()
+		return
+	}
+	b.privacyMask = gocv.NewMatWithSizeFromScalar(gocv.NewScalar(255, 0, 0, 0), size.Y, size.X, gocv.MatTypeCV8U)
+	for _, r := range b.privacy {
+		gocv.Rectangle(&b.privacyMask, r, color.RGBA{0, 0, 0, 0}, -1)
+	}
+}
+
+func (b *gocvBackend) findContours(minArea float64) ([]region, float64) {
+	regions, noise := []region{}, 0.0
+	contours := gocv.FindContours(b.threshMatrix, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	found := make([]region, len(contours))
+	b.cfg.workers.run(len(contours), func(i int) {
+		found[i] = region{area: gocv.ContourArea(contours[i]), contour: contours[i]}
+		if found[i].area >= minArea {
+			found[i].bounds = gocv.BoundingRect(contours[i])
+		}
+	})
+	for _, r := range found {
+		if r.area < minArea {
+			noise += r.area
+			continue
+		}
+		regions = append(regions, r)
+	}
+	return regions, noise
+}
+
+func (b *gocvBackend) drawRegion(r region, c color.RGBA) {
+	gocv.DrawContours(&b.baseImgMatrix, [][]image.Point{r.contour}, 0, c, 2)
+	gocv.Rectangle(&b.baseImgMatrix, r.bounds, boundingRectColor, 2)
+}
+
+// FrameHook is called with every processed frame, see WithFrameHook. The
+// frame is a BGR matrix
+type FrameHook func(frame *gocv.Mat, info FrameInfo)
+
+func (b *gocvBackend) displayResult(status string, c color.RGBA, info FrameInfo) bool {
+	gocv.PutText(&b.baseImgMatrix, status, image.Pt(10, 20), gocv.FontHersheyPlain, 1.2, c, 2)
+	if b.cfg.frameHook != nil {
+		b.cfg.frameHook(&b.baseImgMatrix, info)
+	}
+	return b.window.show(b.baseImgMatrix)
+}
+
+func (b *gocvBackend) frameSize() image.Point {
+	return image.Pt(b.baseImgMatrix.Cols(), b.baseImgMatrix.Rows())
+}
+
+// snapshotJPG encodes the frame, or its crop, in place, OpenCV's encoding is
+// copied into dst as gocv has no way to encode into a Go buffer
+func (b *gocvBackend) snapshotJPG(dst []byte, crop image.Rectangle, size image.Point) ([]byte, error) {
+	src := b.baseImgMatrix
+	if crop != image.Rect(0, 0, b.baseImgMatrix.Cols(), b.baseImgMatrix.Rows()) || size != crop.Size() {
+		cropped := b.baseImgMatrix.Region(crop)
+		defer cropped.Close()
+		if size != crop.Size() {
+			gocv.Resize(cropped, &b.resizeMatrix, size, 0, 0, gocv.InterpolationArea)
+			src = b.resizeMatrix
+		} else {
+			src = cropped
+		}
+	}
+	jpg, err := gocv.IMEncode(".jpg", src)
+	if err != nil || dst == nil {
+		return jpg, err
+	}
+	return append(dst, jpg...), nil
+}
+
+// mog2BytesPerPixel approximates the size of the per pixel model kept by
+// the MOG2 background subtractor: 5 gaussians of a weight, a variance and
+// a mean per channel, each a 4 byte float
+const mog2BytesPerPixel = 5 * (2 + 3) * 4
+
+func matBytes(m gocv.Mat) int64 {
+	if m.Empty() {
+		return 0
+	}
+	return int64(m.Rows()) * int64(m.Step())
+}
+
+// controlProperties are the OpenCV capture properties of camera controls,
+// white balance is CAP_PROP_WB_TEMPERATURE and CAP_PROP_AUTO_WB, which the
+// vendored gocv has no constants for
+var controlProperties = map[CameraControl]gocv.VideoCaptureProperties{
+	ControlExposure:         gocv.VideoCaptureExposure,
+	ControlAutoExposure:     gocv.VideoCaptureAutoExposure,
+	ControlGain:             gocv.VideoCaptureGain,
+	ControlBrightness:       gocv.VideoCaptureBrightness,
+	ControlContrast:         gocv.VideoCaptureContrast,
+	ControlWhiteBalance:     gocv.VideoCaptureProperties(45),
+	ControlAutoWhiteBalance: gocv.VideoCaptureProperties(44),
+}
+
+func (b *gocvBackend) setControl(c CameraControl, value float64) error {
+	if b.camera == nil {
+		return sourceControl(b.source, c, value)
+	}
+	if b.suspended {
+		return errCameraAsleep
+	}
+	prop, ok := controlProperties[c]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnsupportedControl, c)
+	}
+	b.camera.Set(prop, value)
+	return nil
+}
+
+func (b *gocvBackend) control(c CameraControl) (float64, error) {
+	if b.camera == nil {
+		return sourceControlValue(b.source, c)
+	}
+	if b.suspended {
+		return 0, errCameraAsleep
+	}
+	prop, ok := controlProperties[c]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedControl, c)
+	}
+	return b.camera.Get(prop), nil
+}
+
+func (b *gocvBackend) reopenCamera(camID int) error {
+	if b.camera == nil {
+		return errors.New("sources can't be reopened")
+	}
+	cam, err := gocv.OpenVideoCapture(camID)
+	if err != nil {
+		return err
+	}
+	if !b.suspended {
+		b.camera.Close()
+	}
+	b.camera, b.suspended = cam, false
+	// the camera adjusts its exposure again, and may have been moved
+	b.resetBackground()
+	return nil
+}
+
+func (b *gocvBackend) suspend() error {
+	if b.camera == nil {
+		return suspendSource(b.source)
+	}
+	// closing the camera lets it power down
+	b.suspended = true
+	return b.camera.Close()
+}
+
+func (b *gocvBackend) resume() error {
+	if err := resumeSource(b.source); err != nil {
+		return err
+	}
+	b.resetBackground()
+	return nil
+}
+
+// resetBackground learns the background again
+func (b *gocvBackend) resetBackground() {
+	b.bgSubtractor.Close()
+	b.bgSubtractor = gocv.NewBackgroundSubtractorMOG2()
+}
+
+func (b *gocvBackend) sampleFrame(dst []uint8) []uint8 {
+	// frames read from cameras and sources are continuous BGR matrices
+	if b.readMatrix.Channels() != 3 {
+		return dst[:0]
+	}
+	return sampleBrightness(dst, b.readMatrix.DataPtrUint8(), 3)
+}
+
+func (b *gocvBackend) brightness() float64 {
+	return b.lastBrightness
+}
+
+func (b *gocvBackend) memStats() MemStats {
+	mats := []gocv.Mat{b.readMatrix, b.baseImgMatrix, b.diffMatrix, b.threshMatrix, b.nightMatrix, b.preMatrix, b.grayMatrix, b.refMatrix, b.matchMatrix, b.mapX, b.mapY, b.kernel, b.privacyMask, b.resizeMatrix}
+	stats := MemStats{Mats: len(mats)}
+	for _, m := range mats {
+		stats.NativeBytes += matBytes(m)
+	}
+	stats.NativeBytes += int64(b.baseImgMatrix.Rows()) * int64(b.baseImgMatrix.Cols()) * mog2BytesPerPixel
+	return stats
+}
+
+func (b *gocvBackend) close() []error {
+	errs := []error{}
+	closeResource := func(name string, c interface{ Close() error }) {
+		if err := c.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("could not close %s: %w", name, err))
+		}
+	}
+	if b.camera != nil && !b.suspended {
+		closeResource("camera", b.camera)
+	}
+	if b.source != nil {
+		closeResource("frame source", b.source)
+	}
+	if err := b.window.close(); err != nil {
+		errs = append(errs, fmt.Errorf("could not close window: %w", err))
+	}
+	closeResource("read matrix", &b.readMatrix)
+	closeResource("image matrix", &b.baseImgMatrix)
+	closeResource("diff matrix", &b.diffMatrix)
+	closeResource("threshold matrix", &b.threshMatrix)
+	closeResource("night matrix", &b.nightMatrix)
+	closeResource("pre-processing matrix", &b.preMatrix)
+	closeResource("gray matrix", &b.grayMatrix)
+	closeResource("reference matrix", &b.refMatrix)
+	closeResource("match matrix", &b.matchMatrix)
+	closeResource("remap x matrix", &b.mapX)
+	closeResource("remap y matrix", &b.mapY)
+	closeResource("background subtractor", &b.bgSubtractor)
+	closeResource("dilation kernel", &b.kernel)
+	closeResource("privacy mask", &b.privacyMask)
+	closeResource("snapshot matrix", &b.resizeMatrix)
+	return errs
+}
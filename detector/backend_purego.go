@@ -0,0 +1,550 @@
+//go:build purego
+// +build purego
+
+package detector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+)
+
+const (
+	// backgroundLearningRate is the weight given to each new frame when
+	// updating the running average background model
+	backgroundLearningRate = 0.05
+
+	// foregroundLearningRate is the learning rate used for foreground pixels,
+	// it is much lower so that moving objects aren't absorbed into the model
+	// (leaving "ghosts" behind) while objects which stop moving eventually are
+	foregroundLearningRate = 0.005
+
+	// slowForegroundLearningRate is the learning rate used for foreground
+	// pixels with WithSlowSubjects
+	slowForegroundLearningRate = foregroundLearningRate / 5
+)
+
+// pureGoBackend detects motion by differencing each frame against a running
+// average of previous frames and labeling the connected blobs of foreground
+// pixels. It has no display, frames can only be seen through snapshots
+type pureGoBackend struct {
+	cfg        backendConfig
+	source     Source
+	next       image.Image
+	frame      *image.RGBA
+	background []float32
+	reference  []float32
+	shifted    *image.RGBA
+	pre        *image.RGBA
+	remapX     []float32
+	remapY     []float32
+	lum        []float32
+	blurred    []float32
+	night      bool
+	// lastBrightness is the mean brightness of the current frame
+	lastBrightness float64
+	diffMask       []bool
+	threshMask     []bool
+	labels         []int32
+	stack          []int
+	// privacy are the bounds of the privacy zones within frames of
+	// privacySize and privacyMask is set where they are, they are computed
+	// again when the frame size changes
+	privacy     []image.Rectangle
+	privacySize image.Point
+	privacyMask []bool
+	// shrunk is the resized frame of the last snapshot
+	shrunk *image.RGBA
+}
+
+func newCameraBackend(camID int, cfg backendConfig) (backend, error) {
+	return nil, errors.New("camera devices are not supported by the pure Go backend, use NewMotionDetectorFromSource")
+}
+
+func newSourceBackend(src Source, cfg backendConfig) (backend, error) {
+	return &pureGoBackend{cfg: cfg, source: src}, nil
+}
+
+func (b *pureGoBackend) readFrame() error {
+	for {
+		img, err := b.source.Read()
+		if err != nil {
+			return err
+		}
+		if img == nil || img.Bounds().Empty() {
+			continue
+		}
+		b.next = img
+		return nil
+	}
+}
+
+func (b *pureGoBackend) grabFrame() (interface{}, error) {
+	for {
+		img, err := b.source.Read()
+		if err != nil {
+			return nil, err
+		}
+		if img != nil && !img.Bounds().Empty() {
+			return img, nil
+		}
+	}
+}
+
+func (b *pureGoBackend) stageFrame(frame interface{}) {
+	b.next = frame.(image.Image)
+}
+
+func (b *pureGoBackend) discardFrame(frame interface{}) {}
+
+func (b *pureGoBackend) prepareCurrentFrame(p frameParams) bool {
+	bounds := b.next.Bounds()
+	if b.frame == nil || b.frame.Rect.Size() != bounds.Size() {
+		b.frame = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		b.background = nil
+	}
+	draw.Draw(b.frame, b.frame.Rect, b.next, bounds.Min, draw.Src)
+	if b.cfg.fisheye != nil {
+		b.dewarp()
+	}
+	if b.cfg.maxShift > 0 {
+		b.stabilize()
+	}
+	b.updatePrivacyMask()
+	b.hidePrivacyZones(b.privacy)
+	src := b.frame
+	if p.preprocess != nil {
+		// the hook changes a copy, which motion is detected on, so that the
+		// frame shown is left as it is
+		if b.pre == nil || b.pre.Rect != b.frame.Rect {
+			b.pre = image.NewRGBA(b.frame.Rect)
+		}
+		copy(b.pre.Pix, b.frame.Pix)
+		info := p.info
+		info.Size = b.frame.Rect.Size()
+		p.preprocess(b.pre, info)
+		src = b.pre
+	}
+	w, h := b.frame.Rect.Dx(), b.frame.Rect.Dy()
+	n := w * h
+	p.clock.mark(StagePreprocess)
+	night := p.useNight(src.Pix, 4)
+	b.lastBrightness = meanBrightness(src.Pix, 4)
+	if night != b.night {
+		// the luminance of the night processing isn't comparable to the
+		// daylight one, so the background has to be learned again
+		b.background, b.night = nil, night
+	}
+	learn := b.background != nil
+	if !learn {
+		b.background = make([]float32, n)
+		b.lum = make([]float32, n)
+		b.diffMask = make([]bool, n)
+		b.threshMask = make([]bool, n)
+		b.labels = make([]int32, n)
+	}
+	b.computeLum(src)
+	diffThreshold := float32(p.threshold)
+	if night {
+		equalize(b.lum)
+		b.lum, b.blurred = boxBlur(b.lum, b.blurred, w, h, nightBlurRadius), b.lum
+		diffThreshold = float32(p.nightThreshold)
+	}
+	fgRate := float32(foregroundLearningRate)
+	if b.cfg.slowSubjects {
+		fgRate = slowForegroundLearningRate
+	}
+	// foreground (diff mask) = |curFrame - background| > threshold
+	for i, lum := range b.lum {
+		if !learn {
+			b.background[i] = lum
+		}
+		diff := lum - b.background[i]
+		b.diffMask[i] = diff > diffThreshold || diff < -diffThreshold
+		if b.diffMask[i] {
+			b.background[i] += fgRate * diff
+		} else {
+			b.background[i] += backgroundLearningRate * diff
+		}
+	}
+	p.clock.mark(StageSubtraction)
+	// dilate with a 3x3 rectangular kernel
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			set := false
+			for dy := -1; dy <= 1 && !set; dy++ {
+				for dx := -1; dx <= 1 && !set; dx++ {
+					nx, ny := x+dx, y+dy
+					set = nx >= 0 && ny >= 0 && nx < w && ny < h && b.diffMask[ny*w+nx]
+				}
+			}
+			// exclude privacy zones from detection
+			b.threshMask[y*w+x] = set && (b.privacyMask == nil || !b.privacyMask[y*w+x])
+		}
+	}
+	p.clock.mark(StageThreshold)
+	return night
+}
+
+// updatePrivacyMask computes the privacy zones' bounds and mask for the
+// current frame's size, if it changed
+func (b *pureGoBackend) updatePrivacyMask() {
+	size := b.frame.Rect.Size()
+	if size == b.privacySize && b.privacy != nil {
+		return
+	}
+	b.privacy, b.privacySize, b.privacyMask = privacyRects(b.cfg.privacyZones, size, b.cfg.fisheye), size, nil
+	if len(b.privacy) == 0 {
+		return
+	}
+	b.privacyMask = make([]bool, size.X*size.Y)
+	for _, r := range b.privacy {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				b.privacyMask[y*size.X+x] = true
+			}
+		}
+	}
+}
+
+// computeLum computes the luminance of the current frame
+func (b *pureGoBackend) computeLum(img *image.RGBA) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if len(b.lum) != w*h {
+		b.lum = make([]float32, w*h)
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			px := img.Pix[img.PixOffset(x, y):]
+			b.lum[y*w+x] = 0.299*float32(px[0]) + 0.587*float32(px[1]) + 0.114*float32(px[2])
+		}
+	}
+}
+
+// dewarp de-warps the current frame, the remap tables are computed on the
+// first frame and whenever the frame size changes
+func (b *pureGoBackend) dewarp() {
+	w, h := b.frame.Rect.Dx(), b.frame.Rect.Dy()
+	if len(b.remapX) != w*h {
+		b.remapX, b.remapY = b.cfg.fisheye.scaled(image.Pt(w, h)).remapTable()
+	}
+	if b.shifted == nil || b.shifted.Rect != b.frame.Rect {
+		b.shifted = image.NewRGBA(b.frame.Rect)
+	}
+	for i := range b.remapX {
+		x, y := int(b.remapX[i]+0.5), int(b.remapY[i]+0.5)
+		dst := b.shifted.Pix[4*i : 4*i+4]
+		if x < 0 || y < 0 || x >= w || y >= h {
+			copy(dst, []uint8{0, 0, 0, 255})
+			continue
+		}
+		copy(dst, b.frame.Pix[b.frame.PixOffset(x, y):])
+	}
+	b.frame, b.shifted = b.shifted, b.frame
+}
+
+// stabilize shifts the current frame to align it with the previous one
+func (b *pureGoBackend) stabilize() {
+	w, h := b.frame.Rect.Dx(), b.frame.Rect.Dy()
+	b.computeLum(b.frame)
+	if len(b.reference) == len(b.lum) && w > 2*b.cfg.maxShift && h > 2*b.cfg.maxShift {
+		if dx, dy := estimateShift(b.reference, b.lum, w, h, b.cfg.maxShift); dx != 0 || dy != 0 {
+			if b.shifted == nil || b.shifted.Rect != b.frame.Rect {
+				b.shifted = image.NewRGBA(b.frame.Rect)
+			}
+			// the edges uncovered by the shift keep the unshifted pixels
+			copy(b.shifted.Pix, b.frame.Pix)
+			draw.Draw(b.shifted, b.frame.Rect, b.frame, image.Pt(dx, dy), draw.Src)
+			b.frame, b.shifted = b.shifted, b.frame
+			b.computeLum(b.frame)
+		}
+	}
+	b.reference = append(b.reference[:0], b.lum...)
+}
+
+// equalize spreads the luminance values over the full range by histogram
+// equalization, bringing out detail in dark frames
+func equalize(lum []float32) {
+	var hist [256]int
+	for _, l := range lum {
+		hist[uint8(l)]++
+	}
+	var lut [256]float32
+	cdf, minCDF := 0, 0
+	for v, n := range hist {
+		cdf += n
+		if minCDF == 0 {
+			minCDF = cdf
+		}
+		if len(lum) > minCDF {
+			lut[v] = 255 * float32(cdf-minCDF) / float32(len(lum)-minCDF)
+		}
+	}
+	for i, l := range lum {
+		lum[i] = lut[uint8(l)]
+	}
+}
+
+// boxBlur averages each value of a w x h grid with its neighbours within the
+// radius into dst, which is reallocated if too small, and returns dst
+func boxBlur(src, dst []float32, w, h, radius int) []float32 {
+	if len(dst) < len(src) {
+		dst = make([]float32, len(src))
+	}
+	dst = dst[:len(src)]
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sum, n := float32(0), 0
+			for ny := y - radius; ny <= y+radius; ny++ {
+				for nx := x - radius; nx <= x+radius; nx++ {
+					if nx >= 0 && ny >= 0 && nx < w && ny < h {
+						sum += src[ny*w+nx]
+						n++
+					}
+				}
+			}
+			dst[y*w+x] = sum / float32(n)
+		}
+	}
+	return dst
+}
+
+// hidePrivacyZones blacks out or pixelates the privacy zones of the
+// current frame
+func (b *pureGoBackend) hidePrivacyZones(rects []image.Rectangle) {
+	for _, r := range rects {
+		if b.cfg.privacyMode == PrivacyBlackout {
+			draw.Draw(b.frame, r, image.Black, image.Point{}, draw.Src)
+			continue
+		}
+		for y := r.Min.Y; y < r.Max.Y; y += pixelateBlockSize {
+			for x := r.Min.X; x < r.Max.X; x += pixelateBlockSize {
+				block := image.Rect(x, y, x+pixelateBlockSize, y+pixelateBlockSize).Intersect(r)
+				avg := shrink(b.frame, block, image.Pt(1, 1)).At(0, 0)
+				draw.Draw(b.frame, block, image.NewUniform(avg), image.Point{}, draw.Src)
+			}
+		}
+	}
+}
+
+func (b *pureGoBackend) findContours(minArea float64) ([]region, float64) {
+	regions, noise := []region{}, 0.0
+	w, h := b.frame.Rect.Dx(), b.frame.Rect.Dy()
+	for i := range b.labels {
+		b.labels[i] = 0
+	}
+	label, labels := int32(0), []int32{}
+	for start, set := range b.threshMask {
+		if !set || b.labels[start] != 0 {
+			continue
+		}
+		// flood fill the 8-connected blob containing the start pixel
+		label++
+		area, bounds := 0, image.Rectangle{}
+		b.labels[start] = label
+		b.stack = append(b.stack[:0], start)
+		for len(b.stack) > 0 {
+			i := b.stack[len(b.stack)-1]
+			b.stack = b.stack[:len(b.stack)-1]
+			x, y := i%w, i/w
+			area++
+			bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || ny < 0 || nx >= w || ny >= h {
+						continue
+					}
+					if j := ny*w + nx; b.threshMask[j] && b.labels[j] == 0 {
+						b.labels[j] = label
+						b.stack = append(b.stack, j)
+					}
+				}
+			}
+		}
+		if float64(area) < minArea {
+			noise += float64(area)
+			continue
+		}
+		regions = append(regions, region{bounds: bounds, area: float64(area)})
+		labels = append(labels, label)
+	}
+	// the outlines are traced once labeling is done, they only read labels
+	b.cfg.workers.run(len(regions), func(i int) {
+		regions[i].contour = b.rowExtremes(labels[i], regions[i].bounds)
+	})
+	return regions, noise
+}
+
+// rowExtremes returns the corners of the leftmost and rightmost pixels of
+// each row of a labeled blob, which have the same convex hull as the blob
+func (b *pureGoBackend) rowExtremes(label int32, bounds image.Rectangle) []image.Point {
+	w := b.frame.Rect.Dx()
+	points := make([]image.Point, 0, 4*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := b.labels[y*w : (y+1)*w]
+		left, right := bounds.Min.X, bounds.Max.X-1
+		for row[left] != label {
+			left++
+		}
+		for row[right] != label {
+			right--
+		}
+		points = append(points,
+			image.Pt(left, y), image.Pt(left, y+1),
+			image.Pt(right+1, y), image.Pt(right+1, y+1),
+		)
+	}
+	return points
+}
+
+func (b *pureGoBackend) drawRegion(r region, c color.RGBA) {
+	drawRect(b.frame, r.bounds, boundingRectColor, 2)
+}
+
+// FrameHook is called with every processed frame, see WithFrameHook. The
+// frame is an RGBA image with the purego backend
+type FrameHook func(frame *image.RGBA, info FrameInfo)
+
+// displayResult has no window to show the frame in, so it only marks the
+// frame with a status colored box as the standard library can't render text
+func (b *pureGoBackend) displayResult(status string, c color.RGBA, info FrameInfo) bool {
+	draw.Draw(b.frame, image.Rect(10, 10, 20, 20), image.NewUniform(c), image.Point{}, draw.Src)
+	if b.cfg.frameHook != nil {
+		b.cfg.frameHook(b.frame, info)
+	}
+	return false
+}
+
+func (b *pureGoBackend) frameSize() image.Point {
+	if b.frame == nil {
+		return image.Point{}
+	}
+	return b.frame.Rect.Size()
+}
+
+func (b *pureGoBackend) snapshotJPG(dst []byte, crop image.Rectangle, size image.Point) ([]byte, error) {
+	var img image.Image = b.frame.SubImage(crop)
+	if size != crop.Size() {
+		b.shrunk = shrinkInto(b.shrunk, b.frame, crop, size)
+		img = b.shrunk
+	}
+	buf := bytes.NewBuffer(dst)
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// shrink scales the crop of an image down to the given size, averaging the
+// source pixels covered by each destination pixel
+func shrink(src *image.RGBA, crop image.Rectangle, size image.Point) *image.RGBA {
+	return shrinkInto(nil, src, crop, size)
+}
+
+// shrinkInto shrinks into dst if it has the given size, or into a new image
+func shrinkInto(dst *image.RGBA, src *image.RGBA, crop image.Rectangle, size image.Point) *image.RGBA {
+	if dst == nil || dst.Rect.Size() != size {
+		dst = image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	}
+	for y := 0; y < size.Y; y++ {
+		y0 := crop.Min.Y + y*crop.Dy()/size.Y
+		y1 := crop.Min.Y + (y+1)*crop.Dy()/size.Y
+		for x := 0; x < size.X; x++ {
+			x0 := crop.Min.X + x*crop.Dx()/size.X
+			x1 := crop.Min.X + (x+1)*crop.Dx()/size.X
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				p := src.Pix[src.PixOffset(x0, sy):]
+				for sx := 0; sx < x1-x0; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(p[4*sx+c])
+					}
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			q := dst.Pix[dst.PixOffset(x, y):]
+			for c := 0; c < 4; c++ {
+				q[c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+func (b *pureGoBackend) setControl(c CameraControl, value float64) error {
+	return sourceControl(b.source, c, value)
+}
+
+func (b *pureGoBackend) control(c CameraControl) (float64, error) {
+	return sourceControlValue(b.source, c)
+}
+
+func (b *pureGoBackend) reopenCamera(camID int) error {
+	return errors.New("camera devices are not supported by the pure Go backend")
+}
+
+func (b *pureGoBackend) suspend() error {
+	return suspendSource(b.source)
+}
+
+func (b *pureGoBackend) resume() error {
+	if err := resumeSource(b.source); err != nil {
+		return err
+	}
+	b.background = nil
+	return nil
+}
+
+func (b *pureGoBackend) sampleFrame(dst []uint8) []uint8 {
+	switch img := b.next.(type) {
+	case *image.RGBA:
+		return sampleBrightness(dst, img.Pix, 4)
+	case *image.YCbCr:
+		// decoded jpgs, whose luma is their brightness
+		return sampleBrightness(dst, img.Y, 1)
+	case *image.Gray:
+		return sampleBrightness(dst, img.Pix, 1)
+	}
+	return dst[:0]
+}
+
+func (b *pureGoBackend) brightness() float64 {
+	return b.lastBrightness
+}
+
+func (b *pureGoBackend) memStats() MemStats {
+	stats := MemStats{}
+	for _, img := range []*image.RGBA{b.frame, b.shifted, b.pre, b.shrunk} {
+		if img != nil {
+			stats.BufferBytes += int64(len(img.Pix))
+		}
+	}
+	stats.BufferBytes += int64(4*len(b.remapX) + 4*len(b.remapY))
+	stats.BufferBytes += int64(4*len(b.background) + 4*len(b.lum) + 4*len(b.blurred) + 4*len(b.reference) + len(b.diffMask) + len(b.threshMask) + 4*len(b.labels) + 8*cap(b.stack) + len(b.privacyMask))
+	return stats
+}
+
+func (b *pureGoBackend) close() []error {
+	if err := b.source.Close(); err != nil {
+		return []error{fmt.Errorf("could not close frame source: %w", err)}
+	}
+	return nil
+}
+
+// drawRect outlines a rectangle of the given thickness on an image
+func drawRect(img draw.Image, r image.Rectangle, c color.Color, thickness int) {
+	u := image.NewUniform(c)
+	for _, edge := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+thickness),
+		image.Rect(r.Min.X, r.Max.Y-thickness, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+thickness, r.Max.Y),
+		image.Rect(r.Max.X-thickness, r.Min.Y, r.Max.X, r.Max.Y),
+	} {
+		draw.Draw(img, edge.Intersect(img.Bounds()), u, image.Point{}, draw.Src)
+	}
+}
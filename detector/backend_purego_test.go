@@ -0,0 +1,43 @@
+//go:build purego
+// +build purego
+
+package detector_test
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/detector/sourcetest"
+)
+
+// OpenCV's subtractor learns from its own history, slow subjects only change
+// how the pure Go backend learns the background
+
+func TestSlowSubjectsStayInTheForeground(t *testing.T) {
+	// a dim subject which walks in and rests
+	resting := func() detector.Source {
+		return sourcetest.New(320, 240, 200, sourcetest.Rect{
+			Start:  10,
+			End:    200,
+			Bounds: image.Rect(100, 60, 220, 180),
+			Color:  color.Gray{Y: 120},
+		})
+	}
+	motionFrames := func(opts ...detector.Option) int {
+		md, err := detector.NewMotionDetectorFromSource(resting(), "", nil, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer md.Close()
+		if err := md.Start(); err != io.EOF {
+			t.Fatalf("expected source to run out of frames, got: %v", err)
+		}
+		return md.Stats().MotionFrames
+	}
+	if n, slow := motionFrames(), motionFrames(detector.WithSlowSubjects()); n >= 150 || slow < 185 {
+		t.Fatalf("expected the resting subject to be learned into the background only without slow subjects, got motion on %d and %d frames", n, slow)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build purego || nogui
+// +build purego nogui
+
+package detector_test
+
+import (
+	"fmt"
+	"image"
+	"testing"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/detector/sourcetest"
+)
+
+// benchmarkPipeline measures the per-frame cost of the detection pipeline
+// on frames of the given size with a rectangle moving across them
+func benchmarkPipeline(b *testing.B, width, height int, sensitivity float64) {
+	src := sourcetest.New(width, height, 0, sourcetest.Rect{
+		Start:    0,
+		End:      60,
+		Bounds:   image.Rect(0, height/4, width/4, height*3/4),
+		Velocity: image.Pt(width/80, 0),
+	})
+	md, err := detector.NewMotionDetectorFromSource(sourcetest.NewReplay(src, 60, b.N), "", nil,
+		detector.WithSensitivity(sensitivity),
+		detector.WithoutWindow(),
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer md.Close()
+	b.ResetTimer()
+	md.Start()
+}
+
+func BenchmarkPipeline(b *testing.B) {
+	for _, res := range []image.Point{{320, 240}, {640, 480}, {1280, 720}} {
+		for _, sensitivity := range []float64{detector.VerySensitive, detector.NotSensitive} {
+			b.Run(fmt.Sprintf("%dx%d/%v", res.X, res.Y, sensitivity), func(b *testing.B) {
+				benchmarkPipeline(b, res.X, res.Y, sensitivity)
+			})
+		}
+	}
+}
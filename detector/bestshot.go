@@ -0,0 +1,119 @@
+package detector
+
+import (
+	"image"
+	"math"
+	"time"
+)
+
+const (
+	// bestShotThumbWidth is the width the subject is scaled down to, at
+	// most, to measure its sharpness
+	bestShotThumbWidth = 128
+
+	// bestShotSharpness is the variance of the Laplacian of a subject which
+	// scores half of the sharpness score, sharper subjects score more
+	bestShotSharpness = 100.0
+)
+
+// BestShotSelection is the configuration of the best shot selection, see
+// WithBestShot
+type BestShotSelection struct {
+	Zone   string `json:"zone,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// Shot is the best snapshot of an event, see WithBestShot
+type Shot struct {
+	// Frame is the sequence number of the frame the shot was taken of
+	Frame    int       `json:"frame"`
+	Captured time.Time `json:"captured"`
+	// Bounds is the subject, the largest region of motion, on the frame
+	Bounds image.Rectangle `json:"bounds"`
+	// Score is how good the shot is, from 0 to 1, the product of the size,
+	// centering and sharpness of the subject, and Sharpness the variance of
+	// the Laplacian of the subject
+	Score     float64 `json:"score"`
+	Sharpness float64 `json:"sharpness"`
+	JPG       []byte  `json:"-"`
+}
+
+// bestShot picks the best shot of the ongoing event
+type bestShot struct {
+	config BestShotSelection
+	shot   *Shot
+}
+
+// WithBestShot picks the best snapshot of each event, framed as given, and
+// attaches it to the event as BestShot, e.g. for notifications, rather than
+// the first or last frame, which often only show an edge of the subject.
+// Every frame with motion is scored by its largest region of motion, the
+// subject: larger, more centered and sharper subjects make better shots.
+// Shots are taken before regions of motion are outlined
+func WithBestShot(s BestShotSelection) Option {
+	return func(d *Detector) {
+		d.bestShot = &bestShot{config: s}
+	}
+}
+
+// captureBestShot scores the current frame by the largest among the regions,
+// and takes a shot of it when it beats the event's best shot so far. It must
+// be called before regions are drawn on the current frame
+func (d *Detector) captureBestShot(regions []region) {
+	b := d.bestShot
+	frame := d.backend.frameSize()
+	subject := regions[0]
+	for _, r := range regions {
+		if r.area > subject.area {
+			subject = r
+		}
+	}
+	bounds := subject.bounds.Intersect(image.Rectangle{Max: frame})
+	if bounds.Empty() {
+		return
+	}
+	size := float64(bounds.Dx()*bounds.Dy()) / float64(frame.X*frame.Y)
+	cx, cy := center(bounds)
+	centering := 1 - math.Hypot(cx-float64(frame.X)/2, cy-float64(frame.Y)/2)/math.Hypot(float64(frame.X)/2, float64(frame.Y)/2)
+	if b.shot != nil && size*centering <= b.shot.Score {
+		// sharpness can only lower the score
+		return
+	}
+	thumb := bounds.Size()
+	if thumb.X > bestShotThumbWidth {
+		thumb = image.Pt(bestShotThumbWidth, thumb.Y*bestShotThumbWidth/thumb.X)
+	}
+	if thumb.Y < 1 {
+		thumb.Y = 1
+	}
+	jpg, err := d.encodeSnapshot(nil, bounds, thumb)
+	if err != nil {
+		return
+	}
+	g, err := decodeGray(jpg)
+	if err != nil {
+		return
+	}
+	sharpness := laplacianVariance(g)
+	score := size * centering * sharpness / (sharpness + bestShotSharpness)
+	if b.shot != nil && score <= b.shot.Score {
+		return
+	}
+	crop, shotSize, err := d.snapshotFraming(frame, SnapshotOptions{Zone: b.config.Zone, Width: b.config.Width, Height: b.config.Height})
+	if err != nil {
+		return
+	}
+	// a shot which fails to encode is retried on the next frame
+	if jpg, err = d.encodeSnapshot(nil, crop, shotSize); err != nil {
+		return
+	}
+	b.shot = &Shot{
+		Frame:     d.frame,
+		Captured:  d.frameInfo.Captured,
+		Bounds:    subject.bounds,
+		Score:     score,
+		Sharpness: sharpness,
+		JPG:       jpg,
+	}
+}
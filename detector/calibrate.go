@@ -0,0 +1,217 @@
+package detector
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// CalibratedZonePrefix is the prefix of the names of the zones suggested
+	// by Calibrate
+	CalibratedZonePrefix = "calibrated-"
+
+	// calibrationGrid is the number of rows and columns of cells noise is
+	// measured in
+	calibrationGrid = 4
+
+	// calibrationWarmup is the number of frames the background model is
+	// given to settle before noise is measured
+	calibrationWarmup = 30
+
+	// calibrationPercentile is the percentile of a cell's largest contour
+	// areas taken as its noise, so that a rare glitch doesn't count
+	calibrationPercentile = 0.99
+
+	// calibrationMargin is how far above the noise suggested sensitivities
+	// are set
+	calibrationMargin = 2
+
+	// noisyCellFrames is the fraction of frames with motion above which a
+	// cell is considered noisy at the pixel level, and noisyCells the
+	// fraction of noisy cells above which a higher threshold is suggested
+	noisyCellFrames = 0.5
+	noisyCells      = 0.5
+
+	// thresholdStep is how much higher a suggested threshold is, and
+	// maxSuggestedThreshold the highest suggested, past which noise is better
+	// dealt with by night processing or a better camera
+	thresholdStep         = 10
+	maxSuggestedThreshold = 60
+)
+
+// CellNoise is the noise measured in a cell of the frame by Calibrate
+type CellNoise struct {
+	Bounds image.Rectangle `json:"bounds"`
+	// Area is the largest contour area which motion in the cell covered on
+	// all but the noisiest 1% of the frames
+	Area float64 `json:"area"`
+	// Active is the fraction of frames with any motion in the cell
+	Active float64 `json:"active"`
+}
+
+// Calibration is the noise measured on a scene without motion of interest,
+// and the configuration suggested to ignore it
+type Calibration struct {
+	// Frames is the number of frames noise was measured on
+	Frames int         `json:"frames"`
+	Cells  []CellNoise `json:"cells"`
+	// Suggested is the detector's configuration with the suggested
+	// sensitivity and threshold, and zones with their own sensitivity for
+	// the cells which are noisier than the rest
+	Suggested Config `json:"suggested"`
+}
+
+// Calibrate watches the scene for the given duration, or until the source
+// runs out of frames, and measures the noise in a grid of cells of the frame.
+// There should be no motion of interest meanwhile. It must not be called
+// while the detector is running, and suggests no zones with WithFisheye as
+// zones are set on the frames before they are de-warped
+func (d *Detector) Calibrate(duration time.Duration) (*Calibration, error) {
+	cells := calibrationGrid * calibrationGrid
+	areas := make([][]float64, cells)
+	active := make([]int, cells)
+	frame := image.Point{}
+	frames := 0
+	deadline := time.Now().Add(duration)
+	for i := 0; i < calibrationWarmup || time.Now().Before(deadline); i++ {
+		err := d.backend.readFrame()
+		if err == io.EOF && frames > 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		d.mu.Lock()
+		d.backend.prepareCurrentFrame(frameParams{
+			threshold:      d.threshold,
+			nightThreshold: d.nightThreshold,
+			night:          d.nightMode,
+			preprocess:     d.preprocessHook,
+		})
+		// every contour, however small, is noise to be measured
+		regions, _ := d.backend.findContours(1)
+		frame = d.backend.frameSize()
+		d.mu.Unlock()
+		if i < calibrationWarmup {
+			continue
+		}
+		frames++
+		largest := make([]float64, cells)
+		for _, r := range regions {
+			c := cellOf(midpoint(r.bounds), frame)
+			if r.area > largest[c] {
+				largest[c] = r.area
+			}
+		}
+		for c, area := range largest {
+			areas[c] = append(areas[c], area)
+			if area > 0 {
+				active[c]++
+			}
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calibration(frame, frames, areas, active), nil
+}
+
+// calibration returns the calibration of the noise measured in each cell
+func (d *Detector) calibration(frame image.Point, frames int, areas [][]float64, active []int) *Calibration {
+	c := &Calibration{Frames: frames, Suggested: d.configLocked()}
+	c.Suggested.Profile, c.Suggested.Handlers = "", nil
+	noise := make([]float64, len(areas))
+	noisy := 0
+	for i := range areas {
+		noise[i] = percentile(areas[i], calibrationPercentile)
+		c.Cells = append(c.Cells, CellNoise{
+			Bounds: cellBounds(i, frame),
+			Area:   noise[i],
+			Active: float64(active[i]) / float64(frames),
+		})
+		if c.Cells[i].Active > noisyCellFrames {
+			noisy++
+		}
+	}
+	// the sensitivity clears the noise of most of the frame, cells noisier
+	// than that get their own
+	c.Suggested.Sensitivity = math.Max(VerySensitive, roundArea(calibrationMargin*percentile(noise, 0.5)))
+	if float64(noisy) > noisyCells*float64(len(areas)) && d.threshold+thresholdStep <= maxSuggestedThreshold {
+		c.Suggested.Threshold = d.threshold + thresholdStep
+	}
+	if d.fisheye != nil {
+		return c
+	}
+	for i, cell := range c.Cells {
+		if d.overridesSensitivity(cell.Bounds) {
+			// the cell's own sensitivity wouldn't apply
+			continue
+		}
+		if minArea := roundArea(calibrationMargin * cell.Area); minArea > c.Suggested.Sensitivity {
+			c.Suggested.Zones = append(c.Suggested.Zones, Zone{
+				Name:    fmt.Sprintf("%s%d-%d", CalibratedZonePrefix, i/calibrationGrid, i%calibrationGrid),
+				Bounds:  cell.Bounds,
+				MinArea: minArea,
+			})
+		}
+	}
+	return c
+}
+
+// overridesSensitivity returns whether a zone overlapping the given bounds
+// has its own sensitivity
+func (d *Detector) overridesSensitivity(bounds image.Rectangle) bool {
+	for _, z := range d.zones {
+		if z.MinArea > 0 && z.Bounds.Overlaps(bounds) {
+			return true
+		}
+	}
+	return false
+}
+
+// cellOf returns the index of the calibration cell a point is in
+func cellOf(p image.Point, frame image.Point) int {
+	if frame.X == 0 || frame.Y == 0 {
+		return 0
+	}
+	col := clampCell(p.X * calibrationGrid / frame.X)
+	row := clampCell(p.Y * calibrationGrid / frame.Y)
+	return row*calibrationGrid + col
+}
+
+func clampCell(i int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= calibrationGrid {
+		return calibrationGrid - 1
+	}
+	return i
+}
+
+// cellBounds returns the bounds of a calibration cell
+func cellBounds(i int, frame image.Point) image.Rectangle {
+	row, col := i/calibrationGrid, i%calibrationGrid
+	return image.Rect(
+		col*frame.X/calibrationGrid, row*frame.Y/calibrationGrid,
+		(col+1)*frame.X/calibrationGrid, (row+1)*frame.Y/calibrationGrid,
+	)
+}
+
+// percentile returns the given percentile of values, zero if there are none
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+// roundArea rounds a suggested area up to the next hundred
+func roundArea(area float64) float64 {
+	return math.Ceil(area/100) * 100
+}
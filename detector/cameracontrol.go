@@ -0,0 +1,146 @@
+package detector
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// CameraControl is a setting of the camera's image, the auto modes of cheap
+// webcams oscillate, changing the whole frame, which is detected as motion,
+// so fixing them keeps the frames steady
+type CameraControl string
+
+// Camera controls, the range of their values depends on the camera and
+// driver, e.g. with V4L2 exposure is in units of 100µs and auto_exposure is 1
+// for manual and 3 for automatic exposure
+const (
+	ControlExposure         CameraControl = "exposure"
+	ControlAutoExposure     CameraControl = "auto_exposure"
+	ControlGain             CameraControl = "gain"
+	ControlBrightness       CameraControl = "brightness"
+	ControlContrast         CameraControl = "contrast"
+	ControlWhiteBalance     CameraControl = "white_balance"
+	ControlAutoWhiteBalance CameraControl = "auto_white_balance"
+)
+
+// CameraControls are the camera controls, in the order they are applied: auto
+// modes are switched off before their manual values are set
+var CameraControls = []CameraControl{
+	ControlAutoExposure,
+	ControlExposure,
+	ControlGain,
+	ControlAutoWhiteBalance,
+	ControlWhiteBalance,
+	ControlBrightness,
+	ControlContrast,
+}
+
+// ErrUnsupportedControl is returned when setting or getting a camera control
+// of a detector whose camera or source doesn't support it
+var ErrUnsupportedControl = errors.New("camera control not supported")
+
+// ControllableSource is a Source whose camera controls can be set, e.g. a
+// camera which isn't opened by OpenCV
+type ControllableSource interface {
+	Source
+	SetControl(c CameraControl, value float64) error
+	Control(c CameraControl) (float64, error)
+}
+
+// WithCameraControls sets camera controls when the camera is opened, e.g.
+// {ControlAutoExposure: 1, ControlExposure: 150} to fix the exposure
+func WithCameraControls(controls map[CameraControl]float64) Option {
+	return func(d *Detector) {
+		if d.cameraControls == nil {
+			d.cameraControls = map[CameraControl]float64{}
+		}
+		for c, v := range controls {
+			d.cameraControls[c] = v
+		}
+	}
+}
+
+// SetCameraControl sets a camera control while the detector is running. The
+// value is kept in the detector's Config
+func (d *Detector) SetCameraControl(c CameraControl, value float64) error {
+	if !knownControl(c) {
+		return fmt.Errorf("%w: %q", ErrUnsupportedControl, c)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.backend.setControl(c, value); err != nil {
+		return err
+	}
+	if d.cameraControls == nil {
+		d.cameraControls = map[CameraControl]float64{}
+	}
+	d.cameraControls[c] = value
+	return nil
+}
+
+// CameraControl returns the current value of a camera control, as reported
+// by the camera
+func (d *Detector) CameraControl(c CameraControl) (float64, error) {
+	if !knownControl(c) {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedControl, c)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.backend.control(c)
+}
+
+// applyCameraControls sets the controls of WithCameraControls on a newly
+// opened camera, with the given setter
+func (d *Detector) applyCameraControls(set func(c CameraControl, value float64) error) error {
+	for _, c := range CameraControls {
+		v, ok := d.cameraControls[c]
+		if !ok {
+			continue
+		}
+		if err := set(c, v); err != nil {
+			return fmt.Errorf("could not set camera control %s: %w", c, err)
+		}
+	}
+	return nil
+}
+
+// sourceControl sets a control of a source, if it is controllable
+func sourceControl(src Source, c CameraControl, value float64) error {
+	cs, ok := src.(ControllableSource)
+	if !ok {
+		return fmt.Errorf("%w: the source has no controls", ErrUnsupportedControl)
+	}
+	return cs.SetControl(c, value)
+}
+
+// sourceControlValue returns a control of a source, if it is controllable
+func sourceControlValue(src Source, c CameraControl) (float64, error) {
+	cs, ok := src.(ControllableSource)
+	if !ok {
+		return 0, fmt.Errorf("%w: the source has no controls", ErrUnsupportedControl)
+	}
+	return cs.Control(c)
+}
+
+// knownControl returns whether c is one of CameraControls
+func knownControl(c CameraControl) bool {
+	for _, known := range CameraControls {
+		if c == known {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownControls returns the controls which aren't CameraControls, sorted
+func unknownControls(controls map[CameraControl]float64) []string {
+	unknown := []string{}
+	for c := range controls {
+		if !knownControl(c) {
+			unknown = append(unknown, string(c))
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
@@ -0,0 +1,113 @@
+package detector
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+const (
+	// persistenceFrames is the number of frames with motion for which an
+	// event's persistence is one half
+	persistenceFrames = 3
+
+	// noiseFloorDecay is the weight of the noise on each new frame in the
+	// detector's noise floor
+	noiseFloorDecay = 0.05
+)
+
+// ConfidenceFactors are the heuristics an event's confidence is computed
+// from, each from 0 to 1
+type ConfidenceFactors struct {
+	// Size is how far the largest contour area stands above the noise
+	// floor, the detector's sensitivity plus the area of noise on recent
+	// frames. It is one half for motion just as large as the floor
+	Size float64 `json:"size"`
+	// Persistence grows with the number of frames motion was detected on
+	Persistence float64 `json:"persistence"`
+	// Solidity is the mean of the area of the largest region of motion on
+	// each frame relative to that of its convex hull. Moving objects are
+	// solid, while noise and foliage are scattered
+	Solidity float64 `json:"solidity"`
+	// Classifier is a classifier's confidence that the event shows what
+	// should be alerted on, see SetClassifierAgreement
+	Classifier *float64 `json:"classifier,omitempty"`
+}
+
+// confidence combines the factors, the visual ones with their geometric
+// mean so that any one of them being low makes for a low confidence, and a
+// classifier's as much as all visual ones
+func (f ConfidenceFactors) confidence() float64 {
+	c := math.Cbrt(f.Size * f.Persistence * f.Solidity)
+	if f.Classifier != nil {
+		c = (c + *f.Classifier) / 2
+	}
+	return c
+}
+
+// SetClassifierAgreement folds the confidence of a classifier that the
+// event shows what should be alerted on, from 0 to 1, into the event's
+// confidence. Forced events keep their confidence of 1
+func (e *Event) SetClassifierAgreement(agreement float64) {
+	e.ConfidenceFactors.Classifier = &agreement
+	if e.Reason == "" {
+		e.Confidence = e.ConfidenceFactors.confidence()
+	}
+}
+
+// updateConfidence updates the confidence of an event with the largest
+// region of motion on the current frame
+func (e *Event) updateConfidence(largest region, floor float64) {
+	e.motionFrames++
+	e.soliditySum += solidity(largest)
+	f := &e.ConfidenceFactors
+	f.Size = e.MaxArea / (e.MaxArea + floor)
+	f.Persistence = float64(e.motionFrames) / float64(e.motionFrames+persistenceFrames)
+	f.Solidity = e.soliditySum / float64(e.motionFrames)
+	e.Confidence = f.confidence()
+}
+
+// solidity returns the area of a region relative to that of the convex
+// hull of its contour
+func solidity(r region) float64 {
+	hull := hullArea(r.contour)
+	if hull <= 0 || r.area >= hull {
+		return 1
+	}
+	return r.area / hull
+}
+
+// hullArea returns the area of the convex hull of the given points, computed
+// with Andrew's monotone chain algorithm
+func hullArea(points []image.Point) float64 {
+	if len(points) < 3 {
+		return 0
+	}
+	pts := append([]image.Point{}, points...)
+	sort.Slice(pts, func(i, j int) bool {
+		return pts[i].X < pts[j].X || (pts[i].X == pts[j].X && pts[i].Y < pts[j].Y)
+	})
+	cross := func(o, a, b image.Point) int {
+		return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+	}
+	hull := make([]image.Point, 0, 2*len(pts))
+	for _, p := range pts {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(pts) - 2; i >= 0; i-- {
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], pts[i]) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, pts[i])
+	}
+	// the shoelace formula, the last point is the first one again
+	area := 0
+	for i := 0; i < len(hull)-1; i++ {
+		area += hull[i].X*hull[i+1].Y - hull[i+1].X*hull[i].Y
+	}
+	return math.Abs(float64(area)) / 2
+}
@@ -0,0 +1,334 @@
+package detector
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+)
+
+// Config is a detector's configuration, which can be kept in a file, e.g. as
+// suggested by Calibrate, and applied with WithConfig. Zero values leave the
+// defaults. Config returns the effective configuration of a detector
+type Config struct {
+	// Sensitivity is the minimum diff contour area, see WithSensitivity
+	Sensitivity float64 `json:"sensitivity,omitempty"`
+	// Threshold is the minimum pixel difference, see WithThreshold
+	Threshold float64 `json:"threshold,omitempty"`
+	// NightMode and NightThreshold set the low light processing, see
+	// WithNightMode and WithNightThreshold
+	NightMode      NightMode `json:"night_mode,omitempty"`
+	NightThreshold float64   `json:"night_threshold,omitempty"`
+	// EventGap is the number of frames without motion which end an event,
+	// see WithEventGap
+	EventGap int    `json:"event_gap,omitempty"`
+	Zones    []Zone `json:"zones,omitempty"`
+	// PrivacyZones and PrivacyMode hide areas of frames, see
+	// WithPrivacyZones
+	PrivacyZones []Zone      `json:"privacy_zones,omitempty"`
+	PrivacyMode  PrivacyMode `json:"privacy_mode,omitempty"`
+	// Stabilization is the largest camera shake compensated for, see
+	// WithStabilization
+	Stabilization int      `json:"stabilization,omitempty"`
+	Fisheye       *Fisheye `json:"fisheye,omitempty"`
+	// SpeckFilter is set when specks are ignored, see WithSpeckFilter
+	SpeckFilter *SpeckFilter `json:"speck_filter,omitempty"`
+	// MinObjectHeight is in meters, see WithMinObjectHeight
+	MinObjectHeight float64 `json:"min_object_height,omitempty"`
+	// FusionMode and FusionWindow combine motion with external sensors,
+	// see WithSensorFusion
+	FusionMode    FusionMode     `json:"fusion_mode,omitempty"`
+	FusionWindow  time.Duration  `json:"fusion_window,omitempty"`
+	CountingLines []CountingLine `json:"counting_lines,omitempty"`
+	// PlateCapture is set in license plate capture mode, without its
+	// reader, see WithPlateCapture
+	PlateCapture *PlateCapture `json:"plate_capture,omitempty"`
+	// Disarmed and DryRun are whether the detector doesn't report motion,
+	// see Disarm, or only logs it, see WithDryRun
+	Disarmed bool `json:"disarmed,omitempty"`
+	DryRun   bool `json:"dry_run,omitempty"`
+	// Language is the language of the statuses rendered onto frames, see
+	// WithLanguage
+	Language string `json:"language,omitempty"`
+	// Camera identifies the camera, see WithIdentity
+	Camera          *Identity        `json:"camera,omitempty"`
+	SnapshotHistory *SnapshotHistory `json:"snapshot_history,omitempty"`
+	// BestShot is set when the best snapshot of each event is picked, see
+	// WithBestShot
+	BestShot *BestShotSelection `json:"best_shot,omitempty"`
+	// CameraControls are set when the camera is opened, see
+	// WithCameraControls
+	CameraControls map[CameraControl]float64 `json:"camera_controls,omitempty"`
+	Flicker        *FlickerCompensation      `json:"flicker_compensation,omitempty"`
+	// V4L2Controls are set when the camera is opened, see WithV4L2Controls
+	V4L2Controls map[string]int32 `json:"v4l2_controls,omitempty"`
+	// Reconnect is the interval a disconnected camera is looked for at, see
+	// WithReconnect
+	Reconnect  time.Duration `json:"reconnect,omitempty"`
+	FrameQueue *FrameQueue   `json:"frame_queue,omitempty"`
+	// Workers is the size of the pool busy frames are processed across,
+	// see WithWorkers
+	Workers      int           `json:"workers,omitempty"`
+	IdleSkipping *IdleSkipping `json:"idle_skipping,omitempty"`
+	Sleep        *SleepMode    `json:"sleep,omitempty"`
+	// SlowSubjects is set with WithSlowSubjects
+	SlowSubjects          bool                   `json:"slow_subjects,omitempty"`
+	VehicleClassification *VehicleClassification `json:"vehicle_classification,omitempty"`
+
+	// Profile is the name of the profile last applied, see ApplyProfile,
+	// and Handlers are the callbacks which were set, e.g. "event" for
+	// WithEventHandler. They are reported by Config and ignored by
+	// WithConfig
+	Profile  string   `json:"profile,omitempty"`
+	Handlers []string `json:"handlers,omitempty"`
+}
+
+// SpeckFilter is the configuration of the speck filter, see WithSpeckFilter
+type SpeckFilter struct {
+	MinLifetime int     `json:"min_lifetime"`
+	MaxSpeed    float64 `json:"max_speed"`
+}
+
+// SnapshotHistory is the configuration of the snapshot history, see
+// WithSnapshotHistory
+type SnapshotHistory struct {
+	Size   int    `json:"size"`
+	Zone   string `json:"zone,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// WithConfig applies the settings of a Config, options after it override
+// them
+func WithConfig(c Config) Option {
+	return func(d *Detector) {
+		if c.Sensitivity > 0 {
+			d.minDiffContourArea = c.Sensitivity
+		}
+		if c.Threshold > 0 {
+			d.threshold = c.Threshold
+		}
+		if c.NightMode != NightOff {
+			d.nightMode = c.NightMode
+		}
+		if c.NightThreshold > 0 {
+			d.nightThreshold = c.NightThreshold
+		}
+		if c.EventGap > 0 {
+			d.eventGap = c.EventGap
+		}
+		d.zones = append(d.zones, c.Zones...)
+		if len(c.PrivacyZones) > 0 {
+			WithPrivacyZones(c.PrivacyMode, c.PrivacyZones...)(d)
+		}
+		if c.Stabilization > 0 {
+			WithStabilization(c.Stabilization)(d)
+		}
+		if c.Fisheye != nil {
+			WithFisheye(*c.Fisheye)(d)
+		}
+		if c.SpeckFilter != nil {
+			WithSpeckFilter(c.SpeckFilter.MinLifetime, c.SpeckFilter.MaxSpeed)(d)
+		}
+		if c.MinObjectHeight > 0 {
+			d.minObjectHeight = c.MinObjectHeight
+		}
+		if c.FusionMode != FusionVisualOnly {
+			WithSensorFusion(c.FusionMode, c.FusionWindow)(d)
+		}
+		if len(c.CountingLines) > 0 {
+			WithCountingLines(c.CountingLines...)(d)
+		}
+		if c.PlateCapture != nil {
+			WithPlateCapture(*c.PlateCapture)(d)
+		}
+		if c.Disarmed {
+			d.disarmed = true
+		}
+		if c.DryRun {
+			d.dryRun = true
+		}
+		if c.Language != "" {
+			WithLanguage(c.Language)(d)
+		}
+		if c.Camera != nil {
+			WithIdentity(*c.Camera)(d)
+		}
+		if len(c.CameraControls) > 0 {
+			WithCameraControls(c.CameraControls)(d)
+		}
+		if len(c.V4L2Controls) > 0 {
+			WithV4L2Controls(c.V4L2Controls)(d)
+		}
+		if c.Reconnect > 0 {
+			WithReconnect(c.Reconnect)(d)
+		}
+		if c.IdleSkipping != nil {
+			WithIdleSkipping(*c.IdleSkipping)(d)
+		}
+		if c.Sleep != nil {
+			WithSleepMode(*c.Sleep)(d)
+		}
+		if c.SlowSubjects {
+			WithSlowSubjects()(d)
+		}
+		if c.VehicleClassification != nil {
+			WithVehicleClassification(*c.VehicleClassification)(d)
+		}
+		if c.Workers > 0 {
+			WithWorkers(c.Workers)(d)
+		}
+		if c.FrameQueue != nil {
+			WithFrameQueue(*c.FrameQueue)(d)
+		}
+		if c.Flicker != nil {
+			WithFlickerCompensation(*c.Flicker)(d)
+		}
+		if h := c.SnapshotHistory; h != nil {
+			WithSnapshotHistory(h.Size, SnapshotOptions{Zone: h.Zone, Width: h.Width, Height: h.Height})(d)
+		}
+		if c.BestShot != nil {
+			WithBestShot(*c.BestShot)(d)
+		}
+	}
+}
+
+// Config returns the effective configuration of the detector, after its
+// options, profiles and changes made while it runs, e.g. for dashboards or
+// to attach to support requests
+func (d *Detector) Config() Config {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.configLocked()
+}
+
+// configLocked returns the effective configuration, the caller must hold the
+// detector's lock
+func (d *Detector) configLocked() Config {
+	c := Config{
+		Sensitivity:     d.minDiffContourArea,
+		Threshold:       d.threshold,
+		NightMode:       d.nightMode,
+		NightThreshold:  d.nightThreshold,
+		EventGap:        d.eventGap,
+		Zones:           append([]Zone{}, d.zones...),
+		PrivacyZones:    append([]Zone{}, d.privacyZones...),
+		PrivacyMode:     d.privacyMode,
+		Stabilization:   d.maxShift,
+		MinObjectHeight: d.minObjectHeight,
+		FusionMode:      d.fusionMode,
+		FusionWindow:    d.fusionWindow,
+		CountingLines:   []CountingLine{},
+		Disarmed:        d.disarmed,
+		DryRun:          d.dryRun,
+		Language:        d.language,
+		Camera:          d.eventIdentity(),
+		Reconnect:       d.reconnectInterval,
+		SlowSubjects:    d.slowSubjects,
+		Profile:         d.profile,
+		Handlers:        []string{},
+	}
+	if d.fisheye != nil {
+		f := *d.fisheye
+		c.Fisheye = &f
+	}
+	if len(d.cameraControls) > 0 {
+		c.CameraControls = map[CameraControl]float64{}
+		for control, v := range d.cameraControls {
+			c.CameraControls[control] = v
+		}
+	}
+	if len(d.v4l2Controls) > 0 {
+		c.V4L2Controls = map[string]int32{}
+		for name, v := range d.v4l2Controls {
+			c.V4L2Controls[name] = v
+		}
+	}
+	if d.workers != nil {
+		c.Workers = d.workers.size
+	}
+	if d.idle != nil {
+		s := d.idle.config
+		c.IdleSkipping = &s
+	}
+	if d.sleep != nil {
+		s := d.sleep.config
+		c.Sleep = &s
+	}
+	if d.queue != nil {
+		q := d.queue.config
+		c.FrameQueue = &q
+	}
+	if d.flicker != nil {
+		f := d.flicker.config
+		c.Flicker = &f
+	}
+	if h := d.history; h != nil {
+		c.SnapshotHistory = &SnapshotHistory{Size: len(h.snapshots), Zone: h.opts.Zone, Width: h.opts.Width, Height: h.opts.Height}
+	}
+	if d.bestShot != nil {
+		b := d.bestShot.config
+		c.BestShot = &b
+	}
+	if d.specks != nil {
+		c.SpeckFilter = &SpeckFilter{MinLifetime: d.specks.minLifetime, MaxSpeed: d.specks.maxSpeed}
+	}
+	for _, l := range d.lineCounters {
+		c.CountingLines = append(c.CountingLines, l.line)
+	}
+	if d.vehicleClassification != nil {
+		v := *d.vehicleClassification
+		c.VehicleClassification = &v
+	}
+	if d.plateCapture != nil {
+		p := *d.plateCapture
+		p.Reader = nil
+		c.PlateCapture = &p
+	}
+	for name, set := range map[string]bool{
+		"detect":          d.onDetect != nil,
+		"event":           d.onEvent != nil,
+		"error":           d.onError != nil,
+		"frame_hook":      d.frameHook != nil,
+		"track":           d.onTrack != nil,
+		"occupancy":       d.onOccupancy != nil,
+		"preprocess_hook": d.preprocessHook != nil,
+		"plates":          d.plateCapture != nil && d.plateCapture.Reader != nil,
+		"track_rules":     len(d.trackRules) > 0,
+		"inactivity":      len(d.inactivityRules) > 0,
+		"packages":        len(d.packageWatchers) > 0,
+		"focus":           d.focus != nil,
+		"scene_change":    d.scene != nil,
+	} {
+		if set {
+			c.Handlers = append(c.Handlers, name)
+		}
+	}
+	sort.Strings(c.Handlers)
+	return c
+}
+
+// LoadConfig reads a Config from a JSON file
+func LoadConfig(path string) (Config, error) {
+	c := Config{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// Save writes the Config to a JSON file, replacing it if it exists
+func (c Config) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so the file is never half written
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
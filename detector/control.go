@@ -0,0 +1,39 @@
+package detector
+
+// Arm makes the detector report motion, detectors are armed when created
+func (d *Detector) Arm() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.disarmed = false
+}
+
+// Disarm stops the detector from reporting motion, frames are still
+// processed and shown but the on-detect function and event handler aren't
+// called until it is armed again. An ongoing event ends after the event gap
+func (d *Detector) Disarm() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.disarmed = true
+}
+
+// Armed returns whether the detector is reporting motion
+func (d *Detector) Armed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !d.disarmed
+}
+
+// SetSensitivity changes the minimum diff contour area for motion to be
+// detected while the detector is running, see WithSensitivity
+func (d *Detector) SetSensitivity(minDiffContourArea float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.minDiffContourArea = minDiffContourArea
+}
+
+// Sensitivity returns the minimum diff contour area for motion to be detected
+func (d *Detector) Sensitivity() float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.minDiffContourArea
+}
@@ -0,0 +1,123 @@
+package detector
+
+import (
+	"image"
+	"time"
+)
+
+// countingHistory is how long the hourly counts of crossings are kept for
+const countingHistory = 31 * 24 * time.Hour
+
+// CountingLine is a line objects are counted crossing, e.g. across a shop's
+// entrance for footfall counting. Looking from A towards B, objects crossing
+// from right to left count as in and from left to right as out
+type CountingLine struct {
+	Name string      `json:"name"`
+	A    image.Point `json:"a"`
+	B    image.Point `json:"b"`
+}
+
+// LineCount is the number of objects which crossed a counting line in each
+// direction during the period which started at Start
+type LineCount struct {
+	Start time.Time `json:"start"`
+	In    int       `json:"in"`
+	Out   int       `json:"out"`
+}
+
+// LineStats are the counts of crossings of a counting line
+type LineStats struct {
+	Line string `json:"line"`
+	// In and Out are the total counts since the detector was created
+	In  int `json:"in"`
+	Out int `json:"out"`
+	// Hourly are the counts in each hour of the last day, and Daily those
+	// of each day of the last month, the current one last. Periods without
+	// crossings are left out
+	Hourly []LineCount `json:"hourly"`
+	Daily  []LineCount `json:"daily"`
+}
+
+// lineCounter counts the crossings of a counting line
+type lineCounter struct {
+	line    CountingLine
+	in, out int
+	hours   []LineCount
+}
+
+// WithCountingLines counts the tracked objects which cross the given lines
+// in each direction, see Stats
+func WithCountingLines(lines ...CountingLine) Option {
+	return func(d *Detector) {
+		for _, l := range lines {
+			d.lineCounters = append(d.lineCounters, &lineCounter{line: l})
+		}
+	}
+}
+
+// countCrossings counts an object moving from one position to another on
+// the lines it crossed
+func (d *Detector) countCrossings(from, to image.Rectangle, now time.Time) {
+	p, q := midpoint(from), midpoint(to)
+	for _, c := range d.lineCounters {
+		if side := crossing(c.line.A, c.line.B, p, q); side != 0 {
+			c.count(side > 0, now)
+		}
+	}
+}
+
+// count counts a crossing in the given direction
+func (c *lineCounter) count(in bool, now time.Time) {
+	hour := now.Truncate(time.Hour)
+	if len(c.hours) == 0 || !c.hours[len(c.hours)-1].Start.Equal(hour) {
+		c.hours = append(c.hours, LineCount{Start: hour})
+	}
+	for len(c.hours) > 0 && now.Sub(c.hours[0].Start) > countingHistory {
+		c.hours = c.hours[1:]
+	}
+	if in {
+		c.in++
+		c.hours[len(c.hours)-1].In++
+	} else {
+		c.out++
+		c.hours[len(c.hours)-1].Out++
+	}
+}
+
+// stats returns the counts of the line
+func (c *lineCounter) stats(now time.Time) LineStats {
+	s := LineStats{Line: c.line.Name, In: c.in, Out: c.out, Hourly: []LineCount{}, Daily: []LineCount{}}
+	for _, h := range c.hours {
+		if now.Sub(h.Start) < 24*time.Hour {
+			s.Hourly = append(s.Hourly, h)
+		}
+		y, m, day := h.Start.In(now.Location()).Date()
+		start := time.Date(y, m, day, 0, 0, 0, 0, now.Location())
+		if n := len(s.Daily); n == 0 || !s.Daily[n-1].Start.Equal(start) {
+			s.Daily = append(s.Daily, LineCount{Start: start})
+		}
+		s.Daily[len(s.Daily)-1].In += h.In
+		s.Daily[len(s.Daily)-1].Out += h.Out
+	}
+	return s
+}
+
+// crossing returns whether the segment from p to q crosses the line from a
+// to b, positive when q is to the left of the line looking from a towards b
+// and negative when it is to the right, zero when it doesn't cross it.
+// Points on the line count as being to its right
+func crossing(a, b, p, q image.Point) int {
+	// image coordinates have y pointing down, so a positive cross product
+	// is a clockwise turn, i.e. to the right
+	side := func(o, a, b image.Point) int {
+		if (a.X-o.X)*(b.Y-o.Y)-(a.Y-o.Y)*(b.X-o.X) >= 0 {
+			return 1
+		}
+		return -1
+	}
+	sq := side(a, b, q)
+	if side(a, b, p) == sq || side(p, q, a) == side(p, q, b) {
+		return 0
+	}
+	return -sq
+}
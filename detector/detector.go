@@ -2,16 +2,14 @@ package detector
 
 import (
 	"fmt"
-	"image"
 	"image/color"
-	"log"
+	"sync"
+	"time"
 
-	"gocv.io/x/gocv"
+	"github.com/adrianosela/GoAway/v4l2"
 )
 
 const (
-	escapeKey = 27
-
 	// NotSensitive represents a large mimumum diff contour area of an image
 	// for a minimum sensitivity (not very sensitive) motion detector
 	NotSensitive = 9000
@@ -36,6 +34,14 @@ const (
 	// DetectorStatusClosed is the status of the detector when it is no
 	// longer being closed, once it is closed, it cannot be re-initialized
 	DetectorStatusClosed = "Closed"
+
+	// DetectorStatusReconnecting is the status of the detector while its
+	// camera is disconnected, see WithReconnect
+	DetectorStatusReconnecting = "Reconnecting"
+
+	// DetectorStatusAsleep is the status of the detector while its capture
+	// is suspended, see WithSleepMode
+	DetectorStatusAsleep = "Asleep"
 )
 
 var (
@@ -46,131 +52,366 @@ var (
 
 // Detector is an abstraction for a motion detector
 type Detector struct {
-	camera             *gocv.VideoCapture
-	window             *gocv.Window
-	baseImgMatrix      gocv.Mat
-	diffMatrix         gocv.Mat
-	threshMatrix       gocv.Mat
-	bgSubtractor       gocv.BackgroundSubtractorMOG2
+	// mu guards the current frame and status, which are read by
+	// other goroutines while frames are being processed
+	mu                 sync.Mutex
+	backend            backend
 	statusColor        color.RGBA
 	minDiffContourArea float64
+	threshold          float64
+	nightThreshold     float64
+	nightMode          NightMode
+	night              bool
+	maxShift           int
+	fisheye            *Fisheye
+	specks             *speckFilter
+	minObjectHeight    float64
+	noiseFloor         float64
+	plateCapture       *PlateCapture
+	plateCrops         []PlateCrop
+	bestShot           *bestShot
+	focus              *focusMonitor
+	profile            string
 	status             string
 	onDetect           func()
+	onEvent            func(Event)
+	onError            func(error)
+	onTrack            func(Track)
+	tracks             []*Track
+	nextTrackID        int
+	trackRules         []*trackRule
+	inactivityRules    []*inactivityRule
+	packageWatchers    []*packageWatcher
+	lineCounters       []*lineCounter
+	occupancy          map[string]*zoneOccupancy
+	onOccupancy        func(OccupancyChange)
+	pending            []func()
+	eventGap           int
+	event              *Event
+	quietFrames        int
+	frame              int
+	frameInfo          FrameInfo
+	decodeTimer        DecodeTimer
+	motionFrames       int
+	events             int
+	noWindow           bool
+	zones              []Zone
+	privacyZones       []Zone
+	privacyMode        PrivacyMode
+	disarmed           bool
+	dryRun             bool
+	dryRunEvents       []Event
+	fusionMode         FusionMode
+	fusionWindow       time.Duration
+	lastTrigger        time.Time
+	language           string
+	statusText         map[string]string
+	identity           Identity
+	history            *snapshotHistory
+	cameraControls     map[CameraControl]float64
+	flicker            *flickerCompensator
+	v4l2Controls       map[string]int32
+	reconnectInterval  time.Duration
+	queue              *frameQueue
+	workers            *workerPool
+	zoneCache          zoneBoundsCache
+	latency            latencies
+	frameHook          FrameHook
+	preprocessHook     FrameHook
+	// camera is the camera read from, to reopen it once reconnected or
+	// awake
+	camera *cameraDevice
+	// clock measures the stages of the frame being processed
+	clock *stageClock
+	// detecting waits for the on-detect functions which are running, none
+	// are started once closed
+	detecting sync.WaitGroup
+	closed    bool
+	// now tells the time frames are processed at, replaced by tests
+	now   func() time.Time
+	idle  *idleSkipper
+	sleep *sleeper
+	// slowSubjects keeps slow and resting subjects in the foreground longer
+	slowSubjects          bool
+	vehicleClassification *VehicleClassification
+	// sharpness is that of the frame last measured, see updateSharpness
+	sharpness float64
+	scene     *sceneMonitor
+	// captures are when the latest frames were captured, for FPS
+	captures frameRate
 }
 
-func (d *Detector) waitForNextFrame() error {
-	for {
-		if ok := d.camera.Read(&d.baseImgMatrix); !ok {
-			return fmt.Errorf("Video Device Closed")
-		}
-		if !d.baseImgMatrix.Empty() {
-			d.status, d.statusColor = DetectorStatusReady, statusReadyColor
-			return nil
-		}
+// processFrame runs the detection pipeline on the frame which was last read,
+// at the given time after reading for the given duration. It returns the
+// event which ended on the frame, if any, and whether the user asked for the
+// detector to stop
+func (d *Detector) processFrame(captured time.Time, read time.Duration) (*Event, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.frame++
+	now := d.now()
+	d.status, d.statusColor = DetectorStatusReady, statusReadyColor
+	d.latency.add(StageCapture, read)
+	d.clock = newStageClock()
+	if d.decodeTimer != nil {
+		read = d.decodeTimer.DecodeLatency()
+	}
+	d.frameInfo = FrameInfo{Sequence: d.frame, Captured: captured, DecodeLatency: read}
+	d.captures.add(captured)
+	d.night = d.backend.prepareCurrentFrame(frameParams{
+		threshold:      d.threshold,
+		nightThreshold: d.nightThreshold,
+		night:          d.nightMode,
+		preprocess:     d.preprocessHook,
+		info:           d.frameInfo,
+		clock:          d.clock,
+	})
+	d.frameInfo.Size = d.backend.frameSize()
+	if d.flicker != nil {
+		d.flicker.update(d.backend.brightness())
 	}
+	regions := d.findAndDrawContours(now)
+	d.updateInactivity(regions, now)
+	if !d.reporting() {
+		regions = nil
+	}
+	ended := d.trackEvent(regions, now)
+	d.updateTracks(regions, now)
+	d.updatePackages(now)
+	d.updateIdle(now)
+	d.updateSleep(now)
+	d.clock.mark(StageTracking)
+	done := d.backend.displayResult(d.displayStatus(), d.statusColor, d.frameInfo)
+	d.clock.mark(StageDrawing)
+	d.clock.record(&d.latency)
+	return ended, done
 }
 
-func (d *Detector) prepareCurrentFrame() {
-	// foreground (diff matrix) = curFrame - prevFrame
-	d.bgSubtractor.Apply(d.baseImgMatrix, &d.diffMatrix)
-	// get rid of pixels with too small or too large values
-	gocv.Threshold(d.diffMatrix, &d.threshMatrix, 25, 255, gocv.ThresholdBinary)
-	// Dilate: transformation that produces an image that is the same shape as the
-	// original, but is a different size
-	kernel := gocv.GetStructuringElement(gocv.MorphRect, image.Pt(3, 3))
-	defer kernel.Close()
-	gocv.Dilate(d.threshMatrix, &d.threshMatrix, kernel)
+// reporting returns whether detected motion should be reported, it isn't
+// while the detector is disarmed or external sensors don't confirm it
+func (d *Detector) reporting() bool {
+	return !d.disarmed && d.sensorAllows()
 }
 
-func (d *Detector) findAndDrawContours() {
-	contours := gocv.FindContours(d.threshMatrix, gocv.RetrievalExternal, gocv.ChainApproxSimple)
-	for i, c := range contours {
-		area := gocv.ContourArea(c)
-		if area < d.minDiffContourArea {
-			continue
-		}
+func (d *Detector) findAndDrawContours(now time.Time) []region {
+	regions, noise := d.backend.findContours(d.minArea())
+	d.noiseFloor += noiseFloorDecay * (noise - d.noiseFloor)
+	if len(d.zones) > 0 {
+		regions = d.filterZoneAreas(regions)
+	}
+	if d.specks != nil {
+		regions = d.specks.filter(regions)
+	}
+	if d.minObjectHeight > 0 {
+		regions = d.filterSmallObjects(regions)
+	}
+	if d.flicker != nil {
+		regions = d.flicker.filter(regions, d.frameInfo.Size)
+	}
+	report := d.reporting()
+	if d.plateCapture != nil && report && len(regions) > 0 {
+		d.capturePlate(regions)
+	}
+	if d.bestShot != nil && report && len(regions) > 0 {
+		d.captureBestShot(regions)
+	}
+	d.updateSharpness(regions, report, now)
+	d.updateScene(now)
+	d.clock.mark(StageContours)
+	for _, r := range regions {
 		d.status, d.statusColor = DetectorStatusMotionDetected, statusMotionDetectedColor
 		// run user provided on-detect function
-		if d.onDetect != nil {
-			go d.onDetect()
+		if d.onDetect != nil && report && !d.dryRun && !d.closed {
+			d.detecting.Add(1)
+			go func() {
+				defer d.detecting.Done()
+				d.safeCall(d.onDetect)
+			}()
 		}
-		gocv.DrawContours(&d.baseImgMatrix, contours, i, d.statusColor, 2)
-		rect := gocv.BoundingRect(c)
-		gocv.Rectangle(&d.baseImgMatrix, rect, boundingRectColor, 2)
+		d.backend.drawRegion(r, d.statusColor)
 	}
+	d.clock.mark(StageDrawing)
+	return regions
 }
 
-func (d *Detector) displayResult() bool {
-	gocv.PutText(&d.baseImgMatrix, d.status, image.Pt(10, 20), gocv.FontHersheyPlain, 1.2, d.statusColor, 2)
-	d.window.IMShow(d.baseImgMatrix)
-	return d.window.WaitKey(1) == escapeKey
+func newDetector(onDetect func(), opts []Option) *Detector {
+	d := &Detector{
+		statusColor:        statusReadyColor,
+		status:             DetectorStatusReady,
+		onDetect:           onDetect,
+		minDiffContourArea: NotSensitive,
+		threshold:          DefaultThreshold,
+		nightThreshold:     DefaultNightThreshold,
+		eventGap:           DefaultEventGap,
+		frame:              -1,
+		now:                time.Now,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// backendConfig returns the configuration for the detector's backend
+func (d *Detector) backendConfig(winTitle string) backendConfig {
+	return backendConfig{
+		winTitle:     winTitle,
+		noWindow:     d.noWindow,
+		privacyZones: d.privacyZones,
+		privacyMode:  d.privacyMode,
+		maxShift:     d.maxShift,
+		fisheye:      d.fisheye,
+		frameHook:    d.frameHook,
+		workers:      d.workers,
+		slowSubjects: d.slowSubjects,
+	}
 }
 
 // NewMotionDetector is the constructor for a Detector
-func NewMotionDetector(camID int, winTitle string, onDetect func()) (*Detector, error) {
-	cam, err := gocv.OpenVideoCapture(camID)
+func NewMotionDetector(camID int, winTitle string, onDetect func(), opts ...Option) (*Detector, error) {
+	d := newDetector(onDetect, opts)
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	b, err := newCameraBackend(camID, d.backendConfig(winTitle))
 	if err != nil {
 		return nil, err
 	}
-	return &Detector{
-		camera:             cam,
-		window:             gocv.NewWindow(winTitle),
-		baseImgMatrix:      gocv.NewMat(),
-		diffMatrix:         gocv.NewMat(),
-		threshMatrix:       gocv.NewMat(),
-		bgSubtractor:       gocv.NewBackgroundSubtractorMOG2(),
-		statusColor:        statusReadyColor,
-		status:             DetectorStatusReady,
-		onDetect:           onDetect,
-		minDiffContourArea: NotSensitive,
-	}, nil
+	if err := d.applyCameraControls(b.setControl); err != nil {
+		b.close()
+		return nil, err
+	}
+	if err := d.applyV4L2Controls(v4l2.DevicePath(camID)); err != nil {
+		b.close()
+		return nil, err
+	}
+	d.camera = newCameraDevice(camID)
+	d.backend = b
+	return d, nil
+}
+
+// NewMotionDetectorForDevice is the constructor for a Detector of a camera
+// selected by a device spec rather than its ID, which can change when
+// cameras are re-enumerated, e.g. a /dev/v4l/by-id path or a USB serial
+// number, see v4l2.Resolve. IDs are also accepted, e.g. "0"
+func NewMotionDetectorForDevice(device string, winTitle string, onDetect func(), opts ...Option) (*Detector, error) {
+	info, err := v4l2.Resolve(device)
+	if err != nil {
+		return nil, fmt.Errorf("could not find camera %q: %w", device, err)
+	}
+	return NewMotionDetector(info.Index, winTitle, onDetect, opts...)
 }
 
-// Start initializes the motion detector
+// NewMotionDetectorFromSource is the constructor for a Detector which reads
+// its frames from the given Source rather than from a camera device
+func NewMotionDetectorFromSource(src Source, winTitle string, onDetect func(), opts ...Option) (*Detector, error) {
+	d := newDetector(onDetect, opts)
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	d.decodeTimer, _ = src.(DecodeTimer)
+	err := d.applyCameraControls(func(c CameraControl, value float64) error {
+		return sourceControl(src, c, value)
+	})
+	if err == nil {
+		err = d.applyV4L2Controls("")
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := newSourceBackend(src, d.backendConfig(winTitle))
+	if err != nil {
+		return nil, err
+	}
+	d.backend = b
+	return d, nil
+}
+
+// Start initializes the motion detector, any ongoing event and tracks are
+// ended when it returns
 func (d *Detector) Start() error {
+	defer d.stop()
 	for {
-		if err := d.waitForNextFrame(); err != nil {
+		_, done, err := d.step()
+		if err != nil {
 			return err
 		}
-		d.prepareCurrentFrame()
-		d.findAndDrawContours()
-		if done := d.displayResult(); done {
-			break
+		if done {
+			return nil
 		}
 	}
-	return nil
+}
+
+// step reads and processes the next frame, it returns whether a frame was
+// processed, rather than skipped or not read as the detector slept or
+// reconnected, and whether the user asked for the detector to stop
+func (d *Detector) step() (bool, bool, error) {
+	if slept, err := d.doze(); slept || err != nil {
+		return false, false, err
+	}
+	// frames are read into a staging buffer, so snapshots and status
+	// remain available while waiting on the device
+	captured, read, err := d.readFrame()
+	if err != nil {
+		if err = d.reconnect(err); err != nil {
+			d.reportError(OpRead, err)
+			return false, false, err
+		}
+		return false, false, nil
+	}
+	d.mu.Lock()
+	skip := d.skipFrame()
+	d.mu.Unlock()
+	if skip {
+		return false, false, nil
+	}
+	ended, done := d.processFrame(captured, read)
+	d.recordSnapshot()
+	d.lockExposure()
+	d.handleEvent(ended)
+	d.runPending()
+	return true, done, nil
+}
+
+// stop ends any ongoing event and tracks once frames are no longer processed
+func (d *Detector) stop() {
+	d.handleEvent(d.endEvent())
+	d.mu.Lock()
+	d.endTracks()
+	d.mu.Unlock()
+	d.runPending()
 }
 
 // Status returns the status of the detector
 func (d *Detector) Status() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	return d.status
 }
 
 // SnapshotJPG returns a jpg encoded byte slice containing
 // the latest image taken from the video capture device
 func (d *Detector) SnapshotJPG() ([]byte, error) {
-	return gocv.IMEncode(".jpg", d.baseImgMatrix)
+	return d.Snapshot(SnapshotOptions{})
 }
 
-// Close handles closing gocv resources
+// Close handles closing the resources held by the detector, any resource
+// which fails to close is reported to the error handler. It returns once the
+// on-detect functions which are running have returned
 func (d *Detector) Close() {
+	d.mu.Lock()
 	d.status = DetectorStatusClosed
-	if err := d.camera.Close(); err != nil {
-		log.Printf("could not close camera: %s", err)
-	}
-	if err := d.window.Close(); err != nil {
-		log.Printf("could not close window: %s", err)
-	}
-	if err := d.baseImgMatrix.Close(); err != nil {
-		log.Printf("could not close image matrix: %s", err)
-	}
-	if err := d.diffMatrix.Close(); err != nil {
-		log.Printf("could not close diff matrix: %s", err)
+	d.closed = true
+	if d.sleep != nil {
+		d.sleep.signal()
 	}
-	if err := d.threshMatrix.Close(); err != nil {
-		log.Printf("could not close threshold matrix: %s", err)
+	if d.queue != nil {
+		d.queue.close(d.backend)
 	}
-	if err := d.bgSubtractor.Close(); err != nil {
-		log.Printf("could not close background subtractor: %s", err)
+	errs := d.backend.close()
+	d.mu.Unlock()
+	for _, err := range errs {
+		d.reportError(OpClose, err)
 	}
+	d.detecting.Wait()
 }
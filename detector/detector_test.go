@@ -0,0 +1,1144 @@
+//go:build purego || nogui
+// +build purego nogui
+
+package detector_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/detector/sourcetest"
+)
+
+// detections runs a detector over the given source and returns the number
+// of times its on-detect function was called, the detector is disarmed
+// before starting if disarm is set
+func detections(t *testing.T, src detector.Source, disarm bool, opts ...detector.Option) int32 {
+	var n int32
+	md, err := detector.NewMotionDetectorFromSource(src, "", func() {
+		atomic.AddInt32(&n, 1)
+	}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disarm {
+		md.Disarm()
+	}
+	if err := md.Start(); err != io.EOF {
+		md.Close()
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	// on-detect functions run on their own goroutines, closing waits for
+	// them
+	md.Close()
+	return atomic.LoadInt32(&n)
+}
+
+func TestStaticSceneHasNoMotion(t *testing.T) {
+	if n := detections(t, sourcetest.New(320, 240, 30), false); n != 0 {
+		t.Fatalf("expected no detections on a static scene, got %d", n)
+	}
+}
+
+func movingRect() *sourcetest.Source {
+	return sourcetest.New(320, 240, 40, sourcetest.Rect{
+		Start:    20,
+		End:      40,
+		Bounds:   image.Rect(0, 60, 120, 180),
+		Velocity: image.Pt(8, 0),
+	})
+}
+
+func TestMovingRectIsDetected(t *testing.T) {
+	if n := detections(t, movingRect(), false); n == 0 {
+		t.Fatal("expected the moving rectangle to be detected")
+	}
+}
+
+func TestDisarmedDetectorReportsNothing(t *testing.T) {
+	if n := detections(t, movingRect(), true); n != 0 {
+		t.Fatalf("expected no detections while disarmed, got %d", n)
+	}
+}
+
+func TestDryRunFiresNothing(t *testing.T) {
+	handled := 0
+	md, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil,
+		detector.WithDryRun(),
+		detector.WithEventHandler(func(e detector.Event) { handled++ }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	if handled != 0 {
+		t.Fatalf("expected no events to be handled in dry run mode, got %d", handled)
+	}
+	if events := md.DryRunEvents(); len(events) != 1 || !events[0].DryRun {
+		t.Fatalf("expected the event to be kept as a dry run, got %+v", events)
+	}
+	if n := detections(t, movingRect(), false, detector.WithDryRun()); n != 0 {
+		t.Fatalf("expected no detections in dry run mode, got %d", n)
+	}
+}
+
+func TestCalibrateSuggestsZonesForNoisyCells(t *testing.T) {
+	// a patch flickering in the top left corner, e.g. a swaying branch
+	src := sourcetest.New(320, 240, 120)
+	for i := 0; i < 120; i += 2 {
+		src.Rects = append(src.Rects, sourcetest.Rect{Start: i, End: i + 1, Bounds: image.Rect(10, 10, 60, 60)})
+	}
+	md, err := detector.NewMotionDetectorFromSource(src, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	c, err := md.Calibrate(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Frames == 0 || c.Suggested.Sensitivity != detector.VerySensitive {
+		t.Fatalf("expected the quiet scene to allow the highest sensitivity, got %+v", c)
+	}
+	if len(c.Suggested.Zones) != 1 || !image.Pt(35, 35).In(c.Suggested.Zones[0].Bounds) ||
+		c.Suggested.Zones[0].MinArea <= c.Suggested.Sensitivity {
+		t.Fatalf("expected a less sensitive zone over the flickering patch, got %+v", c.Suggested.Zones)
+	}
+}
+
+func TestInvalidConfigIsRejected(t *testing.T) {
+	_, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil,
+		detector.WithSensitivity(-1),
+		detector.WithZones(
+			detector.Zone{Name: "door", Bounds: image.Rect(0, 0, 100, 100), MinArea: 500},
+			detector.Zone{Name: "path", Bounds: image.Rect(50, 50, 150, 150), MinArea: 5000},
+			detector.Zone{Name: "path", Bounds: image.Rectangle{Min: image.Pt(100, 100)}},
+		),
+	)
+	var cErr *detector.ConfigError
+	if !errors.As(err, &cErr) || len(cErr.Problems) != 4 {
+		t.Fatalf("expected the negative sensitivity, empty bounds, duplicate name and contradictory zones to be reported, got %v", err)
+	}
+	if err := (detector.Config{Sensitivity: detector.DefaultSensitive}).Validate(); err != nil {
+		t.Fatalf("expected a valid configuration, got %v", err)
+	}
+}
+
+func TestConfigReportsEffectiveConfiguration(t *testing.T) {
+	md, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil,
+		detector.WithConfig(detector.Config{Threshold: 30, Zones: []detector.Zone{{Name: "door", Bounds: image.Rect(0, 0, 50, 50)}}}),
+		detector.WithSpeckFilter(0, 0),
+		detector.WithEventHandler(func(detector.Event) {}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	md.SetSensitivity(4000)
+	c := md.Config()
+	if c.Sensitivity != 4000 || c.Threshold != 30 || c.EventGap != detector.DefaultEventGap || len(c.Zones) != 1 {
+		t.Fatalf("expected the defaults, options and changes to be reported, got %+v", c)
+	}
+	if c.SpeckFilter == nil || c.SpeckFilter.MinLifetime != detector.DefaultSpeckLifetime || len(c.Handlers) != 1 || c.Handlers[0] != "event" {
+		t.Fatalf("expected the speck filter and event handler to be reported, got %+v", c)
+	}
+}
+
+// fallingSpecks returns a source of small specks crossing the frame within a
+// few frames, like rain drops
+func fallingSpecks() *sourcetest.Source {
+	src := sourcetest.New(320, 240, 40)
+	for i := 0; i < 10; i++ {
+		src.Rects = append(src.Rects, sourcetest.Rect{
+			Start:    10 + 3*i,
+			End:      16 + 3*i,
+			Bounds:   image.Rect(20+28*i, 0, 30+28*i, 10),
+			Velocity: image.Pt(0, 40),
+		})
+	}
+	return src
+}
+
+func TestSpeckFilterIgnoresSpecks(t *testing.T) {
+	sensitivity := detector.WithSensitivity(50)
+	if n := detections(t, fallingSpecks(), false, sensitivity); n == 0 {
+		t.Fatal("expected the specks to be detected without the filter")
+	}
+	if n := detections(t, fallingSpecks(), false, sensitivity, detector.WithSpeckFilter(0, 0)); n != 0 {
+		t.Fatalf("expected no detections of specks with the filter, got %d", n)
+	}
+	if n := detections(t, movingRect(), false, sensitivity, detector.WithSpeckFilter(0, 0)); n == 0 {
+		t.Fatal("expected the moving rectangle to be detected with the filter")
+	}
+}
+
+func TestMinObjectHeightFiltersSmallObjects(t *testing.T) {
+	// the moving rectangle is 120 pixels, 1.2 meters, tall
+	zones := detector.WithZones(detector.Zone{
+		Name:           "yard",
+		Bounds:         image.Rect(0, 0, 320, 240),
+		PixelsPerMeter: 100,
+	})
+	if n := detections(t, movingRect(), false, zones, detector.WithMinObjectHeight(1)); n == 0 {
+		t.Fatal("expected an object taller than the minimum height to be detected")
+	}
+	if n := detections(t, movingRect(), false, zones, detector.WithMinObjectHeight(1.5)); n != 0 {
+		t.Fatalf("expected no detections of an object shorter than the minimum height, got %d", n)
+	}
+}
+
+func TestPlateCaptureAttachesPlates(t *testing.T) {
+	var events []detector.Event
+	reads := 0
+	md, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil,
+		detector.WithEventHandler(func(e detector.Event) { events = append(events, e) }),
+		detector.WithPlateCapture(detector.PlateCapture{
+			Burst: 3,
+			Reader: func(jpg []byte) ([]detector.PlateCandidate, error) {
+				reads++
+				return []detector.PlateCandidate{{Text: "ABC123", Confidence: float64(reads) / 10}}, nil
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one event, got %d", len(events))
+	}
+	e := events[0]
+	if len(e.PlateCrops) != 3 {
+		t.Fatalf("expected a burst of 3 plate crops, got %d", len(e.PlateCrops))
+	}
+	if len(e.Plates) != 1 || e.Plates[0].Text != "ABC123" || e.Plates[0].Confidence != 0.3 {
+		t.Fatalf("expected the most confident reading of the plate, got %+v", e.Plates)
+	}
+	if e.Plates[0].Frame != e.PlateCrops[2].Frame {
+		t.Fatalf("expected the reading of frame %d, got %d", e.PlateCrops[2].Frame, e.Plates[0].Frame)
+	}
+}
+
+func TestZoneSensitivityOverridesDetector(t *testing.T) {
+	// the moving rectangle covers 14400 pixels
+	zone := detector.Zone{Name: "yard", Bounds: image.Rect(0, 0, 320, 240), MinArea: 20000}
+	if n := detections(t, movingRect(), false, detector.WithZones(zone)); n != 0 {
+		t.Fatalf("expected no detections of motion smaller than the zone's minimum area, got %d", n)
+	}
+	zone.MinArea = 1000
+	if n := detections(t, movingRect(), false, detector.WithSensitivity(20000), detector.WithZones(zone)); n == 0 {
+		t.Fatal("expected motion larger than the zone's minimum area to be detected")
+	}
+}
+
+func TestEventConfidence(t *testing.T) {
+	var events []detector.Event
+	md, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil,
+		detector.WithEventHandler(func(e detector.Event) { events = append(events, e) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one event, got %d", len(events))
+	}
+	// a large solid rectangle moving for 20 frames over a static scene
+	f := events[0].ConfidenceFactors
+	if events[0].Confidence < 0.6 || f.Solidity < 0.9 || f.Persistence < 0.8 {
+		t.Fatalf("expected a high confidence, got %.2f: %+v", events[0].Confidence, f)
+	}
+	events[0].SetClassifierAgreement(0)
+	if events[0].Confidence > 0.5 {
+		t.Fatalf("expected a classifier's disagreement to lower the confidence, got %.2f", events[0].Confidence)
+	}
+}
+
+func TestEventsCarryFrameInfo(t *testing.T) {
+	var events []detector.Event
+	md, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil,
+		detector.WithEventHandler(func(e detector.Event) { events = append(events, e) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one event, got %d", len(events))
+	}
+	start, end := events[0].StartFrameInfo, events[0].EndFrameInfo
+	if start.Sequence != events[0].StartFrame || end.Sequence != events[0].EndFrame || start.Size != image.Pt(320, 240) {
+		t.Fatalf("expected the metadata of the event's first and last frames, got %+v and %+v", start, end)
+	}
+	if start.Captured.IsZero() || end.Captured.Before(start.Captured) {
+		t.Fatalf("expected increasing capture times, got %s and %s", start.Captured, end.Captured)
+	}
+	if last := md.FrameInfo(); last.Sequence != 39 {
+		t.Fatalf("expected the last of 40 frames to be the last processed, got %+v", last)
+	}
+}
+
+func TestFramesIteratesAnnotatedFrames(t *testing.T) {
+	events := 0
+	md, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil,
+		detector.WithEventHandler(func(e detector.Event) { events++ }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	frames := md.Frames(detector.SnapshotOptions{Width: 160})
+	n, motion := 0, 0
+	for frames.Next() {
+		f := frames.Frame()
+		img, err := jpeg.Decode(bytes.NewReader(f.JPG))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Info.Sequence != n || img.Bounds().Size() != image.Pt(160, 120) {
+			t.Fatalf("expected frame %d scaled to 160x120, got frame %d of %s", n, f.Info.Sequence, img.Bounds().Size())
+		}
+		if f.Status == detector.DetectorStatusMotionDetected {
+			motion++
+		}
+		n++
+	}
+	if err := frames.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 40 || motion == 0 || events != 1 {
+		t.Fatalf("expected 40 frames, some with motion, and the event to be handled, got %d frames, %d with motion and %d events", n, motion, events)
+	}
+}
+
+func TestFramesSkipsIdleFrames(t *testing.T) {
+	md, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil,
+		detector.WithIdleSkipping(detector.IdleSkipping{After: time.Nanosecond, Every: 4}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	frames := md.Frames(detector.SnapshotOptions{Width: 80})
+	n, last := 0, -1
+	for frames.Next() {
+		seq := frames.Frame().Info.Sequence
+		if seq <= last {
+			t.Fatalf("expected increasing frame sequences, got %d after %d", seq, last)
+		}
+		n, last = n+1, seq
+	}
+	if err := frames.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 || n == 40 {
+		t.Fatalf("expected some of the 40 frames to be skipped while idle, got %d frames", n)
+	}
+}
+
+func TestRecentSnapshotsKeepsTheLastFrames(t *testing.T) {
+	md, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil,
+		detector.WithSnapshotHistory(5, detector.SnapshotOptions{Width: 160}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	recent := md.RecentSnapshots()
+	if len(recent) != 5 {
+		t.Fatalf("expected 5 snapshots, got %d", len(recent))
+	}
+	for i, s := range recent {
+		if s.Sequence != 35+i {
+			t.Fatalf("expected snapshot %d to be of frame %d, got %d", i, 35+i, s.Sequence)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(s.JPG))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Size() != image.Pt(160, 120) {
+			t.Fatalf("expected snapshots scaled to 160x120, got %s", img.Bounds().Size())
+		}
+	}
+}
+
+// controllableSource is a source with camera controls
+type controllableSource struct {
+	*sourcetest.Source
+	controls map[detector.CameraControl]float64
+}
+
+func (s *controllableSource) SetControl(c detector.CameraControl, value float64) error {
+	s.controls[c] = value
+	return nil
+}
+
+func (s *controllableSource) Control(c detector.CameraControl) (float64, error) {
+	return s.controls[c], nil
+}
+
+func TestCameraControlsAreSetOnTheSource(t *testing.T) {
+	src := &controllableSource{Source: sourcetest.New(320, 240, 1), controls: map[detector.CameraControl]float64{}}
+	md, err := detector.NewMotionDetectorFromSource(src, "", nil,
+		detector.WithCameraControls(map[detector.CameraControl]float64{detector.ControlAutoExposure: 1, detector.ControlExposure: 150}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.SetCameraControl(detector.ControlGain, 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := md.CameraControl(detector.ControlExposure); err != nil || v != 150 {
+		t.Fatalf("expected exposure 150, got %v, %v", v, err)
+	}
+	if c := md.Config().CameraControls; len(c) != 3 || c[detector.ControlGain] != 0 || c[detector.ControlAutoExposure] != 1 {
+		t.Fatalf("expected the three controls set in the config, got %v", c)
+	}
+	if err := md.SetCameraControl("zoom", 2); !errors.Is(err, detector.ErrUnsupportedControl) {
+		t.Fatalf("expected unknown controls to be unsupported, got %v", err)
+	}
+	if _, err := detector.NewMotionDetectorFromSource(sourcetest.New(320, 240, 1), "", nil,
+		detector.WithCameraControls(map[detector.CameraControl]float64{detector.ControlGain: 0}),
+	); !errors.Is(err, detector.ErrUnsupportedControl) {
+		t.Fatalf("expected controls of a source without controls to be unsupported, got %v", err)
+	}
+}
+
+// flickeringSource is a source whose frames are brightened every other few
+// frames, as by auto exposure hunting
+type flickeringSource struct {
+	*sourcetest.Source
+}
+
+func (s flickeringSource) Read() (image.Image, error) {
+	frame := s.Frame()
+	img, err := s.Source.Read()
+	if err != nil || frame/3%2 == 0 {
+		return img, err
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+	for i := range rgba.Pix {
+		if i%4 != 3 && rgba.Pix[i] < 215 {
+			rgba.Pix[i] += 40
+		}
+	}
+	return rgba, nil
+}
+
+// lateMotionFrames returns the number of frames after the first 30 in which
+// motion was detected
+func lateMotionFrames(t *testing.T, md *detector.Detector) int {
+	defer md.Close()
+	frames := md.Frames(detector.SnapshotOptions{Width: 80})
+	n := 0
+	for frames.Next() {
+		if f := frames.Frame(); f.Info.Sequence >= 30 && f.Status == detector.DetectorStatusMotionDetected {
+			n++
+		}
+	}
+	if err := frames.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestFlickerCompensationIgnoresFlicker(t *testing.T) {
+	md, err := detector.NewMotionDetectorFromSource(flickeringSource{sourcetest.New(320, 240, 90)}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := lateMotionFrames(t, md); n == 0 {
+		t.Fatal("expected flicker to be detected as motion without compensation")
+	}
+	md, err = detector.NewMotionDetectorFromSource(flickeringSource{sourcetest.New(320, 240, 90)}, "", nil,
+		detector.WithFlickerCompensation(detector.FlickerCompensation{Window: 30}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := lateMotionFrames(t, md); n != 0 || !md.Flickering() {
+		t.Fatalf("expected flicker to be compensated for, got motion in %d frames, flickering: %v", n, md.Flickering())
+	}
+}
+
+func TestTracksReportSpeedAndDwell(t *testing.T) {
+	var tracks []detector.Track
+	zone := detector.Zone{Name: "yard", Bounds: image.Rect(0, 0, 320, 240), PixelsPerMeter: 100}
+	md, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil,
+		detector.WithZones(zone),
+		detector.WithTrackHandler(func(tr detector.Track) { tracks = append(tracks, tr) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	if len(tracks) != 1 {
+		t.Fatalf("expected the moving rectangle to be tracked once, got %d tracks", len(tracks))
+	}
+	tr := tracks[0]
+	if tr.Speed <= 0 || tr.MetersPerSecond != tr.Speed/zone.PixelsPerMeter {
+		t.Fatalf("expected a speed in calibrated units, got %+v", tr)
+	}
+	if tr.Dwell["yard"] <= 0 || tr.Dwell["yard"] > tr.LastSeen.Sub(tr.FirstSeen) {
+		t.Fatalf("expected the time in the zone to be the time tracked, got %+v", tr)
+	}
+}
+
+// runDetector runs a detector over a source until it runs out of frames
+func runDetector(t *testing.T, src detector.Source, opts ...detector.Option) {
+	md, err := detector.NewMotionDetectorFromSource(src, "", nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+}
+
+// frameClock returns a clock which moves on by interval every frame
+func frameClock(interval time.Duration) func() time.Time {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(interval)
+		return now
+	}
+}
+
+func TestLoitering(t *testing.T) {
+	// a person walking up to the door and standing there
+	src := sourcetest.New(320, 240, 60,
+		sourcetest.Rect{Start: 5, End: 15, Bounds: image.Rect(0, 60, 40, 180), Velocity: image.Pt(16, 0)},
+		sourcetest.Rect{Start: 15, End: 60, Bounds: image.Rect(160, 60, 200, 180)},
+	)
+	door := detector.Zone{Name: "door", Bounds: image.Rect(140, 0, 320, 240)}
+	var alerts []detector.Loitering
+	// a frame every 100ms, the person walks through the door zone in less
+	// than a second and stands in it for over 4
+	runDetector(t, src, detector.WithSensitivity(1000), detector.WithZones(door), detector.WithClock(frameClock(100*time.Millisecond)),
+		detector.WithLoitering(detector.LoiteringRule{Zone: "door", MinDuration: 2 * time.Second, Severity: detector.SeverityHigh},
+			func(l detector.Loitering) { alerts = append(alerts, l) }),
+	)
+	if len(alerts) != 1 {
+		t.Fatalf("expected one loitering alert, got %d", len(alerts))
+	}
+	if alerts[0].Zone != "door" || alerts[0].Severity != detector.SeverityHigh || alerts[0].Track.Bounds.Min.X < 155 {
+		t.Fatalf("expected the person standing at the door, got %+v", alerts[0])
+	}
+}
+
+func TestAbandonedObject(t *testing.T) {
+	// a person carrying a bag in, setting it down and walking away
+	src := sourcetest.New(320, 240, 60,
+		sourcetest.Rect{Start: 5, End: 60, Bounds: image.Rect(30, 60, 70, 180), Velocity: image.Pt(8, 0)},
+		sourcetest.Rect{Start: 5, End: 20, Bounds: image.Rect(0, 140, 30, 180), Velocity: image.Pt(8, 0)},
+		sourcetest.Rect{Start: 20, End: 60, Bounds: image.Rect(120, 140, 150, 180)},
+	)
+	var abandoned []detector.AbandonedObject
+	runDetector(t, src, detector.WithSensitivity(1000), detector.WithAbandonedObjects(detector.AbandonedObjectRule{MinDuration: time.Nanosecond},
+		func(a detector.AbandonedObject) { abandoned = append(abandoned, a) }),
+	)
+	if len(abandoned) != 1 {
+		t.Fatalf("expected one abandoned object, got %d", len(abandoned))
+	}
+	if b := abandoned[0].Track.Bounds; !b.Overlaps(image.Rect(120, 140, 150, 180)) || b.Dx() > 60 {
+		t.Fatalf("expected the bag to be abandoned, got %+v", abandoned[0])
+	}
+}
+
+func TestCountingLine(t *testing.T) {
+	// two objects walking in through the entrance, left to right, and
+	// another walking out
+	src := sourcetest.New(320, 240, 60,
+		sourcetest.Rect{Start: 5, End: 20, Bounds: image.Rect(0, 20, 40, 100), Velocity: image.Pt(16, 0)},
+		sourcetest.Rect{Start: 25, End: 40, Bounds: image.Rect(0, 140, 40, 220), Velocity: image.Pt(16, 0)},
+		sourcetest.Rect{Start: 45, End: 60, Bounds: image.Rect(280, 80, 320, 160), Velocity: image.Pt(-16, 0)},
+	)
+	md, err := detector.NewMotionDetectorFromSource(src, "", nil, detector.WithSensitivity(1000),
+		detector.WithCountingLines(detector.CountingLine{Name: "entrance", A: image.Pt(160, 0), B: image.Pt(160, 240)}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	stats := md.Stats()
+	if len(stats.Lines) != 1 {
+		t.Fatalf("expected the counts of one line, got %d", len(stats.Lines))
+	}
+	// looking down the line, walking left to right crosses it from its
+	// right to its left
+	l := stats.Lines[0]
+	if l.In != 2 || l.Out != 1 || len(l.Hourly) == 0 || len(l.Daily) == 0 || l.Daily[len(l.Daily)-1].In != 2 {
+		t.Fatalf("expected two crossings in and one out, got %+v", l)
+	}
+}
+
+func TestOccupancy(t *testing.T) {
+	// someone sitting in a meeting room for the whole meeting, and someone
+	// else dropping in
+	src := sourcetest.New(320, 240, 60,
+		sourcetest.Rect{Start: 5, End: 60, Bounds: image.Rect(20, 60, 60, 180)},
+		sourcetest.Rect{Start: 15, End: 35, Bounds: image.Rect(200, 60, 240, 180)},
+	)
+	room := detector.Zone{Name: "room", Bounds: image.Rect(0, 0, 320, 240)}
+	var changes []int
+	md, err := detector.NewMotionDetectorFromSource(src, "", nil, detector.WithSensitivity(1000), detector.WithZones(room),
+		detector.WithOccupancyHandler(func(c detector.OccupancyChange) { changes = append(changes, c.Occupancy) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	if fmt.Sprint(changes) != "[1 2 1]" {
+		t.Fatalf("expected the occupancy to go up to 2 and back down to 1, got %v", changes)
+	}
+	if n := md.Stats().Occupancy["room"]; n != 1 {
+		t.Fatalf("expected one object in the room, got %d", n)
+	}
+}
+
+func TestFrameQueueDropsFramesUnderLoad(t *testing.T) {
+	slow := detector.WithFrameHook(func(frame *image.RGBA, info detector.FrameInfo) {
+		time.Sleep(2 * time.Millisecond)
+	})
+	for _, c := range []struct {
+		policy  detector.FrameDropPolicy
+		dropped bool
+	}{{detector.DropOldest, true}, {detector.DropNewest, true}, {detector.BlockCapture, false}} {
+		md, err := detector.NewMotionDetectorFromSource(sourcetest.New(320, 240, 60), "", nil, slow,
+			detector.WithFrameQueue(detector.FrameQueue{Size: 1, Policy: c.policy}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := md.Start(); err != io.EOF {
+			t.Fatalf("%s: expected source to run out of frames, got: %v", c.policy, err)
+		}
+		md.Close()
+		// the first frame is the initial background, which isn't counted
+		stats := md.Stats()
+		if stats.Frames+stats.DroppedFrames != 59 || (stats.DroppedFrames > 0) != c.dropped {
+			t.Fatalf("%s: expected 59 frames, dropped: %v, got %d processed and %d dropped", c.policy, c.dropped, stats.Frames, stats.DroppedFrames)
+		}
+	}
+}
+
+func TestWorkersDetectTheSameAsSequential(t *testing.T) {
+	// a busy scene, with more objects than frames are processed in parallel
+	// for
+	busy := func() *sourcetest.Source {
+		rects := []sourcetest.Rect{}
+		for i := 0; i < 12; i++ {
+			x, y := 10+(i%4)*75, 10+(i/4)*75
+			rects = append(rects, sourcetest.Rect{Start: 5, End: 30, Bounds: image.Rect(x, y, x+30, y+30), Velocity: image.Pt(1, 1)})
+		}
+		return sourcetest.New(320, 240, 40, rects...)
+	}
+	events := func(opts ...detector.Option) []string {
+		found := []string{}
+		opts = append(opts, detector.WithSensitivity(100), detector.WithEventHandler(func(e detector.Event) {
+			found = append(found, fmt.Sprint(e.StartFrame, e.EndFrame, e.Bounds))
+		}))
+		runDetector(t, busy(), opts...)
+		return found
+	}
+	sequential, parallel := events(), events(detector.WithWorkers(4))
+	if len(sequential) == 0 || fmt.Sprint(sequential) != fmt.Sprint(parallel) {
+		t.Fatalf("expected the same events with workers, got %v and %v", sequential, parallel)
+	}
+}
+
+// concatSource reads its sources one after the other
+type concatSource []detector.Source
+
+func (s *concatSource) Read() (image.Image, error) {
+	for len(*s) > 0 {
+		img, err := (*s)[0].Read()
+		if err != io.EOF {
+			return img, err
+		}
+		*s = (*s)[1:]
+	}
+	return nil, io.EOF
+}
+
+func (s *concatSource) Close() error {
+	return nil
+}
+
+func TestPrivacyZonesHideMotionAfterFrameSizeChanges(t *testing.T) {
+	// the privacy mask is computed again for the larger frames
+	resized := func() detector.Source {
+		return &concatSource{movingRect(), sourcetest.New(640, 480, 40, sourcetest.Rect{
+			Start:    20,
+			End:      40,
+			Bounds:   image.Rect(0, 60, 120, 180),
+			Velocity: image.Pt(8, 0),
+		})}
+	}
+	private := detector.WithPrivacyZones(detector.PrivacyBlackout, detector.Zone{Name: "neighbor", Bounds: image.Rect(0, 0, 320, 240)})
+	if n := detections(t, resized(), false, private); n != 0 {
+		t.Fatalf("expected no detections in the privacy zone, got %d", n)
+	}
+	if n := detections(t, resized(), false); n == 0 {
+		t.Fatal("expected detections without the privacy zone")
+	}
+}
+
+func TestAppendSnapshotReusesTheBuffer(t *testing.T) {
+	md, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	opts := detector.SnapshotOptions{Width: 160}
+	buf, err := md.AppendSnapshot([]byte("jpg:"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf, []byte("jpg:")) {
+		t.Fatalf("expected the snapshot to be appended, got %q", buf[:4])
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(buf[4:])); err != nil {
+		t.Fatal(err)
+	}
+	again, err := md.AppendSnapshot(buf[:0], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != len(buf)-4 || &again[0] != &buf[0] {
+		t.Fatal("expected the snapshot to be encoded into the buffer")
+	}
+}
+
+func TestStatsReportStageLatencies(t *testing.T) {
+	md, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil,
+		detector.WithSnapshotHistory(2, detector.SnapshotOptions{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	latency := md.Stats().Latency
+	for _, stage := range detector.Stages {
+		l, ok := latency[stage]
+		if !ok || l.Samples == 0 {
+			t.Fatalf("expected the latency of stage %s, got %+v", stage, latency)
+		}
+		if l.P50 > l.P90 || l.P90 > l.P99 || l.P99 > l.Max {
+			t.Fatalf("expected the percentiles of stage %s to increase, got %+v", stage, l)
+		}
+	}
+	if l := latency[detector.StageThreshold]; l.Samples != 40 || l.Max <= 0 {
+		t.Fatalf("expected the threshold stage of the 40 frames to be measured, got %+v", l)
+	}
+}
+
+func TestIdleSkippingWakesUpOnChange(t *testing.T) {
+	idle := detector.WithIdleSkipping(detector.IdleSkipping{After: time.Nanosecond, Every: 4})
+	md, err := detector.NewMotionDetectorFromSource(movingRect(), "", nil, idle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	// the rect appears on frame 20, until which 3 in 4 frames are skipped
+	stats := md.Stats()
+	if stats.SkippedFrames < 12 || stats.SkippedFrames > 15 || stats.MotionFrames == 0 {
+		t.Fatalf("expected the quiet frames to be skipped and motion detected, got %d skipped and %d with motion", stats.SkippedFrames, stats.MotionFrames)
+	}
+	if n := detections(t, movingRect(), false, idle); n != detections(t, movingRect(), false) {
+		t.Fatalf("expected the same detections with idle skipping, got %d", n)
+	}
+}
+
+// suspendableSource is a source which fails reads while suspended
+type suspendableSource struct {
+	*sourcetest.Source
+	suspended         bool
+	suspends, resumes int
+}
+
+func (s *suspendableSource) Read() (image.Image, error) {
+	if s.suspended {
+		return nil, errors.New("read while suspended")
+	}
+	return s.Source.Read()
+}
+
+func (s *suspendableSource) Suspend() error {
+	s.suspended = true
+	s.suspends++
+	return nil
+}
+
+func (s *suspendableSource) Resume() error {
+	s.suspended = false
+	s.resumes++
+	return nil
+}
+
+func TestSleepModeSuspendsCaptureUntilWokenUp(t *testing.T) {
+	src := &suspendableSource{Source: sourcetest.New(320, 240, 10)}
+	md, err := detector.NewMotionDetectorFromSource(src, "", nil, detector.WithSleepMode(detector.SleepMode{After: time.Nanosecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	done := make(chan error)
+	go func() { done <- md.Start() }()
+	// the detector falls asleep after every frame, a sensor trigger wakes it
+	// up for the next one
+	for {
+		select {
+		case err := <-done:
+			if err != io.EOF {
+				t.Fatalf("expected source to run out of frames, got: %v", err)
+			}
+			if src.suspends < 5 || src.suspends != src.resumes {
+				t.Fatalf("expected the source to be suspended and resumed, got %d suspends and %d resumes", src.suspends, src.resumes)
+			}
+			return
+		case <-time.After(time.Millisecond):
+			if md.Status() == detector.DetectorStatusAsleep {
+				md.Trigger("pir")
+			}
+		}
+	}
+}
+
+func TestClosingWakesTheDetectorUp(t *testing.T) {
+	md, err := detector.NewMotionDetectorFromSource(sourcetest.New(320, 240, 10), "", nil, detector.WithSleepMode(detector.SleepMode{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md.Sleep()
+	done := make(chan error)
+	go func() { done <- md.Start() }()
+	for md.Status() != detector.DetectorStatusAsleep {
+		time.Sleep(time.Millisecond)
+	}
+	md.Close()
+	select {
+	case err := <-done:
+		if err == nil || err == io.EOF {
+			t.Fatalf("expected the detector to stop as it was closed, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected closing to wake the detector up")
+	}
+}
+
+func TestInactivityAlertsOncePerQuietSpell(t *testing.T) {
+	// the rect walks through the frame between two quiet spells
+	src := sourcetest.New(320, 240, 60, sourcetest.Rect{
+		Start:    20,
+		End:      40,
+		Bounds:   image.Rect(0, 60, 120, 180),
+		Velocity: image.Pt(8, 0),
+	})
+	alerts := []detector.Inactivity{}
+	rule := detector.InactivityRule{MaxQuiet: time.Nanosecond, Severity: detector.SeverityHigh}
+	runDetector(t, src, detector.WithInactivityAlert(rule, func(i detector.Inactivity) {
+		alerts = append(alerts, i)
+	}))
+	if len(alerts) != 2 || !alerts[0].LastMotion.IsZero() || alerts[1].LastMotion.IsZero() {
+		t.Fatalf("expected an alert before and after the motion, got %+v", alerts)
+	}
+	// outside of the active hours nothing is expected
+	now := time.Now()
+	since := now.Sub(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	rule.Start, rule.End = since+time.Hour, since+2*time.Hour
+	if rule.End >= 24*time.Hour {
+		rule.Start, rule.End = since-2*time.Hour, since-time.Hour
+	}
+	alerts = nil
+	runDetector(t, sourcetest.New(320, 240, 30), detector.WithInactivityAlert(rule, func(i detector.Inactivity) {
+		alerts = append(alerts, i)
+	}))
+	if len(alerts) != 0 {
+		t.Fatalf("expected no alerts outside of the active hours, got %+v", alerts)
+	}
+}
+
+func TestVehicleClassification(t *testing.T) {
+	classes := func(src detector.Source) []detector.Event {
+		var events []detector.Event
+		runDetector(t, src, detector.WithSensitivity(1000),
+			detector.WithVehicleClassification(detector.VehicleClassification{}),
+			detector.WithEventHandler(func(e detector.Event) { events = append(events, e) }))
+		return events
+	}
+	// a car driving by is wide, a person walking by tall
+	car := classes(sourcetest.New(320, 240, 40, sourcetest.Rect{Start: 10, End: 40, Bounds: image.Rect(0, 120, 120, 180), Velocity: image.Pt(8, 0)}))
+	if len(car) != 1 || car[0].Class != detector.ClassVehicle || car[0].ClassConfidence <= 0 {
+		t.Fatalf("expected a vehicle, got %+v", car)
+	}
+	person := classes(sourcetest.New(320, 240, 40, sourcetest.Rect{Start: 10, End: 40, Bounds: image.Rect(0, 60, 40, 180), Velocity: image.Pt(8, 0)}))
+	if len(person) != 1 || person[0].Class != detector.ClassPedestrian {
+		t.Fatalf("expected a pedestrian, got %+v", person)
+	}
+	// a confident classifier overrules the shape
+	e := person[0]
+	e.SetClassifierClasses(1, 0)
+	if e.Class != detector.ClassVehicle {
+		t.Fatalf("expected the classifier to make it a vehicle, got %q with %v", e.Class, e.ClassConfidence)
+	}
+}
+
+func TestPackageDetection(t *testing.T) {
+	// a courier walking by the door leaves a package, which is later taken
+	src := sourcetest.New(320, 240, 200,
+		sourcetest.Rect{Start: 5, End: 50, Bounds: image.Rect(0, 20, 40, 140), Velocity: image.Pt(8, 0)},
+		sourcetest.Rect{Start: 25, End: 90, Bounds: image.Rect(220, 150, 260, 180), Color: color.Gray{Y: 160}},
+	)
+	door := detector.Zone{Name: "door", Bounds: image.Rect(160, 100, 320, 240)}
+	var packages []detector.PackageEvent
+	runDetector(t, src, detector.WithSensitivity(1000), detector.WithZones(door),
+		detector.WithPackageDetection(detector.PackageRule{Zone: "door", Settle: 30 * time.Millisecond, Severity: detector.SeverityMedium},
+			func(p detector.PackageEvent) { packages = append(packages, p) }),
+	)
+	if len(packages) != 2 || packages[0].Type != detector.PackageDelivered || packages[1].Type != detector.PackageTaken {
+		t.Fatalf("expected the package to be delivered and taken, got %+v", packages)
+	}
+	for _, p := range packages {
+		if !p.Bounds.Overlaps(image.Rect(220, 150, 260, 180)) || p.Bounds.Dx() > 60 || p.Zone != "door" || p.Severity != detector.SeverityMedium {
+			t.Fatalf("expected the package by the door, got %+v", p)
+		}
+	}
+	if !packages[1].Delivered.Equal(packages[0].Time) {
+		t.Fatalf("expected the taken package to have been delivered at %s, got %s", packages[0].Time, packages[1].Delivered)
+	}
+}
+
+func TestBestShotPicksTheLargestMostCenteredSubject(t *testing.T) {
+	// a subject walking in from the edge, to the center, and back out
+	src := sourcetest.New(320, 240, 60,
+		sourcetest.Rect{Start: 10, End: 30, Bounds: image.Rect(-40, 60, 0, 180), Velocity: image.Pt(10, 0)},
+		sourcetest.Rect{Start: 30, End: 50, Bounds: image.Rect(160, 60, 200, 180), Velocity: image.Pt(10, 0)},
+	)
+	var events []detector.Event
+	runDetector(t, src, detector.WithSensitivity(1000), detector.WithBestShot(detector.BestShotSelection{Width: 160}),
+		detector.WithEventHandler(func(e detector.Event) { events = append(events, e) }))
+	if len(events) != 1 || events[0].BestShot == nil {
+		t.Fatalf("expected one event with a best shot, got %+v", events)
+	}
+	shot := events[0].BestShot
+	if x := (shot.Bounds.Min.X + shot.Bounds.Max.X) / 2; x < 120 || x > 200 {
+		t.Fatalf("expected the subject in the center, got %s", shot.Bounds)
+	}
+	if shot.Frame <= events[0].StartFrame || shot.Frame >= events[0].EndFrame || shot.Score <= 0 || shot.Sharpness <= 0 {
+		t.Fatalf("expected a shot in the middle of the event, got %+v", shot)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(shot.JPG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := img.Bounds().Dx(); w != 160 {
+		t.Fatalf("expected a 160 pixels wide shot, got %d", w)
+	}
+}
+
+func TestFocusMonitorWarnsOfBlurryFrames(t *testing.T) {
+	focus := detector.FocusMonitor{After: time.Nanosecond, Every: time.Nanosecond}
+	// a featureless scene, as seen through a dirty lens
+	blurry := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	draw.Draw(blurry, blurry.Rect, image.NewUniform(color.Gray{Y: 128}), image.Point{}, draw.Src)
+	var warnings []detector.FocusWarning
+	runDetector(t, &sourcetest.Source{Background: blurry, Frames: 30}, detector.WithFocusMonitor(focus, func(w detector.FocusWarning) {
+		warnings = append(warnings, w)
+	}))
+	if len(warnings) != 1 || warnings[0].Sharpness >= detector.DefaultMinSharpness || warnings[0].BlurrySince.IsZero() {
+		t.Fatalf("expected a warning of the blurry frames, got %+v", warnings)
+	}
+	// a checkerboard is all edges
+	sharp := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			if (x/8+y/8)%2 == 0 {
+				sharp.Set(x, y, color.White)
+			} else {
+				sharp.Set(x, y, color.Gray{Y: 64})
+			}
+		}
+	}
+	warnings = nil
+	var events []detector.Event
+	md, err := detector.NewMotionDetectorFromSource(&sourcetest.Source{
+		Background: sharp,
+		Frames:     40,
+		Rects:      []sourcetest.Rect{{Start: 20, End: 40, Bounds: image.Rect(0, 60, 120, 180), Velocity: image.Pt(8, 0)}},
+	}, "", nil,
+		detector.WithFocusMonitor(focus, func(w detector.FocusWarning) { warnings = append(warnings, w) }),
+		detector.WithEventHandler(func(e detector.Event) { events = append(events, e) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("expected no warnings of sharp frames, got %+v", warnings)
+	}
+	if len(events) != 1 || events[0].Sharpness < detector.DefaultMinSharpness || md.Stats().Sharpness < detector.DefaultMinSharpness {
+		t.Fatalf("expected the sharpness of the frames, got %+v and %v", events, md.Stats().Sharpness)
+	}
+}
+
+func TestSceneChangeDetection(t *testing.T) {
+	// a few boxes, as seen before and after the camera was bumped
+	scene := func(shift int) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+		draw.Draw(img, img.Rect, image.NewUniform(color.Gray{Y: 96}), image.Point{}, draw.Src)
+		for i, b := range []image.Rectangle{image.Rect(20, 20, 100, 90), image.Rect(150, 40, 290, 110), image.Rect(60, 140, 200, 220)} {
+			draw.Draw(img, b.Add(image.Pt(shift, shift/2)), image.NewUniform(color.Gray{Y: uint8(160 + 40*i)}), image.Point{}, draw.Src)
+		}
+		return img
+	}
+	config := detector.SceneChangeDetection{Every: time.Nanosecond}
+	var changes []detector.SceneChange
+	onChange := func(c detector.SceneChange) { changes = append(changes, c) }
+	md, err := detector.NewMotionDetectorFromSource(&sourcetest.Source{Background: scene(0), Frames: 20}, "", nil, detector.WithSceneChangeDetection(config, onChange))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	reference := md.SceneReference()
+	if len(changes) != 0 || reference == nil || md.Stats().SceneSimilarity < detector.DefaultSceneSimilarity {
+		t.Fatalf("expected the scene not to change, got %+v and a similarity of %v", changes, md.Stats().SceneSimilarity)
+	}
+	config.Reference = reference
+	runDetector(t, &sourcetest.Source{Background: scene(40), Frames: 20}, detector.WithSceneChangeDetection(config, onChange))
+	if len(changes) != 1 || changes[0].Similarity >= detector.DefaultSceneSimilarity || !changes[0].Reference.Equal(reference.Taken) {
+		t.Fatalf("expected the stored reference to show the scene changed once, got %+v", changes)
+	}
+}
+
+func TestSceneShiftRemapsZones(t *testing.T) {
+	scene := func(shift image.Point) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+		draw.Draw(img, img.Rect, image.NewUniform(color.Gray{Y: 96}), image.Point{}, draw.Src)
+		for i, b := range []image.Rectangle{image.Rect(20, 20, 100, 90), image.Rect(150, 40, 290, 110), image.Rect(60, 140, 200, 220)} {
+			draw.Draw(img, b.Add(shift), image.NewUniform(color.Gray{Y: uint8(160 + 40*i)}), image.Point{}, draw.Src)
+		}
+		return img
+	}
+	zone := detector.Zone{Name: "door", Bounds: image.Rect(150, 40, 290, 110)}
+	line := detector.CountingLine{Name: "path", A: image.Pt(60, 140), B: image.Pt(200, 140)}
+	md, err := detector.NewMotionDetectorFromSource(&sourcetest.Source{Background: scene(image.Point{}), Frames: 10}, "", nil,
+		detector.WithSceneChangeDetection(detector.SceneChangeDetection{Every: time.Nanosecond}, func(detector.SceneChange) {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	// the camera was bumped a little to the left and up
+	var changes []detector.SceneChange
+	md, err = detector.NewMotionDetectorFromSource(&sourcetest.Source{Background: scene(image.Pt(24, 12)), Frames: 10}, "", nil,
+		detector.WithZones(zone),
+		detector.WithCountingLines(line),
+		detector.WithSceneChangeDetection(detector.SceneChangeDetection{Every: time.Nanosecond, Reference: md.SceneReference()}, func(c detector.SceneChange) {
+			changes = append(changes, c)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Shift == nil {
+		t.Fatalf("expected a change with a small shift, got %+v", changes)
+	}
+	near := func(got, want image.Point) bool {
+		d := got.Sub(want)
+		return d.X*d.X+d.Y*d.Y <= 16
+	}
+	shift := changes[0].Shift
+	if len(shift.Zones) != 1 || !near(shift.Zones[0].Bounds.Min, image.Pt(174, 52)) || !near(shift.Zones[0].Bounds.Max, image.Pt(314, 122)) {
+		t.Fatalf("expected the zone to shift with the view, got %+v", shift)
+	}
+	if len(shift.Lines) != 1 || !near(shift.Lines[0].A, image.Pt(84, 152)) || !near(shift.Lines[0].B, image.Pt(224, 152)) {
+		t.Fatalf("expected the counting line to shift with the view, got %+v", shift)
+	}
+	if err := md.ApplySceneShift(*shift); err != nil {
+		t.Fatal(err)
+	}
+	if zones := md.Zones(); zones[0].Bounds != shift.Zones[0].Bounds || md.Config().CountingLines[0] != shift.Lines[0] {
+		t.Fatalf("expected the shifted zones and lines to apply, got %+v and %+v", zones, md.Config().CountingLines)
+	}
+	if err := md.ApplySceneShift(detector.SceneShift{}); err != detector.ErrStaleSceneShift {
+		t.Fatalf("expected a stale shift not to apply, got %v", err)
+	}
+}
+
+func TestFrameRate(t *testing.T) {
+	md, err := detector.NewMotionDetectorFromSource(&sourcetest.Source{Background: image.NewGray(image.Rect(0, 0, 320, 240)), Frames: 20}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected source to run out of frames, got: %v", err)
+	}
+	fps := md.FrameRate()
+	if fps <= 0 || md.Stats().FPS <= 0 {
+		t.Fatalf("expected frames to be processed at a positive rate, got %v", fps)
+	}
+	// frames stopped coming once the source ran out
+	time.Sleep(time.Duration(40 * float64(time.Second) / fps))
+	if stopped := md.FrameRate(); stopped > fps/2 {
+		t.Fatalf("expected the frame rate to fall once frames stopped, got %v from %v", stopped, fps)
+	}
+}
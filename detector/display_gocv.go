@@ -0,0 +1,28 @@
+//go:build !purego && !nogui
+// +build !purego,!nogui
+
+package detector
+
+import (
+	"gocv.io/x/gocv"
+)
+
+const escapeKey = 27
+
+// window displays frames in an OpenCV (highgui) window
+type window struct {
+	w *gocv.Window
+}
+
+func newDisplay(winTitle string) display {
+	return &window{w: gocv.NewWindow(winTitle)}
+}
+
+func (w *window) show(img gocv.Mat) bool {
+	w.w.IMShow(img)
+	return w.w.WaitKey(1) == escapeKey
+}
+
+func (w *window) close() error {
+	return w.w.Close()
+}
@@ -0,0 +1,9 @@
+//go:build !purego && nogui
+// +build !purego,nogui
+
+package detector
+
+// newDisplay never opens a window when building with the "nogui" tag
+func newDisplay(winTitle string) display {
+	return headless{}
+}
@@ -0,0 +1,73 @@
+package detector
+
+import (
+	"log"
+)
+
+const (
+	// maxDryRunEvents is the number of events kept in dry run mode, older
+	// ones are dropped
+	maxDryRunEvents = 100
+)
+
+// WithDryRun starts the detector in dry run mode, for safely tuning it on a
+// live camera: the whole pipeline runs, but events are logged and kept (see
+// DryRunEvents) rather than handed to the event handler, and no other user
+// provided callback is called, so no notification, recording or action
+// fires. Frames are marked as a dry run
+func WithDryRun() Option {
+	return func(d *Detector) {
+		d.dryRun = true
+	}
+}
+
+// SetDryRun switches dry run mode on or off while the detector is running,
+// see WithDryRun. Events are handled according to the mode they started in
+func (d *Detector) SetDryRun(dryRun bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dryRun = dryRun
+	if !dryRun {
+		d.dryRunEvents = nil
+	}
+}
+
+// DryRun returns whether the detector is in dry run mode
+func (d *Detector) DryRun() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dryRun
+}
+
+// DryRunEvents returns the last events which ended in dry run mode, oldest
+// first
+func (d *Detector) DryRunEvents() []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Event{}, d.dryRunEvents...)
+}
+
+// displayStatus returns the status rendered onto the current frame, after
+// the camera's name if it has one. In dry run mode it is marked as such so
+// that it is clear in every view of the camera
+func (d *Detector) displayStatus() string {
+	status := d.translate(d.status)
+	if d.identity.Name != "" {
+		status = d.identity.Name + ": " + status
+	}
+	if d.dryRun {
+		return status + " (" + d.translate(StatusDryRun) + ")"
+	}
+	return status
+}
+
+// logDryRun logs and keeps an event which ended in dry run mode
+func (d *Detector) logDryRun(e *Event) {
+	log.Printf("dry run: event from frame %d to %d (%s), bounds %s, confidence %.2f",
+		e.StartFrame, e.EndFrame, e.End.Sub(e.Start), e.Bounds, e.Confidence)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dryRunEvents = append(d.dryRunEvents, *e); len(d.dryRunEvents) > maxDryRunEvents {
+		d.dryRunEvents = d.dryRunEvents[1:]
+	}
+}
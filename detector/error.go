@@ -0,0 +1,87 @@
+package detector
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"runtime/debug"
+)
+
+const (
+	// OpRead is the operation of reading a frame from a camera or source
+	OpRead = "read"
+
+	// OpEncode is the operation of encoding a frame, e.g. for a snapshot
+	OpEncode = "encode"
+
+	// OpClose is the operation of releasing the detector's resources
+	OpClose = "close"
+
+	// OpCallback is the operation of running a user provided callback
+	OpCallback = "callback"
+
+	// OpControl is the operation of setting a camera control
+	OpControl = "control"
+)
+
+// Error is an error which occurred in a detector, along with the operation
+// which failed
+type Error struct {
+	Op  string
+	Err error
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is the error reported when a user provided callback panics
+type PanicError struct {
+	// Value is the value the callback panicked with
+	Value interface{}
+	// Stack is the stack trace of the goroutine at the time of the panic
+	Stack []byte
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// safeCall runs a user provided callback, recovering from any panic in it
+// so that a buggy callback can't take down the whole process
+func (d *Detector) safeCall(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			d.reportError(OpCallback, &PanicError{Value: r, Stack: debug.Stack()})
+		}
+	}()
+	fn()
+}
+
+// reportError hands an error to the error handler, or logs it with the
+// default logger when there is none. It must not be called with the
+// detector's lock held as the handler may use the detector
+func (d *Detector) reportError(op string, err error) {
+	if err == nil || err == io.EOF {
+		return
+	}
+	e := &Error{Op: op, Err: err}
+	if d.onError == nil {
+		log.Print(e)
+		return
+	}
+	// the error handler is a callback too, but its panics can only be logged
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("error handler panicked handling %q: %v\n%s", e, r, debug.Stack())
+		}
+	}()
+	d.onError(e)
+}
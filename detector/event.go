@@ -0,0 +1,164 @@
+package detector
+
+import (
+	"image"
+	"time"
+)
+
+// Event is a period of continuous motion, it ends once no motion has been
+// detected for the detector's event gap
+type Event struct {
+	// StartFrame and EndFrame are the sequence numbers of the first and
+	// last frames motion was detected on
+	StartFrame int `json:"start_frame"`
+	EndFrame   int `json:"end_frame"`
+	// Start and End are the times at which those frames were processed
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// StartFrameInfo and EndFrameInfo are the metadata of those frames,
+	// e.g. when they were captured
+	StartFrameInfo FrameInfo `json:"start_frame_info"`
+	EndFrameInfo   FrameInfo `json:"end_frame_info"`
+	// Bounds is the smallest rectangle containing all motion in the event
+	Bounds image.Rectangle `json:"bounds"`
+	// StartBounds and EndBounds contain the motion on the first and last
+	// frames, i.e. where the motion entered and left the scene
+	StartBounds image.Rectangle `json:"start_bounds"`
+	EndBounds   image.Rectangle `json:"end_bounds"`
+	// FrameSize is the size of the frames the event was detected on
+	FrameSize image.Point `json:"frame_size"`
+	// MaxArea is the largest contour area detected during the event
+	MaxArea float64 `json:"max_area"`
+	// Confidence is a heuristic confidence, from 0 to 1, that the event is
+	// motion of interest rather than noise, computed from its
+	// ConfidenceFactors, for consumers to set their own alerting threshold.
+	// Forced events have a confidence of 1
+	Confidence        float64           `json:"confidence"`
+	ConfidenceFactors ConfidenceFactors `json:"confidence_factors"`
+	// Reason is why the event was forced with CaptureEvent, it is empty for
+	// events of detected motion
+	Reason string `json:"reason,omitempty"`
+	// PlateCrops are the crops around the plate of the vehicle in the
+	// event, and Plates the plate text candidates read from them, with
+	// WithPlateCapture
+	PlateCrops []PlateCrop      `json:"plate_crops,omitempty"`
+	Plates     []PlateCandidate `json:"plates,omitempty"`
+	// BestShot is the best snapshot of the event, with WithBestShot
+	BestShot *Shot `json:"best_shot,omitempty"`
+	// Sharpness is that of the frame the event started on, see Sharpness
+	Sharpness float64 `json:"sharpness,omitempty"`
+	// DryRun is set for events which started in dry run mode, see WithDryRun
+	DryRun bool `json:"dry_run,omitempty"`
+	// Camera is the identity of the camera, see WithIdentity
+	Camera *Identity `json:"camera,omitempty"`
+	// Class is whether the event shows a vehicle or a pedestrian, and
+	// ClassConfidence the confidence in it, from 0 to 1, see
+	// WithVehicleClassification
+	Class           ObjectClass `json:"class,omitempty"`
+	ClassConfidence float64     `json:"class_confidence,omitempty"`
+
+	motionFrames int
+	soliditySum  float64
+	// classFrames is the number of frames scored for the event's class,
+	// classSum their sum, and classBounds and classTime the bounds of the
+	// largest object on the last one and when it was processed
+	classFrames     int
+	classSum        float64
+	classBounds     image.Rectangle
+	classTime       time.Time
+	classifierScore *float64
+}
+
+// trackEvent updates the ongoing event with the regions of motion found on
+// the current frame, ending it when the event gap has passed without motion.
+// It returns the event which ended, if any
+func (d *Detector) trackEvent(regions []region, now time.Time) *Event {
+	if len(regions) == 0 {
+		if d.event == nil {
+			return nil
+		}
+		if d.quietFrames++; d.quietFrames >= d.eventGap {
+			return d.endEvent()
+		}
+		return nil
+	}
+	d.motionFrames++
+	bounds := image.Rectangle{}
+	for _, r := range regions {
+		bounds = bounds.Union(r.bounds)
+	}
+	if d.event == nil {
+		d.event = &Event{StartFrame: d.frame, Start: now, StartBounds: bounds, FrameSize: d.backend.frameSize(), DryRun: d.dryRun, Camera: d.eventIdentity(), Sharpness: d.sharpness}
+		d.event.StartFrameInfo = d.frameInfo
+		d.events++
+	}
+	d.quietFrames = 0
+	d.event.EndFrame, d.event.End, d.event.EndBounds = d.frame, now, bounds
+	d.event.EndFrameInfo = d.frameInfo
+	d.event.Bounds = d.event.Bounds.Union(bounds)
+	largest := regions[0]
+	for _, r := range regions {
+		if r.area > d.event.MaxArea {
+			d.event.MaxArea = r.area
+		}
+		if r.area > largest.area {
+			largest = r
+		}
+	}
+	d.event.updateConfidence(largest, d.minArea()+d.noiseFloor)
+	d.updateClass(d.event, largest, now)
+	return nil
+}
+
+// endEvent ends and returns the ongoing event, if any
+func (d *Detector) endEvent() *Event {
+	e := d.event
+	if e != nil {
+		e.PlateCrops = d.plateCrops
+	}
+	if b := d.bestShot; b != nil {
+		if e != nil {
+			e.BestShot = b.shot
+		}
+		b.shot = nil
+	}
+	d.event, d.quietFrames, d.plateCrops = nil, 0, nil
+	return e
+}
+
+// CaptureEvent forces an event from an external trigger, e.g. a doorbell
+// press or a door sensor, the event is handed to the event handler straight
+// away so that it goes through the same snapshot, storage and notification
+// pipeline as detected motion. It is independent of any ongoing event
+func (d *Detector) CaptureEvent(reason string) {
+	d.mu.Lock()
+	now := time.Now()
+	e := &Event{
+		StartFrame: d.frame,
+		EndFrame:   d.frame,
+		Start:      now,
+		End:        now,
+		FrameSize:  d.backend.frameSize(),
+		Reason:     reason,
+		Confidence: 1,
+		DryRun:     d.dryRun,
+		Camera:     d.eventIdentity(),
+	}
+	e.StartFrameInfo, e.EndFrameInfo = d.frameInfo, d.frameInfo
+	d.events++
+	d.mu.Unlock()
+	d.handleEvent(e)
+}
+
+// handleEvent hands an event which ended to the event handler, it must not
+// be called with the detector's lock held as the handler may use the detector
+func (d *Detector) handleEvent(e *Event) {
+	if e != nil && e.DryRun {
+		d.logDryRun(e)
+		return
+	}
+	if e != nil && d.onEvent != nil {
+		d.readPlates(e)
+		d.safeCall(func() { d.onEvent(*e) })
+	}
+}
@@ -0,0 +1,11 @@
+package detector
+
+import "time"
+
+// WithClock replaces the time frames are processed at, so that tests can
+// tell time in frames rather than race the wall clock
+func WithClock(now func() time.Time) Option {
+	return func(d *Detector) {
+		d.now = now
+	}
+}
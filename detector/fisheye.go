@@ -0,0 +1,149 @@
+package detector
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"os"
+)
+
+// Fisheye holds the intrinsics of a fisheye (or wide angle) camera, as
+// calibrated with OpenCV's fisheye camera model, used to de-warp its frames
+// before detection. Zones are given in the coordinates of the camera's
+// warped frames and are mapped through the de-warp
+type Fisheye struct {
+	// Width and Height are the size of the frames the camera was calibrated
+	// with, the intrinsics are scaled to frames of other sizes
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// FX, FY, CX and CY are the focal lengths and principal point in pixels
+	FX float64 `json:"fx"`
+	FY float64 `json:"fy"`
+	CX float64 `json:"cx"`
+	CY float64 `json:"cy"`
+	// D are the distortion coefficients k1 to k4
+	D [4]float64 `json:"d"`
+	// Scale scales the focal length of the de-warped frames, values below 1
+	// keep more of the field of view. Zero is treated as 1
+	Scale float64 `json:"scale,omitempty"`
+}
+
+// LoadFisheye reads fisheye intrinsics from a JSON file
+func LoadFisheye(path string) (Fisheye, error) {
+	f := Fisheye{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("invalid fisheye intrinsics in %s: %w", path, err)
+	}
+	if f.Width <= 0 || f.Height <= 0 || f.FX <= 0 || f.FY <= 0 {
+		return f, fmt.Errorf("invalid fisheye intrinsics in %s: calibration size and focal lengths must be positive", path)
+	}
+	return f, nil
+}
+
+// WithFisheye de-warps every frame with the given intrinsics before detection
+func WithFisheye(f Fisheye) Option {
+	return func(d *Detector) {
+		d.fisheye = &f
+	}
+}
+
+// scaled returns the intrinsics for frames of the given size
+func (f Fisheye) scaled(frame image.Point) Fisheye {
+	sx, sy := float64(frame.X)/float64(f.Width), float64(frame.Y)/float64(f.Height)
+	f.FX, f.CX = f.FX*sx, f.CX*sx
+	f.FY, f.CY = f.FY*sy, f.CY*sy
+	f.Width, f.Height = frame.X, frame.Y
+	if f.Scale == 0 {
+		f.Scale = 1
+	}
+	return f
+}
+
+// distort returns the point of the warped frame which is shown at the given
+// point of the de-warped frame
+func (f Fisheye) distort(u, v float64) (float64, float64) {
+	x, y := (u-f.CX)/(f.FX*f.Scale), (v-f.CY)/(f.FY*f.Scale)
+	r := math.Hypot(x, y)
+	if r == 0 {
+		return f.CX, f.CY
+	}
+	theta := math.Atan(r)
+	t2 := theta * theta
+	thetaD := theta * (1 + t2*(f.D[0]+t2*(f.D[1]+t2*(f.D[2]+t2*f.D[3]))))
+	s := thetaD / r
+	return f.FX*x*s + f.CX, f.FY*y*s + f.CY
+}
+
+// undistort returns the point of the de-warped frame at which the given
+// point of the warped frame is shown, the inverse of distort. Points which
+// fall behind the camera in the de-warped frame aren't shown
+func (f Fisheye) undistort(px, py float64) (float64, float64, bool) {
+	x, y := (px-f.CX)/f.FX, (py-f.CY)/f.FY
+	thetaD := math.Hypot(x, y)
+	if thetaD == 0 {
+		return f.CX, f.CY, true
+	}
+	// solve thetaD = theta * (1 + k1 theta^2 + ...) with Newton's method
+	theta := thetaD
+	for i := 0; i < 10; i++ {
+		t2 := theta * theta
+		g := theta*(1+t2*(f.D[0]+t2*(f.D[1]+t2*(f.D[2]+t2*f.D[3])))) - thetaD
+		dg := 1 + t2*(3*f.D[0]+t2*(5*f.D[1]+t2*(7*f.D[2]+t2*9*f.D[3])))
+		theta -= g / dg
+	}
+	if theta <= 0 || theta >= math.Pi/2 {
+		return 0, 0, false
+	}
+	s := math.Tan(theta) / thetaD
+	return f.FX*f.Scale*x*s + f.CX, f.FY*f.Scale*y*s + f.CY, true
+}
+
+// remapTable returns, for every pixel of the de-warped frame in row order,
+// the coordinates of the pixel of the warped frame it is taken from
+func (f Fisheye) remapTable() (xs, ys []float32) {
+	xs, ys = make([]float32, f.Width*f.Height), make([]float32, f.Width*f.Height)
+	for v := 0; v < f.Height; v++ {
+		for u := 0; u < f.Width; u++ {
+			x, y := f.distort(float64(u), float64(v))
+			xs[v*f.Width+u], ys[v*f.Width+u] = float32(x), float32(y)
+		}
+	}
+	return xs, ys
+}
+
+// mapRect maps a rectangle of the warped frame to the smallest rectangle of
+// the de-warped frame containing it, by mapping points along its edges
+func (f Fisheye) mapRect(r image.Rectangle) image.Rectangle {
+	const steps = 16
+	out := image.Rectangle{}
+	add := func(px, py float64) {
+		if x, y, ok := f.undistort(px, py); ok {
+			p := image.Pt(int(math.Floor(x)), int(math.Floor(y)))
+			out = out.Union(image.Rectangle{Min: p, Max: p.Add(image.Pt(1, 1))})
+		}
+	}
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / steps
+		x := float64(r.Min.X) + t*float64(r.Dx())
+		y := float64(r.Min.Y) + t*float64(r.Dy())
+		add(x, float64(r.Min.Y))
+		add(x, float64(r.Max.Y))
+		add(float64(r.Min.X), y)
+		add(float64(r.Max.X), y)
+	}
+	return out.Intersect(image.Rect(0, 0, f.Width, f.Height))
+}
+
+// zoneRect returns the bounds of a zone within a frame of the given size,
+// mapped through the de-warp if frames are de-warped
+func zoneRect(bounds image.Rectangle, frame image.Point, f *Fisheye) image.Rectangle {
+	if f != nil {
+		return f.scaled(frame).mapRect(bounds)
+	}
+	return bounds.Intersect(image.Rectangle{Max: frame})
+}
@@ -0,0 +1,182 @@
+package detector
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// DefaultFlickerWindow is the default number of frames brightness
+	// oscillation is looked for in
+	DefaultFlickerWindow = 60
+
+	// DefaultFlickerAmplitude is the default smallest deviation of a frame's
+	// mean brightness, out of 255, from the window's which counts as a swing
+	DefaultFlickerAmplitude = 1.5
+
+	// DefaultFlickerMaxArea is the default fraction of the frame which
+	// motion must cover to be ignored while the camera flickers
+	DefaultFlickerMaxArea = 0.25
+
+	// flickerMinSwings is the number of swings of the brightness across its
+	// mean, within the window, from which the camera is flickering: two
+	// periods of the oscillation, so that a light switched on isn't flicker
+	flickerMinSwings = 4
+)
+
+// FlickerCompensation is the configuration of the flicker compensation, see
+// WithFlickerCompensation
+type FlickerCompensation struct {
+	// Window is the number of frames oscillation is looked for in, it must
+	// span two periods of the slowest oscillation to be compensated for,
+	// DefaultFlickerWindow when 0
+	Window int `json:"window,omitempty"`
+	// Amplitude is the smallest swing of the mean brightness, out of 255,
+	// DefaultFlickerAmplitude when 0
+	Amplitude float64 `json:"amplitude,omitempty"`
+	// MaxArea is the fraction of the frame from which motion is ignored
+	// while the camera flickers, DefaultFlickerMaxArea when 0
+	MaxArea float64 `json:"max_area,omitempty"`
+	// LockExposure switches the camera's auto exposure off once it
+	// flickers, by setting ControlAutoExposure to ManualExposure, 1 (manual
+	// with V4L2) when 0
+	LockExposure   bool    `json:"lock_exposure,omitempty"`
+	ManualExposure float64 `json:"manual_exposure,omitempty"`
+}
+
+// WithFlickerCompensation detects the periodic oscillation of the frames'
+// brightness caused by auto exposure hunting or mains frequency flicker of
+// lights, which changes the whole frame. While the camera flickers motion
+// covering more than MaxArea of the frame is ignored, and auto exposure is
+// switched off if LockExposure is set
+func WithFlickerCompensation(f FlickerCompensation) Option {
+	return func(d *Detector) {
+		if f.Window <= 0 {
+			f.Window = DefaultFlickerWindow
+		}
+		if f.Amplitude <= 0 {
+			f.Amplitude = DefaultFlickerAmplitude
+		}
+		if f.MaxArea <= 0 {
+			f.MaxArea = DefaultFlickerMaxArea
+		}
+		if f.ManualExposure == 0 {
+			f.ManualExposure = 1
+		}
+		d.flicker = &flickerCompensator{config: f}
+	}
+}
+
+// Flickering returns whether the camera's frames are flickering, see
+// WithFlickerCompensation
+func (d *Detector) Flickering() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.flicker != nil && d.flicker.flickering
+}
+
+// flickerCompensator tracks the mean brightness of the last frames
+type flickerCompensator struct {
+	config     FlickerCompensation
+	brightness []float64
+	flickering bool
+	// lock is set when the exposure should be locked, locked once it was
+	lock, locked bool
+}
+
+// update adds the mean brightness of the current frame and reevaluates
+// whether the camera flickers
+func (f *flickerCompensator) update(brightness float64) {
+	f.brightness = append(f.brightness, brightness)
+	if len(f.brightness) > f.config.Window {
+		f.brightness = f.brightness[1:]
+	}
+	swings := f.swings()
+	switch {
+	case swings >= flickerMinSwings:
+		f.flickering = true
+	case swings < flickerMinSwings/2:
+		// only stop once the oscillation has mostly died down, so that a
+		// weakening oscillation doesn't toggle the compensation
+		f.flickering = false
+	}
+	if f.flickering && f.config.LockExposure && !f.locked {
+		f.lock = true
+	}
+}
+
+// swings returns the number of times the brightness swung across its mean,
+// by more than the amplitude on both sides
+func (f *flickerCompensator) swings() int {
+	if len(f.brightness) < f.config.Window/2 {
+		return 0
+	}
+	mean := 0.0
+	for _, b := range f.brightness {
+		mean += b
+	}
+	mean /= float64(len(f.brightness))
+	swings, side := 0, 0
+	for _, b := range f.brightness {
+		dev := b - mean
+		if math.Abs(dev) < f.config.Amplitude {
+			continue
+		}
+		s := 1
+		if dev < 0 {
+			s = -1
+		}
+		if side != 0 && s != side {
+			swings++
+		}
+		side = s
+	}
+	return swings
+}
+
+// filter drops the regions of the current frame if the camera flickers and
+// they cover more than the maximum area, as when the whole frame changed
+func (f *flickerCompensator) filter(regions []region, frame image.Point) []region {
+	if !f.flickering || frame.X == 0 || frame.Y == 0 {
+		return regions
+	}
+	area := 0
+	for _, r := range regions {
+		area += r.bounds.Dx() * r.bounds.Dy()
+	}
+	if float64(area) > f.config.MaxArea*float64(frame.X*frame.Y) {
+		return nil
+	}
+	return regions
+}
+
+// lockExposure switches the camera's auto exposure off once it flickers, if
+// the flicker compensation does so. It must not be called with the lock held
+func (d *Detector) lockExposure() {
+	d.mu.Lock()
+	f := d.flicker
+	if f == nil || !f.lock {
+		d.mu.Unlock()
+		return
+	}
+	f.lock, f.locked = false, true
+	d.mu.Unlock()
+	if err := d.SetCameraControl(ControlAutoExposure, f.config.ManualExposure); err != nil {
+		d.reportError(OpControl, err)
+	}
+}
+
+// meanBrightness returns the mean brightness of a frame, out of 255,
+// judging by a sample of its interleaved 8-bit pixels of which the first 3
+// channels are color
+func meanBrightness(pix []uint8, channels int) float64 {
+	samples, sum := 0, 0
+	for i := 0; i+2 < len(pix); i += grayscaleSampleStride * channels {
+		samples++
+		sum += int(pix[i]) + int(pix[i+1]) + int(pix[i+2])
+	}
+	if samples == 0 {
+		return 0
+	}
+	return float64(sum) / float64(3*samples)
+}
@@ -0,0 +1,78 @@
+package detector
+
+import (
+	"image"
+	"time"
+)
+
+// FrameInfo is the metadata of a processed frame, e.g. to correlate events
+// with other time based data sources
+type FrameInfo struct {
+	// Sequence is the frame's sequence number, see Event.StartFrame
+	Sequence int `json:"sequence"`
+	// Captured is when the frame was read from the camera or source
+	Captured time.Time   `json:"captured"`
+	Size     image.Point `json:"size"`
+	// DecodeLatency is how long decoding the frame took for sources which
+	// measure it (see DecodeTimer), and how long reading it took otherwise,
+	// including waiting for the camera
+	DecodeLatency time.Duration `json:"decode_latency"`
+}
+
+// DecodeTimer is implemented by sources which measure how long decoding
+// their last frame took, e.g. MJPEGSource
+type DecodeTimer interface {
+	DecodeLatency() time.Duration
+}
+
+// FrameInfo returns the metadata of the last processed frame, it is zero
+// before the first frame has been processed
+func (d *Detector) FrameInfo() FrameInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.frameInfo
+}
+
+// frameRateWindow is the number of latest frames the frame rate is measured
+// over
+const frameRateWindow = 30
+
+// frameRate measures the rate frames are processed at from when the latest
+// ones were captured
+type frameRate struct {
+	captured []time.Time
+}
+
+func (r *frameRate) add(t time.Time) {
+	if len(r.captured) == frameRateWindow {
+		r.captured = append(r.captured[:0], r.captured[1:]...)
+	}
+	r.captured = append(r.captured, t)
+}
+
+// rate returns the frames per second over the latest frames. The wait for
+// the next frame beyond the average gap between them counts too, so that
+// the rate falls when frames stop coming
+func (r *frameRate) rate(now time.Time) float64 {
+	if len(r.captured) < 2 {
+		return 0
+	}
+	first, last := r.captured[0], r.captured[len(r.captured)-1]
+	frames := len(r.captured) - 1
+	span := last.Sub(first)
+	if wait := now.Sub(last) - span/time.Duration(frames); wait > 0 {
+		span += wait
+	}
+	if span <= 0 {
+		return 0
+	}
+	return float64(frames) / span.Seconds()
+}
+
+// FrameRate returns the rate frames are processed at, in frames per second,
+// over the latest frames
+func (d *Detector) FrameRate() float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.captures.rate(time.Now())
+}
@@ -0,0 +1,219 @@
+package detector
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// FrameDropPolicy is what a detector does with frames captured while its
+// frame queue is full, see WithFrameQueue
+type FrameDropPolicy string
+
+const (
+	// DropOldest discards the oldest queued frame to make room for the new
+	// one, so that the frames processed are as recent as possible
+	DropOldest FrameDropPolicy = "drop_oldest"
+	// DropNewest discards the new frame, so that the queued frames are
+	// processed without gaps between them
+	DropNewest FrameDropPolicy = "drop_newest"
+	// BlockCapture waits for room in the queue before capturing again,
+	// leaving frames to the camera's driver or the source, which buffer or
+	// drop them in their own way
+	BlockCapture FrameDropPolicy = "block"
+)
+
+// DefaultFrameQueueSize is the default number of frames queued for
+// processing
+const DefaultFrameQueueSize = 2
+
+// errDetectorClosed is returned by reads of a closed frame queue
+var errDetectorClosed = errors.New("detector closed")
+
+// FrameQueue configures the queue of frames captured ahead of processing,
+// see WithFrameQueue
+type FrameQueue struct {
+	// Size is the number of frames queued, DefaultFrameQueueSize when 0
+	Size int `json:"size,omitempty"`
+	// Policy is DropOldest when empty
+	Policy FrameDropPolicy `json:"policy,omitempty"`
+}
+
+// WithFrameQueue makes the detector capture frames on a goroutine of their
+// own, into a queue of frames waiting to be processed, and explicit about
+// what happens when processing can't keep up with capture: once the queue
+// is full, frames are dropped as the policy says, or capture blocks. Dropped
+// frames are counted in Stats.
+//
+// Without a queue frames are captured one at a time, once the previous one
+// was processed, and a detector which falls behind reads the frames the
+// camera's driver or the source buffered meanwhile, e.g. OpenCV's V4L2
+// capture keeps the few oldest frames and the camera drops the newer ones
+func WithFrameQueue(q FrameQueue) Option {
+	return func(d *Detector) {
+		if q.Size == 0 {
+			q.Size = DefaultFrameQueueSize
+		}
+		if q.Policy == "" {
+			q.Policy = DropOldest
+		}
+		d.queue = &frameQueue{config: q}
+		d.queue.cond = sync.NewCond(&d.queue.mu)
+	}
+}
+
+// queuedFrame is a frame captured ahead of processing
+type queuedFrame struct {
+	frame    interface{}
+	captured time.Time
+	// read is how long reading the frame took
+	read time.Duration
+}
+
+// frameQueue is the queue of frames captured ahead of processing, filled by
+// a capture goroutine, which runs until capture fails or the queue is closed
+type frameQueue struct {
+	config  FrameQueue
+	mu      sync.Mutex
+	cond    *sync.Cond
+	frames  []queuedFrame
+	running bool
+	closed  bool
+	// paused stops capture while the detector goes to sleep
+	paused  bool
+	err     error
+	dropped int
+}
+
+// next returns the next queued frame, starting the capture goroutine if it
+// isn't running. It returns the capture error once the queued frames were
+// processed, after which the goroutine is started again by the next call
+func (q *frameQueue) next(b backend) (queuedFrame, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.running && q.err == nil && !q.closed {
+		q.running = true
+		go q.capture(b)
+	}
+	for len(q.frames) == 0 && q.err == nil && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return queuedFrame{}, errDetectorClosed
+	}
+	if len(q.frames) == 0 {
+		err := q.err
+		q.err = nil
+		return queuedFrame{}, err
+	}
+	f := q.frames[0]
+	q.frames = q.frames[1:]
+	q.cond.Broadcast()
+	return f, nil
+}
+
+// capture reads frames into the queue until reading fails or the queue is
+// closed
+func (q *frameQueue) capture(b backend) {
+	for {
+		start := time.Now()
+		frame, err := b.grabFrame()
+		captured := time.Now()
+		q.mu.Lock()
+		if err != nil || q.closed || q.paused {
+			if err != nil && !q.closed {
+				q.err = err
+			} else if err == nil {
+				b.discardFrame(frame)
+			}
+			q.running = false
+			q.cond.Broadcast()
+			q.mu.Unlock()
+			return
+		}
+		f := queuedFrame{frame: frame, captured: captured, read: captured.Sub(start)}
+		switch {
+		case len(q.frames) < q.config.Size:
+			q.frames = append(q.frames, f)
+		case q.config.Policy == DropOldest:
+			b.discardFrame(q.frames[0].frame)
+			q.frames = append(q.frames[1:], f)
+			q.dropped++
+		case q.config.Policy == DropNewest:
+			b.discardFrame(frame)
+			q.dropped++
+		default:
+			for len(q.frames) >= q.config.Size && !q.closed && !q.paused {
+				q.cond.Wait()
+			}
+			if q.closed || q.paused {
+				b.discardFrame(frame)
+				q.running = false
+				q.cond.Broadcast()
+				q.mu.Unlock()
+				return
+			}
+			q.frames = append(q.frames, f)
+		}
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}
+}
+
+// close stops capture and discards the queued frames, waiting for the frame
+// being read, so that the backend can be closed once it returns
+func (q *frameQueue) close(b backend) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+	for q.running {
+		q.cond.Wait()
+	}
+	for _, f := range q.frames {
+		b.discardFrame(f.frame)
+	}
+	q.frames = nil
+}
+
+// pause stops capture and discards the queued frames, waiting for the frame
+// being read, capture starts again with the next call to next
+func (q *frameQueue) pause(b backend) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.paused = true
+	q.cond.Broadcast()
+	for q.running && !q.closed {
+		q.cond.Wait()
+	}
+	q.paused = false
+	for _, f := range q.frames {
+		b.discardFrame(f.frame)
+	}
+	q.frames = nil
+}
+
+// droppedFrames returns the number of frames dropped
+func (q *frameQueue) droppedFrames() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// readFrame reads the next frame into the backend's staging buffer, from
+// the frame queue if the detector has one, it returns when the frame was
+// captured and how long reading it took
+func (d *Detector) readFrame() (time.Time, time.Duration, error) {
+	if d.queue == nil {
+		start := time.Now()
+		err := d.backend.readFrame()
+		captured := time.Now()
+		return captured, captured.Sub(start), err
+	}
+	f, err := d.queue.next(d.backend)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	d.backend.stageFrame(f.frame)
+	return f.captured, f.read, nil
+}
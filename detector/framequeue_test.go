@@ -0,0 +1,73 @@
+package detector
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// slowBackend grabs the first frame straight away and the next ones once
+// released, and records whether it was closed while a frame was being
+// grabbed
+type slowBackend struct {
+	backend
+	grabs        int32
+	grabbing     int32
+	closedInGrab int32
+	// started is signaled once a grab waits for release
+	started chan struct{}
+	release chan struct{}
+}
+
+func newSlowBackend() *slowBackend {
+	return &slowBackend{started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (b *slowBackend) grabFrame() (interface{}, error) {
+	if atomic.AddInt32(&b.grabs, 1) > 1 {
+		atomic.StoreInt32(&b.grabbing, 1)
+		defer atomic.StoreInt32(&b.grabbing, 0)
+		select {
+		case b.started <- struct{}{}:
+		default:
+		}
+		<-b.release
+	}
+	return struct{}{}, nil
+}
+
+func (b *slowBackend) discardFrame(frame interface{}) {}
+
+func (b *slowBackend) close() []error {
+	if atomic.LoadInt32(&b.grabbing) == 1 {
+		atomic.StoreInt32(&b.closedInGrab, 1)
+	}
+	return nil
+}
+
+func TestFrameQueueCloseWaitsForGrab(t *testing.T) {
+	for _, policy := range []FrameDropPolicy{DropOldest, DropNewest, BlockCapture} {
+		b := newSlowBackend()
+		q := &frameQueue{config: FrameQueue{Size: 1, Policy: policy}}
+		q.cond = sync.NewCond(&q.mu)
+		if _, err := q.next(b); err != nil {
+			t.Fatal(err)
+		}
+		// as Detector.Close does, with capture in the middle of a grab
+		// which only returns once the queue is closed
+		<-b.started
+		go func() {
+			q.mu.Lock()
+			for !q.closed {
+				q.cond.Wait()
+			}
+			q.mu.Unlock()
+			close(b.release)
+		}()
+		q.close(b)
+		b.close()
+		if atomic.LoadInt32(&b.closedInGrab) == 1 {
+			t.Fatalf("expected %s queue to close after the frame being grabbed was read", policy)
+		}
+	}
+}
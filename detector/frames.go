@@ -0,0 +1,91 @@
+package detector
+
+import (
+	"io"
+)
+
+// Frame is a processed frame, annotated with the motion found on it
+type Frame struct {
+	// JPG is the annotated frame, framed as requested from Frames
+	JPG    []byte    `json:"jpg"`
+	Info   FrameInfo `json:"info"`
+	Status string    `json:"status"`
+}
+
+// FrameIterator runs the detector, one frame at a time, handing each
+// annotated frame to the application, e.g. to stream it without the API
+// server or the window:
+//
+//	frames := md.Frames(detector.SnapshotOptions{Width: 640})
+//	defer frames.Close()
+//	for frames.Next() {
+//		f := frames.Frame()
+//		...
+//	}
+//	if err := frames.Err(); err != nil {
+//		...
+//	}
+type FrameIterator struct {
+	d      *Detector
+	opts   SnapshotOptions
+	frame  Frame
+	err    error
+	closed bool
+}
+
+// Frames returns an iterator over the detector's annotated frames, which
+// runs the detector in place of Start: each call to Next processes a frame,
+// calling the detector's callbacks as Start would
+func (d *Detector) Frames(opts SnapshotOptions) *FrameIterator {
+	return &FrameIterator{d: d, opts: opts}
+}
+
+// Next processes the next frame, reading past the frames which are skipped,
+// e.g. while the scene is idle, it returns false once the camera or source
+// has no more frames, the user asked for the detector to stop, or an error
+// occurred, see Err
+func (it *FrameIterator) Next() bool {
+	if it.closed {
+		return false
+	}
+	var processed, done bool
+	var err error
+	for !processed && !done && err == nil {
+		processed, done, err = it.d.step()
+	}
+	if err == nil {
+		var jpg []byte
+		if jpg, err = it.d.Snapshot(it.opts); err == nil {
+			it.frame = Frame{JPG: jpg, Info: it.d.FrameInfo(), Status: it.d.Status()}
+		}
+	}
+	if err != nil || done {
+		if err != io.EOF {
+			it.err = err
+		}
+		it.Close()
+		return false
+	}
+	return true
+}
+
+// Frame returns the frame processed by the last call to Next
+func (it *FrameIterator) Frame() Frame {
+	return it.frame
+}
+
+// Err returns the error which stopped the iteration, nil when the camera or
+// source ran out of frames or the user asked for the detector to stop
+func (it *FrameIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iteration, ending any ongoing event and tracks as Start
+// does when it returns. The detector itself isn't closed
+func (it *FrameIterator) Close() {
+	if it.closed {
+		return
+	}
+	it.closed = true
+	it.d.stop()
+}
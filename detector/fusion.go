@@ -0,0 +1,57 @@
+package detector
+
+import (
+	"time"
+)
+
+// FusionMode is the way triggers of external sensors, such as PIR sensors,
+// door contacts or radar, are combined with visual motion
+type FusionMode int
+
+const (
+	// FusionVisualOnly ignores external sensors
+	FusionVisualOnly FusionMode = iota
+
+	// FusionRequireSensor only reports visual motion while an external sensor
+	// has triggered within the fusion window, e.g. to require PIR and visual
+	// motion, cutting out false positives such as shadows and headlights
+	FusionRequireSensor
+
+	// FusionAny reports visual motion and sensor triggers alike, a trigger
+	// without visual motion forces an event, catching motion the camera misses
+	FusionAny
+)
+
+// WithSensorFusion combines visual motion with the triggers of external
+// sensors (see Trigger) in the given mode. Triggers count for the window
+// after they happen
+func WithSensorFusion(mode FusionMode, window time.Duration) Option {
+	return func(d *Detector) {
+		d.fusionMode = mode
+		d.fusionWindow = window
+	}
+}
+
+// Trigger reports that an external sensor, e.g. "pir", has triggered. With
+// FusionAny a trigger forces an event with the reason "sensor: <name>"
+// unless visual motion is already being reported. Triggers wake sleeping
+// detectors up, see WithSleepMode
+func (d *Detector) Trigger(sensor string) {
+	d.mu.Lock()
+	d.lastTrigger = time.Now()
+	d.wakeLocked()
+	capture := d.fusionMode == FusionAny && d.event == nil && !d.disarmed
+	d.mu.Unlock()
+	if capture {
+		d.CaptureEvent("sensor: " + sensor)
+	}
+}
+
+// sensorAllows returns whether visual motion should be reported given the
+// triggers of external sensors
+func (d *Detector) sensorAllows() bool {
+	if d.fusionMode != FusionRequireSensor {
+		return true
+	}
+	return !d.lastTrigger.IsZero() && time.Since(d.lastTrigger) <= d.fusionWindow
+}
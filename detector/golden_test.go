@@ -0,0 +1,102 @@
+//go:build purego || nogui
+// +build purego nogui
+
+package detector_test
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/GoAway/detector"
+)
+
+var update = flag.Bool("update", false, "overwrite golden files with the detected events")
+
+type goldenEvent struct {
+	StartFrame int `json:"startFrame"`
+	EndFrame   int `json:"endFrame"`
+}
+
+// golden holds the known-good events for a sample video, the sample videos
+// and initial golden files are generated by testdata/genvideos
+type golden struct {
+	Sensitivity float64       `json:"sensitivity"`
+	Tolerance   int           `json:"tolerance"`
+	Events      []goldenEvent `json:"events"`
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func runGoldenVideo(t *testing.T, video string) {
+	goldenPath := strings.TrimSuffix(video, ".mjpeg") + ".golden.json"
+	data, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want golden
+	if err := json.Unmarshal(data, &want); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(video)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []goldenEvent{}
+	md, err := detector.NewMotionDetectorFromSource(detector.NewMJPEGSource(f), "", nil,
+		detector.WithSensitivity(want.Sensitivity),
+		detector.WithEventHandler(func(e detector.Event) {
+			got = append(got, goldenEvent{StartFrame: e.StartFrame, EndFrame: e.EndFrame})
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer md.Close()
+	if err := md.Start(); err != io.EOF {
+		t.Fatalf("expected the video to run out of frames, got: %v", err)
+	}
+
+	if *update {
+		want.Events = got
+		data, err := json.MarshalIndent(want, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(goldenPath, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if len(got) != len(want.Events) {
+		t.Fatalf("expected %d events, got %d: %v", len(want.Events), len(got), got)
+	}
+	for i, e := range want.Events {
+		if abs(got[i].StartFrame-e.StartFrame) > want.Tolerance || abs(got[i].EndFrame-e.EndFrame) > want.Tolerance {
+			t.Errorf("event %d: expected frames %d-%d (±%d), got %d-%d",
+				i, e.StartFrame, e.EndFrame, want.Tolerance, got[i].StartFrame, got[i].EndFrame)
+		}
+	}
+}
+
+func TestGoldenVideos(t *testing.T) {
+	videos, err := filepath.Glob(filepath.Join("testdata", "*.mjpeg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, video := range videos {
+		video := video
+		t.Run(filepath.Base(video), func(t *testing.T) {
+			runGoldenVideo(t, video)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package detector
+
+import (
+	"time"
+)
+
+// RecentSnapshot is a snapshot kept in the detector's snapshot history
+type RecentSnapshot struct {
+	// JPG is the annotated frame, framed as given to WithSnapshotHistory
+	JPG      []byte    `json:"jpg"`
+	Sequence int       `json:"sequence"`
+	Captured time.Time `json:"captured"`
+	// Motion is set for frames motion was detected in
+	Motion bool `json:"motion,omitempty"`
+}
+
+// snapshotHistory is a ring buffer of the latest snapshots
+type snapshotHistory struct {
+	opts      SnapshotOptions
+	snapshots []RecentSnapshot
+	// next is the index the next snapshot is written at, the oldest once
+	// the buffer is full
+	next int
+	full bool
+}
+
+// WithSnapshotHistory keeps the snapshots of the last n frames in memory,
+// framed as given, e.g. so that a notification sent a few seconds after an
+// event started can include the frames from the moment motion was detected
+// instead of the current one, see RecentSnapshots. Every frame is encoded,
+// so scaling the snapshots down keeps the cost low
+func WithSnapshotHistory(n int, opts SnapshotOptions) Option {
+	return func(d *Detector) {
+		if n <= 0 {
+			d.history = nil
+			return
+		}
+		d.history = &snapshotHistory{opts: opts, snapshots: make([]RecentSnapshot, n)}
+	}
+}
+
+// RecentSnapshots returns the snapshots kept by WithSnapshotHistory, oldest
+// first
+func (d *Detector) RecentSnapshots() []RecentSnapshot {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	h := d.history
+	if h == nil {
+		return nil
+	}
+	recent := []RecentSnapshot{}
+	if h.full {
+		recent = append(recent, h.snapshots[h.next:]...)
+	}
+	return append(recent, h.snapshots[:h.next]...)
+}
+
+// recordSnapshot adds the snapshot of the frame just processed to the
+// history, if one is kept
+func (d *Detector) recordSnapshot() {
+	d.mu.Lock()
+	h := d.history
+	frame := d.backend.frameSize()
+	if h == nil || frame.X == 0 || frame.Y == 0 {
+		d.mu.Unlock()
+		return
+	}
+	crop, size, err := d.snapshotFraming(frame, h.opts)
+	var jpg []byte
+	if err == nil {
+		jpg, err = d.encodeSnapshot(nil, crop, size)
+	}
+	if err == nil {
+		h.snapshots[h.next] = RecentSnapshot{
+			JPG:      jpg,
+			Sequence: d.frameInfo.Sequence,
+			Captured: d.frameInfo.Captured,
+			Motion:   d.status == DetectorStatusMotionDetected,
+		}
+		h.next = (h.next + 1) % len(h.snapshots)
+		h.full = h.full || h.next == 0
+	}
+	d.mu.Unlock()
+	d.reportError(OpEncode, err)
+}
@@ -0,0 +1,161 @@
+package detector
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/png" // some cameras serve png stills
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultStillInterval is the default interval a still image is
+	// requested at
+	DefaultStillInterval = time.Second
+
+	// DefaultStillTimeout is the default time a still image request can
+	// take, slow cameras such as the ESP32-CAM take a few seconds at high
+	// resolutions
+	DefaultStillTimeout = 10 * time.Second
+
+	// DefaultStillMaxBackoff is the default longest wait between requests
+	// while the camera fails
+	DefaultStillMaxBackoff = 30 * time.Second
+
+	// maxStillSize is the largest still image read, larger responses are
+	// not images of a camera
+	maxStillSize = 16 << 20
+)
+
+// HTTPStillOptions configure an HTTPStillSource, zero values use the defaults
+type HTTPStillOptions struct {
+	// Interval is the interval stills are requested at, slower responses
+	// delay the next request rather than overlapping it
+	Interval time.Duration
+	// Timeout is the longest a request can take
+	Timeout time.Duration
+	// MaxBackoff is the longest wait between requests while the camera
+	// fails, the wait doubles from the interval with every failure
+	MaxBackoff time.Duration
+	// MaxFailures is the number of consecutive failures after which Read
+	// returns the last error, 0 to keep retrying
+	MaxFailures int
+	// Header is sent with every request, e.g. for authentication
+	Header http.Header
+	Client *http.Client
+	// OnError is called with every failed request, which is otherwise
+	// retried silently
+	OnError func(error)
+}
+
+// HTTPStillSource is a Source which polls a URL serving the camera's current
+// still image, e.g. http://<ip>/capture of an ESP32-CAM or the snapshot URL
+// of a doorbell or IP camera without a video stream
+type HTTPStillSource struct {
+	url      string
+	opts     HTTPStillOptions
+	ctx      context.Context
+	cancel   context.CancelFunc
+	next     time.Time
+	failures int
+	latency  time.Duration
+}
+
+// NewHTTPStillSource is the constructor for an HTTPStillSource of the given
+// URL
+func NewHTTPStillSource(url string, opts HTTPStillOptions) *HTTPStillSource {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultStillInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultStillTimeout
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultStillMaxBackoff
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HTTPStillSource{url: url, opts: opts, ctx: ctx, cancel: cancel}
+}
+
+// Read waits for the next interval and returns the camera's still image.
+// Failed requests, slow, erroring or with invalid images, are retried with a
+// backoff until MaxFailures, or indefinitely. It returns io.EOF once the
+// source is closed
+func (s *HTTPStillSource) Read() (image.Image, error) {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil, io.EOF
+		case <-time.After(time.Until(s.next)):
+		}
+		start := time.Now()
+		img, err := s.fetch()
+		if err == nil {
+			s.failures, s.latency = 0, time.Since(start)
+			s.next = start.Add(s.opts.Interval)
+			return img, nil
+		}
+		if s.ctx.Err() != nil {
+			return nil, io.EOF
+		}
+		s.failures++
+		if s.opts.OnError != nil {
+			s.opts.OnError(err)
+		}
+		if s.opts.MaxFailures > 0 && s.failures >= s.opts.MaxFailures {
+			return nil, fmt.Errorf("%d consecutive failures, the last: %w", s.failures, err)
+		}
+		backoff := s.opts.Interval
+		for i := 1; i < s.failures && backoff < s.opts.MaxBackoff; i++ {
+			backoff *= 2
+		}
+		if backoff > s.opts.MaxBackoff {
+			backoff = s.opts.MaxBackoff
+		}
+		s.next = time.Now().Add(backoff)
+	}
+}
+
+// fetch requests and decodes a still image
+func (s *HTTPStillSource) fetch() (image.Image, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, s.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.opts.Header {
+		req.Header[k] = v
+	}
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("still image request responded with %s", resp.Status)
+	}
+	img, _, err := image.Decode(io.LimitReader(resp.Body, maxStillSize))
+	if err != nil {
+		return nil, fmt.Errorf("invalid still image: %w", err)
+	}
+	return img, nil
+}
+
+// DecodeLatency implements DecodeTimer, it is how long requesting and
+// decoding the last still image took
+func (s *HTTPStillSource) DecodeLatency() time.Duration {
+	return s.latency
+}
+
+// Close stops polling, interrupting any request
+func (s *HTTPStillSource) Close() error {
+	s.cancel()
+	return nil
+}
@@ -0,0 +1,66 @@
+package detector
+
+import (
+	"path"
+	"regexp"
+)
+
+// identityIDPattern are the valid camera IDs, which are used in storage
+// paths and metric labels
+var identityIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// Identity identifies a camera, so that the data of many cameras remains
+// attributable to each, e.g. {ID: "garage-north", Name: "Garage",
+// Labels: {"location": "garage", "direction": "north"}}
+type Identity struct {
+	// ID is the camera's stable ID, its events, metrics and storage paths
+	// are keyed by it, so it shouldn't change once data has been recorded
+	ID string `json:"id"`
+	// Name is the camera's human friendly name, rendered onto its frames
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// WithIdentity identifies the camera, its identity is set on its events and
+// its name rendered onto its frames
+func WithIdentity(id Identity) Option {
+	return func(d *Detector) {
+		d.identity = id.copy()
+	}
+}
+
+// Identity returns the camera's identity, see WithIdentity
+func (d *Detector) Identity() Identity {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.identity.copy()
+}
+
+// Path returns a storage path under the camera's ID, e.g.
+// garage-north/snapshots/1.jpg, so that cameras sharing a storage don't
+// overwrite each other's files
+func (i Identity) Path(elem ...string) string {
+	return path.Join(append([]string{i.ID}, elem...)...)
+}
+
+// copy returns a copy of the identity which doesn't share its labels
+func (i Identity) copy() Identity {
+	if i.Labels != nil {
+		labels := make(map[string]string, len(i.Labels))
+		for k, v := range i.Labels {
+			labels[k] = v
+		}
+		i.Labels = labels
+	}
+	return i
+}
+
+// eventIdentity returns the identity set on events, none without an ID, the
+// caller must hold the detector's lock
+func (d *Detector) eventIdentity() *Identity {
+	if d.identity.ID == "" {
+		return nil
+	}
+	id := d.identity.copy()
+	return &id
+}
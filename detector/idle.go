@@ -0,0 +1,146 @@
+package detector
+
+import (
+	"time"
+)
+
+const (
+	// DefaultIdleAfter is the default time without motion after which
+	// frames are skipped, see WithIdleSkipping
+	DefaultIdleAfter = 30 * time.Second
+
+	// DefaultIdleEvery is the default interval, in frames, between the
+	// frames processed while idle
+	DefaultIdleEvery = 5
+
+	// DefaultIdleChange is the default fraction of the sampled pixels of a
+	// skipped frame which must change for the detector to wake up
+	DefaultIdleChange = 0.005
+
+	// idleSampleStride is the number of pixels between those sampled to
+	// look for changes in skipped frames
+	idleSampleStride = 7
+
+	// idleSampleDiff is the smallest change of a sampled pixel's
+	// brightness, out of 255, which counts as a change
+	idleSampleDiff = 24
+)
+
+// IdleSkipping is the configuration of the frame skipping of quiet scenes,
+// see WithIdleSkipping
+type IdleSkipping struct {
+	// After is how long the scene must be quiet for frames to be skipped,
+	// DefaultIdleAfter when 0
+	After time.Duration `json:"after,omitempty"`
+	// Every is the interval, in frames, between the frames processed while
+	// idle, DefaultIdleEvery when 0
+	Every int `json:"every,omitempty"`
+	// Change is the fraction of pixels, sampled from skipped frames, which
+	// must change between frames to process them again, DefaultIdleChange
+	// when 0
+	Change float64 `json:"change,omitempty"`
+}
+
+// WithIdleSkipping cuts the CPU used while the scene is quiet, e.g. on
+// battery or solar powered cameras: once no motion was detected for After,
+// only every Every-th frame is processed. Skipped frames are still read, and
+// a sample of their pixels is compared with the previous frame's, so that
+// the detector snaps back to processing every frame as soon as anything
+// changes. Skipped frames are counted in Stats
+func WithIdleSkipping(s IdleSkipping) Option {
+	return func(d *Detector) {
+		if s.After == 0 {
+			s.After = DefaultIdleAfter
+		}
+		if s.Every == 0 {
+			s.Every = DefaultIdleEvery
+		}
+		if s.Change == 0 {
+			s.Change = DefaultIdleChange
+		}
+		d.idle = &idleSkipper{config: s}
+	}
+}
+
+// idleSkipper decides which frames are skipped while the scene is quiet
+type idleSkipper struct {
+	config IdleSkipping
+	// quietSince is when motion was last detected, or the first frame
+	// processed
+	quietSince time.Time
+	skipping   bool
+	// since is the number of frames skipped since the last one processed
+	since   int
+	skipped int
+	// samples and previous are the brightness samples of the staged frame
+	// and of the one before it
+	samples, previous []uint8
+}
+
+// skipFrame returns whether the frame which was read is skipped rather than
+// processed, the caller must hold the detector's lock
+func (d *Detector) skipFrame() bool {
+	s := d.idle
+	if s == nil {
+		return false
+	}
+	s.samples, s.previous = d.backend.sampleFrame(s.previous), s.samples
+	if !s.skipping {
+		return false
+	}
+	if changedFraction(s.samples, s.previous) > s.config.Change {
+		// something changed, motion is detected at full rate from now
+		s.skipping, s.quietSince = false, time.Now()
+		return false
+	}
+	if s.since++; s.since >= s.config.Every {
+		s.since = 0
+		return false
+	}
+	s.skipped++
+	return true
+}
+
+// updateIdle starts skipping frames once no motion was detected for long
+// enough, the caller must hold the detector's lock
+func (d *Detector) updateIdle(now time.Time) {
+	s := d.idle
+	if s == nil {
+		return
+	}
+	if s.quietSince.IsZero() || d.status == DetectorStatusMotionDetected || d.event != nil {
+		s.skipping, s.quietSince, s.since = false, now, 0
+		return
+	}
+	s.skipping = now.Sub(s.quietSince) >= s.config.After
+}
+
+// sampleBrightness appends the brightness of every idleSampleStride-th pixel
+// of a frame with the given number of channels to dst, the first three
+// channels are colors
+func sampleBrightness(dst []uint8, pix []uint8, channels int) []uint8 {
+	dst = dst[:0]
+	for i := 0; i+channels <= len(pix); i += idleSampleStride * channels {
+		if channels < 3 {
+			dst = append(dst, pix[i])
+			continue
+		}
+		dst = append(dst, uint8((int(pix[i])+int(pix[i+1])+int(pix[i+2]))/3))
+	}
+	return dst
+}
+
+// changedFraction returns the fraction of the samples which changed, all of
+// them if the frames can't be compared
+func changedFraction(samples, previous []uint8) float64 {
+	if len(samples) == 0 || len(samples) != len(previous) {
+		return 1
+	}
+	changed := 0
+	for i, v := range samples {
+		if diff := int(v) - int(previous[i]); diff > idleSampleDiff || diff < -idleSampleDiff {
+			changed++
+		}
+	}
+	return float64(changed) / float64(len(samples))
+}
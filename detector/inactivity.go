@@ -0,0 +1,128 @@
+package detector
+
+import (
+	"time"
+)
+
+// InactivityRule alerts when no motion was seen in a zone for too long
+// during the hours activity is expected, e.g. to check on an elderly relative
+// with no movement in their kitchen by 10am
+type InactivityRule struct {
+	// Zone is the name of the zone, empty for anywhere in the frame
+	Zone string
+	// MaxQuiet is the longest time without motion which is normal during
+	// the active hours, quiet time outside of them doesn't count
+	MaxQuiet time.Duration
+	// Start and End are the times of day activity is expected between, as
+	// offsets from midnight in local time, e.g. 6*time.Hour and 22*time.Hour.
+	// The hours span midnight when End is before Start, and the whole day
+	// when both are 0
+	Start, End time.Duration
+	Severity   Severity
+}
+
+// Inactivity is a zone in which no motion was seen for longer than a rule
+// allows
+type Inactivity struct {
+	Zone string `json:"zone,omitempty"`
+	// LastMotion is when motion was last seen in the zone, zero if it
+	// wasn't since the detector started
+	LastMotion time.Time `json:"last_motion,omitempty"`
+	// Quiet is how long the zone was quiet for during the active hours
+	Quiet    time.Duration `json:"quiet"`
+	Time     time.Time     `json:"time"`
+	Severity Severity      `json:"severity"`
+}
+
+// inactivityRule is an inactivity rule and what it saw so far
+type inactivityRule struct {
+	rule         InactivityRule
+	onInactivity func(Inactivity)
+	lastMotion   time.Time
+	// watchedSince is since when the zone was watched without a break,
+	// the quiet time counts from then at the earliest
+	watchedSince time.Time
+	// alerted is whether the rule alerted on the current quiet spell
+	alerted bool
+}
+
+// WithInactivityAlert calls onInactivity when no motion was seen in the
+// rule's zone for longer than its MaxQuiet during its active hours, e.g. for
+// baby or elderly monitors. It alerts once per quiet spell, and again once
+// motion was seen, or on the next day's active hours. Motion counts whether
+// or not it is reported, e.g. without sensor triggers, while a disarmed
+// detector doesn't alert and the quiet time counts from when it is armed
+// again
+func WithInactivityAlert(rule InactivityRule, onInactivity func(Inactivity)) Option {
+	return func(d *Detector) {
+		d.inactivityRules = append(d.inactivityRules, &inactivityRule{rule: rule, onInactivity: onInactivity})
+	}
+}
+
+// activeSince returns when the active hours the given time is in started,
+// false outside of them. It is zero when the whole day is active
+func (r InactivityRule) activeSince(now time.Time) (time.Time, bool) {
+	if r.Start == 0 && r.End == 0 {
+		return time.Time{}, true
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start, of := midnight.Add(r.Start), now.Sub(midnight)
+	switch {
+	case r.Start <= r.End:
+		return start, of >= r.Start && of < r.End
+	case of >= r.Start:
+		return start, true
+	default:
+		// the hours which started yesterday
+		return start.AddDate(0, 0, -1), of < r.End
+	}
+}
+
+// updateInactivity checks the inactivity rules given the regions in which
+// motion was detected, alerts are handed to their handlers once the
+// detector's lock is released. The caller must hold the detector's lock
+func (d *Detector) updateInactivity(regions []region, now time.Time) {
+	if len(d.inactivityRules) == 0 {
+		return
+	}
+	frame := d.backend.frameSize()
+	for _, r := range d.inactivityRules {
+		if d.disarmed || r.watchedSince.IsZero() {
+			r.watchedSince, r.alerted = now, false
+		}
+		motion := false
+		for _, region := range regions {
+			if r.rule.Zone == "" || d.trackZone(region.bounds, frame) == r.rule.Zone {
+				motion = true
+				break
+			}
+		}
+		if motion {
+			r.lastMotion, r.alerted = now, false
+			continue
+		}
+		active, ok := r.rule.activeSince(now)
+		if !ok {
+			r.alerted = false
+			continue
+		}
+		quietSince := r.watchedSince
+		for _, t := range []time.Time{active, r.lastMotion} {
+			if t.After(quietSince) {
+				quietSince = t
+			}
+		}
+		if r.alerted || now.Sub(quietSince) < r.rule.MaxQuiet {
+			continue
+		}
+		r.alerted = true
+		alert, onInactivity := Inactivity{
+			Zone:       r.rule.Zone,
+			LastMotion: r.lastMotion,
+			Quiet:      now.Sub(quietSince),
+			Time:       now,
+			Severity:   r.rule.Severity,
+		}, r.onInactivity
+		d.pending = append(d.pending, func() { onInactivity(alert) })
+	}
+}
@@ -0,0 +1,127 @@
+package detector
+
+import (
+	"image"
+	"sort"
+	"time"
+)
+
+// Stage is a stage of the frame processing pipeline, whose latency is
+// measured, see Stats.Latency
+type Stage string
+
+const (
+	// StageCapture is reading the frame from the camera or source,
+	// including waiting for it
+	StageCapture Stage = "capture"
+	// StagePreprocess is de-warping, stabilizing, hiding privacy zones and
+	// the pre-processing hook
+	StagePreprocess Stage = "preprocess"
+	// StageSubtraction is the background subtraction, including the night
+	// processing
+	StageSubtraction Stage = "subtraction"
+	// StageThreshold is thresholding and dilating the foreground mask
+	StageThreshold Stage = "threshold"
+	// StageContours is finding the contours of the foreground mask and
+	// filtering them
+	StageContours Stage = "contours"
+	// StageTracking is tracking objects and events
+	StageTracking Stage = "tracking"
+	// StageDrawing is outlining motion, rendering the status, the frame
+	// hook and showing the frame
+	StageDrawing Stage = "drawing"
+	// StageEncode is encoding snapshots, of the snapshot history, plates,
+	// Snapshot and Frames
+	StageEncode Stage = "encode"
+)
+
+// Stages are the stages of the pipeline, in order
+var Stages = []Stage{StageCapture, StagePreprocess, StageSubtraction, StageThreshold, StageContours, StageTracking, StageDrawing, StageEncode}
+
+// latencyWindow is the number of frames latency percentiles are computed
+// over
+const latencyWindow = 300
+
+// LatencyStats are the percentiles of a stage's latency over the latest
+// frames
+type LatencyStats struct {
+	// Samples is the number of frames the percentiles are computed over
+	Samples int           `json:"samples"`
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	P99     time.Duration `json:"p99"`
+	Max     time.Duration `json:"max"`
+}
+
+// latencies keeps the latest latencies of each stage
+type latencies struct {
+	samples map[Stage][]time.Duration
+	next    map[Stage]int
+}
+
+// add records a latency of a stage
+func (l *latencies) add(s Stage, latency time.Duration) {
+	if l.samples == nil {
+		l.samples, l.next = map[Stage][]time.Duration{}, map[Stage]int{}
+	}
+	samples := l.samples[s]
+	if len(samples) < latencyWindow {
+		l.samples[s] = append(samples, latency)
+		return
+	}
+	samples[l.next[s]] = latency
+	l.next[s] = (l.next[s] + 1) % latencyWindow
+}
+
+// stats returns the percentiles of the stages measured so far
+func (l *latencies) stats() map[Stage]LatencyStats {
+	stats := make(map[Stage]LatencyStats, len(l.samples))
+	for s, samples := range l.samples {
+		sorted := append([]time.Duration{}, samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		at := func(p float64) time.Duration {
+			return sorted[int(p*float64(len(sorted)-1))]
+		}
+		stats[s] = LatencyStats{Samples: len(sorted), P50: at(0.5), P90: at(0.9), P99: at(0.99), Max: sorted[len(sorted)-1]}
+	}
+	return stats
+}
+
+// stageClock measures the stages of a frame, in the order they run in.
+// Stages can run more than once per frame, their latency is the total
+type stageClock struct {
+	last  time.Time
+	spent map[Stage]time.Duration
+}
+
+// newStageClock starts measuring a frame's stages
+func newStageClock() *stageClock {
+	return &stageClock{last: time.Now(), spent: map[Stage]time.Duration{}}
+}
+
+// mark ends a stage, which started when the previous one ended
+func (c *stageClock) mark(s Stage) {
+	if c == nil {
+		return
+	}
+	now := time.Now()
+	c.spent[s] += now.Sub(c.last)
+	c.last = now
+}
+
+// record adds the latencies of the frame's stages
+func (c *stageClock) record(l *latencies) {
+	for s, spent := range c.spent {
+		l.add(s, spent)
+	}
+}
+
+// encodeSnapshot appends a snapshot of the current frame to dst, see
+// backend.snapshotJPG, measuring StageEncode. The caller must hold the
+// detector's lock
+func (d *Detector) encodeSnapshot(dst []byte, crop image.Rectangle, size image.Point) ([]byte, error) {
+	start := time.Now()
+	jpg, err := d.backend.snapshotJPG(dst, crop, size)
+	d.latency.add(StageEncode, time.Since(start))
+	return jpg, err
+}
@@ -0,0 +1,87 @@
+package detector
+
+import (
+	"strings"
+)
+
+// StatusDryRun is the text marking frames in dry run mode, see WithDryRun,
+// it can be translated like the statuses
+const StatusDryRun = "Dry Run"
+
+// StatusTranslations are the built-in translations of the statuses rendered
+// onto frames, by language. They are ASCII only, as the fonts frames are
+// rendered with have no accented letters
+var StatusTranslations = map[string]map[string]string{
+	"de": {
+		DetectorStatusReady:          "Bereit",
+		DetectorStatusMotionDetected: "Bewegung erkannt",
+		DetectorStatusClosed:         "Beendet",
+		DetectorStatusReconnecting:   "Verbindet neu",
+		DetectorStatusAsleep:         "Schlaeft",
+		StatusDryRun:                 "Testlauf",
+	},
+	"es": {
+		DetectorStatusReady:          "Listo",
+		DetectorStatusMotionDetected: "Movimiento detectado",
+		DetectorStatusClosed:         "Cerrado",
+		DetectorStatusReconnecting:   "Reconectando",
+		DetectorStatusAsleep:         "En reposo",
+		StatusDryRun:                 "Simulacro",
+	},
+	"fr": {
+		DetectorStatusReady:          "Pret",
+		DetectorStatusMotionDetected: "Mouvement detecte",
+		DetectorStatusClosed:         "Ferme",
+		DetectorStatusReconnecting:   "Reconnexion",
+		DetectorStatusAsleep:         "En veille",
+		StatusDryRun:                 "Essai",
+	},
+	"pt": {
+		DetectorStatusReady:          "Pronto",
+		DetectorStatusMotionDetected: "Movimento detectado",
+		DetectorStatusClosed:         "Fechado",
+		DetectorStatusReconnecting:   "Reconectando",
+		DetectorStatusAsleep:         "Em repouso",
+		StatusDryRun:                 "Simulacao",
+	},
+}
+
+// WithLanguage renders the statuses onto frames in the given language, e.g.
+// "es" or "pt-BR", with the StatusTranslations. Status and the API still
+// report them in English, for programs. Unknown languages are English
+func WithLanguage(lang string) Option {
+	return func(d *Detector) {
+		d.language = lang
+		d.statusText = StatusTranslations[baseLanguage(lang)]
+		if t, ok := StatusTranslations[lang]; ok {
+			d.statusText = t
+		}
+	}
+}
+
+// WithStatusText renders the statuses onto frames with the given text,
+// keyed by status, e.g. DetectorStatusMotionDetected or StatusDryRun, for
+// languages without built-in translations or to reword them. Statuses
+// without text are rendered in English
+func WithStatusText(text map[string]string) Option {
+	return func(d *Detector) {
+		d.statusText = text
+	}
+}
+
+// baseLanguage returns the language of a language tag, e.g. "pt" for
+// "pt-BR"
+func baseLanguage(lang string) string {
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	return strings.ToLower(lang)
+}
+
+// translate returns the text rendered for a status
+func (d *Detector) translate(status string) string {
+	if t, ok := d.statusText[status]; ok && t != "" {
+		return t
+	}
+	return status
+}
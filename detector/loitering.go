@@ -0,0 +1,162 @@
+package detector
+
+import (
+	"time"
+)
+
+// abandonDistance is the distance, in multiples of the larger object's size,
+// beyond which the carrier of an object is considered to have left it
+const abandonDistance = 2.0
+
+// Severity is how urgent an alert is, e.g. to pick a notification channel
+type Severity int
+
+const (
+	// SeverityLow alerts are worth logging
+	SeverityLow Severity = iota
+
+	// SeverityMedium alerts are worth a notification
+	SeverityMedium
+
+	// SeverityHigh alerts are worth waking someone up for
+	SeverityHigh
+)
+
+// String returns the name of the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityLow:
+		return "low"
+	case SeverityMedium:
+		return "medium"
+	case SeverityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the severity by name, e.g. in JSON
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// LoiteringRule alerts on objects which stay still in a zone for too long
+type LoiteringRule struct {
+	// Zone is the name of the zone, empty for anywhere in the frame
+	Zone        string
+	MinDuration time.Duration
+	Severity    Severity
+}
+
+// Loitering is an object which stayed still in a zone for longer than a
+// rule allows
+type Loitering struct {
+	Track    Track         `json:"track"`
+	Zone     string        `json:"zone,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Severity Severity      `json:"severity"`
+}
+
+// AbandonedObjectRule alerts on objects left behind in a zone, e.g. a bag,
+// a new still object which split off from another one that moved away
+type AbandonedObjectRule struct {
+	// Zone is the name of the zone, empty for anywhere in the frame
+	Zone string
+	// MinDuration is how long the object must stay after it was left
+	MinDuration time.Duration
+	Severity    Severity
+}
+
+// AbandonedObject is an object left behind by its carrier
+type AbandonedObject struct {
+	Track Track `json:"track"`
+	// CarrierID is the ID of the track of the object which left it behind
+	CarrierID int       `json:"carrier_id"`
+	Left      time.Time `json:"left"`
+	Zone      string    `json:"zone,omitempty"`
+	Severity  Severity  `json:"severity"`
+}
+
+// trackRule is a rule on tracked objects, it remembers the tracks it already
+// alerted on so that it alerts once per object
+type trackRule struct {
+	check   func(t *Track, now time.Time) func()
+	alerted map[int]bool
+}
+
+// WithLoitering calls onLoitering, once per object, when an object stays
+// still in the rule's zone for longer than its minimum duration. Objects
+// which blend into the background as they stay still are eventually lost,
+// see also Track.Dwell for objects which move about
+func WithLoitering(rule LoiteringRule, onLoitering func(Loitering)) Option {
+	return func(d *Detector) {
+		d.trackRules = append(d.trackRules, &trackRule{check: func(t *Track, now time.Time) func() {
+			if t.Zone != rule.Zone && rule.Zone != "" {
+				return nil
+			}
+			still := now.Sub(t.StillSince)
+			if still < rule.MinDuration {
+				return nil
+			}
+			l := Loitering{Track: t.copy(), Zone: t.Zone, Duration: still, Severity: rule.Severity}
+			return func() { onLoitering(l) }
+		}})
+	}
+}
+
+// WithAbandonedObjects calls onAbandoned, once per object, when an object
+// stays still in the rule's zone for longer than its minimum duration after
+// the object it split off from, its carrier, moved away or left the frame
+func WithAbandonedObjects(rule AbandonedObjectRule, onAbandoned func(AbandonedObject)) Option {
+	return func(d *Detector) {
+		d.trackRules = append(d.trackRules, &trackRule{check: func(t *Track, now time.Time) func() {
+			if t.carrierLeft.IsZero() || (t.Zone != rule.Zone && rule.Zone != "") {
+				return nil
+			}
+			// the object must have stayed still since before it was left,
+			// the carrier itself moves until it leaves
+			if t.StillSince.After(t.carrierLeft) || now.Sub(t.carrierLeft) < rule.MinDuration {
+				return nil
+			}
+			a := AbandonedObject{Track: t.copy(), CarrierID: t.carrier, Left: t.carrierLeft, Zone: t.Zone, Severity: rule.Severity}
+			return func() { onAbandoned(a) }
+		}})
+	}
+}
+
+// applyTrackRules checks the tracked objects against the rules, the alerts
+// are handed to their handlers once the detector's lock is released
+func (d *Detector) applyTrackRules(now time.Time) {
+	for _, t := range d.tracks {
+		if t.carrier == 0 {
+			continue
+		}
+		if c, ok := d.track(t.carrier); ok && distance(c.Bounds, t.Bounds) <= abandonDistance*size(c.Bounds, t.Bounds) {
+			t.carrierLeft = time.Time{}
+		} else if t.carrierLeft.IsZero() {
+			t.carrierLeft = now
+		}
+	}
+	for _, rule := range d.trackRules {
+		live := make(map[int]bool, len(d.tracks))
+		for _, t := range d.tracks {
+			live[t.ID] = true
+			if t.missed > 0 || rule.alerted[t.ID] {
+				continue
+			}
+			if alert := rule.check(t, now); alert != nil {
+				if rule.alerted == nil {
+					rule.alerted = map[int]bool{}
+				}
+				rule.alerted[t.ID] = true
+				d.pending = append(d.pending, alert)
+			}
+		}
+		for id := range rule.alerted {
+			if !live[id] {
+				delete(rule.alerted, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package detector
+
+import (
+	"runtime"
+	"runtime/pprof"
+)
+
+// matProfileName is the name of the pprof profile of unclosed Mats which gocv
+// registers when built with the "matprofile" tag
+const matProfileName = "gocv.io/x/gocv.Mat"
+
+// MemStats reports the memory used by a Detector, to help track down leaks
+// in long running deployments
+type MemStats struct {
+	// Mats is the number of OpenCV matrices held by the detector
+	Mats int `json:"mats"`
+	// NativeBytes approximates the memory allocated by OpenCV, outside of
+	// the Go heap, for the matrices and background model of the detector
+	NativeBytes int64 `json:"native_bytes"`
+	// BufferBytes is the size of the frame buffers held by the detector on
+	// the Go heap (used by the pure Go backend)
+	BufferBytes int64 `json:"buffer_bytes"`
+	// ProcessMats is the number of unclosed Mats in the whole process, it is
+	// only tracked when gocv is built with the "matprofile" tag, -1 otherwise
+	ProcessMats int `json:"process_mats"`
+	// HeapAlloc is the number of bytes allocated on the Go heap
+	HeapAlloc uint64 `json:"heap_alloc"`
+}
+
+// MemStats returns the memory usage of the detector
+func (d *Detector) MemStats() MemStats {
+	d.mu.Lock()
+	stats := d.backend.memStats()
+	d.mu.Unlock()
+
+	stats.ProcessMats = -1
+	if p := pprof.Lookup(matProfileName); p != nil {
+		stats.ProcessMats = p.Count()
+	}
+	var rt runtime.MemStats
+	runtime.ReadMemStats(&rt)
+	stats.HeapAlloc = rt.HeapAlloc
+	return stats
+}
@@ -0,0 +1,109 @@
+package detector
+
+// NightMode is the way frames are processed in low light
+type NightMode int
+
+const (
+	// NightOff always uses the daylight processing
+	NightOff NightMode = iota
+
+	// NightOn always uses the night processing: luminance is histogram
+	// equalized and denoised before subtraction, and the night threshold
+	// is used
+	NightOn
+
+	// NightAuto uses the night processing on black and white frames, e.g.
+	// when the camera's IR illuminator is on
+	NightAuto
+)
+
+const (
+	// DefaultNightThreshold is the default threshold used with the night
+	// processing, higher than DefaultThreshold to ignore sensor noise
+	DefaultNightThreshold = 40
+
+	// grayscaleTolerance is the largest difference between the channels of
+	// a pixel for the pixel to be considered gray
+	grayscaleTolerance = 12
+
+	// grayscaleSampleStride is the number of pixels between those sampled to
+	// tell if a frame is black and white, it is prime so the samples don't
+	// line up in columns
+	grayscaleSampleStride = 97
+
+	// nightBlurRadius is the radius of the box blur which denoises frames
+	// before subtraction with the night processing
+	nightBlurRadius = 2
+)
+
+// frameParams are the detector settings which backends use to process frames
+type frameParams struct {
+	threshold      float64
+	nightThreshold float64
+	night          NightMode
+	// preprocess is the pre-processing hook and info the metadata of the
+	// frame it is called with, its size is set by the backend
+	preprocess FrameHook
+	info       FrameInfo
+	// clock measures the stages of the frame
+	clock *stageClock
+}
+
+// WithNightMode sets the way frames are processed in low light, e.g.
+// NightAuto to switch to the night processing when the camera switches to IR
+func WithNightMode(mode NightMode) Option {
+	return func(d *Detector) {
+		d.nightMode = mode
+	}
+}
+
+// WithNightThreshold sets the threshold used with the night processing,
+// see WithThreshold
+func WithNightThreshold(threshold float64) Option {
+	return func(d *Detector) {
+		d.nightThreshold = threshold
+	}
+}
+
+// Night returns whether the last frame was processed with the night
+// processing
+func (d *Detector) Night() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.night
+}
+
+// useNight returns whether a frame should be processed with the night
+// processing, given its interleaved 8-bit pixels of which the first 3
+// channels are color
+func (p frameParams) useNight(pix []uint8, channels int) bool {
+	switch p.night {
+	case NightOn:
+		return true
+	case NightAuto:
+		return grayscale(pix, channels)
+	}
+	return false
+}
+
+// grayscale returns whether a frame is black and white, judging by a sample
+// of its pixels
+func grayscale(pix []uint8, channels int) bool {
+	samples, gray := 0, 0
+	for i := 0; i+2 < len(pix); i += grayscaleSampleStride * channels {
+		samples++
+		a, b, c := int(pix[i]), int(pix[i+1]), int(pix[i+2])
+		if abs(a-b) <= grayscaleTolerance && abs(b-c) <= grayscaleTolerance && abs(a-c) <= grayscaleTolerance {
+			gray++
+		}
+	}
+	// tolerate a few colored pixels, e.g. an overlaid timestamp
+	return samples > 0 && gray*100 >= samples*98
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,47 @@
+package detector
+
+import (
+	"image"
+)
+
+// WithMinObjectHeight ignores motion of objects shorter than the given
+// height in meters, e.g. so that cats and birds don't trigger alerts meant
+// for people. The height of an object is measured with the scale of the
+// calibrated zone (see Zone.PixelsPerMeter) its feet, the bottom center of
+// its bounds, are in. Motion outside of calibrated zones is always reported
+func WithMinObjectHeight(meters float64) Option {
+	return func(d *Detector) {
+		d.minObjectHeight = meters
+	}
+}
+
+// scaleAt returns the pixels per meter of the first calibrated zone which
+// contains the given point of a frame of the given size, zero if none does
+func (d *Detector) scaleAt(p image.Point, frame image.Point) float64 {
+	bounds := d.zoneBounds(frame)
+	for i, z := range d.zones {
+		if z.PixelsPerMeter <= 0 {
+			continue
+		}
+		if p.In(bounds[i]) {
+			return z.PixelsPerMeter
+		}
+	}
+	return 0
+}
+
+// filterSmallObjects returns the regions of objects which aren't known to be
+// shorter than the minimum object height
+func (d *Detector) filterSmallObjects(regions []region) []region {
+	frame := d.backend.frameSize()
+	kept := []region{}
+	for _, r := range regions {
+		feet := image.Pt((r.bounds.Min.X+r.bounds.Max.X)/2, r.bounds.Max.Y-1)
+		scale := d.scaleAt(feet, frame)
+		if scale > 0 && float64(r.bounds.Dy())/scale < d.minObjectHeight {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
@@ -0,0 +1,97 @@
+package detector
+
+import (
+	"time"
+)
+
+// occupancyStableFrames is the number of consecutive frames the number of
+// objects in a zone must stay the same for before its occupancy changes,
+// tracks briefly split and merge as objects cross each other
+const occupancyStableFrames = 5
+
+// OccupancyChange is a change of the number of objects in a zone
+type OccupancyChange struct {
+	Zone      string    `json:"zone"`
+	Occupancy int       `json:"occupancy"`
+	Previous  int       `json:"previous"`
+	Time      time.Time `json:"time"`
+}
+
+// zoneOccupancy is the occupancy of a zone, and the number of objects
+// counted in it on the last frames while that differs
+type zoneOccupancy struct {
+	occupancy int
+	candidate int
+	frames    int
+}
+
+// WithOccupancyHandler sets a function to be called whenever the number of
+// distinct objects in a zone changes, e.g. to turn the lights of a meeting
+// room off once it is empty
+func WithOccupancyHandler(onOccupancy func(OccupancyChange)) Option {
+	return func(d *Detector) {
+		d.onOccupancy = onOccupancy
+	}
+}
+
+// Occupancy returns the number of distinct objects currently in each zone
+func (d *Detector) Occupancy() map[string]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.occupancyLocked()
+}
+
+// occupancyLocked returns the occupancy of every zone, the detector's lock
+// must be held
+func (d *Detector) occupancyLocked() map[string]int {
+	occupancy := make(map[string]int, len(d.zones))
+	for _, z := range d.zones {
+		occupancy[z.Name] = 0
+		if o, ok := d.occupancy[z.Name]; ok {
+			occupancy[z.Name] = o.occupancy
+		}
+	}
+	return occupancy
+}
+
+// updateOccupancy counts the tracked objects in each zone, changes which
+// last for long enough are handed to the occupancy handler once the
+// detector's lock is released. Objects which went undetected for a few
+// frames, e.g. while sitting still, still count
+func (d *Detector) updateOccupancy(now time.Time) {
+	if len(d.zones) == 0 {
+		return
+	}
+	if d.occupancy == nil {
+		d.occupancy = map[string]*zoneOccupancy{}
+	}
+	counts := map[string]int{}
+	for _, t := range d.tracks {
+		if t.Zone != "" {
+			counts[t.Zone]++
+		}
+	}
+	for _, z := range d.zones {
+		o := d.occupancy[z.Name]
+		if o == nil {
+			o = &zoneOccupancy{}
+			d.occupancy[z.Name] = o
+		}
+		n := counts[z.Name]
+		if n == o.occupancy {
+			o.frames = 0
+			continue
+		}
+		if n != o.candidate {
+			o.candidate, o.frames = n, 0
+		}
+		if o.frames++; o.frames < occupancyStableFrames {
+			continue
+		}
+		change := OccupancyChange{Zone: z.Name, Occupancy: n, Previous: o.occupancy, Time: now}
+		o.occupancy, o.frames = n, 0
+		if d.onOccupancy != nil {
+			d.pending = append(d.pending, func() { d.onOccupancy(change) })
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package detector
+
+const (
+	// DefaultEventGap is the default number of consecutive frames without
+	// motion after which an ongoing event ends
+	DefaultEventGap = 15
+
+	// DefaultThreshold is the default minimum difference between a pixel
+	// and the background model for the pixel to be considered in motion
+	DefaultThreshold = 25
+)
+
+// Option configures optional behaviour of a Detector
+type Option func(*Detector)
+
+// WithSensitivity sets the minimum diff contour area for motion to be
+// detected, e.g. NotSensitive, DefaultSensitive or VerySensitive
+func WithSensitivity(minDiffContourArea float64) Option {
+	return func(d *Detector) {
+		d.minDiffContourArea = minDiffContourArea
+	}
+}
+
+// WithThreshold sets the minimum difference between a pixel and the
+// background model for the pixel to be considered in motion, higher values
+// ignore more noise, e.g. grainy night footage
+func WithThreshold(threshold float64) Option {
+	return func(d *Detector) {
+		d.threshold = threshold
+	}
+}
+
+// WithEventHandler sets a function to be called with every Event once it
+// has ended. It runs on the detection goroutine so it should return quickly
+func WithEventHandler(onEvent func(Event)) Option {
+	return func(d *Detector) {
+		d.onEvent = onEvent
+	}
+}
+
+// WithErrorHandler sets a function to be called with every *Error which
+// occurs in the detector, e.g. when reading a frame or encoding a snapshot
+// fails. Without one errors are written to the default logger
+func WithErrorHandler(onError func(error)) Option {
+	return func(d *Detector) {
+		d.onError = onError
+	}
+}
+
+// WithEventGap sets the number of consecutive frames without motion after
+// which an ongoing event ends
+func WithEventGap(frames int) Option {
+	return func(d *Detector) {
+		d.eventGap = frames
+	}
+}
+
+// WithSlowSubjects keeps subjects which move slowly or rest, e.g. grazing
+// animals, in the foreground for longer rather than learning them into the
+// background, so that their events don't end while they are still there. The
+// pure Go backend learns the foreground 5 times slower, OpenCV's subtractor
+// already learns from a long history of frames
+func WithSlowSubjects() Option {
+	return func(d *Detector) {
+		d.slowSubjects = true
+	}
+}
+
+// WithoutWindow disables the window in which annotated frames are shown,
+// the detector then only stops when its camera or source does
+func WithoutWindow() Option {
+	return func(d *Detector) {
+		d.noWindow = true
+	}
+}
+
+// WithFrameHook sets a function to be called with every frame once it has
+// been annotated, before it is shown or encoded, e.g. for snapshots, to draw
+// overlays of its own such as a logo or sensor readings. It runs on the
+// detection goroutine while the detector is locked, so it must return
+// quickly and not call the detector
+func WithFrameHook(h FrameHook) Option {
+	return func(d *Detector) {
+		d.frameHook = h
+	}
+}
+
+// WithPreprocessHook sets a function to be called with every frame before
+// motion is detected on it, e.g. to apply a mask, a color space transform or
+// a denoiser of its own. It is called with a copy of the frame, once privacy
+// zones are hidden, which motion is detected on while the original is shown
+// and encoded. It must leave the frame's size as it is, and, like the frame
+// hook, return quickly and not call the detector
+func WithPreprocessHook(h FrameHook) Option {
+	return func(d *Detector) {
+		d.preprocessHook = h
+	}
+}
@@ -0,0 +1,315 @@
+package detector
+
+import (
+	"image"
+	"math"
+	"time"
+)
+
+const (
+	// DefaultPackageSettle is the default time the zone of a package rule
+	// must be quiet for before it is looked at for packages
+	DefaultPackageSettle = 10 * time.Second
+
+	// DefaultPackageMinSize and DefaultPackageMaxSize are the default
+	// smallest and largest fractions of the zone a package covers
+	DefaultPackageMinSize = 0.01
+	DefaultPackageMaxSize = 0.5
+
+	// packageGridWidth is the width, in cells, of the grid the zone is
+	// looked at with, each cell is a pixel of a thumbnail of the zone
+	packageGridWidth = 48
+
+	// packageDiff is the smallest change of a cell's brightness, out of 255,
+	// once the change of the whole zone's is taken out, which counts as an
+	// object
+	packageDiff = 32
+
+	// packageSettleFrames is the least number of frames, besides the
+	// settle time, no object must move in the zone for, objects are only
+	// seen to move once they moved by a fraction of their size
+	packageSettleFrames = 5
+
+	// packageGone is the fraction of the cells of a package which must still
+	// differ from the empty doorstep for the package to still be there
+	packageGone = 0.3
+)
+
+// PackageEventType is the type of a PackageEvent
+type PackageEventType string
+
+// package event types
+const (
+	PackageDelivered PackageEventType = "package_delivered"
+	PackageTaken     PackageEventType = "package_taken"
+)
+
+// PackageRule detects packages left at, and taken from, a door
+type PackageRule struct {
+	// Zone is the name of the zone, e.g. the doorstep, empty for the whole
+	// frame
+	Zone string
+	// Settle is how long the zone must be quiet, without motion, for it to
+	// be looked at, DefaultPackageSettle when 0. Packages must stay that
+	// long, so that people standing at the door aren't taken for packages
+	Settle time.Duration
+	// MinSize and MaxSize are the smallest and largest fractions of the
+	// zone a package covers, DefaultPackageMinSize and
+	// DefaultPackageMaxSize when 0. Larger changes, e.g. of the lighting,
+	// are learned as the new empty zone
+	MinSize, MaxSize float64
+	Severity         Severity
+}
+
+// PackageEvent is a package which was delivered to, or taken from, a zone
+type PackageEvent struct {
+	Type PackageEventType `json:"type"`
+	Zone string           `json:"zone,omitempty"`
+	// Bounds is where the package is, or was, in the frame
+	Bounds image.Rectangle `json:"bounds"`
+	// Delivered is when the package was delivered, and Time when the event
+	// was detected, the same for delivered packages
+	Delivered time.Time `json:"delivered"`
+	Time      time.Time `json:"time"`
+	Severity  Severity  `json:"severity"`
+}
+
+// packageWatcher looks for the packages of a rule
+type packageWatcher struct {
+	rule      PackageRule
+	onPackage func(PackageEvent)
+	// empty is the brightness of each cell of the zone without packages,
+	// of a grid of the given size
+	empty    []float64
+	size     image.Point
+	packages []*deliveredPackage
+	// lastMotion is when an object last moved in the zone, and quietFrames
+	// the number of frames since
+	lastMotion  time.Time
+	quietFrames int
+	lastCheck   time.Time
+}
+
+// deliveredPackage is a package which is still there
+type deliveredPackage struct {
+	cells     []int
+	bounds    image.Rectangle
+	delivered time.Time
+}
+
+// WithPackageDetection calls onPackage when a new still object appears in
+// the rule's zone and stays there, a package was left, and when it is gone,
+// the package was taken. The zone is compared with how it looked when empty
+// once no object moved in it for the rule's Settle, so that packages are
+// found whether or not the background learned them. Packages aren't alerted
+// on while the detector is disarmed
+func WithPackageDetection(rule PackageRule, onPackage func(PackageEvent)) Option {
+	return func(d *Detector) {
+		if rule.Settle == 0 {
+			rule.Settle = DefaultPackageSettle
+		}
+		if rule.MinSize == 0 {
+			rule.MinSize = DefaultPackageMinSize
+		}
+		if rule.MaxSize == 0 {
+			rule.MaxSize = DefaultPackageMaxSize
+		}
+		d.packageWatchers = append(d.packageWatchers, &packageWatcher{rule: rule, onPackage: onPackage})
+	}
+}
+
+// updatePackages looks for packages once the objects tracked in the zones
+// settled, events are handed to their handlers once the detector's lock is
+// released. The caller must hold the detector's lock
+func (d *Detector) updatePackages(now time.Time) {
+	if len(d.packageWatchers) == 0 {
+		return
+	}
+	frame := d.backend.frameSize()
+	for _, w := range d.packageWatchers {
+		crop, size, err := d.snapshotFraming(frame, SnapshotOptions{Zone: w.rule.Zone, Width: packageGridWidth})
+		if err != nil {
+			continue
+		}
+		// objects which stopped in the zone, e.g. packages, stay in the
+		// foreground until the background learns them
+		w.quietFrames++
+		for _, t := range d.tracks {
+			if t.Bounds.Overlaps(crop) && t.StillSince.After(w.lastMotion) {
+				w.lastMotion, w.quietFrames = t.StillSince, 0
+			}
+		}
+		if w.lastMotion.IsZero() {
+			w.lastMotion = now
+		}
+		if w.quietFrames < packageSettleFrames || now.Sub(w.lastMotion) < w.rule.Settle || now.Sub(w.lastCheck) < w.rule.Settle {
+			continue
+		}
+		w.lastCheck = now
+		jpg, err := d.encodeSnapshot(nil, crop, size)
+		if err != nil {
+			d.reportError(OpEncode, err)
+			continue
+		}
+		cells, err := grayCells(jpg)
+		if err != nil {
+			continue
+		}
+		for _, e := range w.update(cells, size, crop, now) {
+			e.Zone, e.Severity = w.rule.Zone, w.rule.Severity
+			if d.disarmed {
+				continue
+			}
+			onPackage, e := w.onPackage, e
+			d.pending = append(d.pending, func() { onPackage(e) })
+		}
+	}
+}
+
+// update compares the cells of the zone with those of the empty zone, it
+// returns the packages which were taken and delivered
+func (w *packageWatcher) update(cells []float64, size image.Point, crop image.Rectangle, now time.Time) []PackageEvent {
+	if w.empty == nil || w.size != size {
+		w.empty, w.size, w.packages = cells, size, nil
+		return nil
+	}
+	// the brightness of the whole zone changes with the light, only the
+	// cells which changed more than the rest of the zone are objects
+	covered := make([]bool, len(cells))
+	for _, p := range w.packages {
+		for _, i := range p.cells {
+			covered[i] = true
+		}
+	}
+	shift, n := 0.0, 0
+	for i := range cells {
+		if !covered[i] {
+			shift += cells[i] - w.empty[i]
+			n++
+		}
+	}
+	if n > 0 {
+		shift /= float64(n)
+	}
+	changed := make([]bool, len(cells))
+	nchanged := 0
+	for i := range cells {
+		if math.Abs(cells[i]-w.empty[i]-shift) > packageDiff {
+			changed[i] = true
+			nchanged++
+		}
+	}
+	total := float64(len(cells))
+	if float64(nchanged)/total > w.rule.MaxSize {
+		// the whole scene changed, e.g. the camera moved, the packages
+		// can't be told apart from it anymore
+		w.empty, w.packages = cells, nil
+		return nil
+	}
+	events := []PackageEvent{}
+	kept := w.packages[:0]
+	for _, p := range w.packages {
+		still := 0
+		for _, i := range p.cells {
+			if changed[i] {
+				still++
+			}
+		}
+		if float64(still) >= packageGone*float64(len(p.cells)) {
+			kept = append(kept, p)
+			continue
+		}
+		events = append(events, PackageEvent{Type: PackageTaken, Bounds: p.bounds, Delivered: p.delivered, Time: now})
+		for _, i := range p.cells {
+			covered[i] = false
+		}
+	}
+	w.packages = kept
+	for _, component := range components(changed, size) {
+		if float64(len(component)) < w.rule.MinSize*total {
+			continue
+		}
+		known := false
+		for _, i := range component {
+			if covered[i] {
+				known = true
+				break
+			}
+		}
+		if known {
+			continue
+		}
+		p := &deliveredPackage{cells: component, bounds: packageBounds(component, size, crop), delivered: now}
+		for _, i := range component {
+			covered[i] = true
+		}
+		w.packages = append(w.packages, p)
+		events = append(events, PackageEvent{Type: PackageDelivered, Bounds: p.bounds, Delivered: now, Time: now})
+	}
+	// the empty zone follows the light where there are no packages
+	for i := range cells {
+		if !covered[i] {
+			w.empty[i] = cells[i]
+		}
+	}
+	return events
+}
+
+// components returns the cells of each 4-connected component of the set
+// cells of a grid of the given size
+func components(set []bool, size image.Point) [][]int {
+	seen := make([]bool, len(set))
+	found := [][]int{}
+	for start := range set {
+		if !set[start] || seen[start] {
+			continue
+		}
+		seen[start] = true
+		component := []int{start}
+		for next := 0; next < len(component); next++ {
+			i := component[next]
+			x, y := i%size.X, i/size.X
+			for _, n := range [4][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if n[0] < 0 || n[1] < 0 || n[0] >= size.X || n[1] >= size.Y {
+					continue
+				}
+				if j := n[1]*size.X + n[0]; set[j] && !seen[j] {
+					seen[j] = true
+					component = append(component, j)
+				}
+			}
+		}
+		found = append(found, component)
+	}
+	return found
+}
+
+// packageBounds returns the bounds in the frame of cells of a grid of the
+// given size laid over the crop
+func packageBounds(cells []int, size image.Point, crop image.Rectangle) image.Rectangle {
+	grid := image.Rectangle{}
+	for _, i := range cells {
+		grid = grid.Union(image.Rect(i%size.X, i/size.X, i%size.X+1, i/size.X+1))
+	}
+	return image.Rect(
+		crop.Min.X+grid.Min.X*crop.Dx()/size.X, crop.Min.Y+grid.Min.Y*crop.Dy()/size.Y,
+		crop.Min.X+grid.Max.X*crop.Dx()/size.X, crop.Min.Y+grid.Max.Y*crop.Dy()/size.Y,
+	)
+}
+
+// grayCells returns the brightness of each pixel of a jpg encoded image, row
+// by row
+func grayCells(jpg []byte) ([]float64, error) {
+	g, err := decodeGray(jpg)
+	if err != nil {
+		return nil, err
+	}
+	b := g.Rect
+	cells := make([]float64, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			cells = append(cells, float64(g.GrayAt(x, y).Y))
+		}
+	}
+	return cells, nil
+}
@@ -0,0 +1,191 @@
+package detector
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// DefaultPiCameraWidth and DefaultPiCameraHeight are the default size
+	// of the frames of a PiCameraSource
+	DefaultPiCameraWidth  = 1280
+	DefaultPiCameraHeight = 720
+
+	// DefaultPiCameraFPS is the default frame rate of a PiCameraSource
+	DefaultPiCameraFPS = 15
+
+	// piCameraStderrTail is how much of the camera app's output is kept to
+	// describe why it stopped
+	piCameraStderrTail = 4096
+)
+
+// PiCameraOptions configure a PiCameraSource, zero values use the defaults
+type PiCameraOptions struct {
+	// Command is the libcamera video app, rpicam-vid, or libcamera-vid on
+	// Raspberry Pi OS releases before Bookworm, whichever is installed when
+	// empty
+	Command string
+	// Camera is the index of the CSI camera, for boards with more than one
+	Camera        int
+	Width, Height int
+	FPS           float64
+	// Quality is the jpg quality of the frames, out of 100, the app's
+	// default when 0
+	Quality int
+	// Args are passed to the app, e.g. --hflip, --vflip or --awb indoor
+	Args []string
+}
+
+// PiCameraSource is a Source of the Raspberry Pi's CSI camera, read through
+// libcamera by running its video app with MJPEG output, since OpenCV's V4L2
+// capture doesn't work with the camera stack of recent Raspberry Pi OS
+// releases. It is a SuspendableSource, the app is stopped while suspended
+type PiCameraSource struct {
+	*MJPEGSource
+	command string
+	args    []string
+	cmd     *exec.Cmd
+	stdout  io.ReadCloser
+	stderr  *tailBuffer
+	once    *sync.Once
+	waited  error
+	closed  int32
+}
+
+// NewPiCameraSource is the constructor for a PiCameraSource, it starts the
+// camera app
+func NewPiCameraSource(opts PiCameraOptions) (*PiCameraSource, error) {
+	command := opts.Command
+	if command == "" {
+		command = "rpicam-vid"
+		if _, err := exec.LookPath(command); err != nil {
+			command = "libcamera-vid"
+		}
+	}
+	if opts.Width <= 0 || opts.Height <= 0 {
+		opts.Width, opts.Height = DefaultPiCameraWidth, DefaultPiCameraHeight
+	}
+	if opts.FPS <= 0 {
+		opts.FPS = DefaultPiCameraFPS
+	}
+	args := []string{
+		// run until stopped, without a preview window or per frame logs
+		"--timeout", "0",
+		"--nopreview",
+		"--verbose", "0",
+		"--camera", strconv.Itoa(opts.Camera),
+		"--codec", "mjpeg",
+		"--width", strconv.Itoa(opts.Width),
+		"--height", strconv.Itoa(opts.Height),
+		"--framerate", strconv.FormatFloat(opts.FPS, 'f', -1, 64),
+		"--flush",
+	}
+	if opts.Quality > 0 {
+		args = append(args, "--quality", strconv.Itoa(opts.Quality))
+	}
+	args = append(append(args, opts.Args...), "--output", "-")
+	s := &PiCameraSource{command: command, args: args}
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// start starts the camera app
+func (s *PiCameraSource) start() error {
+	cmd := exec.Command(s.command, s.args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr := &tailBuffer{max: piCameraStderrTail}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start %s: %w", s.command, err)
+	}
+	s.MJPEGSource, s.cmd, s.stdout, s.stderr = NewMJPEGSource(stdout), cmd, stdout, stderr
+	s.once, s.waited = &sync.Once{}, nil
+	return nil
+}
+
+// Read decodes the next frame of the camera, once the camera app stops the
+// error describes why
+func (s *PiCameraSource) Read() (image.Image, error) {
+	img, err := s.MJPEGSource.Read()
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if atomic.LoadInt32(&s.closed) == 1 {
+			return nil, io.EOF
+		}
+		if werr := s.wait(); werr != nil {
+			return nil, werr
+		}
+	}
+	return img, err
+}
+
+// Close stops the camera app
+func (s *PiCameraSource) Close() error {
+	atomic.StoreInt32(&s.closed, 1)
+	s.stop()
+	return nil
+}
+
+// Suspend implements SuspendableSource, it stops the camera app, which
+// powers the camera down
+func (s *PiCameraSource) Suspend() error {
+	s.stop()
+	return nil
+}
+
+// Resume implements SuspendableSource, it starts the camera app again
+func (s *PiCameraSource) Resume() error {
+	return s.start()
+}
+
+// stop stops the camera app
+func (s *PiCameraSource) stop() {
+	s.cmd.Process.Kill()
+	s.stdout.Close()
+	s.wait()
+}
+
+// wait waits for the camera app to exit, returning why it failed
+func (s *PiCameraSource) wait() error {
+	s.once.Do(func() {
+		if err := s.cmd.Wait(); err != nil {
+			s.waited = fmt.Errorf("%s stopped: %w: %s", s.cmd.Path, err, strings.TrimSpace(s.stderr.String()))
+		}
+	})
+	return s.waited
+}
+
+// tailBuffer keeps the last bytes written to it
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+// Write implements io.Writer
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = append([]byte{}, t.buf[len(t.buf)-t.max:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the bytes kept
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
@@ -0,0 +1,133 @@
+package detector
+
+import (
+	"image"
+	"sort"
+)
+
+const (
+	// DefaultPlateBurst is the default number of plate crops captured
+	// per event
+	DefaultPlateBurst = 5
+
+	// OpPlateRead is the operation of reading license plates from the
+	// plate crops of an event
+	OpPlateRead = "plate read"
+)
+
+// PlateReader reads license plate text candidates from a jpg encoded crop
+// around a vehicle's plate, e.g. with an OCR engine
+type PlateReader func(jpg []byte) ([]PlateCandidate, error)
+
+// PlateCandidate is a possible reading of a license plate
+type PlateCandidate struct {
+	Text string `json:"text"`
+	// Confidence is the reader's confidence in the reading, from 0 to 1
+	Confidence float64 `json:"confidence"`
+	// Frame is the sequence number of the frame the plate was read on
+	Frame int `json:"frame"`
+}
+
+// PlateCrop is a full resolution crop of a frame around a vehicle's plate
+type PlateCrop struct {
+	Frame  int             `json:"frame"`
+	Bounds image.Rectangle `json:"bounds"`
+	JPG    []byte          `json:"-"`
+}
+
+// PlateCapture configures the license plate capture mode
+type PlateCapture struct {
+	// MinVehicleArea is the smallest contour area of motion considered to
+	// be a vehicle, zero considers all motion
+	MinVehicleArea float64 `json:"min_vehicle_area,omitempty"`
+	// Burst is the number of crops captured per event, on consecutive
+	// frames with a vehicle. Zero uses DefaultPlateBurst
+	Burst int `json:"burst,omitempty"`
+	// Reader reads the plates from the crops once the event ends, before
+	// the event handler is called. It runs on the detection goroutine, so a
+	// slow reader delays detection. Without one only the crops are captured
+	Reader PlateReader `json:"-"`
+}
+
+// WithPlateCapture enables the license plate capture mode, meant for
+// driveway cameras: while an event is ongoing, crops around the plate region
+// of the largest vehicle are captured at full resolution and attached to the
+// event, along with the plate text candidates read from them
+func WithPlateCapture(c PlateCapture) Option {
+	return func(d *Detector) {
+		if c.Burst <= 0 {
+			c.Burst = DefaultPlateBurst
+		}
+		d.plateCapture = &c
+	}
+}
+
+// plateRegion returns where the plate of a vehicle with the given bounds is
+// expected to be, plates are mounted in the lower middle of the front and
+// rear of vehicles
+func plateRegion(vehicle image.Rectangle) image.Rectangle {
+	w, h := vehicle.Dx(), vehicle.Dy()
+	return image.Rect(
+		vehicle.Min.X+w/5, vehicle.Min.Y+h/2,
+		vehicle.Max.X-w/5, vehicle.Max.Y,
+	)
+}
+
+// capturePlate captures a crop around the plate of the largest vehicle among
+// the regions, until the burst is complete. It must be called before regions
+// are drawn on the current frame
+func (d *Detector) capturePlate(regions []region) {
+	c := d.plateCapture
+	if len(d.plateCrops) >= c.Burst {
+		return
+	}
+	var vehicle *region
+	for i, r := range regions {
+		if r.area >= c.MinVehicleArea && (vehicle == nil || r.area > vehicle.area) {
+			vehicle = &regions[i]
+		}
+	}
+	if vehicle == nil {
+		return
+	}
+	crop := plateRegion(vehicle.bounds).Intersect(image.Rectangle{Max: d.backend.frameSize()})
+	if crop.Empty() {
+		return
+	}
+	// a crop which fails to encode is retried on the next frame
+	jpg, err := d.encodeSnapshot(nil, crop, crop.Size())
+	if err != nil {
+		return
+	}
+	d.plateCrops = append(d.plateCrops, PlateCrop{Frame: d.frame, Bounds: crop, JPG: jpg})
+}
+
+// readPlates reads the plates from the crops of an event which ended, only
+// the most confident reading of each text is kept, most confident first
+func (d *Detector) readPlates(e *Event) {
+	if d.plateCapture == nil || d.plateCapture.Reader == nil {
+		return
+	}
+	best := map[string]int{}
+	for _, crop := range e.PlateCrops {
+		var candidates []PlateCandidate
+		var err error
+		d.safeCall(func() { candidates, err = d.plateCapture.Reader(crop.JPG) })
+		if err != nil {
+			d.reportError(OpPlateRead, err)
+			continue
+		}
+		for _, c := range candidates {
+			c.Frame = crop.Frame
+			if i, ok := best[c.Text]; !ok {
+				best[c.Text] = len(e.Plates)
+				e.Plates = append(e.Plates, c)
+			} else if c.Confidence > e.Plates[i].Confidence {
+				e.Plates[i] = c
+			}
+		}
+	}
+	sort.SliceStable(e.Plates, func(i, j int) bool {
+		return e.Plates[i].Confidence > e.Plates[j].Confidence
+	})
+}
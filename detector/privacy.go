@@ -0,0 +1,42 @@
+package detector
+
+import (
+	"image"
+)
+
+// PrivacyMode is the way privacy zones are hidden in frames
+type PrivacyMode int
+
+const (
+	// PrivacyBlackout fills privacy zones with black
+	PrivacyBlackout PrivacyMode = iota
+
+	// PrivacyPixelate pixelates privacy zones
+	PrivacyPixelate
+)
+
+// pixelateBlockSize is the size in pixels of the blocks privacy zones are
+// pixelated into
+const pixelateBlockSize = 16
+
+// WithPrivacyZones hides the given zones in every frame, as shown in the
+// window, in snapshots and in anything else built from frames, and excludes
+// them from detection. Useful for cameras overlooking a neighbor's property
+func WithPrivacyZones(mode PrivacyMode, zones ...Zone) Option {
+	return func(d *Detector) {
+		d.privacyMode = mode
+		d.privacyZones = append(d.privacyZones, zones...)
+	}
+}
+
+// privacyRects returns the bounds of the privacy zones within a frame of
+// the given size, mapped through the de-warp if frames are de-warped
+func privacyRects(zones []Zone, frame image.Point, f *Fisheye) []image.Rectangle {
+	rects := []image.Rectangle{}
+	for _, z := range zones {
+		if r := zoneRect(z.Bounds, frame, f); !r.Empty() {
+			rects = append(rects, r)
+		}
+	}
+	return rects
+}
@@ -0,0 +1,31 @@
+package detector
+
+// Profile is a named set of detection settings which can be switched between
+// while the detector is running, e.g. day and night profiles
+type Profile struct {
+	Name string `json:"name"`
+	// Sensitivity is the minimum diff contour area, see WithSensitivity
+	Sensitivity float64 `json:"sensitivity"`
+	// Threshold is the minimum pixel difference, see WithThreshold
+	Threshold float64 `json:"threshold"`
+	// NightMode is the way frames are processed in low light, see
+	// WithNightMode
+	NightMode NightMode `json:"night_mode"`
+}
+
+// ApplyProfile switches the detector to the settings of a profile
+func (d *Detector) ApplyProfile(p Profile) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.profile = p.Name
+	d.minDiffContourArea = p.Sensitivity
+	d.threshold = p.Threshold
+	d.nightMode = p.NightMode
+}
+
+// Profile returns the name of the profile last applied, empty if none was
+func (d *Detector) Profile() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.profile
+}
@@ -0,0 +1,103 @@
+package detector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adrianosela/GoAway/v4l2"
+)
+
+// DefaultReconnectInterval is the default interval a disconnected camera is
+// looked for at, see WithReconnect
+const DefaultReconnectInterval = 2 * time.Second
+
+// WithReconnect makes a detector reading from a camera recover when the
+// camera disappears, e.g. when its USB cable is unplugged, instead of Start
+// returning the read error. The camera is looked for at every interval, until
+// the detector is closed, and reopened once found. On Linux it is found by
+// its serial number or name, even if it was plugged back in with another
+// index, elsewhere it is reopened by its index. The disconnection is reported
+// to the error handler and the status is DetectorStatusReconnecting
+// meanwhile. Zero uses DefaultReconnectInterval
+func WithReconnect(interval time.Duration) Option {
+	return func(d *Detector) {
+		if interval <= 0 {
+			interval = DefaultReconnectInterval
+		}
+		d.reconnectInterval = interval
+	}
+}
+
+// cameraDevice is the camera a detector reads from
+type cameraDevice struct {
+	id int
+	// info describes the device, if known, to find it again once it was
+	// plugged back in
+	info  v4l2.DeviceInfo
+	known bool
+}
+
+// newCameraDevice returns the camera device of an OpenCV camera ID,
+// described if possible
+func newCameraDevice(id int) *cameraDevice {
+	c := &cameraDevice{id: id}
+	if info, err := v4l2.Describe(v4l2.DevicePath(id)); err == nil {
+		c.info, c.known = info, true
+	}
+	return c
+}
+
+// locate returns the camera ID the device currently has, false if it is
+// known and isn't connected
+func (c *cameraDevice) locate() (int, bool) {
+	if !c.known {
+		return c.id, true
+	}
+	devices, err := v4l2.Devices()
+	if err != nil {
+		return c.id, true
+	}
+	info, ok := v4l2.Find(devices, c.info)
+	return info.Index, ok
+}
+
+// reconnect waits for the camera to be connected again after reading from
+// it failed and reopens it. It returns the read error if the detector
+// doesn't reconnect, or is closed while reconnecting
+func (d *Detector) reconnect(readErr error) error {
+	d.mu.Lock()
+	if d.reconnectInterval == 0 || d.camera == nil || d.status == DetectorStatusClosed {
+		d.mu.Unlock()
+		return readErr
+	}
+	d.status, d.statusColor = DetectorStatusReconnecting, statusReadyColor
+	d.mu.Unlock()
+	d.reportError(OpRead, fmt.Errorf("camera disconnected, reconnecting: %w", readErr))
+	for {
+		time.Sleep(d.reconnectInterval)
+		d.mu.Lock()
+		if d.status == DetectorStatusClosed {
+			d.mu.Unlock()
+			return readErr
+		}
+		if id, ok := d.camera.locate(); ok && d.reopenCamera(id) == nil {
+			d.camera.id = id
+			d.status = DetectorStatusReady
+			d.mu.Unlock()
+			return nil
+		}
+		d.mu.Unlock()
+	}
+}
+
+// reopenCamera reopens the camera with the given ID and sets its controls
+// again, the caller must hold the detector's lock
+func (d *Detector) reopenCamera(id int) error {
+	if err := d.backend.reopenCamera(id); err != nil {
+		return err
+	}
+	if err := d.applyCameraControls(d.backend.setControl); err != nil {
+		return err
+	}
+	return d.applyV4L2Controls(v4l2.DevicePath(id))
+}
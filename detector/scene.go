@@ -0,0 +1,518 @@
+package detector
+
+import (
+	"errors"
+	"image"
+	"math"
+	"time"
+)
+
+const (
+	// DefaultSceneSimilarity is the default similarity to the reference
+	// below which the scene changed, see WithSceneChangeDetection
+	DefaultSceneSimilarity = 0.7
+
+	// DefaultSceneEvery is the default interval frames are sampled into
+	// the long-term background at
+	DefaultSceneEvery = 10 * time.Second
+
+	// sceneWidth is the width of the long-term background, frames are scaled
+	// down to it
+	sceneWidth = 64
+
+	// sceneLearningRate is the weight of each sample in the long-term
+	// background, passing objects and shadows are averaged out
+	sceneLearningRate = 0.05
+
+	// sceneMaxShift is the largest fraction of the frame's size the view can
+	// shift by for zones to be remapped, and sceneMaxSkew the largest
+	// rotation, scaling or shearing of the view
+	sceneMaxShift = 0.125
+	sceneMaxSkew  = 0.15
+
+	// sceneAlignIterations is the most iterations the alignment of the
+	// view with the reference is refined in
+	sceneAlignIterations = 20
+)
+
+// ErrStaleSceneShift is returned when applying a scene shift estimated for
+// other zones or counting lines than the detector's
+var ErrStaleSceneShift = errors.New("the zones or counting lines changed since the scene shift was estimated")
+
+// SceneChangeDetection is the configuration of the scene change detection,
+// see WithSceneChangeDetection
+type SceneChangeDetection struct {
+	// MinSimilarity is the similarity, from -1 to 1, between the long-term
+	// background and the reference below which the scene changed,
+	// DefaultSceneSimilarity when 0
+	MinSimilarity float64 `json:"min_similarity,omitempty"`
+	// Every is the interval frames are sampled into the long-term
+	// background at, DefaultSceneEvery when 0
+	Every time.Duration `json:"every,omitempty"`
+	// Reference is the stored reference, see Detector.SceneReference, the
+	// first frame is the reference when nil
+	Reference *SceneReference `json:"reference,omitempty"`
+}
+
+// SceneReference is how the scene looked when the camera was set up, a
+// scaled down frame, which can be stored to survive restarts
+type SceneReference struct {
+	Size image.Point `json:"size"`
+	// Pixels are the brightness of the pixels, row by row
+	Pixels []uint8   `json:"pixels"`
+	Taken  time.Time `json:"taken"`
+}
+
+// SceneChange is raised when the long-term background no longer looks like
+// the reference, e.g. the camera was bumped or re-aimed
+type SceneChange struct {
+	// Similarity is that of the long-term background to the reference,
+	// from -1 to 1
+	Similarity float64 `json:"similarity"`
+	// Reference is when the reference was taken
+	Reference time.Time `json:"reference"`
+	Time      time.Time `json:"time"`
+	// Shift is how the view shifted, for small shifts, to remap the zones
+	// and counting lines with, nil when the scene changed beyond that
+	Shift *SceneShift `json:"shift,omitempty"`
+}
+
+// SceneShift is a small shift of the view from the scene change detection's
+// reference, with the detector's zones and counting lines remapped onto the
+// current view, see Detector.ApplySceneShift
+type SceneShift struct {
+	// Homography maps points of the reference onto the current view, in
+	// pixels of the frame, row by row. Small shifts of a fixed camera are
+	// close to affine, so its perspective terms are zero
+	Homography [9]float64 `json:"homography"`
+	// Similarity is that of the current view to the reference once aligned,
+	// from -1 to 1
+	Similarity float64        `json:"similarity"`
+	Zones      []Zone         `json:"zones"`
+	Lines      []CountingLine `json:"lines"`
+}
+
+// sceneMonitor keeps the long-term background and compares it with the
+// reference
+type sceneMonitor struct {
+	config    SceneChangeDetection
+	onChange  func(SceneChange)
+	reference *SceneReference
+	// background is the long-term background, of the reference's size
+	background []float64
+	// latest is the latest sample, the current view
+	latest     []float64
+	similarity float64
+	lastSample time.Time
+	// alerted is whether the monitor alerted on the current change
+	alerted bool
+}
+
+// WithSceneChangeDetection calls onChange when the camera was bumped or
+// re-aimed, since zones, counting lines and tripwires silently become wrong
+// when the view shifts. Frames are sampled into a long-term background,
+// which passing objects don't disturb, and its edges are compared with
+// those of a reference, so that changes of the light don't count. It alerts
+// once per change, and again once the scene looked like the reference in
+// between. After re-aiming the camera on purpose, ResetSceneReference makes
+// the new view the reference. When the view only shifted a little, the
+// change comes with the shift and the zones and counting lines remapped
+// onto the new view, which ApplySceneShift applies
+func WithSceneChangeDetection(s SceneChangeDetection, onChange func(SceneChange)) Option {
+	return func(d *Detector) {
+		if s.MinSimilarity == 0 {
+			s.MinSimilarity = DefaultSceneSimilarity
+		}
+		if s.Every == 0 {
+			s.Every = DefaultSceneEvery
+		}
+		d.scene = &sceneMonitor{config: s, onChange: onChange, reference: s.Reference, similarity: 1}
+	}
+}
+
+// SceneReference returns the reference of the scene change detection, e.g.
+// to store it, nil without one
+func (d *Detector) SceneReference() *SceneReference {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.scene == nil || d.scene.reference == nil {
+		return nil
+	}
+	r := *d.scene.reference
+	r.Pixels = append([]uint8{}, r.Pixels...)
+	return &r
+}
+
+// ResetSceneReference makes the current view the reference of the scene
+// change detection, e.g. after re-aiming the camera on purpose
+func (d *Detector) ResetSceneReference() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.scene != nil {
+		d.scene.resetReference(time.Now())
+	}
+}
+
+// ApplySceneShift remaps the detector's zones and counting lines onto the
+// shifted view, as offered by a SceneChange, and makes the current view the
+// reference of the scene change detection. It returns ErrStaleSceneShift
+// when the zones or counting lines changed since. Privacy zones aren't
+// remapped, hiding the wrong area on an estimate is worse than re-drawing
+// them
+func (d *Detector) ApplySceneShift(shift SceneShift) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(shift.Zones) != len(d.zones) || len(shift.Lines) != len(d.lineCounters) {
+		return ErrStaleSceneShift
+	}
+	for i, z := range shift.Zones {
+		if z.Name != d.zones[i].Name {
+			return ErrStaleSceneShift
+		}
+	}
+	for i, l := range shift.Lines {
+		if l.Name != d.lineCounters[i].line.Name {
+			return ErrStaleSceneShift
+		}
+	}
+	for i, z := range shift.Zones {
+		d.zones[i].Bounds = z.Bounds
+	}
+	for i, l := range shift.Lines {
+		d.lineCounters[i].line.A, d.lineCounters[i].line.B = l.A, l.B
+	}
+	if d.scene != nil {
+		d.scene.resetReference(time.Now())
+	}
+	return nil
+}
+
+// resetReference makes the latest sample the reference and the long-term
+// background
+func (s *sceneMonitor) resetReference(now time.Time) {
+	if s.latest == nil {
+		return
+	}
+	s.reference = &SceneReference{Size: s.reference.Size, Pixels: make([]uint8, len(s.latest)), Taken: now}
+	for i, v := range s.latest {
+		s.reference.Pixels[i] = uint8(math.Round(v))
+	}
+	s.background = append([]float64{}, s.latest...)
+	s.similarity, s.alerted = 1, false
+}
+
+// updateScene samples the current frame into the long-term background when
+// due, and compares it with the reference. Alerts are handed to the handler
+// once the detector's lock is released. It must be called before regions
+// are drawn on the current frame
+func (d *Detector) updateScene(now time.Time) {
+	s := d.scene
+	if s == nil || now.Sub(s.lastSample) < s.config.Every {
+		return
+	}
+	s.lastSample = now
+	frame := d.backend.frameSize()
+	crop, size, err := d.snapshotFraming(frame, SnapshotOptions{Width: sceneWidth})
+	if err != nil {
+		return
+	}
+	if s.reference != nil && s.reference.Size != size {
+		// the frame size changed, the reference can't be compared with
+		// frames of another aspect ratio
+		size = s.reference.Size
+	}
+	jpg, err := d.encodeSnapshot(nil, crop, size)
+	if err != nil {
+		return
+	}
+	sample, err := grayCells(jpg)
+	if err != nil || len(sample) != size.X*size.Y {
+		return
+	}
+	if s.reference == nil {
+		s.reference = &SceneReference{Size: size, Pixels: make([]uint8, len(sample)), Taken: now}
+		for i, v := range sample {
+			s.reference.Pixels[i] = uint8(v)
+		}
+	}
+	s.latest = sample
+	if s.background == nil {
+		s.background = append([]float64{}, sample...)
+	}
+	for i, v := range sample {
+		s.background[i] += sceneLearningRate * (v - s.background[i])
+	}
+	reference := make([]float64, len(s.reference.Pixels))
+	for i, v := range s.reference.Pixels {
+		reference[i] = float64(v)
+	}
+	s.similarity = correlation(edges(s.background, size), edges(reference, size))
+	if s.similarity >= s.config.MinSimilarity {
+		s.alerted = false
+		return
+	}
+	if s.alerted {
+		return
+	}
+	s.alerted = true
+	change, onChange := SceneChange{Similarity: s.similarity, Reference: s.reference.Taken, Time: now}, s.onChange
+	if d.fisheye == nil {
+		// zones are drawn on the frames before they are de-warped, which a
+		// shift of the de-warped frames doesn't map onto
+		change.Shift = d.sceneShift(reference, sample, size, frame, s.config.MinSimilarity)
+	}
+	d.pending = append(d.pending, func() { onChange(change) })
+}
+
+// edges returns the gradient magnitude of each pixel of an image of the
+// given size, row by row, zero on its border
+func edges(pixels []float64, size image.Point) []float64 {
+	g := make([]float64, len(pixels))
+	for y := 1; y < size.Y-1; y++ {
+		for x := 1; x < size.X-1; x++ {
+			i := y*size.X + x
+			g[i] = math.Abs(pixels[i+1]-pixels[i-1]) + math.Abs(pixels[i+size.X]-pixels[i-size.X])
+		}
+	}
+	return g
+}
+
+// correlation returns the correlation coefficient of two series, from -1 to
+// 1, and 1 when both are constant
+func correlation(a, b []float64) float64 {
+	n := float64(len(a))
+	if n == 0 {
+		return 1
+	}
+	meanA, meanB := 0.0, 0.0
+	for i := range a {
+		meanA += a[i] / n
+		meanB += b[i] / n
+	}
+	cov, varA, varB := 0.0, 0.0, 0.0
+	for i := range a {
+		da, db := a[i]-meanA, b[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		if varA == varB {
+			return 1
+		}
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+// sceneShift estimates how the current view, a sample of the given size of
+// a frame of the given size, shifted from the reference, and remaps the
+// zones and counting lines accordingly. It returns nil when the view
+// shifted too much or doesn't align with the reference
+func (d *Detector) sceneShift(reference, current []float64, size, frame image.Point, minSimilarity float64) *SceneShift {
+	a, similarity := align(normalize(edges(reference, size)), normalize(edges(current, size)), size)
+	maxShift := sceneMaxShift * float64(size.X)
+	if similarity < minSimilarity || math.Abs(a[2]) > maxShift || math.Abs(a[5]) > maxShift ||
+		math.Abs(a[0]-1) > sceneMaxSkew || math.Abs(a[1]) > sceneMaxSkew || math.Abs(a[3]) > sceneMaxSkew || math.Abs(a[4]-1) > sceneMaxSkew {
+		return nil
+	}
+	// the alignment maps the sample's pixels about its center, the
+	// homography maps the frame's
+	sx, sy := float64(frame.X)/float64(size.X), float64(frame.Y)/float64(size.Y)
+	cx, cy := float64(size.X)/2, float64(size.Y)/2
+	m := [4]float64{a[0], a[1] * sx / sy, a[3] * sy / sx, a[4]}
+	h := [9]float64{
+		m[0], m[1], sx*(cx+a[2]) - m[0]*sx*cx - m[1]*sy*cy,
+		m[2], m[3], sy*(cy+a[5]) - m[2]*sx*cx - m[3]*sy*cy,
+		0, 0, 1,
+	}
+	shift := &SceneShift{Homography: h, Similarity: similarity, Zones: []Zone{}, Lines: []CountingLine{}}
+	for _, z := range d.zones {
+		b := z.Bounds
+		mapped := image.Rectangle{Min: project(h, b.Min), Max: project(h, b.Min)}
+		for _, p := range []image.Point{{b.Max.X, b.Min.Y}, {b.Min.X, b.Max.Y}, b.Max} {
+			q := project(h, p)
+			if q.X < mapped.Min.X {
+				mapped.Min.X = q.X
+			}
+			if q.Y < mapped.Min.Y {
+				mapped.Min.Y = q.Y
+			}
+			if q.X > mapped.Max.X {
+				mapped.Max.X = q.X
+			}
+			if q.Y > mapped.Max.Y {
+				mapped.Max.Y = q.Y
+			}
+		}
+		z.Bounds = mapped.Intersect(image.Rectangle{Max: frame})
+		shift.Zones = append(shift.Zones, z)
+	}
+	for _, c := range d.lineCounters {
+		l := c.line
+		l.A, l.B = project(h, l.A), project(h, l.B)
+		shift.Lines = append(shift.Lines, l)
+	}
+	return shift
+}
+
+// project maps a point with a homography
+func project(h [9]float64, p image.Point) image.Point {
+	x, y := float64(p.X), float64(p.Y)
+	w := h[6]*x + h[7]*y + h[8]
+	return image.Pt(int(math.Round((h[0]*x+h[1]*y+h[2])/w)), int(math.Round((h[3]*x+h[4]*y+h[5])/w)))
+}
+
+// normalize returns a series with its mean taken out and scaled to unit
+// variance, so that series of different contrast compare
+func normalize(a []float64) []float64 {
+	mean, variance := 0.0, 0.0
+	for _, v := range a {
+		mean += v / float64(len(a))
+	}
+	for _, v := range a {
+		variance += (v - mean) * (v - mean) / float64(len(a))
+	}
+	n := make([]float64, len(a))
+	if variance == 0 {
+		return n
+	}
+	sd := math.Sqrt(variance)
+	for i, v := range a {
+		n[i] = (v - mean) / sd
+	}
+	return n
+}
+
+// align estimates the affine map a, row by row, which maps the pixels of
+// the reference, about the center, onto those of the current image, both of
+// the given size, and returns it with the correlation of the images once
+// aligned. The translation is searched for first and the map refined with
+// Gauss-Newton from there
+func align(reference, current []float64, size image.Point) ([6]float64, float64) {
+	best, bestSimilarity := [6]float64{1, 0, 0, 0, 1, 0}, -1.0
+	maxShift := int(math.Ceil(sceneMaxShift * float64(size.X)))
+	for dy := -maxShift; dy <= maxShift; dy++ {
+		for dx := -maxShift; dx <= maxShift; dx++ {
+			a := [6]float64{1, 0, float64(dx), 0, 1, float64(dy)}
+			if s := aligned(reference, current, size, a); s > bestSimilarity {
+				best, bestSimilarity = a, s
+			}
+		}
+	}
+	cx, cy := float64(size.X)/2, float64(size.Y)/2
+	a := best
+	for iteration := 0; iteration < sceneAlignIterations; iteration++ {
+		var h [6][6]float64
+		var b [6]float64
+		for y := 1; y < size.Y-1; y++ {
+			for x := 1; x < size.X-1; x++ {
+				u, v := float64(x)-cx, float64(y)-cy
+				wx, wy := a[0]*u+a[1]*v+a[2]+cx, a[3]*u+a[4]*v+a[5]+cy
+				c, gx, gy, ok := sample(current, size, wx, wy)
+				if !ok {
+					continue
+				}
+				j := [6]float64{gx * u, gx * v, gx, gy * u, gy * v, gy}
+				e := c - reference[y*size.X+x]
+				for r := range j {
+					b[r] += j[r] * e
+					for k := range j {
+						h[r][k] += j[r] * j[k]
+					}
+				}
+			}
+		}
+		step, ok := solve(h, b)
+		if !ok {
+			break
+		}
+		norm := 0.0
+		for i := range a {
+			a[i] -= step[i]
+			norm += step[i] * step[i]
+		}
+		if norm < 1e-6 {
+			break
+		}
+	}
+	if s := aligned(reference, current, size, a); s > bestSimilarity {
+		best, bestSimilarity = a, s
+	}
+	return best, bestSimilarity
+}
+
+// aligned returns the correlation of the reference with the current image,
+// both of the given size, mapped onto it with the affine map a, over the
+// pixels the current image covers, or -1 when it covers less than half
+func aligned(reference, current []float64, size image.Point, a [6]float64) float64 {
+	cx, cy := float64(size.X)/2, float64(size.Y)/2
+	r, c := []float64{}, []float64{}
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			u, v := float64(x)-cx, float64(y)-cy
+			if value, _, _, ok := sample(current, size, a[0]*u+a[1]*v+a[2]+cx, a[3]*u+a[4]*v+a[5]+cy); ok {
+				r, c = append(r, reference[y*size.X+x]), append(c, value)
+			}
+		}
+	}
+	if 2*len(r) < len(reference) {
+		return -1
+	}
+	return correlation(r, c)
+}
+
+// sample returns the bilinearly interpolated value, and gradient, of an
+// image of the given size at a point, and whether the point is inside it
+func sample(pixels []float64, size image.Point, x, y float64) (float64, float64, float64, bool) {
+	if x < 0 || y < 0 || x > float64(size.X-1) || y > float64(size.Y-1) {
+		return 0, 0, 0, false
+	}
+	x0, y0 := int(x), int(y)
+	if x0 == size.X-1 {
+		x0--
+	}
+	if y0 == size.Y-1 {
+		y0--
+	}
+	fx, fy := x-float64(x0), y-float64(y0)
+	i := y0*size.X + x0
+	p00, p10, p01, p11 := pixels[i], pixels[i+1], pixels[i+size.X], pixels[i+size.X+1]
+	top, bottom := p00+fx*(p10-p00), p01+fx*(p11-p01)
+	gx := (1-fy)*(p10-p00) + fy*(p11-p01)
+	return top + fy*(bottom-top), gx, bottom - top, true
+}
+
+// solve solves the linear system h x = b with Gaussian elimination, it
+// returns false when h is singular
+func solve(h [6][6]float64, b [6]float64) ([6]float64, bool) {
+	var x [6]float64
+	for col := 0; col < 6; col++ {
+		pivot := col
+		for row := col + 1; row < 6; row++ {
+			if math.Abs(h[row][col]) > math.Abs(h[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(h[pivot][col]) < 1e-9 {
+			return x, false
+		}
+		h[col], h[pivot] = h[pivot], h[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for row := col + 1; row < 6; row++ {
+			f := h[row][col] / h[col][col]
+			for k := col; k < 6; k++ {
+				h[row][k] -= f * h[col][k]
+			}
+			b[row] -= f * b[col]
+		}
+	}
+	for row := 5; row >= 0; row-- {
+		x[row] = b[row]
+		for k := row + 1; k < 6; k++ {
+			x[row] -= h[row][k] * x[k]
+		}
+		x[row] /= h[row][row]
+	}
+	return x, true
+}
@@ -0,0 +1,180 @@
+package detector
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"time"
+)
+
+const (
+	// DefaultMinSharpness is the default sharpness below which frames are
+	// blurry, see WithFocusMonitor
+	DefaultMinSharpness = 100.0
+
+	// DefaultFocusAfter is the default time frames must stay blurry for
+	// before the focus monitor warns
+	DefaultFocusAfter = 10 * time.Minute
+
+	// DefaultFocusEvery is the default interval the focus monitor measures
+	// the sharpness of frames at
+	DefaultFocusEvery = time.Minute
+
+	// sharpnessWidth is the width frames are scaled down to, at most, to
+	// measure their sharpness, so that it doesn't depend on the resolution
+	sharpnessWidth = 320
+
+	// focusMinBrightness is the least mean brightness, out of 255, of the
+	// frames the focus monitor measures, dark frames have no edges to see
+	focusMinBrightness = 40
+)
+
+// FocusMonitor is the configuration of the focus monitor, see
+// WithFocusMonitor
+type FocusMonitor struct {
+	// MinSharpness is the sharpness, the variance of the Laplacian of a
+	// frame (see Sharpness), below which frames are blurry,
+	// DefaultMinSharpness when 0
+	MinSharpness float64 `json:"min_sharpness,omitempty"`
+	// After is how long frames must stay blurry for to warn,
+	// DefaultFocusAfter when 0
+	After time.Duration `json:"after,omitempty"`
+	// Every is the interval frames are measured at, DefaultFocusEvery when
+	// 0
+	Every time.Duration `json:"every,omitempty"`
+}
+
+// FocusWarning is raised when a camera appears out of focus, or its lens
+// dirty, i.e. its frames stayed blurry for longer than the focus monitor's
+// After
+type FocusWarning struct {
+	// Sharpness is that of the latest frame measured
+	Sharpness float64 `json:"sharpness"`
+	// BlurrySince is when frames became blurry
+	BlurrySince time.Time `json:"blurry_since"`
+	Time        time.Time `json:"time"`
+}
+
+// focusMonitor measures the sharpness of frames and warns when they stay
+// blurry
+type focusMonitor struct {
+	config      FocusMonitor
+	onBlurry    func(FocusWarning)
+	lastCheck   time.Time
+	blurrySince time.Time
+	// alerted is whether the monitor warned of the current blurry spell
+	alerted bool
+}
+
+// WithFocusMonitor calls onBlurry when the camera appears permanently out of
+// focus or dirty: the sharpness of frames, measured every Every, stayed
+// below MinSharpness for After. It warns once per blurry spell, and again
+// once a sharp frame was measured. Dark frames, e.g. at night without an
+// illuminator, aren't measured
+func WithFocusMonitor(m FocusMonitor, onBlurry func(FocusWarning)) Option {
+	return func(d *Detector) {
+		if m.MinSharpness == 0 {
+			m.MinSharpness = DefaultMinSharpness
+		}
+		if m.After == 0 {
+			m.After = DefaultFocusAfter
+		}
+		if m.Every == 0 {
+			m.Every = DefaultFocusEvery
+		}
+		d.focus = &focusMonitor{config: m, onBlurry: onBlurry}
+	}
+}
+
+// Sharpness returns the sharpness of a jpg encoded image, e.g. a snapshot:
+// the variance of its Laplacian, which is high for sharp images and low for
+// blurry ones. Scores are only comparable between images of about the same
+// resolution and scene
+func Sharpness(jpg []byte) (float64, error) {
+	g, err := decodeGray(jpg)
+	if err != nil {
+		return 0, err
+	}
+	return laplacianVariance(g), nil
+}
+
+// updateSharpness measures the sharpness of the current frame when an event
+// starts on it, for the event, and when the focus monitor is due. Warnings
+// are handed to the handler once the detector's lock is released. It must be
+// called before regions are drawn on the current frame
+func (d *Detector) updateSharpness(regions []region, report bool, now time.Time) {
+	starting := report && len(regions) > 0 && d.event == nil
+	f := d.focus
+	due := f != nil && now.Sub(f.lastCheck) >= f.config.Every && d.backend.brightness() >= focusMinBrightness
+	if !starting && !due {
+		return
+	}
+	frame := d.backend.frameSize()
+	crop, size, err := d.snapshotFraming(frame, SnapshotOptions{Width: sharpnessWidth})
+	if err != nil {
+		return
+	}
+	jpg, err := d.encodeSnapshot(nil, crop, size)
+	if err != nil {
+		return
+	}
+	sharpness, err := Sharpness(jpg)
+	if err != nil {
+		return
+	}
+	d.sharpness = sharpness
+	if !due {
+		return
+	}
+	f.lastCheck = now
+	if sharpness >= f.config.MinSharpness {
+		f.blurrySince, f.alerted = time.Time{}, false
+		return
+	}
+	if f.blurrySince.IsZero() {
+		f.blurrySince = now
+	}
+	if f.alerted || now.Sub(f.blurrySince) < f.config.After {
+		return
+	}
+	f.alerted = true
+	warning, onBlurry := FocusWarning{Sharpness: sharpness, BlurrySince: f.blurrySince, Time: now}, f.onBlurry
+	d.pending = append(d.pending, func() { onBlurry(warning) })
+}
+
+// decodeGray decodes a jpg encoded image into its brightness
+func decodeGray(jpg []byte) (*image.Gray, error) {
+	img, err := jpeg.Decode(bytes.NewReader(jpg))
+	if err != nil {
+		return nil, err
+	}
+	if g, ok := img.(*image.Gray); ok {
+		return g, nil
+	}
+	g := image.NewGray(img.Bounds())
+	draw.Draw(g, g.Rect, img, img.Bounds().Min, draw.Src)
+	return g, nil
+}
+
+// laplacianVariance returns the variance of the Laplacian of an image, a
+// measure of its focus: sharp edges make for a high variance, while blurry,
+// out of focus or dirty lens images have a low one
+func laplacianVariance(g *image.Gray) float64 {
+	b := g.Rect
+	if b.Dx() < 3 || b.Dy() < 3 {
+		return 0
+	}
+	sum, sumSq, n := 0.0, 0.0, 0.0
+	for y := b.Min.Y + 1; y < b.Max.Y-1; y++ {
+		for x := b.Min.X + 1; x < b.Max.X-1; x++ {
+			i := g.PixOffset(x, y)
+			l := float64(g.Pix[i-1]) + float64(g.Pix[i+1]) + float64(g.Pix[i-g.Stride]) + float64(g.Pix[i+g.Stride]) - 4*float64(g.Pix[i])
+			sum += l
+			sumSq += l * l
+			n++
+		}
+	}
+	mean := sum / n
+	return sumSq/n - mean*mean
+}
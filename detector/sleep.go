@@ -0,0 +1,199 @@
+package detector
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errCameraAsleep is returned when setting or getting the controls of a
+// camera which was closed while the detector sleeps
+var errCameraAsleep = errors.New("the camera is closed while the detector is asleep")
+
+// SleepMode is the configuration of the power saving sleep of a detector,
+// see WithSleepMode
+type SleepMode struct {
+	// After is how long the detector stays awake without motion, events or
+	// sensor triggers before it goes to sleep, 0 to only sleep when told to
+	// with Sleep
+	After time.Duration `json:"after,omitempty"`
+}
+
+// SuspendableSource is a Source which can stop capturing while the detector
+// sleeps, e.g. by stopping the camera, see WithSleepMode. Other sources are
+// only no longer read
+type SuspendableSource interface {
+	Source
+	// Suspend stops capturing, Read isn't called until Resume
+	Suspend() error
+	// Resume captures again
+	Resume() error
+}
+
+// WithSleepMode lets the detector sleep, for solar or battery powered
+// cameras where continuous capture drains the battery. A sleeping detector
+// suspends its whole pipeline: cameras are closed, so that they power down,
+// SuspendableSources are suspended and other sources are no longer read.
+// It goes to sleep after no motion, events or sensor triggers for After, or
+// when Sleep is called, and is only woken up by an external signal: a
+// sensor trigger, e.g. of a PIR sensor or a webhook (see Trigger), or Wake.
+// The background is learned again once awake, and the status is
+// DetectorStatusAsleep meanwhile
+func WithSleepMode(s SleepMode) Option {
+	return func(d *Detector) {
+		d.sleep = &sleeper{config: s, wake: make(chan struct{}, 1)}
+	}
+}
+
+// sleeper puts a detector to sleep and wakes it up
+type sleeper struct {
+	config SleepMode
+	asleep bool
+	// wake is signaled to wake the detector up, or once it is closed
+	wake chan struct{}
+	// activeSince is when the detector last woke up or saw activity
+	activeSince time.Time
+}
+
+// signal signals a sleeping detector to wake up, it doesn't block
+func (s *sleeper) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Sleep puts a detector with a sleep mode to sleep once the frame being
+// processed is done, ending any ongoing event
+func (d *Detector) Sleep() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.sleep != nil {
+		d.sleep.asleep = true
+	}
+}
+
+// Wake wakes a sleeping detector up, it stays awake for the sleep mode's
+// After at least
+func (d *Detector) Wake() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.wakeLocked()
+}
+
+// wakeLocked wakes a sleeping detector up, the caller must hold the
+// detector's lock
+func (d *Detector) wakeLocked() {
+	s := d.sleep
+	if s == nil {
+		return
+	}
+	s.activeSince = time.Now()
+	if s.asleep {
+		s.asleep = false
+		s.signal()
+	}
+}
+
+// updateSleep puts the detector to sleep once it saw no activity for long
+// enough, the caller must hold the detector's lock
+func (d *Detector) updateSleep(now time.Time) {
+	s := d.sleep
+	if s == nil || s.asleep {
+		return
+	}
+	if s.activeSince.IsZero() || d.status == DetectorStatusMotionDetected || d.event != nil {
+		s.activeSince = now
+		return
+	}
+	if s.config.After > 0 && now.Sub(s.activeSince) >= s.config.After {
+		s.asleep = true
+	}
+}
+
+// doze suspends capture while the detector is asleep, until it is woken up
+// or closed, it returns whether the detector slept. Capture is resumed on
+// waking up, failing which the camera is reconnected to, see WithReconnect
+func (d *Detector) doze() (bool, error) {
+	d.mu.Lock()
+	s := d.sleep
+	if s == nil || !s.asleep || d.status == DetectorStatusClosed {
+		d.mu.Unlock()
+		return false, nil
+	}
+	d.status, d.statusColor = DetectorStatusAsleep, statusReadyColor
+	d.mu.Unlock()
+	d.stop()
+	if d.queue != nil {
+		d.queue.pause(d.backend)
+	}
+	d.mu.Lock()
+	// the detector may have been woken up or closed meanwhile
+	suspended := s.asleep && d.status != DetectorStatusClosed
+	var err error
+	if suspended {
+		err = d.backend.suspend()
+	}
+	d.mu.Unlock()
+	if err != nil {
+		d.reportError(OpRead, fmt.Errorf("could not suspend capture: %w", err))
+	}
+	for {
+		d.mu.Lock()
+		if d.status == DetectorStatusClosed {
+			d.mu.Unlock()
+			return true, errDetectorClosed
+		}
+		if !s.asleep {
+			break
+		}
+		d.mu.Unlock()
+		<-s.wake
+	}
+	if suspended {
+		err = d.resumeCapture()
+	}
+	s.activeSince = time.Now()
+	d.status = DetectorStatusReady
+	d.mu.Unlock()
+	if err != nil {
+		if err = d.reconnect(err); err != nil {
+			d.reportError(OpRead, err)
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// resumeCapture reopens the camera, wherever it is now, or resumes the
+// source, the caller must hold the detector's lock
+func (d *Detector) resumeCapture() error {
+	if d.camera == nil {
+		return d.backend.resume()
+	}
+	id, ok := d.camera.locate()
+	if !ok {
+		return errors.New("camera disconnected while asleep")
+	}
+	if err := d.reopenCamera(id); err != nil {
+		return err
+	}
+	d.camera.id = id
+	return nil
+}
+
+// suspendSource suspends a SuspendableSource
+func suspendSource(src Source) error {
+	if s, ok := src.(SuspendableSource); ok {
+		return s.Suspend()
+	}
+	return nil
+}
+
+// resumeSource resumes a SuspendableSource
+func resumeSource(src Source) error {
+	if s, ok := src.(SuspendableSource); ok {
+		return s.Resume()
+	}
+	return nil
+}
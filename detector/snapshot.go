@@ -0,0 +1,102 @@
+package detector
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+var (
+	// ErrUnknownZone is returned when a snapshot is requested for a zone
+	// which the detector wasn't configured with
+	ErrUnknownZone = errors.New("unknown zone")
+
+	// ErrNoFrame is returned when a snapshot is requested before the first
+	// frame has been processed
+	ErrNoFrame = errors.New("no frame has been processed yet")
+
+	// ErrInvalidSnapshotOptions is returned when a snapshot is requested
+	// with options which can't be satisfied
+	ErrInvalidSnapshotOptions = errors.New("invalid snapshot options")
+)
+
+// SnapshotOptions changes the framing of a snapshot
+type SnapshotOptions struct {
+	// Zone is the name of a zone to crop the snapshot to
+	Zone string
+	// Width and Height are the size to scale the snapshot down to, when only
+	// one of them is set the other is scaled to preserve the aspect ratio.
+	// Snapshots are never scaled up
+	Width, Height int
+}
+
+// snapshotFraming returns the crop and size of a snapshot of a frame of the
+// given size
+func (d *Detector) snapshotFraming(frame image.Point, opts SnapshotOptions) (image.Rectangle, image.Point, error) {
+	if opts.Width < 0 || opts.Height < 0 {
+		return image.Rectangle{}, image.Point{}, fmt.Errorf("%w: negative size %dx%d", ErrInvalidSnapshotOptions, opts.Width, opts.Height)
+	}
+	crop := image.Rectangle{Max: frame}
+	if opts.Zone != "" {
+		z, ok := d.zone(opts.Zone)
+		if !ok {
+			return image.Rectangle{}, image.Point{}, fmt.Errorf("%w %q", ErrUnknownZone, opts.Zone)
+		}
+		if crop = zoneRect(z.Bounds, frame, d.fisheye); crop.Empty() {
+			return image.Rectangle{}, image.Point{}, fmt.Errorf("%w: zone %q is outside of the frame", ErrInvalidSnapshotOptions, opts.Zone)
+		}
+	}
+	size := crop.Size()
+	switch {
+	case opts.Width > 0 && opts.Height > 0:
+		size = image.Pt(opts.Width, opts.Height)
+	case opts.Width > 0:
+		size = image.Pt(opts.Width, crop.Dy()*opts.Width/crop.Dx())
+	case opts.Height > 0:
+		size = image.Pt(crop.Dx()*opts.Height/crop.Dy(), opts.Height)
+	}
+	// never scale up, nor down to nothing
+	if size.X > crop.Dx() {
+		size.X = crop.Dx()
+	}
+	if size.Y > crop.Dy() {
+		size.Y = crop.Dy()
+	}
+	if size.X < 1 {
+		size.X = 1
+	}
+	if size.Y < 1 {
+		size.Y = 1
+	}
+	return crop, size, nil
+}
+
+// Snapshot returns a jpg encoded byte slice containing the latest image
+// taken from the video capture device, cropped and resized as requested
+func (d *Detector) Snapshot(opts SnapshotOptions) ([]byte, error) {
+	return d.AppendSnapshot(nil, opts)
+}
+
+// AppendSnapshot appends a snapshot, see Snapshot, to buf and returns the
+// extended buffer, so that callers fetching snapshots frequently, e.g. to
+// stream them, can reuse their buffers rather than allocate one per
+// snapshot:
+//
+//	buf, err = md.AppendSnapshot(buf[:0], opts)
+func (d *Detector) AppendSnapshot(buf []byte, opts SnapshotOptions) ([]byte, error) {
+	d.mu.Lock()
+	frame := d.backend.frameSize()
+	if frame.X == 0 || frame.Y == 0 {
+		d.mu.Unlock()
+		return nil, ErrNoFrame
+	}
+	crop, size, err := d.snapshotFraming(frame, opts)
+	if err != nil {
+		d.mu.Unlock()
+		return nil, err
+	}
+	img, err := d.encodeSnapshot(buf, crop, size)
+	d.mu.Unlock()
+	d.reportError(OpEncode, err)
+	return img, err
+}
@@ -0,0 +1,163 @@
+package detector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"time"
+)
+
+// Source is a provider of video frames for a Detector
+type Source interface {
+	// Read blocks until the next frame is available, it returns io.EOF
+	// once the source has no more frames to provide
+	Read() (image.Image, error)
+	// Close releases the resources held by the source
+	Close() error
+}
+
+// MJPEGSource is a Source which decodes a stream of consecutive jpg images
+// such as the output of `ffmpeg -f mjpeg -` or the body of an MJPEG over
+// HTTP (multipart/x-mixed-replace) response from an IP camera
+type MJPEGSource struct {
+	r      *bufio.Reader
+	closer io.Closer
+	buf    bytes.Buffer
+	decode time.Duration
+}
+
+// NewMJPEGSource is the constructor for an MJPEGSource, if the reader is
+// also an io.Closer it will be closed when the source is closed
+func NewMJPEGSource(r io.Reader) *MJPEGSource {
+	s := &MJPEGSource{r: bufio.NewReader(r)}
+	if c, ok := r.(io.Closer); ok {
+		s.closer = c
+	}
+	return s
+}
+
+// Read decodes the next jpg image in the stream
+func (s *MJPEGSource) Read() (image.Image, error) {
+	if err := s.nextJPG(); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	img, err := jpeg.Decode(&s.buf)
+	s.decode = time.Since(start)
+	return img, err
+}
+
+// DecodeLatency implements DecodeTimer, it is how long decoding the last
+// image took
+func (s *MJPEGSource) DecodeLatency() time.Duration {
+	return s.decode
+}
+
+// Close closes the underlying reader
+func (s *MJPEGSource) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// nextJPG reads the bytes of the next jpg image in the stream into buf by
+// walking its markers, anything in between images (e.g. multipart headers
+// and boundaries) is skipped
+func (s *MJPEGSource) nextJPG() error {
+	s.buf.Reset()
+	// skip until the start of image marker
+	for prev := byte(0); ; {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if prev == 0xff && c == 0xd8 {
+			break
+		}
+		prev = c
+	}
+	s.buf.Write([]byte{0xff, 0xd8})
+	for {
+		marker, err := s.readMarker()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		switch {
+		case marker == 0xd9: // end of image
+			return nil
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// markers without a payload
+			continue
+		}
+		if err := s.copySegment(); err != nil {
+			return unexpectedEOF(err)
+		}
+		if marker == 0xda {
+			// start of scan, entropy coded data follows until the next marker
+			if err := s.copyScan(); err != nil {
+				return unexpectedEOF(err)
+			}
+		}
+	}
+}
+
+// readMarker reads the next marker, skipping any fill bytes
+func (s *MJPEGSource) readMarker() (byte, error) {
+	c, err := s.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if c != 0xff {
+		return 0, fmt.Errorf("invalid jpg marker prefix 0x%02x", c)
+	}
+	for c == 0xff {
+		if c, err = s.r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	s.buf.Write([]byte{0xff, c})
+	return c, nil
+}
+
+// copySegment copies a length prefixed marker segment
+func (s *MJPEGSource) copySegment() error {
+	var size [2]byte
+	if _, err := io.ReadFull(s.r, size[:]); err != nil {
+		return err
+	}
+	s.buf.Write(size[:])
+	n := int64(size[0])<<8 | int64(size[1])
+	if n < 2 {
+		return fmt.Errorf("invalid jpg segment length %d", n)
+	}
+	_, err := io.CopyN(&s.buf, s.r, n-2)
+	return err
+}
+
+// copyScan copies entropy coded data, leaving the reader positioned at the
+// marker which terminates it
+func (s *MJPEGSource) copyScan() error {
+	for {
+		next, err := s.r.Peek(2)
+		if err != nil {
+			return err
+		}
+		// stuffed bytes and restart markers are part of the scan data
+		if next[0] == 0xff && next[1] != 0x00 && (next[1] < 0xd0 || next[1] > 0xd7) {
+			return nil
+		}
+		c, _ := s.r.ReadByte()
+		s.buf.WriteByte(c)
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+// Package sourcetest provides a deterministic synthetic frame source for
+// testing code built on the detector package without a camera
+package sourcetest
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+)
+
+// Rect is a scripted rectangle which moves across the frames in a straight
+// line while it is visible
+type Rect struct {
+	// Start and End are the indices of the first frame the rectangle is
+	// visible on and of the first frame it is no longer visible on
+	Start, End int
+	// Bounds is the position of the rectangle on the Start frame
+	Bounds image.Rectangle
+	// Velocity is the number of pixels the rectangle moves by every frame
+	Velocity image.Point
+	// Color is the fill color of the rectangle, white if nil
+	Color color.Color
+}
+
+// At returns the position of the rectangle on the given frame and whether it
+// is visible on that frame at all
+func (r Rect) At(frame int) (image.Rectangle, bool) {
+	if frame < r.Start || frame >= r.End {
+		return image.Rectangle{}, false
+	}
+	n := frame - r.Start
+	return r.Bounds.Add(image.Pt(r.Velocity.X*n, r.Velocity.Y*n)), true
+}
+
+// Source generates frames of a static background with scripted rectangles
+// drawn over it. It satisfies the detector.Source interface
+type Source struct {
+	// Background is drawn at the start of every frame
+	Background image.Image
+	// Frames is the number of frames generated before Read returns io.EOF,
+	// zero means frames are generated forever
+	Frames int
+	// Rects are drawn over the background in order
+	Rects []Rect
+
+	frame  int
+	closed bool
+}
+
+// New is the constructor for a Source generating the given number of frames
+// of the given size, over a fixed gradient background
+func New(width, height, frames int, rects ...Rect) *Source {
+	return &Source{
+		Background: Gradient(width, height),
+		Frames:     frames,
+		Rects:      rects,
+	}
+}
+
+// Gradient returns a deterministic background image which, unlike a single
+// color, has some texture for background subtraction to model
+func Gradient(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(40 + 80*x/width),
+				G: uint8(40 + 80*y/height),
+				B: uint8(80 + (x+y)%16),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+// Read returns the next frame, or io.EOF once all frames were generated
+// or the source was closed
+func (s *Source) Read() (image.Image, error) {
+	if s.closed || (s.Frames > 0 && s.frame >= s.Frames) {
+		return nil, io.EOF
+	}
+	img := s.Render(s.frame)
+	s.frame++
+	return img, nil
+}
+
+// Render returns the given frame without advancing the source
+func (s *Source) Render(frame int) image.Image {
+	bounds := s.Background.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Rect, s.Background, bounds.Min, draw.Src)
+	for _, r := range s.Rects {
+		pos, ok := r.At(frame)
+		if !ok {
+			continue
+		}
+		c := r.Color
+		if c == nil {
+			c = color.White
+		}
+		draw.Draw(img, pos, image.NewUniform(c), image.Point{}, draw.Src)
+	}
+	return img
+}
+
+// Frame returns the index of the next frame Read will return
+func (s *Source) Frame() int {
+	return s.frame
+}
+
+// Close stops the source, subsequent reads return io.EOF
+func (s *Source) Close() error {
+	s.closed = true
+	return nil
+}
+
+// Replay is a Source which replays a fixed set of frames in a loop, useful
+// when the cost of rendering frames shouldn't be measured
+type Replay struct {
+	// Frames are the frames to replay
+	Frames []image.Image
+	// N is the number of frames returned before Read returns io.EOF, zero
+	// means the frames are replayed forever
+	N int
+
+	read   int
+	closed bool
+}
+
+// NewReplay is the constructor for a Replay of the first frames of a Source
+func NewReplay(src *Source, frames, n int) *Replay {
+	r := &Replay{N: n}
+	for f := 0; f < frames; f++ {
+		r.Frames = append(r.Frames, src.Render(f))
+	}
+	return r
+}
+
+// Read returns the next frame, or io.EOF once N frames were returned or
+// the replay was closed
+func (r *Replay) Read() (image.Image, error) {
+	if r.closed || len(r.Frames) == 0 || (r.N > 0 && r.read >= r.N) {
+		return nil, io.EOF
+	}
+	img := r.Frames[r.read%len(r.Frames)]
+	r.read++
+	return img, nil
+}
+
+// Close stops the replay, subsequent reads return io.EOF
+func (r *Replay) Close() error {
+	r.closed = true
+	return nil
+}
@@ -0,0 +1,106 @@
+package detector
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// DefaultSpeckLifetime is the default number of consecutive frames an
+	// object must be tracked for before its motion is reported
+	DefaultSpeckLifetime = 3
+
+	// DefaultSpeckMaxSpeed is the default largest distance, in multiples of
+	// its own size, which an object can plausibly move by between frames
+	DefaultSpeckMaxSpeed = 1.0
+
+	// speckMaxMissed is the number of consecutive frames a tracked object
+	// can go undetected for, e.g. while it stands still, before it is lost
+	speckMaxMissed = 2
+)
+
+// WithSpeckFilter ignores fast, small and short lived moving specks such as
+// rain, snow and insects flying near IR illuminators. Motion is only
+// reported once the moving object has been tracked for minLifetime frames,
+// and an object which moves by more than maxSpeed times its own size between
+// frames isn't tracked at all. Zero values use DefaultSpeckLifetime and
+// DefaultSpeckMaxSpeed
+func WithSpeckFilter(minLifetime int, maxSpeed float64) Option {
+	return func(d *Detector) {
+		if minLifetime <= 0 {
+			minLifetime = DefaultSpeckLifetime
+		}
+		if maxSpeed <= 0 {
+			maxSpeed = DefaultSpeckMaxSpeed
+		}
+		d.specks = &speckFilter{minLifetime: minLifetime, maxSpeed: maxSpeed}
+	}
+}
+
+// speckTrack is an object tracked across frames
+type speckTrack struct {
+	bounds image.Rectangle
+	age    int
+	missed int
+}
+
+// speckFilter tracks the regions of motion across frames to tell objects
+// from specks
+type speckFilter struct {
+	minLifetime int
+	maxSpeed    float64
+	tracks      []speckTrack
+}
+
+// center returns the center of a rectangle
+func center(r image.Rectangle) (float64, float64) {
+	return float64(r.Min.X+r.Max.X) / 2, float64(r.Min.Y+r.Max.Y) / 2
+}
+
+// plausible returns whether an object can have moved from one rectangle to
+// the other between frames
+func (f *speckFilter) plausible(from, to image.Rectangle) bool {
+	size := math.Max(float64(from.Dx()), float64(from.Dy()))
+	size = math.Max(size, math.Max(float64(to.Dx()), float64(to.Dy())))
+	fx, fy := center(from)
+	tx, ty := center(to)
+	return math.Hypot(tx-fx, ty-fy) <= f.maxSpeed*size
+}
+
+// filter matches the regions of the current frame with the tracked objects
+// and returns those of objects tracked for long enough
+func (f *speckFilter) filter(regions []region) []region {
+	matched := make([]bool, len(f.tracks))
+	tracks := make([]speckTrack, 0, len(regions)+len(f.tracks))
+	kept := []region{}
+	for _, r := range regions {
+		best, bestDist := -1, math.Inf(1)
+		rx, ry := center(r.bounds)
+		for i, t := range f.tracks {
+			if matched[i] || !f.plausible(t.bounds, r.bounds) {
+				continue
+			}
+			tx, ty := center(t.bounds)
+			if dist := math.Hypot(rx-tx, ry-ty); dist < bestDist {
+				best, bestDist = i, dist
+			}
+		}
+		t := speckTrack{bounds: r.bounds, age: 1}
+		if best >= 0 {
+			matched[best] = true
+			t.age = f.tracks[best].age + 1
+		}
+		tracks = append(tracks, t)
+		if t.age >= f.minLifetime {
+			kept = append(kept, r)
+		}
+	}
+	for i, t := range f.tracks {
+		if !matched[i] && t.missed < speckMaxMissed {
+			t.missed++
+			tracks = append(tracks, t)
+		}
+	}
+	f.tracks = tracks
+	return kept
+}
@@ -0,0 +1,49 @@
+package detector
+
+// DefaultMaxShift is the default largest camera shake, in pixels, which
+// stabilization compensates for
+const DefaultMaxShift = 8
+
+// stabilizeSampleStride is the number of pixels, in both directions, between
+// those compared to estimate the shake of a frame
+const stabilizeSampleStride = 4
+
+// WithStabilization aligns every frame with the previous one before
+// subtraction, compensating for camera shake of up to maxShift pixels in
+// each direction, so wind-induced vibration doesn't register the entire
+// frame as motion. Zero uses DefaultMaxShift
+func WithStabilization(maxShift int) Option {
+	return func(d *Detector) {
+		if maxShift <= 0 {
+			maxShift = DefaultMaxShift
+		}
+		d.maxShift = maxShift
+	}
+}
+
+// estimateShift returns the translation (dx, dy) within maxShift which best
+// aligns the current luminance of a w x h frame with the reference one, i.e.
+// for which cur(x+dx, y+dy) is closest to ref(x, y), by comparing a sample of
+// the frames' pixels
+func estimateShift(ref, cur []float32, w, h, maxShift int) (int, int) {
+	bestDX, bestDY, best := 0, 0, float32(-1)
+	for dy := -maxShift; dy <= maxShift; dy++ {
+		for dx := -maxShift; dx <= maxShift; dx++ {
+			sad := float32(0)
+			for y := maxShift; y < h-maxShift; y += stabilizeSampleStride {
+				for x := maxShift; x < w-maxShift; x += stabilizeSampleStride {
+					d := cur[(y+dy)*w+x+dx] - ref[y*w+x]
+					if d < 0 {
+						d = -d
+					}
+					sad += d
+				}
+			}
+			// prefer the smallest shift when several align equally well
+			if best < 0 || sad < best || (sad == best && abs(dx)+abs(dy) < abs(bestDX)+abs(bestDY)) {
+				bestDX, bestDY, best = dx, dy, sad
+			}
+		}
+	}
+	return bestDX, bestDY
+}
@@ -0,0 +1,72 @@
+package detector
+
+import (
+	"time"
+)
+
+// Stats are counts of what a detector has seen, e.g. for dashboards and
+// metrics
+type Stats struct {
+	// Frames is the number of frames processed
+	Frames int `json:"frames"`
+	// MotionFrames is the number of frames motion was reported in
+	MotionFrames int `json:"motion_frames"`
+	// Events is the number of events which started, including captured
+	// ones, see CaptureEvent
+	Events int `json:"events"`
+	// Tracks is the number of objects currently tracked
+	Tracks int `json:"tracks"`
+	// Lines are the counts of the counting lines, see WithCountingLines
+	Lines []LineStats `json:"lines"`
+	// Occupancy is the number of distinct objects currently in each zone
+	Occupancy map[string]int `json:"occupancy"`
+	// DroppedFrames is the number of frames dropped because the frame queue
+	// was full, see WithFrameQueue
+	DroppedFrames int `json:"dropped_frames"`
+	// SkippedFrames is the number of frames skipped while the scene was
+	// quiet, see WithIdleSkipping
+	SkippedFrames int `json:"skipped_frames"`
+	// Latency are the percentiles of the latency of each stage of the
+	// pipeline over the latest frames, to see which stage to tune
+	Latency map[Stage]LatencyStats `json:"latency"`
+	// Sharpness is that of the frame last measured, when an event started
+	// or by the focus monitor, see WithFocusMonitor
+	Sharpness float64 `json:"sharpness"`
+	// SceneSimilarity is the similarity of the long-term background to the
+	// reference, from -1 to 1, see WithSceneChangeDetection
+	SceneSimilarity float64 `json:"scene_similarity,omitempty"`
+	// FPS is the rate frames are processed at over the latest frames, see
+	// FrameRate
+	FPS float64 `json:"fps"`
+}
+
+// Stats returns the detector's stats
+func (d *Detector) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	s := Stats{
+		Frames:       d.frame,
+		MotionFrames: d.motionFrames,
+		Events:       d.events,
+		Tracks:       len(d.tracks),
+		Lines:        []LineStats{},
+		Occupancy:    d.occupancyLocked(),
+		Latency:      d.latency.stats(),
+		Sharpness:    d.sharpness,
+		FPS:          d.captures.rate(now),
+	}
+	if d.scene != nil {
+		s.SceneSimilarity = d.scene.similarity
+	}
+	if d.idle != nil {
+		s.SkippedFrames = d.idle.skipped
+	}
+	if d.queue != nil {
+		s.DroppedFrames = d.queue.droppedFrames()
+	}
+	for _, c := range d.lineCounters {
+		s.Lines = append(s.Lines, c.stats(now))
+	}
+	return s
+}
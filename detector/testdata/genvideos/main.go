@@ -0,0 +1,108 @@
+// Command genvideos regenerates the sample videos used by the golden video
+// regression tests, along with golden files listing their scripted motion.
+// Run it from the detector directory with `go run ./testdata/genvideos`
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/detector/sourcetest"
+)
+
+const (
+	width, height = 160, 120
+	noise         = 3
+)
+
+type video struct {
+	name   string
+	frames int
+	rects  []sourcetest.Rect
+}
+
+type goldenEvent struct {
+	StartFrame int `json:"startFrame"`
+	EndFrame   int `json:"endFrame"`
+}
+
+type golden struct {
+	Sensitivity float64       `json:"sensitivity"`
+	Tolerance   int           `json:"tolerance"`
+	Events      []goldenEvent `json:"events"`
+}
+
+var videos = []video{
+	{name: "empty", frames: 60},
+	{name: "walk", frames: 60, rects: []sourcetest.Rect{
+		{Start: 15, End: 45, Bounds: image.Rect(-60, 40, 0, 100), Velocity: image.Pt(8, 0)},
+	}},
+	{name: "two_visits", frames: 90, rects: []sourcetest.Rect{
+		{Start: 10, End: 25, Bounds: image.Rect(20, 30, 80, 90), Velocity: image.Pt(3, 1)},
+		{Start: 60, End: 75, Bounds: image.Rect(100, 20, 160, 80), Velocity: image.Pt(-3, 1), Color: color.Black},
+	}},
+}
+
+// visible returns the span of frames on which the rectangle is in view
+func visible(r sourcetest.Rect) goldenEvent {
+	e := goldenEvent{StartFrame: -1}
+	frame := image.Rect(0, 0, width, height)
+	for f := r.Start; f < r.End; f++ {
+		if pos, _ := r.At(f); pos.Overlaps(frame) {
+			if e.StartFrame < 0 {
+				e.StartFrame = f
+			}
+			e.EndFrame = f
+		}
+	}
+	return e
+}
+
+func main() {
+	for _, v := range videos {
+		src := sourcetest.New(width, height, v.frames, v.rects...)
+		rnd := rand.New(rand.NewSource(1))
+		stream := &bytes.Buffer{}
+		for f := 0; f < v.frames; f++ {
+			img := src.Render(f).(*image.RGBA)
+			// sensor noise
+			for i := range img.Pix {
+				if i%4 == 3 {
+					continue
+				}
+				p := int(img.Pix[i]) + rnd.Intn(2*noise+1) - noise
+				if p < 0 {
+					p = 0
+				} else if p > 255 {
+					p = 255
+				}
+				img.Pix[i] = uint8(p)
+			}
+			if err := jpeg.Encode(stream, img, &jpeg.Options{Quality: 80}); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join("testdata", v.name+".mjpeg"), stream.Bytes(), 0644); err != nil {
+			log.Fatal(err)
+		}
+		g := golden{Sensitivity: detector.VerySensitive / 2, Tolerance: 3, Events: []goldenEvent{}}
+		for _, r := range v.rects {
+			g.Events = append(g.Events, visible(r))
+		}
+		data, err := json.MarshalIndent(g, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join("testdata", v.name+".golden.json"), append(data, '\n'), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package detector
+
+import (
+	"image"
+	"math"
+	"time"
+)
+
+const (
+	// trackMaxJump is the largest distance, in multiples of its own size,
+	// an object can move by between frames and still be tracked
+	trackMaxJump = 1.0
+
+	// trackMaxMissed is the number of consecutive frames a tracked object
+	// can go undetected for before its track ends
+	trackMaxMissed = 10
+
+	// speedSmoothing is the weight of each new measurement in the smoothed
+	// speed of a track
+	speedSmoothing = 0.3
+
+	// stillJitter is the largest distance, in multiples of its own size, an
+	// object can move by from where it stopped and still be considered still,
+	// its bounds jitter with the noise of the foreground mask
+	stillJitter = 0.25
+)
+
+// Track is an object tracked across frames
+type Track struct {
+	ID int `json:"id"`
+	// Bounds is where the object was last seen
+	Bounds    image.Rectangle `json:"bounds"`
+	FirstSeen time.Time       `json:"first_seen"`
+	LastSeen  time.Time       `json:"last_seen"`
+	// Speed is the object's smoothed speed in pixels per second, and
+	// MetersPerSecond in meters per second when the zone it is in is
+	// calibrated (see Zone.PixelsPerMeter), zero otherwise
+	Speed           float64 `json:"speed"`
+	MetersPerSecond float64 `json:"meters_per_second,omitempty"`
+	// Zone is the name of the zone the object is in, if any, and Dwell the
+	// time it spent in each zone it has been in
+	Zone  string                   `json:"zone,omitempty"`
+	Dwell map[string]time.Duration `json:"dwell,omitempty"`
+	// StillSince is when the object last stopped moving, i.e. since when it
+	// stayed about where it is
+	StillSince time.Time `json:"still_since"`
+
+	missed int
+	anchor image.Rectangle
+	// carrier is the ID of the track this object split off from, or which
+	// split off from it, e.g. a person setting down a bag, and carrierLeft
+	// when that object moved away or left the frame
+	carrier     int
+	carrierLeft time.Time
+}
+
+// copy returns a copy of the track which doesn't share its dwell times
+func (t *Track) copy() Track {
+	c := *t
+	c.Dwell = make(map[string]time.Duration, len(t.Dwell))
+	for zone, d := range t.Dwell {
+		c.Dwell[zone] = d
+	}
+	return c
+}
+
+// WithTrackHandler sets a function to be called with every tracked object
+// once its track ends, i.e. it hasn't been seen for a few frames
+func WithTrackHandler(onTrack func(Track)) Option {
+	return func(d *Detector) {
+		d.onTrack = onTrack
+	}
+}
+
+// Tracks returns the objects currently tracked, e.g. to alert on an object
+// dwelling in a zone for too long
+func (d *Detector) Tracks() []Track {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tracks := make([]Track, len(d.tracks))
+	for i, t := range d.tracks {
+		tracks[i] = t.copy()
+	}
+	return tracks
+}
+
+// updateTracks matches the regions of motion on the current frame with the
+// tracked objects, the tracks which ended are handed to the track handler
+// once the detector's lock is released
+func (d *Detector) updateTracks(regions []region, now time.Time) {
+	frame := d.backend.frameSize()
+	matched := make([]bool, len(d.tracks))
+	prev := make([]image.Rectangle, len(d.tracks))
+	for i, t := range d.tracks {
+		prev[i] = t.Bounds
+	}
+	born := []region{}
+	for _, r := range regions {
+		best, bestDist := -1, math.Inf(1)
+		for i, t := range d.tracks {
+			if matched[i] {
+				continue
+			}
+			if dist := distance(t.Bounds, r.bounds); dist <= trackMaxJump*size(t.Bounds, r.bounds) && dist < bestDist {
+				best, bestDist = i, dist
+			}
+		}
+		if best < 0 {
+			born = append(born, r)
+			continue
+		}
+		matched[best] = true
+		d.moveTrack(d.tracks[best], r.bounds, now, frame)
+	}
+	for _, r := range born {
+		d.nextTrackID++
+		t := &Track{
+			ID:         d.nextTrackID,
+			Bounds:     r.bounds,
+			FirstSeen:  now,
+			LastSeen:   now,
+			Zone:       d.trackZone(r.bounds, frame),
+			Dwell:      map[string]time.Duration{},
+			StillSince: now,
+			anchor:     r.bounds,
+		}
+		// an object appearing where another one was split off from it
+		for i, p := range prev {
+			if p.Overlaps(r.bounds) {
+				t.carrier = d.tracks[i].ID
+				if d.tracks[i].carrier == 0 {
+					d.tracks[i].carrier = t.ID
+				}
+				break
+			}
+		}
+		d.tracks = append(d.tracks, t)
+		matched = append(matched, true)
+	}
+	kept := d.tracks[:0]
+	for i, t := range d.tracks {
+		if !matched[i] {
+			if t.missed++; t.missed > trackMaxMissed {
+				d.endTrack(t)
+				continue
+			}
+		}
+		kept = append(kept, t)
+	}
+	d.tracks = kept
+	d.applyTrackRules(now)
+	d.updateOccupancy(now)
+}
+
+// endTracks ends all tracks, e.g. when the detector stops
+func (d *Detector) endTracks() {
+	for _, t := range d.tracks {
+		d.endTrack(t)
+	}
+	d.tracks = nil
+}
+
+// endTrack queues a track which ended for the track handler
+func (d *Detector) endTrack(t *Track) {
+	if d.onTrack != nil {
+		ended := t.copy()
+		d.pending = append(d.pending, func() { d.onTrack(ended) })
+	}
+}
+
+// moveTrack updates a track with the object's new position
+func (d *Detector) moveTrack(t *Track, bounds image.Rectangle, now time.Time, frame image.Point) {
+	if dt := now.Sub(t.LastSeen); dt > 0 {
+		speed := distance(t.Bounds, bounds) / dt.Seconds()
+		if t.Speed == 0 {
+			t.Speed = speed
+		} else {
+			t.Speed += speedSmoothing * (speed - t.Speed)
+		}
+		if t.Zone != "" {
+			t.Dwell[t.Zone] += dt
+		}
+	}
+	t.MetersPerSecond = 0
+	if scale := d.scaleAt(image.Pt((bounds.Min.X+bounds.Max.X)/2, bounds.Max.Y-1), frame); scale > 0 {
+		t.MetersPerSecond = t.Speed / scale
+	}
+	d.countCrossings(t.Bounds, bounds, now)
+	if distance(t.anchor, bounds) > stillJitter*size(t.anchor, bounds) {
+		t.anchor, t.StillSince = bounds, now
+	}
+	t.Bounds, t.LastSeen, t.missed = bounds, now, 0
+	t.Zone = d.trackZone(bounds, frame)
+}
+
+// trackZone returns the name of the zone an object with the given bounds is
+// in, if any
+func (d *Detector) trackZone(bounds image.Rectangle, frame image.Point) string {
+	z, _ := d.zoneAt(midpoint(bounds), frame)
+	return z.Name
+}
+
+// distance returns the distance between the centers of two rectangles
+func distance(a, b image.Rectangle) float64 {
+	ax, ay := center(a)
+	bx, by := center(b)
+	return math.Hypot(bx-ax, by-ay)
+}
+
+// size returns the size of the larger of two objects, their largest side
+func size(a, b image.Rectangle) float64 {
+	return math.Max(math.Max(float64(a.Dx()), float64(a.Dy())), math.Max(float64(b.Dx()), float64(b.Dy())))
+}
+
+// track returns the live track with the given ID
+func (d *Detector) track(id int) (*Track, bool) {
+	for _, t := range d.tracks {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// runPending runs the callbacks queued while the detector's lock was held,
+// they are dropped in dry run mode. It must not be called with the lock held
+func (d *Detector) runPending() {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = nil
+	if d.dryRun {
+		pending = nil
+	}
+	d.mu.Unlock()
+	for _, fn := range pending {
+		d.safeCall(fn)
+	}
+}
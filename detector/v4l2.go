@@ -0,0 +1,50 @@
+package detector
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/adrianosela/GoAway/v4l2"
+)
+
+// WithV4L2Controls sets raw V4L2 controls of the camera, by name or ID, when
+// it is opened, on Linux, for settings which aren't CameraControls, e.g.
+// {"power_line_frequency": 1} to compensate for 50Hz flicker. See the v4l2
+// package, and `goaway v4l2` which lists a camera's controls
+func WithV4L2Controls(controls map[string]int32) Option {
+	return func(d *Detector) {
+		if d.v4l2Controls == nil {
+			d.v4l2Controls = map[string]int32{}
+		}
+		for c, v := range controls {
+			d.v4l2Controls[c] = v
+		}
+	}
+}
+
+// applyV4L2Controls sets the controls of WithV4L2Controls on the device at
+// the given path, in the order of their names
+func (d *Detector) applyV4L2Controls(path string) error {
+	if len(d.v4l2Controls) == 0 {
+		return nil
+	}
+	if path == "" {
+		return errors.New("V4L2 controls can only be set on cameras")
+	}
+	dev, err := v4l2.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dev.Close()
+	names := []string{}
+	for name := range d.v4l2Controls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := dev.Set(name, d.v4l2Controls[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
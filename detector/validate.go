@@ -0,0 +1,220 @@
+package detector
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ConfigError is returned for a configuration which can't work, e.g. a
+// negative sensitivity, it lists every problem found so that they can all be
+// fixed at once
+type ConfigError struct {
+	Problems []string
+}
+
+// Error implements the error interface
+func (e *ConfigError) Error() string {
+	return "invalid detector configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the configuration for impossible or contradictory values,
+// it returns a *ConfigError describing them, if any, without creating a
+// detector
+func (c Config) Validate() error {
+	return newDetector(nil, []Option{WithConfig(c)}).Validate()
+}
+
+// Validate checks the detector's configuration for impossible or
+// contradictory values, it returns a *ConfigError describing them, if any.
+// The constructors validate the configuration, so that mistakes are caught
+// at startup rather than mid-run
+func (d *Detector) Validate() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	problems := []string{}
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if !(d.minDiffContourArea >= 0) {
+		add("sensitivity is %v, it must be a minimum contour area of 0 or more, e.g. DefaultSensitive", d.minDiffContourArea)
+	}
+	for _, t := range []struct {
+		name  string
+		value float64
+	}{{"threshold", d.threshold}, {"night threshold", d.nightThreshold}} {
+		if !(t.value > 0 && t.value < 255) {
+			add("%s is %v, it must be a pixel difference between 0 and 255, e.g. %d", t.name, t.value, DefaultThreshold)
+		}
+	}
+	if d.eventGap < 0 {
+		add("event gap is %d frames, it can't be negative", d.eventGap)
+	}
+	if d.maxShift < 0 {
+		add("stabilization shift is %d pixels, it can't be negative", d.maxShift)
+	}
+	if !(d.minObjectHeight >= 0) {
+		add("minimum object height is %v, it can't be negative", d.minObjectHeight)
+	} else if d.minObjectHeight > 0 && !d.hasCalibratedZone() {
+		add("minimum object height is set but no zone has PixelsPerMeter, so no object would be filtered")
+	}
+	if d.fusionWindow < 0 {
+		add("sensor fusion window is %s, it can't be negative", d.fusionWindow)
+	} else if d.fusionMode != FusionVisualOnly && d.fusionWindow == 0 {
+		add("sensor fusion window is 0, so sensor triggers would never coincide with motion")
+	}
+	if d.fisheye != nil && (d.fisheye.Width <= 0 || d.fisheye.Height <= 0 || d.fisheye.FX <= 0 || d.fisheye.FY <= 0) {
+		add("fisheye intrinsics need a positive frame size and focal lengths, recalibrate the camera")
+	}
+	if id := d.identity; id.ID != "" || id.Name != "" || len(id.Labels) > 0 {
+		if !identityIDPattern.MatchString(id.ID) {
+			add("camera ID is %q, it must be letters, digits, '.', '-' and '_', not starting with '.', e.g. garage-north", id.ID)
+		}
+		for k := range id.Labels {
+			if k == "" {
+				add("camera label names can't be empty")
+			}
+		}
+	}
+	if unknown := unknownControls(d.cameraControls); len(unknown) > 0 {
+		add("unknown camera controls %s, expected %s", strings.Join(unknown, ", "), CameraControls)
+	}
+	if f := d.flicker; f != nil && f.config.MaxArea > 1 {
+		add("flicker compensation maximum area is %v, it must be a fraction of the frame between 0 and 1, e.g. %v", f.config.MaxArea, DefaultFlickerMaxArea)
+	}
+	if f := d.flicker; f != nil && f.config.Window < 2*flickerMinSwings {
+		add("flicker compensation window is %d frames, it must be at least %d to see %d swings", f.config.Window, 2*flickerMinSwings, flickerMinSwings)
+	}
+	if s := d.idle; s != nil {
+		if s.config.After < 0 {
+			add("idle skipping starts after %s, it can't be negative", s.config.After)
+		}
+		if s.config.Every < 1 {
+			add("idle skipping processes every %d frames, it must be 1 or more, e.g. %d", s.config.Every, DefaultIdleEvery)
+		}
+		if !(s.config.Change > 0 && s.config.Change <= 1) {
+			add("idle skipping change is %v, it must be a fraction of the pixels between 0 and 1, e.g. %v", s.config.Change, DefaultIdleChange)
+		}
+	}
+	if s := d.sleep; s != nil && s.config.After < 0 {
+		add("sleep mode sleeps after %s, it can't be negative", s.config.After)
+	}
+	for _, w := range d.packageWatchers {
+		r := w.rule
+		if _, ok := d.zone(r.Zone); r.Zone != "" && !ok {
+			add("packages are looked for in zone %q, which doesn't exist", r.Zone)
+		}
+		if r.Settle < 0 {
+			add("packages settle for %s, it can't be negative", r.Settle)
+		}
+		if !(r.MinSize > 0 && r.MinSize <= r.MaxSize && r.MaxSize <= 1) {
+			add("packages cover between %v and %v of their zone, they must be fractions between 0 and 1, the smallest first", r.MinSize, r.MaxSize)
+		}
+	}
+	if v := d.vehicleClassification; v != nil && !(v.MinVehicleArea >= 0) {
+		add("minimum vehicle area is %v, it can't be negative", v.MinVehicleArea)
+	}
+	if q := d.queue; q != nil {
+		if q.config.Size < 0 {
+			add("frame queue size is %d, it can't be negative", q.config.Size)
+		}
+		if p := q.config.Policy; p != DropOldest && p != DropNewest && p != BlockCapture {
+			add("frame drop policy is %q, expected %s, %s or %s", p, DropOldest, DropNewest, BlockCapture)
+		}
+	}
+	if h := d.history; h != nil {
+		if _, ok := d.zone(h.opts.Zone); h.opts.Zone != "" && !ok {
+			add("snapshot history is cropped to zone %q, which doesn't exist", h.opts.Zone)
+		}
+		if h.opts.Width < 0 || h.opts.Height < 0 {
+			add("snapshot history size is %dx%d, it can't be negative", h.opts.Width, h.opts.Height)
+		}
+	}
+	if f := d.focus; f != nil {
+		if !(f.config.MinSharpness > 0) {
+			add("focus monitor minimum sharpness is %v, it must be more than 0, e.g. %v", f.config.MinSharpness, DefaultMinSharpness)
+		}
+		if f.config.After < 0 || f.config.Every < 0 {
+			add("focus monitor warns after %s measuring every %s, they can't be negative", f.config.After, f.config.Every)
+		}
+	}
+	if s := d.scene; s != nil {
+		if !(s.config.MinSimilarity > -1 && s.config.MinSimilarity <= 1) {
+			add("scene change minimum similarity is %v, it must be more than -1 and at most 1, e.g. %v", s.config.MinSimilarity, DefaultSceneSimilarity)
+		}
+		if s.config.Every < 0 {
+			add("scene change detection samples every %s, it can't be negative", s.config.Every)
+		}
+		if r := s.config.Reference; r != nil && (r.Size.X < 3 || r.Size.Y < 3 || len(r.Pixels) != r.Size.X*r.Size.Y) {
+			add("scene reference has %d pixels for a size of %v, it must be at least 3x3 with a pixel for each", len(r.Pixels), r.Size)
+		}
+	}
+	if b := d.bestShot; b != nil {
+		if _, ok := d.zone(b.config.Zone); b.config.Zone != "" && !ok {
+			add("best shots are cropped to zone %q, which doesn't exist", b.config.Zone)
+		}
+		if b.config.Width < 0 || b.config.Height < 0 {
+			add("best shot size is %dx%d, it can't be negative", b.config.Width, b.config.Height)
+		}
+	}
+	d.validateZones("zone", d.zones, add)
+	d.validateZones("privacy zone", d.privacyZones, add)
+	d.validateZonesAgree(add)
+	lines := map[string]bool{}
+	for _, c := range d.lineCounters {
+		l := c.line
+		if l.A == l.B {
+			add("counting line %q starts and ends at %s, it needs two distinct points", l.Name, l.A)
+		}
+		if lines[l.Name] {
+			add("counting line name %q is used more than once", l.Name)
+		}
+		lines[l.Name] = true
+	}
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// validateZones checks the zones of a kind, e.g. privacy zones
+func (d *Detector) validateZones(kind string, zones []Zone, add func(string, ...interface{})) {
+	names := map[string]bool{}
+	for _, z := range zones {
+		if z.Bounds.Empty() {
+			add("%s %q has empty bounds %s, Min must be above and to the left of Max", kind, z.Name, z.Bounds)
+		}
+		if !(z.MinArea >= 0) || math.IsInf(z.MinArea, 0) {
+			add("%s %q has sensitivity %v, it must be 0 or more", kind, z.Name, z.MinArea)
+		}
+		if !(z.PixelsPerMeter >= 0) || math.IsInf(z.PixelsPerMeter, 0) {
+			add("%s %q has a scale of %v pixels per meter, it must be 0 or more", kind, z.Name, z.PixelsPerMeter)
+		}
+		if z.Name != "" && names[z.Name] {
+			add("%s name %q is used more than once, zones are looked up by name", kind, z.Name)
+		}
+		names[z.Name] = true
+	}
+}
+
+// validateZonesAgree checks that overlapping zones don't set different
+// sensitivities, only the first zone's would apply to motion in both
+func (d *Detector) validateZonesAgree(add func(string, ...interface{})) {
+	for i, a := range d.zones {
+		for _, b := range d.zones[i+1:] {
+			if a.MinArea > 0 && b.MinArea > 0 && a.MinArea != b.MinArea && a.Bounds.Overlaps(b.Bounds) {
+				add("zones %q and %q overlap with different sensitivities, %q's applies to motion in both", a.Name, b.Name, a.Name)
+			}
+		}
+	}
+}
+
+// hasCalibratedZone returns whether a zone has a scale, see WithMinObjectHeight
+func (d *Detector) hasCalibratedZone() bool {
+	for _, z := range d.zones {
+		if z.PixelsPerMeter > 0 {
+			return true
+		}
+	}
+	return false
+}
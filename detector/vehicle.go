@@ -0,0 +1,152 @@
+package detector
+
+import (
+	"image"
+	"math"
+	"time"
+)
+
+const (
+	// DefaultVehicleSpeed is the default speed, in meters per second, above
+	// which moving objects are more likely vehicles than pedestrians
+	DefaultVehicleSpeed = 3.0
+
+	// vehicleWidth is the width, in meters, above which objects are more
+	// likely vehicles than pedestrians
+	vehicleWidth = 1.25
+
+	// classMargin is the least score, either way, an event is classified
+	// with, events with a score closer to zero are of unknown class
+	classMargin = 0.25
+
+	// classifierWeight is how much more a classifier's score counts for
+	// than that of the heuristics, it sees what the object is
+	classifierWeight = 2.0
+)
+
+// ObjectClass is the kind of object which moved in an event
+type ObjectClass string
+
+// object classes of the vehicle vs pedestrian differentiation mode, see
+// WithVehicleClassification
+const (
+	ClassUnknown    ObjectClass = ""
+	ClassVehicle    ObjectClass = "vehicle"
+	ClassPedestrian ObjectClass = "pedestrian"
+)
+
+// VehicleClassification configures the vehicle vs pedestrian
+// differentiation mode
+type VehicleClassification struct {
+	// MinVehicleArea is the contour area around which objects are more
+	// likely vehicles than pedestrians, zero leaves the area out. It is only
+	// used outside of calibrated zones, where objects are measured in meters
+	// instead (see Zone.PixelsPerMeter)
+	MinVehicleArea float64 `json:"min_vehicle_area,omitempty"`
+	// VehicleSpeed is the speed, in meters per second, above which objects
+	// are more likely vehicles than pedestrians, zero uses
+	// DefaultVehicleSpeed. Speed is only measured in calibrated zones
+	VehicleSpeed float64 `json:"vehicle_speed,omitempty"`
+}
+
+// WithVehicleClassification enables the vehicle vs pedestrian
+// differentiation mode, meant for driveway cameras: events are labeled as
+// showing a vehicle or a pedestrian (see Event.Class), e.g. for separate
+// notification rules for each. The largest object of each frame of an event
+// is scored by its shape, vehicles are wider than tall and pedestrians taller
+// than wide, its size and its speed. A classifier, e.g. a DNN, can have its
+// say with Event.SetClassifierClasses
+func WithVehicleClassification(c VehicleClassification) Option {
+	return func(d *Detector) {
+		if c.VehicleSpeed <= 0 {
+			c.VehicleSpeed = DefaultVehicleSpeed
+		}
+		d.vehicleClassification = &c
+	}
+}
+
+// classScore returns how much more like a vehicle than a pedestrian the
+// largest object on the current frame is, from -1 for a pedestrian to 1 for
+// a vehicle. It is the mean of the object's shape, its size and its speed
+// since the previous frame of the event, for those which can be measured
+func (d *Detector) classScore(e *Event, largest region, now time.Time) float64 {
+	c := d.vehicleClassification
+	b := largest.bounds
+	scores := []float64{}
+	if b.Dy() > 0 {
+		// square objects are either, wide ones vehicles
+		scores = append(scores, clampScore((float64(b.Dx())/float64(b.Dy())-1)*2.5))
+	}
+	frame := d.backend.frameSize()
+	scale := d.scaleAt(image.Pt((b.Min.X+b.Max.X)/2, b.Max.Y-1), frame)
+	switch {
+	case scale > 0:
+		scores = append(scores, clampScore((float64(b.Dx())/scale-vehicleWidth)*2))
+		if dt := now.Sub(e.classTime); !e.classTime.IsZero() && dt > 0 {
+			speed := distance(e.classBounds, b) / dt.Seconds() / scale
+			scores = append(scores, clampScore((speed-c.VehicleSpeed)/2))
+		}
+	case c.MinVehicleArea > 0 && largest.area > 0:
+		scores = append(scores, clampScore(math.Log2(largest.area/c.MinVehicleArea)))
+	}
+	e.classBounds, e.classTime = b, now
+	if len(scores) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, s := range scores {
+		sum += s
+	}
+	return sum / float64(len(scores))
+}
+
+// clampScore clamps a score to the range from -1 to 1
+func clampScore(s float64) float64 {
+	return math.Max(-1, math.Min(1, s))
+}
+
+// updateClass updates the class of an event with the largest region of
+// motion on the current frame
+func (d *Detector) updateClass(e *Event, largest region, now time.Time) {
+	if d.vehicleClassification == nil {
+		return
+	}
+	e.classFrames++
+	e.classSum += d.classScore(e, largest, now)
+	e.classify()
+}
+
+// SetClassifierClasses folds the confidences of a classifier that the event
+// shows a vehicle and a pedestrian, from 0 to 1, into the event's class. A
+// classifier counts twice as much as the heuristics of the vehicle vs
+// pedestrian differentiation mode, so that a confident one overrules them,
+// and alone without it
+func (e *Event) SetClassifierClasses(vehicle, pedestrian float64) {
+	s := vehicle - pedestrian
+	e.classifierScore = &s
+	e.classify()
+}
+
+// classify sets the class of the event and the confidence in it from its
+// scores
+func (e *Event) classify() {
+	score, weight := 0.0, 0.0
+	if e.classFrames > 0 {
+		score, weight = e.classSum/float64(e.classFrames), 1
+	}
+	if e.classifierScore != nil {
+		score += classifierWeight * *e.classifierScore
+		weight += classifierWeight
+	}
+	if weight > 0 {
+		score /= weight
+	}
+	switch {
+	case score >= classMargin:
+		e.Class, e.ClassConfidence = ClassVehicle, score
+	case score <= -classMargin:
+		e.Class, e.ClassConfidence = ClassPedestrian, -score
+	default:
+		e.Class, e.ClassConfidence = ClassUnknown, 0
+	}
+}
@@ -0,0 +1,59 @@
+package detector
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// minParallelItems is the fewest contours or regions of a frame which are
+// processed across the worker pool, handing fewer off costs more than it
+// saves
+const minParallelItems = 8
+
+// WithWorkers processes the contours of busy frames, i.e. their areas,
+// bounds and outlines, and the zones they are in, across a pool of n
+// goroutines, to keep frame latency low on multi-core machines when many
+// objects move at once. Zero or less sizes the pool to GOMAXPROCS. Results
+// are the same as without a pool
+func WithWorkers(n int) Option {
+	return func(d *Detector) {
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		d.workers = &workerPool{size: n}
+	}
+}
+
+// workerPool runs per contour or per region work in parallel, a nil pool
+// runs it on the calling goroutine
+type workerPool struct {
+	size int
+}
+
+// run calls f with every index up to n, returning once all calls returned.
+// Calls run concurrently, so f must only write to what belongs to its index
+func (p *workerPool) run(n int, f func(i int)) {
+	if p == nil || p.size < 2 || n < minParallelItems {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+	workers := p.size
+	if workers > n {
+		workers = n
+	}
+	next := int64(-1)
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := int(atomic.AddInt64(&next, 1)); i < n; i = int(atomic.AddInt64(&next, 1)) {
+				f(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
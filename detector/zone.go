@@ -0,0 +1,151 @@
+package detector
+
+import (
+	"fmt"
+	"image"
+)
+
+// Zone is a named area of the frame
+type Zone struct {
+	Name   string          `json:"name"`
+	Bounds image.Rectangle `json:"bounds"`
+	// PixelsPerMeter is the approximate scale of objects standing in the
+	// zone, e.g. measured with a one meter stick at the zone's floor line,
+	// for WithMinObjectHeight. It is measured on the frames detection runs
+	// on, i.e. de-warped with WithFisheye. Zero leaves the zone uncalibrated
+	PixelsPerMeter float64 `json:"pixels_per_meter,omitempty"`
+	// MinArea overrides the detector's sensitivity, the minimum diff
+	// contour area, for motion centered in the zone. Zero uses the
+	// detector's
+	MinArea float64 `json:"min_area,omitempty"`
+}
+
+// WithZones sets the named areas of the frame, e.g. for snapshots to be
+// cropped to or to calibrate the scale of objects in
+func WithZones(zones ...Zone) Option {
+	return func(d *Detector) {
+		d.zones = append(d.zones, zones...)
+	}
+}
+
+// zone returns the zone with the given name
+func (d *Detector) zone(name string) (Zone, bool) {
+	for _, z := range d.zones {
+		if z.Name == name {
+			return z, true
+		}
+	}
+	return Zone{}, false
+}
+
+// Zones returns the zones the detector was configured with, along with
+// their current sensitivity
+func (d *Detector) Zones() []Zone {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Zone{}, d.zones...)
+}
+
+// SetZoneSensitivity changes the minimum diff contour area for motion
+// centered in a zone to be detected while the detector is running, see
+// Zone.MinArea
+func (d *Detector) SetZoneSensitivity(name string, minArea float64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.zones {
+		if d.zones[i].Name == name {
+			d.zones[i].MinArea = minArea
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %q", ErrUnknownZone, name)
+}
+
+// ZoneOf returns the zone the motion of an event was centered in, if any
+func (d *Detector) ZoneOf(e Event) (Zone, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.zoneAt(midpoint(e.Bounds), e.FrameSize)
+}
+
+// midpoint returns the center pixel of a rectangle
+func midpoint(r image.Rectangle) image.Point {
+	return image.Pt((r.Min.X+r.Max.X)/2, (r.Min.Y+r.Max.Y)/2)
+}
+
+// zoneAt returns the first zone containing the given point of a frame of
+// the given size
+func (d *Detector) zoneAt(p image.Point, frame image.Point) (Zone, bool) {
+	bounds := d.zoneBounds(frame)
+	for i, z := range d.zones {
+		if p.In(bounds[i]) {
+			return z, true
+		}
+	}
+	return Zone{}, false
+}
+
+// zoneBoundsCache holds the bounds of the zones within frames of a size,
+// which are mapped through the de-warp, so that they are computed again
+// when the frame size or the zones change rather than for every region of
+// every frame
+type zoneBoundsCache struct {
+	frame  image.Point
+	zones  []image.Rectangle
+	bounds []image.Rectangle
+}
+
+// zoneBounds returns the bounds of the zones within a frame of the given
+// size, by the zones' index. Once computed for the frame size, it only reads
+// the cache, so it can be called concurrently
+func (d *Detector) zoneBounds(frame image.Point) []image.Rectangle {
+	c := &d.zoneCache
+	valid := c.frame == frame && c.bounds != nil && len(c.zones) == len(d.zones)
+	for i := 0; valid && i < len(d.zones); i++ {
+		valid = c.zones[i] == d.zones[i].Bounds
+	}
+	if valid {
+		return c.bounds
+	}
+	c.frame = frame
+	c.zones, c.bounds = make([]image.Rectangle, len(d.zones)), make([]image.Rectangle, len(d.zones))
+	for i, z := range d.zones {
+		c.zones[i], c.bounds[i] = z.Bounds, zoneRect(z.Bounds, frame, d.fisheye)
+	}
+	return c.bounds
+}
+
+// minArea returns the smallest minimum diff contour area of the detector
+// and its zones
+func (d *Detector) minArea() float64 {
+	minArea := d.minDiffContourArea
+	for _, z := range d.zones {
+		if z.MinArea > 0 && z.MinArea < minArea {
+			minArea = z.MinArea
+		}
+	}
+	return minArea
+}
+
+// filterZoneAreas returns the regions covering at least the minimum diff
+// contour area of the zone they are centered in
+func (d *Detector) filterZoneAreas(regions []region) []region {
+	frame := d.backend.frameSize()
+	// the workers only read the zones' bounds once they are computed
+	d.zoneBounds(frame)
+	keep := make([]bool, len(regions))
+	d.workers.run(len(regions), func(i int) {
+		minArea := d.minDiffContourArea
+		if z, ok := d.zoneAt(midpoint(regions[i].bounds), frame); ok && z.MinArea > 0 {
+			minArea = z.MinArea
+		}
+		keep[i] = regions[i].area >= minArea
+	})
+	kept := []region{}
+	for i, r := range regions {
+		if keep[i] {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,196 @@
+// Package digest makes digests of the events of a period, e.g. a day: a
+// short video joining the best part of each event's clip, and a record
+// summarizing the events with their counts per zone, which notifiers
+// deliver like that of an event
+package digest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adrianosela/GoAway/clips"
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+const (
+	// DefaultPerEvent is the default length of the part of each event's
+	// clip in a digest's video
+	DefaultPerEvent = 10 * time.Second
+
+	// Reason is the reason of the events of the records of digests, e.g.
+	// for rules to route them with reason == 'digest'
+	Reason = "digest"
+)
+
+// Options configure a digest
+type Options struct {
+	// Camera is the camera whose events are digested, all cameras' when
+	// empty
+	Camera string
+	// Zones are the zones events are counted in, by the names of those
+	// they overlap
+	Zones []detector.Zone
+	// PerEvent is the length of the part of each event's clip in the
+	// video, DefaultPerEvent when 0
+	PerEvent time.Duration
+	// Width is the width of the video, clips.DefaultConcatWidth when 0
+	Width int
+	// Encoder is how the video is encoded
+	Encoder clips.EncoderOptions
+	// NoVideo only summarizes the events, without a video, e.g. for
+	// summary notifications
+	NoVideo bool
+}
+
+// Make makes the digest of the events stored in records which started
+// between start and end. The part of each event's clip, or the continuous
+// recording it is in, around its best shot, or from its start without one,
+// is joined into a video stored in media as digests/<camera>/<end>.mp4.
+// The returned record summarizes the events, see events.Summarize, with
+// the video as its media, e.g. for a notify.Dispatcher to deliver. Events
+// without clips are only counted, and there is no video without any. Media
+// is not used, and may be nil, with Options.NoVideo
+func Make(ctx context.Context, records events.Store, media storage.Storage, start, end time.Time, opts Options) (*events.Record, error) {
+	if opts.PerEvent <= 0 {
+		opts.PerEvent = DefaultPerEvent
+	}
+	all, err := records.List()
+	if err != nil {
+		return nil, err
+	}
+	camera := []*events.Record{}
+	for _, r := range all {
+		if opts.Camera == "" || r.Camera == opts.Camera {
+			camera = append(camera, r)
+		}
+	}
+	record := &events.Record{
+		ID:      events.NewID(end),
+		Camera:  opts.Camera,
+		Event:   detector.Event{Start: start, End: end, Reason: Reason},
+		Summary: events.Summarize(camera, start, end, opts.Zones...),
+	}
+	if opts.NoVideo {
+		return record, nil
+	}
+	tmp, err := os.MkdirTemp("", "goaway-digest-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	parts := []clips.Part{}
+	copied := map[string]string{}
+	for _, r := range events.Summarized(camera, start, end) {
+		name, offset, available, ok := clipOf(r)
+		if !ok {
+			continue
+		}
+		local, done := copied[name]
+		if !done {
+			local = filepath.Join(tmp, fmt.Sprintf("%d%s", len(copied), path.Ext(name)))
+			if err := copyClip(media, name, local); err != nil {
+				log.Printf("could not add %s of event %s to the digest: %s", name, r.ID, err)
+				continue
+			}
+			copied[name] = local
+		}
+		parts = append(parts, bestPart(r, local, offset, available, opts.PerEvent))
+	}
+	if len(parts) == 0 {
+		return record, nil
+	}
+	dir := opts.Camera
+	if dir == "" {
+		dir = "all"
+	}
+	f, err := media.PutClip(fmt.Sprintf("digests/%s/%s.mp4", dir, end.UTC().Format("20060102T150405Z")))
+	if err != nil {
+		return nil, err
+	}
+	if err := clips.Concat(ctx, f, parts, opts.Width, opts.Encoder); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	record.Media = append(record.Media, f.Object())
+	return record, nil
+}
+
+// clipOf returns the name of the clip an event was recorded in, its first
+// clip or the first segment of the continuous recording it is in, with the
+// event's offset into it and how long it is recorded for, 0 when unknown
+func clipOf(r *events.Record) (string, time.Duration, time.Duration, bool) {
+	for _, obj := range r.Media {
+		if isClip(obj.Name) {
+			// clips start with their event
+			return obj.Name, 0, r.Event.End.Sub(r.Event.Start), true
+		}
+	}
+	if len(r.Recording) > 0 {
+		ref := r.Recording[0]
+		return ref.Segment, ref.Offset, ref.Duration, true
+	}
+	return "", 0, 0, false
+}
+
+// bestPart returns the part, at most perEvent long, of an event's clip on
+// disk, recorded from offset for the available time, centered on its best
+// shot or from its start without one
+func bestPart(r *events.Record, local string, offset, available, perEvent time.Duration) clips.Part {
+	if available <= perEvent {
+		if available <= 0 {
+			available = perEvent
+		}
+		return clips.Part{Path: local, Offset: offset, Duration: available}
+	}
+	from := time.Duration(0)
+	if shot := r.Event.BestShot; shot != nil && !shot.Captured.IsZero() {
+		from = shot.Captured.Sub(r.Event.Start) - perEvent/2
+	}
+	if from > available-perEvent {
+		from = available - perEvent
+	}
+	if from < 0 {
+		from = 0
+	}
+	return clips.Part{Path: local, Offset: offset + from, Duration: perEvent}
+}
+
+// copyClip copies a clip out of its storage to a file on disk, decrypted,
+// for ffmpeg to read
+func copyClip(media storage.Storage, name, dst string) error {
+	src, err := media.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// isClip returns whether a media file is a clip rather than a still image
+func isClip(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".mp4", ".mkv", ".avi", ".webm":
+		return true
+	}
+	return false
+}
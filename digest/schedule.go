@@ -0,0 +1,92 @@
+package digest
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/notify"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+// Period is how often a Scheduler sends digests
+type Period string
+
+const (
+	// Daily digests are sent every day and cover the day before
+	Daily Period = "daily"
+	// Weekly digests are sent every week and cover the week before
+	Weekly Period = "weekly"
+)
+
+// Schedule is when a Scheduler sends digests
+type Schedule struct {
+	Period Period
+	// Hour is the hour of the day, in local time, digests are sent at
+	Hour int
+	// Weekday is the day weekly digests are sent on
+	Weekday time.Weekday
+}
+
+// Scheduler sends the digests of stored events through a notifier, e.g. a
+// notify.Dispatcher, on a schedule. Digests are sent even when there were
+// no events, so that quiet systems still prove they're alive
+type Scheduler struct {
+	records  events.Store
+	media    storage.Storage
+	notifier notify.Notifier
+	schedule Schedule
+	opts     Options
+}
+
+// NewScheduler is the constructor for a Scheduler, media may be nil with
+// Options.NoVideo, see Make
+func NewScheduler(records events.Store, media storage.Storage, notifier notify.Notifier, schedule Schedule, opts Options) *Scheduler {
+	return &Scheduler{records: records, media: media, notifier: notifier, schedule: schedule, opts: opts}
+}
+
+// Next returns when the next digest is sent after the given time, and the
+// start of the period it covers
+func (s *Scheduler) Next(after time.Time) (time.Time, time.Time) {
+	after = after.Local()
+	next := time.Date(after.Year(), after.Month(), after.Day(), s.schedule.Hour, 0, 0, 0, time.Local)
+	if s.schedule.Period == Weekly {
+		next = next.AddDate(0, 0, (int(s.schedule.Weekday)-int(next.Weekday())+7)%7)
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next, next.AddDate(0, 0, -7)
+	}
+	if !next.After(after) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, next.AddDate(0, 0, -1)
+}
+
+// Run sends digests on the schedule until the context is done
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		end, start := s.Next(time.Now())
+		timer := time.NewTimer(time.Until(end))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if err := s.Send(ctx, start, end); err != nil {
+			log.Printf("could not send %s digest: %s", s.schedule.Period, err)
+		}
+	}
+}
+
+// Send makes the digest of the events between start and end, see Make, and
+// sends it through the scheduler's notifier
+func (s *Scheduler) Send(ctx context.Context, start, end time.Time) error {
+	r, err := Make(ctx, s.records, s.media, start, end, s.opts)
+	if err != nil {
+		return err
+	}
+	return s.notifier.Notify(ctx, r)
+}
@@ -0,0 +1,352 @@
+// Package diskguard keeps the disk footage is recorded to from filling up.
+// Past a first threshold the oldest footage is pruned, and past a second
+// one clips stop being recorded while snapshots, and so notifications, carry
+// on, with an alert raised whenever the disk crosses either
+package diskguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/storage"
+	"github.com/adrianosela/GoAway/sysinfo"
+)
+
+const (
+	// DefaultInterval is the default interval the disk is checked at
+	DefaultInterval = 30 * time.Second
+
+	// DefaultPrune and DefaultStop are the default fractions of the disk
+	// used past which footage is pruned, and clips stop being recorded
+	DefaultPrune = 0.9
+	DefaultStop  = 0.97
+
+	// recordings is the prefix of the segments of continuous recordings,
+	// see clips.Continuous
+	recordings = "recordings/"
+
+	// segmentTime is the format of the start of segments in their names
+	segmentTime = "20060102T150405Z"
+)
+
+// ErrDiskFull is returned for clips which aren't recorded as the disk is
+// past the stop threshold
+var ErrDiskFull = errors.New("the recording disk is full, clips aren't recorded")
+
+// Level is how full the disk is
+type Level int
+
+// Levels
+const (
+	// LevelOK is below the thresholds
+	LevelOK Level = iota
+	// LevelPruning is past the prune threshold, which pruning couldn't get
+	// the disk back under, e.g. as all footage left is held
+	LevelPruning
+	// LevelFull is past the stop threshold, clips aren't recorded
+	LevelFull
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelPruning:
+		return "pruning"
+	case LevelFull:
+		return "full"
+	}
+	return "ok"
+}
+
+// Thresholds are the fractions of the disk used, from 0 to 1, past which
+// footage is pruned and clips stop being recorded, 0 disables either
+type Thresholds struct {
+	Prune float64 `json:"prune"`
+	Stop  float64 `json:"stop"`
+}
+
+// Alert is raised when the disk crosses a threshold, either way
+type Alert struct {
+	Level Level        `json:"level"`
+	Disk  sysinfo.Disk `json:"disk"`
+	// Pruned are the names of the records and segments pruned by the check
+	// which raised the alert
+	Pruned []string  `json:"pruned,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+func (a Alert) String() string {
+	return fmt.Sprintf("recording disk %s is %s, %.1f%% used, %d MB free", a.Disk.Path, a.Level, a.Disk.Used()*100, a.Disk.Free>>20)
+}
+
+// Guard is a Storage which keeps the disk of the directory it stores
+// footage in, e.g. that of a storage.Dir, from filling up, see Run
+type Guard struct {
+	storage.Storage
+	dir        string
+	thresholds Thresholds
+	interval   time.Duration
+	records    events.Store
+	onAlert    func(Alert)
+	// readDisk reads the usage of the disk of a directory
+	readDisk func(dir string) (sysinfo.Disk, error)
+
+	mu    sync.Mutex
+	level Level
+	disk  sysinfo.Disk
+	// open are the clips being written, which aren't pruned
+	open map[string]bool
+}
+
+// Option configures optional behaviour of a Guard
+type Option func(*Guard)
+
+// WithThresholds sets the thresholds, DefaultPrune and DefaultStop by
+// default
+func WithThresholds(t Thresholds) Option {
+	return func(g *Guard) {
+		g.thresholds = t
+	}
+}
+
+// WithInterval sets the interval the disk is checked at
+func WithInterval(interval time.Duration) Option {
+	return func(g *Guard) {
+		g.interval = interval
+	}
+}
+
+// WithEventStore prunes the records of the store, and their media, along
+// with the segments of continuous recordings, oldest first. Without it only
+// segments are pruned
+func WithEventStore(records events.Store) Option {
+	return func(g *Guard) {
+		g.records = records
+	}
+}
+
+// WithAlertHandler calls onAlert whenever the disk crosses a threshold,
+// either way, e.g. to notify that clips stopped being recorded. Alerts are
+// logged either way
+func WithAlertHandler(onAlert func(Alert)) Option {
+	return func(g *Guard) {
+		g.onAlert = onAlert
+	}
+}
+
+// NewGuard is the constructor for a Guard of the storage s, whose files
+// are stored in the directory dir
+func NewGuard(s storage.Storage, dir string, opts ...Option) *Guard {
+	g := &Guard{
+		Storage:    s,
+		dir:        dir,
+		thresholds: Thresholds{Prune: DefaultPrune, Stop: DefaultStop},
+		interval:   DefaultInterval,
+		readDisk:   sysinfo.ReadDisk,
+		open:       map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Level returns how full the disk was at the last check
+func (g *Guard) Level() Level {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.level
+}
+
+// Disk returns the usage of the disk at the last check
+func (g *Guard) Disk() sysinfo.Disk {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.disk
+}
+
+// PutClip implements storage.Storage, it returns ErrDiskFull while the disk
+// is past the stop threshold. Clips being written when the disk crosses it
+// end there: what is written to them after is dropped rather than failing
+// mid-event
+func (g *Guard) PutClip(name string) (storage.ObjectWriter, error) {
+	if g.Level() == LevelFull {
+		return nil, ErrDiskFull
+	}
+	f, err := g.Storage.PutClip(name)
+	if err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	g.open[name] = true
+	g.mu.Unlock()
+	return &clip{ObjectWriter: f, guard: g, name: name}, nil
+}
+
+// Run checks the disk at every interval until the context is done
+func (g *Guard) Run(ctx context.Context) error {
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := g.Check(time.Now()); err != nil {
+			log.Printf("could not check the recording disk: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check reads the usage of the disk, prunes footage past the prune
+// threshold until the disk is back under it, and returns how full the disk
+// is, raising an alert when that changed
+func (g *Guard) Check(now time.Time) (Level, error) {
+	disk, err := g.readDisk(g.dir)
+	if err != nil {
+		return g.Level(), err
+	}
+	pruned := []string{}
+	if g.past(disk, g.thresholds.Prune) {
+		disk, pruned, err = g.prune(disk)
+		if len(pruned) > 0 {
+			log.Printf("pruned %d oldest recordings off the recording disk %s", len(pruned), g.dir)
+		}
+	}
+	level := LevelOK
+	switch {
+	case g.past(disk, g.thresholds.Stop):
+		level = LevelFull
+	case g.past(disk, g.thresholds.Prune):
+		level = LevelPruning
+	}
+	g.mu.Lock()
+	changed := level != g.level
+	g.level, g.disk = level, disk
+	g.mu.Unlock()
+	if changed {
+		a := Alert{Level: level, Disk: disk, Pruned: pruned, Time: now}
+		log.Print(a)
+		if g.onAlert != nil {
+			g.onAlert(a)
+		}
+	}
+	return level, err
+}
+
+// past returns whether the disk is past a threshold
+func (g *Guard) past(disk sysinfo.Disk, threshold float64) bool {
+	return threshold > 0 && disk.Used() >= threshold
+}
+
+// footage is a record or segment which can be pruned
+type footage struct {
+	name    string
+	start   time.Time
+	record  *events.Record
+	segment string
+}
+
+// prune deletes the oldest footage until the disk is back under the prune
+// threshold, or until deleting footage frees nothing, e.g. as it is stored on
+// another disk, and returns its usage and what was deleted. Held records, the
+// segments they point into, and clips being written are kept, as are records
+// without media of their own, which deleting wouldn't free any space, and
+// records without a start, which can't be told to be old, see events.Remove
+func (g *Guard) prune(disk sysinfo.Disk) (sysinfo.Disk, []string, error) {
+	candidates := []footage{}
+	held := map[string]bool{}
+	if g.records != nil {
+		records, err := g.records.List()
+		if err != nil {
+			return disk, nil, err
+		}
+		for _, r := range records {
+			if r.Hold != nil {
+				for _, ref := range r.Recording {
+					held[ref.Segment] = true
+				}
+				continue
+			}
+			if len(r.Media) == 0 || r.Event.Start.IsZero() {
+				continue
+			}
+			candidates = append(candidates, footage{name: r.ID, start: r.Event.Start, record: r})
+		}
+	}
+	segments, err := g.Storage.List(recordings)
+	if err != nil && !errors.Is(err, os.ErrNotExist) && err != storage.ErrWriteOnly {
+		return disk, nil, err
+	}
+	g.mu.Lock()
+	for _, name := range segments {
+		start, err := time.Parse(segmentTime, strings.TrimSuffix(path.Base(name), path.Ext(name)))
+		if err != nil || held[name] || g.open[name] {
+			continue
+		}
+		candidates = append(candidates, footage{name: name, start: start, segment: name})
+	}
+	g.mu.Unlock()
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].start.Before(candidates[j].start) })
+	pruned := []string{}
+	for _, c := range candidates {
+		if c.record != nil {
+			err = events.Remove(g.records, g.Storage, c.record)
+		} else {
+			err = g.Storage.Delete(c.segment)
+		}
+		if err != nil {
+			return disk, pruned, err
+		}
+		pruned = append(pruned, c.name)
+		after, err := g.readDisk(g.dir)
+		if err != nil {
+			return disk, pruned, err
+		}
+		freed := after.Free > disk.Free
+		disk = after
+		if !freed {
+			log.Printf("pruning %s freed no space on the recording disk %s, pruning stopped", c.name, g.dir)
+			break
+		}
+		if !g.past(disk, g.thresholds.Prune) {
+			break
+		}
+	}
+	return disk, pruned, nil
+}
+
+// clip is a clip written through a Guard, which drops what is written to it
+// once the disk is full
+type clip struct {
+	storage.ObjectWriter
+	guard   *Guard
+	name    string
+	dropped bool
+}
+
+// Write implements io.Writer
+func (c *clip) Write(p []byte) (int, error) {
+	if c.dropped || c.guard.Level() == LevelFull {
+		c.dropped = true
+		return len(p), nil
+	}
+	return c.ObjectWriter.Write(p)
+}
+
+// Close implements io.Closer
+func (c *clip) Close() error {
+	c.guard.mu.Lock()
+	delete(c.guard.open, c.name)
+	c.guard.mu.Unlock()
+	return c.ObjectWriter.Close()
+}
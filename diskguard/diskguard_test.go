@@ -0,0 +1,201 @@
+package diskguard
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/storage"
+	"github.com/adrianosela/GoAway/sysinfo"
+)
+
+// fileSize is the size of every file of the tests
+const fileSize = 100
+
+// usedDisk reads a disk of the given size whose only files are those of the
+// directory
+func usedDisk(total uint64) func(dir string) (sysinfo.Disk, error) {
+	return func(dir string) (sysinfo.Disk, error) {
+		used := uint64(0)
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				used += uint64(info.Size())
+			}
+			return err
+		})
+		return sysinfo.Disk{Path: dir, Total: total, Free: total - used}, err
+	}
+}
+
+type fixture struct {
+	dir     string
+	media   *storage.Dir
+	records *events.DirStore
+	start   time.Time
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{dir: t.TempDir(), start: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var err error
+	if f.media, err = storage.NewDir(f.dir); err != nil {
+		t.Fatal(err)
+	}
+	if f.records, err = events.NewDirStore(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// segment writes the segment of a continuous recording starting minutes
+// after the fixture's start
+func (f *fixture) segment(t *testing.T, minutes int) string {
+	t.Helper()
+	name := recordings + f.start.Add(time.Duration(minutes)*time.Minute).Format(segmentTime) + ".mp4"
+	if _, err := f.media.WriteFile(name, make([]byte, fileSize)); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// record adds the record of an event starting minutes after the fixture's
+// start, with a snapshot of its own unless it points into segments
+func (f *fixture) record(t *testing.T, id string, minutes int, hold bool, segments ...string) {
+	t.Helper()
+	r := &events.Record{ID: id, Event: detector.Event{Start: f.start.Add(time.Duration(minutes) * time.Minute)}}
+	if hold {
+		r.Hold = &events.Hold{Reason: "incident"}
+	}
+	for _, s := range segments {
+		r.Recording = append(r.Recording, events.RecordingRef{Segment: s})
+	}
+	if len(segments) == 0 {
+		obj, err := f.media.WriteFile(id+".jpg", make([]byte, fileSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Media = []storage.Object{obj}
+	}
+	if err := f.records.Add(r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fixture) ids(t *testing.T) []string {
+	t.Helper()
+	records, err := f.records.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestPruneOldestFootage(t *testing.T) {
+	f := newFixture(t)
+	f.record(t, "oldest", 0, false)
+	held := f.segment(t, 1)
+	f.record(t, "held", 2, true, held)
+	f.segment(t, 3)
+	linked := f.segment(t, 4)
+	// points into a segment rather than owning media, deleting it alone
+	// frees nothing
+	f.record(t, "linked", 5, false, linked)
+	f.record(t, "newest", 6, false)
+	latest := f.segment(t, 7)
+
+	// 6 files of 100 bytes, 86% used, pruned down to under 50%
+	g := NewGuard(f.media, f.dir, WithEventStore(f.records), WithThresholds(Thresholds{Prune: 0.5, Stop: 0.9}))
+	g.readDisk = usedDisk(700)
+	alerts := []Alert{}
+	g.onAlert = func(a Alert) { alerts = append(alerts, a) }
+
+	level, err := g.Check(f.start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level != LevelOK {
+		t.Errorf("got level %s, want %s", level, LevelOK)
+	}
+	// OK is the initial level, so that no alert is raised
+	if len(alerts) != 0 {
+		t.Errorf("got alerts %v", alerts)
+	}
+	if g.Disk().Used() >= 0.5 {
+		t.Errorf("the disk is still %.0f%% used", g.Disk().Used()*100)
+	}
+
+	if want := []string{"held", "linked", "newest"}; !reflect.DeepEqual(f.ids(t), want) {
+		t.Errorf("got records %v left, want %v", f.ids(t), want)
+	}
+	files, err := f.media.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"newest.jpg", held, latest}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got files %v left, want %v", files, want)
+	}
+}
+
+func TestPruneKeepsOpenClips(t *testing.T) {
+	f := newFixture(t)
+	g := NewGuard(f.media, f.dir, WithThresholds(Thresholds{Prune: 0.5, Stop: 0.9}))
+	g.readDisk = usedDisk(150)
+	clip, err := g.PutClip(recordings + f.start.Format(segmentTime) + ".mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clip.Write(make([]byte, fileSize)); err != nil {
+		t.Fatal(err)
+	}
+	if level, err := g.Check(f.start); err != nil || level != LevelPruning {
+		t.Errorf("got level %s and error %v, want %s", level, err, LevelPruning)
+	}
+	if err := clip.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if level, err := g.Check(f.start); err != nil || level != LevelOK {
+		t.Errorf("got level %s and error %v once the clip was closed, want %s", level, err, LevelOK)
+	}
+}
+
+func TestPruneStopsWhenNothingIsFreed(t *testing.T) {
+	f := newFixture(t)
+	f.record(t, "oldest", 0, false)
+	f.record(t, "older", 1, false)
+	f.record(t, "newest", 2, false)
+
+	// the footage is stored on another disk than the one checked, which
+	// stays full whatever is deleted
+	g := NewGuard(f.media, f.dir, WithEventStore(f.records))
+	g.readDisk = func(dir string) (sysinfo.Disk, error) {
+		return sysinfo.Disk{Path: dir, Total: 1000, Free: 10}, nil
+	}
+	alerts := []Alert{}
+	g.onAlert = func(a Alert) { alerts = append(alerts, a) }
+
+	level, err := g.Check(f.start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level != LevelFull {
+		t.Errorf("got level %s, want %s", level, LevelFull)
+	}
+	if len(alerts) != 1 || !reflect.DeepEqual(alerts[0].Pruned, []string{"oldest"}) {
+		t.Errorf("got alerts %v, want one for pruning only the oldest record", alerts)
+	}
+	if want := []string{"older", "newest"}; !reflect.DeepEqual(f.ids(t), want) {
+		t.Errorf("got records %v left, want %v", f.ids(t), want)
+	}
+	if _, err := g.PutClip("clip.mp4"); err != ErrDiskFull {
+		t.Errorf("got error %v for a clip on a full disk, want %v", err, ErrDiskFull)
+	}
+}
@@ -0,0 +1,70 @@
+// Package eventlog writes event records to syslog or the systemd journal in
+// a structured format, for setups which centralize alerts in their existing
+// log pipeline rather than running another service
+package eventlog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrianosela/GoAway/events"
+)
+
+// DefaultTag is the default tag, or syslog identifier, events are logged with
+const DefaultTag = "goaway"
+
+// field is a named value describing an event
+type field struct {
+	name, value string
+}
+
+// fields returns the fields describing a record, empty ones are left out
+func fields(r *events.Record) []field {
+	e := r.Event
+	fs := []field{
+		{"id", r.ID},
+		{"camera", r.Camera},
+		{"cameras", strings.Join(r.Cameras, ",")},
+		{"journey", r.Journey},
+		{"start", e.Start.UTC().Format(time.RFC3339Nano)},
+		{"end", e.End.UTC().Format(time.RFC3339Nano)},
+		{"duration", e.End.Sub(e.Start).String()},
+		{"confidence", strconv.FormatFloat(e.Confidence, 'f', 2, 64)},
+		{"bounds", e.Bounds.String()},
+		{"reason", e.Reason},
+	}
+	if len(e.Plates) > 0 {
+		fs = append(fs, field{"plate", e.Plates[0].Text})
+	}
+	if len(r.Media) > 0 {
+		names := []string{}
+		for _, obj := range r.Media {
+			names = append(names, obj.Name)
+		}
+		fs = append(fs, field{"media", strings.Join(names, ",")})
+	}
+	kept := fs[:0]
+	for _, f := range fs {
+		if f.value != "" {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// logfmt formats fields as key=value pairs, quoting values when needed, e.g.
+// event id=20240101T101000Z-1a2b3c4d camera=front-door duration=4.2s
+func logfmt(fs []field) string {
+	b := &strings.Builder{}
+	b.WriteString("event")
+	for _, f := range fs {
+		v := f.value
+		if strings.ContainsAny(v, " =\"\\\n") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(b, " %s=%s", f.name, v)
+	}
+	return b.String()
+}
@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package eventlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+
+	"github.com/adrianosela/GoAway/events"
+)
+
+// journalSocket is where journald receives entries in its native protocol
+const journalSocket = "/run/systemd/journal/socket"
+
+// Journald logs events to the systemd journal, each field of an event is a
+// field of its entry, prefixed with GOAWAY_, e.g. GOAWAY_CAMERA, so that
+// entries can be filtered with journalctl GOAWAY_CAMERA=front-door
+type Journald struct {
+	conn *net.UnixConn
+	tag  string
+}
+
+// NewJournald is the constructor for a Journald, entries are logged with the
+// given syslog identifier
+func NewJournald(tag string) (*Journald, error) {
+	if tag == "" {
+		tag = DefaultTag
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &Journald{conn: conn, tag: tag}, nil
+}
+
+// Log logs the record of an event
+func (j *Journald) Log(r *events.Record) error {
+	fs := fields(r)
+	entry := &bytes.Buffer{}
+	writeJournalField(entry, "MESSAGE", logfmt(fs))
+	writeJournalField(entry, "PRIORITY", "5")
+	writeJournalField(entry, "SYSLOG_IDENTIFIER", j.tag)
+	for _, f := range fs {
+		writeJournalField(entry, "GOAWAY_"+strings.ToUpper(f.name), f.value)
+	}
+	_, err := j.conn.Write(entry.Bytes())
+	return err
+}
+
+// writeJournalField writes a field of an entry in journald's native
+// protocol, values with newlines are written with their length
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name + "=" + value + "\n")
+		return
+	}
+	b.WriteString(name + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
+
+// Close closes the connection to journald
+func (j *Journald) Close() error {
+	return j.conn.Close()
+}
@@ -0,0 +1,40 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package eventlog
+
+import (
+	"log/syslog"
+
+	"github.com/adrianosela/GoAway/events"
+)
+
+// Syslog logs events to a syslog server
+type Syslog struct {
+	w *syslog.Writer
+}
+
+// NewSyslog is the constructor for a Syslog logging to the given server,
+// e.g. "udp" and "logserver.local:514", or to the local syslog daemon when
+// the network and address are empty. Events are logged with the daemon
+// facility and notice priority, as key=value pairs
+func NewSyslog(network, raddr, tag string) (*Syslog, error) {
+	if tag == "" {
+		tag = DefaultTag
+	}
+	w, err := syslog.Dial(network, raddr, syslog.LOG_NOTICE|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &Syslog{w: w}, nil
+}
+
+// Log logs the record of an event
+func (s *Syslog) Log(r *events.Record) error {
+	return s.w.Notice(logfmt(fields(r)))
+}
+
+// Close closes the connection to the syslog server
+func (s *Syslog) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,137 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+)
+
+// Deduplicator merges the near-simultaneous events of cameras with
+// overlapping fields of view into a single logical event, so that one person
+// walking through a hallway covered by two cameras is only reported once
+type Deduplicator struct {
+	mu      sync.Mutex
+	window  time.Duration
+	groups  map[string]string
+	pending map[string]*pendingRecord
+	emit    func(*Record)
+}
+
+// pendingRecord is a merged record waiting for more events of its group
+type pendingRecord struct {
+	r     *Record
+	timer *time.Timer
+}
+
+// NewDeduplicator is the constructor for a Deduplicator. Events of grouped
+// cameras which start within the window of the end of another event of the
+// group are merged with it, and the merged record is passed to emit once the
+// window has passed without more events. Events of other cameras are passed
+// on straight away
+func NewDeduplicator(window time.Duration, emit func(*Record)) *Deduplicator {
+	return &Deduplicator{
+		window:  window,
+		groups:  map[string]string{},
+		pending: map[string]*pendingRecord{},
+		emit:    emit,
+	}
+}
+
+// Group groups cameras with overlapping fields of view under a name, which
+// becomes the camera of their merged records
+func (d *Deduplicator) Group(name string, cameras ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range cameras {
+		d.groups[c] = name
+	}
+}
+
+// Add adds the record of an event which ended
+func (d *Deduplicator) Add(r *Record) {
+	d.mu.Lock()
+	group, ok := d.groups[r.Camera]
+	if !ok {
+		d.mu.Unlock()
+		d.emit(r)
+		return
+	}
+	var done *Record
+	p := d.pending[group]
+	if p != nil && !r.Event.Start.After(p.r.Event.End.Add(d.window)) && p.timer.Stop() {
+		merge(p.r, r)
+	} else {
+		if p != nil && p.timer.Stop() {
+			done = p.r
+		}
+		p = &pendingRecord{r: &Record{
+			ID:      r.ID,
+			Camera:  group,
+			Cameras: []string{r.Camera},
+			Event:   r.Event,
+			Media:   r.Media,
+		}}
+		d.pending[group] = p
+	}
+	p.timer = time.AfterFunc(d.window, func() { d.release(group, p) })
+	d.mu.Unlock()
+	if done != nil {
+		d.emit(done)
+	}
+}
+
+// release emits a pending record once its window has passed
+func (d *Deduplicator) release(group string, p *pendingRecord) {
+	d.mu.Lock()
+	if d.pending[group] == p {
+		delete(d.pending, group)
+	}
+	d.mu.Unlock()
+	d.emit(p.r)
+}
+
+// Flush emits all pending records without waiting for their window to pass,
+// e.g. when shutting down
+func (d *Deduplicator) Flush() {
+	d.mu.Lock()
+	done := []*Record{}
+	for group, p := range d.pending {
+		if p.timer.Stop() {
+			done = append(done, p.r)
+		}
+		delete(d.pending, group)
+	}
+	d.mu.Unlock()
+	for _, r := range done {
+		d.emit(r)
+	}
+}
+
+// merge merges the record of an event into a logical event, frame numbers
+// and bounds remain those of the first camera's event as they aren't
+// comparable across cameras
+func merge(into, r *Record) {
+	found := false
+	for _, c := range into.Cameras {
+		found = found || c == r.Camera
+	}
+	if !found {
+		into.Cameras = append(into.Cameras, r.Camera)
+	}
+	mergeEvent(&into.Event, r.Event)
+	into.Media = append(into.Media, r.Media...)
+}
+
+// mergeEvent extends an event to span another one
+func mergeEvent(into *detector.Event, e detector.Event) {
+	if e.Start.Before(into.Start) {
+		into.Start = e.Start
+	}
+	if e.End.After(into.End) {
+		into.End = e.End
+	}
+	if e.MaxArea > into.MaxArea {
+		into.MaxArea = e.MaxArea
+	}
+}
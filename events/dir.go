@@ -0,0 +1,122 @@
+package events
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DirStore is a Store which keeps each record as a JSON file in a directory
+type DirStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewDirStore is the constructor for a DirStore, the directory is created
+// if it doesn't exist
+func NewDirStore(path string) (*DirStore, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+	return &DirStore{path: path}, nil
+}
+
+func (s *DirStore) recordPath(id string) string {
+	return filepath.Join(s.path, id+".json")
+}
+
+// Add stores a new record, assigning its ID if it has none, or replaces the
+// record with the same ID
+func (s *DirStore) Add(r *Record) error {
+	if r.ID == "" {
+		r.ID = NewID(r.Event.Start)
+	}
+	if r.Camera == "" && r.Event.Camera != nil {
+		r.Camera = r.Event.Camera.ID
+	}
+	if !validID(r.ID) {
+		return ErrInvalidID
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// write to a temporary file first so records are never half written
+	tmp := s.recordPath(r.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.recordPath(r.ID))
+}
+
+// Get returns the record with the given ID
+func (s *DirStore) Get(id string) (*Record, error) {
+	if !validID(id) {
+		return nil, ErrInvalidID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(s.recordPath(id))
+}
+
+// Delete removes the record with the given ID
+func (s *DirStore) Delete(id string) error {
+	if !validID(id) {
+		return ErrInvalidID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.recordPath(id))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *DirStore) read(path string) (*Record, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &Record{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// List returns all records, oldest first
+func (s *DirStore) List() ([]*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+	records := []*Record{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		r, err := s.read(filepath.Join(s.path, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].Event.Start.Equal(records[j].Event.Start) {
+			return records[i].Event.Start.Before(records[j].Event.Start)
+		}
+		return records[i].ID < records[j].ID
+	})
+	return records, nil
+}
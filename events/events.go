@@ -0,0 +1,128 @@
+// Package events keeps records of detected events along with the media,
+// such as snapshots and clips, stored for them
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+var (
+	// ErrNotFound is returned when there is no record with a given ID
+	ErrNotFound = errors.New("event not found")
+
+	// ErrInvalidID is returned for IDs which could not have been assigned
+	// by NewID
+	ErrInvalidID = errors.New("invalid event ID")
+)
+
+var idPattern = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+// Record is the stored record of an event
+type Record struct {
+	ID string `json:"id"`
+	// Camera is the name of the camera the event was detected by, if the
+	// deployment has more than one, the ID of its identity by default
+	Camera string `json:"camera,omitempty"`
+	// Cameras are the cameras whose events were merged into this one, when
+	// cameras with overlapping fields of view are grouped (see Deduplicator)
+	Cameras []string `json:"cameras,omitempty"`
+	// Journey is the ID of the journey across cameras the event is part of,
+	// when the cameras' topology is tracked (see Tracker)
+	Journey string           `json:"journey,omitempty"`
+	Event   detector.Event   `json:"event"`
+	Media   []storage.Object `json:"media,omitempty"`
+	// Recording points into the segments of a continuous recording the
+	// event was recorded in, instead of it having a clip of its own
+	Recording []RecordingRef `json:"recording,omitempty"`
+	// FalsePositive is set when a user marked the event as not being
+	// motion of interest, e.g. swaying branches, see SetFalsePositive
+	FalsePositive bool `json:"false_positive,omitempty"`
+	// Retention is the record's retention class, e.g. as tagged by rules,
+	// which decides how long it is kept for, see Retention
+	Retention string `json:"retention,omitempty"`
+	// Hold keeps the record, and its media, from being deleted once its
+	// retention expired until it is released, see SetHold
+	Hold *Hold `json:"hold,omitempty"`
+	// Summary is set on the records of digests, which summarize the events
+	// of a period rather than being one, see the digest package
+	Summary *Summary `json:"summary,omitempty"`
+}
+
+// Hold is a legal hold on a record, e.g. because its footage is relevant to
+// an incident report
+type Hold struct {
+	// Reason is why the record is held, e.g. the number of the report
+	Reason string `json:"reason,omitempty"`
+	// By is who placed the hold
+	By    string    `json:"by,omitempty"`
+	Since time.Time `json:"since"`
+}
+
+// RecordingRef is where in a segment of a continuous recording an event is
+type RecordingRef struct {
+	// Segment is the name of the segment in its storage
+	Segment  string        `json:"segment"`
+	Offset   time.Duration `json:"offset"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Store persists event records
+type Store interface {
+	// Add stores a new record, assigning its ID if it has none and its
+	// camera from the event's camera identity, or replaces the record with
+	// the same ID
+	Add(r *Record) error
+	// Get returns the record with the given ID
+	Get(id string) (*Record, error)
+	// List returns all records, oldest first
+	List() ([]*Record, error)
+	// Delete removes the record with the given ID
+	Delete(id string) error
+}
+
+// SetFalsePositive marks the record with the given ID as a false positive,
+// or clears the mark, and returns the updated record
+func SetFalsePositive(s Store, id string, falsePositive bool) (*Record, error) {
+	r, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	r.FalsePositive = falsePositive
+	if err := s.Add(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetHold places a legal hold on the record with the given ID, or releases
+// it when nil, and returns the updated record
+func SetHold(s Store, id string, hold *Hold) (*Record, error) {
+	r, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	r.Hold = hold
+	if err := s.Add(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewID returns a new record ID, which sorts by the given time
+func NewID(t time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return t.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+// validID returns whether an ID is safe to use, e.g. as a file name
+func validID(id string) bool {
+	return idPattern.MatchString(id)
+}
@@ -0,0 +1,201 @@
+package events
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Edge is an edge of a camera's frame
+type Edge int
+
+// Edges of a frame
+const (
+	NoEdge Edge = iota
+	Left
+	Right
+	Top
+	Bottom
+)
+
+func (e Edge) String() string {
+	switch e {
+	case Left:
+		return "left"
+	case Right:
+		return "right"
+	case Top:
+		return "top"
+	case Bottom:
+		return "bottom"
+	}
+	return "none"
+}
+
+// edgeMargin is the fraction of a frame's width or height within which
+// motion is considered to touch the frame's edge
+const edgeMargin = 0.05
+
+// touchedEdge returns the edge of the frame which motion touches, if any,
+// the nearest one when it touches several
+func touchedEdge(bounds image.Rectangle, frame image.Point) Edge {
+	if bounds.Empty() || frame.X == 0 || frame.Y == 0 {
+		return NoEdge
+	}
+	best, bestDist := NoEdge, 1.0
+	for _, c := range []struct {
+		edge Edge
+		dist float64
+	}{
+		{Left, float64(bounds.Min.X) / float64(frame.X)},
+		{Right, float64(frame.X-bounds.Max.X) / float64(frame.X)},
+		{Top, float64(bounds.Min.Y) / float64(frame.Y)},
+		{Bottom, float64(frame.Y-bounds.Max.Y) / float64(frame.Y)},
+	} {
+		if c.dist <= edgeMargin && c.dist < bestDist {
+			best, bestDist = c.edge, c.dist
+		}
+	}
+	return best
+}
+
+// Link is a connection in the camera topology: whatever leaves camera From
+// through its Exit edge reaches camera To through its Entry edge, within
+// MaxTransit. An Entry of NoEdge matches motion entering anywhere
+type Link struct {
+	From       string
+	Exit       Edge
+	To         string
+	Entry      Edge
+	MaxTransit time.Duration
+}
+
+// Leg is the part of a journey seen by one camera
+type Leg struct {
+	Camera  string    `json:"camera"`
+	EventID string    `json:"event_id"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	exit    Edge
+}
+
+// Journey is the path of something tracked across cameras
+type Journey struct {
+	ID   string `json:"id"`
+	Legs []Leg  `json:"legs"`
+}
+
+// String describes the journey, e.g. "entered via gate at 02:13:10, reached
+// door at 02:13:45"
+func (j *Journey) String() string {
+	parts := make([]string, len(j.Legs))
+	for i, l := range j.Legs {
+		verb := "reached"
+		if i == 0 {
+			verb = "entered via"
+		}
+		parts[i] = fmt.Sprintf("%s %s at %s", verb, l.Camera, l.Start.Format("15:04:05"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func newLeg(r *Record) Leg {
+	return Leg{
+		Camera:  r.Camera,
+		EventID: r.ID,
+		Start:   r.Event.Start,
+		End:     r.Event.End,
+		exit:    touchedEdge(r.Event.EndBounds, r.Event.FrameSize),
+	}
+}
+
+// JourneyOf rebuilds a journey from the event history, nil if none of the
+// records are part of it
+func JourneyOf(records []*Record, id string) *Journey {
+	var j *Journey
+	for _, r := range records {
+		if r.Journey != id {
+			continue
+		}
+		if j == nil {
+			j = &Journey{ID: id}
+		}
+		j.Legs = append(j.Legs, newLeg(r))
+	}
+	return j
+}
+
+// Tracker stitches the events of cameras linked in a topology into journeys
+type Tracker struct {
+	mu       sync.Mutex
+	links    []Link
+	journeys []*Journey
+}
+
+// NewTracker is the constructor for a Tracker
+func NewTracker(links ...Link) *Tracker {
+	return &Tracker{links: links}
+}
+
+// Add adds the record of an event which ended, it is appended to the journey
+// of an event on a linked camera which left towards it, or starts a new
+// journey. The record's Journey is set to the journey's ID
+func (t *Tracker) Add(r *Record) *Journey {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry := touchedEdge(r.Event.StartBounds, r.Event.FrameSize)
+	leg := newLeg(r)
+	j := t.continued(r.Camera, entry, r.Event.Start)
+	if j == nil {
+		id := r.ID
+		if id == "" {
+			id = NewID(r.Event.Start)
+		}
+		j = &Journey{ID: id}
+		t.journeys = append(t.journeys, j)
+	}
+	j.Legs = append(j.Legs, leg)
+	r.Journey = j.ID
+	t.expire(r.Event.Start)
+	return j
+}
+
+// continued returns the most recent journey which an event entering the
+// camera through the given edge at the given time continues, if any
+func (t *Tracker) continued(camera string, entry Edge, start time.Time) *Journey {
+	for i := len(t.journeys) - 1; i >= 0; i-- {
+		j := t.journeys[i]
+		last := j.Legs[len(j.Legs)-1]
+		for _, l := range t.links {
+			if l.From != last.Camera || l.To != camera || l.Exit != last.exit {
+				continue
+			}
+			if l.Entry != NoEdge && l.Entry != entry {
+				continue
+			}
+			if transit := start.Sub(last.End); transit >= 0 && transit <= l.MaxTransit {
+				return j
+			}
+		}
+	}
+	return nil
+}
+
+// expire forgets the journeys which can no longer be continued
+func (t *Tracker) expire(now time.Time) {
+	maxTransit := time.Duration(0)
+	for _, l := range t.links {
+		if l.MaxTransit > maxTransit {
+			maxTransit = l.MaxTransit
+		}
+	}
+	kept := t.journeys[:0]
+	for _, j := range t.journeys {
+		if now.Sub(j.Legs[len(j.Legs)-1].End) <= maxTransit {
+			kept = append(kept, j)
+		}
+	}
+	t.journeys = kept
+}
@@ -0,0 +1,134 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/adrianosela/GoAway/storage"
+)
+
+// DefaultCleanupInterval is the default interval a Cleaner deletes expired
+// records at
+const DefaultCleanupInterval = time.Hour
+
+// ErrNoStart is returned when removing a record whose event has no start,
+// as how old it is, and so whether it expired, is unknown
+var ErrNoStart = errors.New("event has no start, its age is unknown")
+
+// Retention is how long records, and their media, are kept for
+type Retention struct {
+	// Default is how long records without a retention class, or of a class
+	// which isn't listed, are kept for, forever when 0
+	Default time.Duration `json:"default,omitempty"`
+	// Classes are how long the records of each retention class are kept
+	// for, see Record.Retention, forever when 0
+	Classes map[string]time.Duration `json:"classes,omitempty"`
+}
+
+// Expires returns when a record expires, by the start of its event, and
+// false when it is kept forever, as are records whose event has no start
+func (p Retention) Expires(r *Record) (time.Time, bool) {
+	if r.Event.Start.IsZero() {
+		return time.Time{}, false
+	}
+	keep, ok := p.Classes[r.Retention]
+	if !ok {
+		keep = p.Default
+	}
+	if keep <= 0 {
+		return time.Time{}, false
+	}
+	return r.Event.Start.Add(keep), true
+}
+
+// Cleaner deletes the records whose retention expired, along with their
+// media, unless they are held (see SetHold). The segments of continuous
+// recordings records point into are shared between records, and aren't
+// deleted
+type Cleaner struct {
+	store     Store
+	media     storage.Storage
+	retention Retention
+	interval  time.Duration
+}
+
+// CleanerOption configures optional behaviour of a Cleaner
+type CleanerOption func(*Cleaner)
+
+// WithCleanupInterval sets the interval the cleaner deletes expired records
+// at
+func WithCleanupInterval(interval time.Duration) CleanerOption {
+	return func(c *Cleaner) {
+		c.interval = interval
+	}
+}
+
+// NewCleaner is the constructor for a Cleaner of the records of a store and
+// their media in the given storage, by the given retention
+func NewCleaner(store Store, media storage.Storage, retention Retention, opts ...CleanerOption) *Cleaner {
+	c := &Cleaner{store: store, media: media, retention: retention, interval: DefaultCleanupInterval}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Clean deletes the records which expired by the given time, and their
+// media, and returns them, see Remove
+func (c *Cleaner) Clean(now time.Time) ([]*Record, error) {
+	records, err := c.store.List()
+	if err != nil {
+		return nil, err
+	}
+	deleted := []*Record{}
+	for _, r := range records {
+		expires, ok := c.retention.Expires(r)
+		if !ok || now.Before(expires) || r.Hold != nil {
+			continue
+		}
+		if err := Remove(c.store, c.media, r); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, r)
+	}
+	return deleted, nil
+}
+
+// Remove deletes a record from a store, and its media from the storage it
+// was saved to. The record is only deleted once all its media is, so that
+// its media is retried rather than left behind. Records whose event has no
+// start aren't deleted, see ErrNoStart
+func Remove(store Store, media storage.Storage, r *Record) error {
+	if r.Event.Start.IsZero() {
+		return fmt.Errorf("could not delete event %s: %w", r.ID, ErrNoStart)
+	}
+	for _, m := range r.Media {
+		if err := media.Delete(m.Name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not delete %s of event %s: %w", m.Name, r.ID, err)
+		}
+	}
+	if err := store.Delete(r.ID); err != nil && err != ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// Run deletes expired records at every interval until the context is done
+func (c *Cleaner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if _, err := c.Clean(now); err != nil {
+				log.Printf("could not delete expired events: %s", err)
+			}
+		}
+	}
+}
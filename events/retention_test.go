@@ -0,0 +1,195 @@
+package events_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newStores returns a store of records and the storage of their media
+func newStores(t *testing.T) (*events.DirStore, *storage.Dir) {
+	t.Helper()
+	records, err := events.NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	media, err := storage.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records, media
+}
+
+// add adds a record of an event starting at the given time, with a snapshot
+func add(t *testing.T, records events.Store, media *storage.Dir, id, class string, at time.Time) *events.Record {
+	t.Helper()
+	obj, err := media.WriteFile(id+".jpg", []byte(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &events.Record{ID: id, Retention: class, Event: detector.Event{Start: at}, Media: []storage.Object{obj}}
+	if err := records.Add(r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func ids(records []*events.Record) []string {
+	ids := []string{}
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestRetentionExpires(t *testing.T) {
+	retention := events.Retention{
+		Default: 24 * time.Hour,
+		Classes: map[string]time.Duration{"person": 90 * 24 * time.Hour, "evidence": 0},
+	}
+	tests := []struct {
+		record  events.Record
+		expires time.Time
+		ok      bool
+	}{
+		{events.Record{Event: detector.Event{Start: start}}, start.Add(24 * time.Hour), true},
+		{events.Record{Retention: "vehicle", Event: detector.Event{Start: start}}, start.Add(24 * time.Hour), true},
+		{events.Record{Retention: "person", Event: detector.Event{Start: start}}, start.Add(90 * 24 * time.Hour), true},
+		{events.Record{Retention: "evidence", Event: detector.Event{Start: start}}, time.Time{}, false},
+		{events.Record{}, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		expires, ok := retention.Expires(&tt.record)
+		if !expires.Equal(tt.expires) || ok != tt.ok {
+			t.Errorf("class %q: got %s, %v, want %s, %v", tt.record.Retention, expires, ok, tt.expires, tt.ok)
+		}
+	}
+	if _, ok := (events.Retention{}).Expires(&events.Record{Event: detector.Event{Start: start}}); ok {
+		t.Error("records expire without a default retention")
+	}
+}
+
+func TestCleanRetentionBoundaries(t *testing.T) {
+	records, media := newStores(t)
+	add(t, records, media, "default", "", start)
+	add(t, records, media, "person", "person", start)
+	add(t, records, media, "evidence", "evidence", start)
+	add(t, records, media, "later", "", start.Add(time.Hour))
+	c := events.NewCleaner(records, media, events.Retention{
+		Default: time.Hour,
+		Classes: map[string]time.Duration{"person": 2 * time.Hour, "evidence": 0},
+	})
+
+	steps := []struct {
+		now  time.Time
+		want []string
+	}{
+		{start, []string{}},
+		{start.Add(time.Hour - time.Nanosecond), []string{}},
+		// records expire at the end of their retention, not after it
+		{start.Add(time.Hour), []string{"default"}},
+		{start.Add(time.Hour), []string{}},
+		{start.Add(2 * time.Hour), []string{"person", "later"}},
+		{start.Add(10000 * time.Hour), []string{}},
+	}
+	for _, s := range steps {
+		deleted, err := c.Clean(s.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ids(deleted), s.want) {
+			t.Errorf("at %s: got deleted %v, want %v", s.now.Sub(start), ids(deleted), s.want)
+		}
+	}
+
+	left, err := records.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"evidence"}; !reflect.DeepEqual(ids(left), want) {
+		t.Errorf("got records %v left, want %v", ids(left), want)
+	}
+	files, err := media.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"evidence.jpg"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("got media %v left, want %v", files, want)
+	}
+}
+
+func TestCleanKeepsHeldRecords(t *testing.T) {
+	records, media := newStores(t)
+	add(t, records, media, "held", "", start)
+	add(t, records, media, "other", "", start)
+	if _, err := events.SetHold(records, "held", &events.Hold{Reason: "report 42"}); err != nil {
+		t.Fatal(err)
+	}
+	c := events.NewCleaner(records, media, events.Retention{Default: time.Hour})
+
+	deleted, err := c.Clean(start.Add(48 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"other"}; !reflect.DeepEqual(ids(deleted), want) {
+		t.Errorf("got deleted %v, want %v", ids(deleted), want)
+	}
+	if _, err := media.ReadFile("held.jpg"); err != nil {
+		t.Errorf("the media of the held record was deleted: %s", err)
+	}
+
+	// released records are deleted at the next cleanup once expired
+	if _, err := events.SetHold(records, "held", nil); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err = c.Clean(start.Add(48 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"held"}; !reflect.DeepEqual(ids(deleted), want) {
+		t.Errorf("got deleted %v once released, want %v", ids(deleted), want)
+	}
+}
+
+func TestCleanSkipsRecordsWithoutStart(t *testing.T) {
+	records, media := newStores(t)
+	r := add(t, records, media, "unknown", "", time.Time{})
+	c := events.NewCleaner(records, media, events.Retention{Default: time.Nanosecond})
+	deleted, err := c.Clean(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("got deleted %v", ids(deleted))
+	}
+	if err := events.Remove(records, media, r); !errors.Is(err, events.ErrNoStart) {
+		t.Errorf("got error %v removing it, want %v", err, events.ErrNoStart)
+	}
+	if _, err := records.Get("unknown"); err != nil {
+		t.Errorf("the record was deleted: %s", err)
+	}
+	if _, err := media.ReadFile("unknown.jpg"); err != nil {
+		t.Errorf("the media of the record was deleted: %s", err)
+	}
+}
+
+func TestRemoveIgnoresMissingMedia(t *testing.T) {
+	records, media := newStores(t)
+	r := add(t, records, media, "gone", "", start)
+	if err := media.Delete("gone.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := events.Remove(records, media, r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := records.Get("gone"); err != events.ErrNotFound {
+		t.Errorf("got error %v getting the removed record, want %v", err, events.ErrNotFound)
+	}
+}
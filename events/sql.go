@@ -0,0 +1,168 @@
+package events
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Dialect is the dialect of SQL spoken by a database
+type Dialect int
+
+// Dialects supported by SQLStore
+const (
+	Postgres Dialect = iota
+	MySQL
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case Postgres:
+		return "postgres"
+	case MySQL:
+		return "mysql"
+	}
+	return "unknown"
+}
+
+// sqlTable is the table SQLStore keeps records in
+const sqlTable = "goaway_events"
+
+// SQLStore is a Store which keeps records in a PostgreSQL or MySQL database,
+// e.g. for the central server of deployments with many detectors. Records are
+// kept as JSON along with the columns they are looked up and sorted by
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewSQLStore is the constructor for an SQLStore in the given database, which
+// must have been opened with a driver for the dialect, e.g. github.com/lib/pq
+// or github.com/go-sql-driver/mysql. The table is created if it doesn't exist
+func NewSQLStore(db *sql.DB, dialect Dialect) (*SQLStore, error) {
+	var schema string
+	switch dialect {
+	case Postgres:
+		schema = `CREATE TABLE IF NOT EXISTS ` + sqlTable + ` (
+	id VARCHAR(64) PRIMARY KEY,
+	camera VARCHAR(255) NOT NULL,
+	start_time TIMESTAMPTZ NOT NULL,
+	record TEXT NOT NULL
+)`
+	case MySQL:
+		schema = `CREATE TABLE IF NOT EXISTS ` + sqlTable + ` (
+	id VARCHAR(64) PRIMARY KEY,
+	camera VARCHAR(255) NOT NULL,
+	start_time DATETIME(6) NOT NULL,
+	record LONGTEXT NOT NULL,
+	INDEX (start_time, id)
+)`
+	default:
+		return nil, fmt.Errorf("unsupported SQL dialect %s", dialect)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("could not create %s table: %w", sqlTable, err)
+	}
+	if dialect == Postgres {
+		if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS ` + sqlTable + `_start ON ` + sqlTable + ` (start_time, id)`); err != nil {
+			return nil, fmt.Errorf("could not index %s table: %w", sqlTable, err)
+		}
+	}
+	return &SQLStore{db: db, dialect: dialect}, nil
+}
+
+// Add stores a new record, assigning its ID if it has none, or replaces the
+// record with the same ID
+func (s *SQLStore) Add(r *Record) error {
+	if r.ID == "" {
+		r.ID = NewID(r.Event.Start)
+	}
+	if r.Camera == "" && r.Event.Camera != nil {
+		r.Camera = r.Event.Camera.ID
+	}
+	if !validID(r.ID) {
+		return ErrInvalidID
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO ` + sqlTable + ` (id, camera, start_time, record) VALUES ($1, $2, $3, $4)
+ON CONFLICT (id) DO UPDATE SET camera = EXCLUDED.camera, start_time = EXCLUDED.start_time, record = EXCLUDED.record`
+	if s.dialect == MySQL {
+		query = `INSERT INTO ` + sqlTable + ` (id, camera, start_time, record) VALUES (?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE camera = VALUES(camera), start_time = VALUES(start_time), record = VALUES(record)`
+	}
+	_, err = s.db.Exec(query, r.ID, r.Camera, r.Event.Start.UTC(), string(data))
+	return err
+}
+
+// Get returns the record with the given ID
+func (s *SQLStore) Get(id string) (*Record, error) {
+	if !validID(id) {
+		return nil, ErrInvalidID
+	}
+	var data string
+	err := s.db.QueryRow(`SELECT record FROM `+sqlTable+` WHERE id = `+s.placeholder(1), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := &Record{}
+	if err := json.Unmarshal([]byte(data), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// List returns all records, oldest first
+func (s *SQLStore) List() ([]*Record, error) {
+	rows, err := s.db.Query(`SELECT record FROM ` + sqlTable + ` ORDER BY start_time, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := []*Record{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		r := &Record{}
+		if err := json.Unmarshal([]byte(data), r); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// Delete removes the record with the given ID
+func (s *SQLStore) Delete(id string) error {
+	if !validID(id) {
+		return ErrInvalidID
+	}
+	res, err := s.db.Exec(`DELETE FROM `+sqlTable+` WHERE id = `+s.placeholder(1), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// placeholder returns the placeholder of the nth parameter of a query
+func (s *SQLStore) placeholder(n int) string {
+	if s.dialect == MySQL {
+		return "?"
+	}
+	return fmt.Sprintf("$%d", n)
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+)
+
+// Summary summarizes the events of a period, e.g. a day, for the records of
+// digests, see Record.Summary
+type Summary struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Events int       `json:"events"`
+	// Zones are the number of events in each zone, an event overlapping
+	// several is counted in each, and Cameras the number of events of each
+	// camera
+	Zones   map[string]int `json:"zones"`
+	Cameras map[string]int `json:"cameras"`
+	// Classes are the number of events of each object class, e.g. vehicles
+	// and pedestrians, see detector.WithVehicleClassification
+	Classes map[string]int `json:"classes"`
+	// Hours are the number of events which started in each hour of the day,
+	// in local time, and BusiestHour the hour most did, -1 without events
+	Hours       [24]int `json:"hours"`
+	BusiestHour int     `json:"busiest_hour"`
+}
+
+// Summarize summarizes the records of the events which started between
+// start and end, the names of the given zones which events overlap are the
+// zones they are counted in. False positives, events detected in dry run
+// mode and the records of other digests aren't counted
+func Summarize(records []*Record, start, end time.Time, zones ...detector.Zone) *Summary {
+	s := &Summary{Start: start, End: end, Zones: map[string]int{}, Cameras: map[string]int{}, Classes: map[string]int{}, BusiestHour: -1}
+	for _, r := range Summarized(records, start, end) {
+		s.Events++
+		if r.Camera != "" {
+			s.Cameras[r.Camera]++
+		}
+		if r.Event.Class != detector.ClassUnknown {
+			s.Classes[string(r.Event.Class)]++
+		}
+		hour := r.Event.Start.Local().Hour()
+		s.Hours[hour]++
+		if s.BusiestHour < 0 || s.Hours[hour] > s.Hours[s.BusiestHour] {
+			s.BusiestHour = hour
+		}
+		for _, z := range zones {
+			if z.Name != "" && z.Bounds.Overlaps(r.Event.Bounds) {
+				s.Zones[z.Name]++
+			}
+		}
+	}
+	return s
+}
+
+// Summarized returns the records Summarize counts
+func Summarized(records []*Record, start, end time.Time) []*Record {
+	kept := []*Record{}
+	for _, r := range records {
+		e := r.Event
+		if r.FalsePositive || e.DryRun || r.Summary != nil || e.Start.Before(start) || !e.Start.Before(end) {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
@@ -0,0 +1,185 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/classify"
+)
+
+const (
+	// DefaultDoorbellReason is the default reason of the events forced by
+	// doorbell presses, see detector.CaptureEvent
+	DefaultDoorbellReason = "doorbell"
+
+	// DefaultPersonLabel and DefaultPersonConfidence are the default label
+	// and least confidence of the people recognized in snapshots
+	DefaultPersonLabel      = "person"
+	DefaultPersonConfidence = 0.5
+
+	// VisitorReason is the reason of the events of visitors
+	VisitorReason = "visitor"
+)
+
+// VisitorCorrelator merges a doorbell press with the events of the person
+// seen at the door around it into a single visitor event, so that a visit
+// is notified once, with the best snapshot of the visitor, rather than as a
+// press and unrelated motion
+type VisitorCorrelator struct {
+	mu            sync.Mutex
+	window        time.Duration
+	doorbell      string
+	person        string
+	minConfidence float64
+	pending       map[string]*visit
+	emit          func(*Record)
+}
+
+// visit is the records of a camera's doorbell presses and people waiting to
+// be correlated
+type visit struct {
+	records []*Record
+	// confidence is that of the person recognized in each record's
+	// snapshot, zero if none was
+	confidence []float64
+	pressed    bool
+	end        time.Time
+	timer      *time.Timer
+}
+
+// VisitorOption configures optional behaviour of a VisitorCorrelator
+type VisitorOption func(*VisitorCorrelator)
+
+// WithDoorbellReason sets the reason of the events forced by doorbell
+// presses, DefaultDoorbellReason by default
+func WithDoorbellReason(reason string) VisitorOption {
+	return func(c *VisitorCorrelator) {
+		c.doorbell = reason
+	}
+}
+
+// WithPersonLabel sets the label of people, and the least confidence it is
+// recognized with, for classifiers with labels of their own
+func WithPersonLabel(name string, minConfidence float64) VisitorOption {
+	return func(c *VisitorCorrelator) {
+		c.person, c.minConfidence = name, minConfidence
+	}
+}
+
+// NewVisitorCorrelator is the constructor for a VisitorCorrelator. The
+// events of a doorbell press and of people seen by the same camera are
+// correlated when they start within the window of the end of another one,
+// and once the window has passed without more of them their records are
+// passed to emit: merged into one record with the reason VisitorReason if
+// the doorbell was pressed and a person seen, or as they were otherwise.
+// Records of other events are passed on straight away
+func NewVisitorCorrelator(window time.Duration, emit func(*Record), opts ...VisitorOption) *VisitorCorrelator {
+	c := &VisitorCorrelator{
+		window:        window,
+		doorbell:      DefaultDoorbellReason,
+		person:        DefaultPersonLabel,
+		minConfidence: DefaultPersonConfidence,
+		pending:       map[string]*visit{},
+		emit:          emit,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Add adds the record of an event which ended, with the labels recognized
+// in its snapshot, the first of its media
+func (c *VisitorCorrelator) Add(r *Record, labels []classify.Label) {
+	pressed := r.Event.Reason == c.doorbell
+	person, seen := classify.Find(labels, c.person, c.minConfidence)
+	if !pressed && !seen {
+		c.emit(r)
+		return
+	}
+	c.mu.Lock()
+	var done *visit
+	v := c.pending[r.Camera]
+	if v == nil || r.Event.Start.After(v.end.Add(c.window)) || !v.timer.Stop() {
+		if v != nil && v.timer.Stop() {
+			done = v
+		}
+		v = &visit{}
+		c.pending[r.Camera] = v
+	}
+	v.records = append(v.records, r)
+	v.confidence = append(v.confidence, person.Confidence)
+	v.pressed = v.pressed || pressed
+	if r.Event.End.After(v.end) {
+		v.end = r.Event.End
+	}
+	camera := r.Camera
+	v.timer = time.AfterFunc(c.window, func() { c.release(camera, v) })
+	c.mu.Unlock()
+	if done != nil {
+		c.emitVisit(done)
+	}
+}
+
+// release emits a pending visit once its window has passed
+func (c *VisitorCorrelator) release(camera string, v *visit) {
+	c.mu.Lock()
+	if c.pending[camera] == v {
+		delete(c.pending, camera)
+	}
+	c.mu.Unlock()
+	c.emitVisit(v)
+}
+
+// Flush emits all pending visits without waiting for their window to pass,
+// e.g. when shutting down
+func (c *VisitorCorrelator) Flush() {
+	c.mu.Lock()
+	done := []*visit{}
+	for camera, v := range c.pending {
+		if v.timer.Stop() {
+			done = append(done, v)
+		}
+		delete(c.pending, camera)
+	}
+	c.mu.Unlock()
+	for _, v := range done {
+		c.emitVisit(v)
+	}
+}
+
+// emitVisit emits the merged record of a visit, or its records as they were
+// unless the doorbell was pressed and a person seen
+func (c *VisitorCorrelator) emitVisit(v *visit) {
+	best := -1
+	for i, confidence := range v.confidence {
+		if confidence > 0 && (best < 0 || confidence > v.confidence[best]) {
+			best = i
+		}
+	}
+	if !v.pressed || best < 0 {
+		for _, r := range v.records {
+			c.emit(r)
+		}
+		return
+	}
+	// the visit has the ID of its first record, and the motion of the
+	// person's best record
+	first := v.records[0]
+	merged := &Record{ID: first.ID, Camera: first.Camera, Cameras: first.Cameras, Journey: first.Journey, Event: v.records[best].Event}
+	// the best snapshot of the visitor is the visit's first media
+	if m := v.records[best].Media; len(m) > 0 {
+		merged.Media = append(merged.Media, m[0])
+	}
+	for i, r := range v.records {
+		mergeEvent(&merged.Event, r.Event)
+		for j, m := range r.Media {
+			if i != best || j != 0 {
+				merged.Media = append(merged.Media, m)
+			}
+		}
+		merged.Recording = append(merged.Recording, r.Recording...)
+	}
+	merged.Event.Reason, merged.Event.Confidence = VisitorReason, 1
+	c.emit(merged)
+}
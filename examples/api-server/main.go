@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/adrianosela/GoAway/api"
+	"github.com/adrianosela/GoAway/audit"
+	"github.com/adrianosela/GoAway/detector"
+)
+
+func main() {
+	md, err := detector.NewMotionDetector(0, "Motion Detector", nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer md.Close()
+
+	// record who arms and disarms the detector
+	auditLog, err := audit.Open("audit.log")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer auditLog.Close()
+
+	// serve the API in the background, the detector's window has to
+	// run on the main goroutine. Without accounts anyone on the network
+	// can arm and disarm the detector, so only listen on localhost
+	go func() {
+		log.Fatal(http.ListenAndServe("localhost:8080", api.NewServer(md, api.WithoutAuthentication(), api.WithPprof(), api.WithAuditLog(auditLog))))
+	}()
+
+	md.Start()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+func main() {
+	// e.g. head -c 32 /dev/urandom | xxd -p -c 64 > goaway.key
+	key, err := storage.ReadKeyFile(os.Getenv("GOAWAY_KEY_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	// e.g. openssl genpkey -algorithm ed25519 -out signing.pem
+	signingKey, err := storage.ReadSigningKeyFile(os.Getenv("GOAWAY_SIGNING_KEY_FILE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := storage.NewDir("footage", storage.WithEncryptionKey(key), storage.WithSigningKey(signingKey))
+	if err != nil {
+		log.Fatal(err)
+	}
+	records, err := events.NewDirStore("events")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var md *detector.Detector
+	onEvent := func(e detector.Event) {
+		jpg, err := md.SnapshotJPG()
+		if err != nil {
+			return
+		}
+		name := fmt.Sprintf("snapshots/%s.jpg", e.Start.Format("20060102-150405"))
+		obj, err := store.WriteFile(name, jpg)
+		if err != nil {
+			log.Printf("could not store snapshot: %s", err)
+			return
+		}
+		// the record keeps the snapshot's hash and signature as evidence
+		if err := records.Add(&events.Record{Event: e, Media: []storage.Object{obj}}); err != nil {
+			log.Printf("could not store event record: %s", err)
+		}
+	}
+
+	md, err = detector.NewMotionDetector(0, "Motion Detector", nil, detector.WithEventHandler(onEvent))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer md.Close()
+
+	md.Start()
+}
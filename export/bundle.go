@@ -0,0 +1,176 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/rules"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+// bundled is a file written to a bundle, with its hash
+type bundled struct {
+	name   string
+	size   int64
+	sha256 string
+	// recorded is the hash recorded when the file was stored, empty for
+	// the files of the bundle itself
+	recorded string
+}
+
+// Bundle writes an incident bundle of an event, e.g. for handing to police
+// or insurance, as a zip archive of:
+//   - media/, the event's snapshots and clips, decrypted
+//   - recording/, the segments of continuous recordings the event is in
+//   - event.json, the event's record, with the hashes and signatures the
+//     media was stored with, see goaway verify
+//   - summary.txt, a human readable summary of the event and its files
+//   - SHA256SUMS, the hashes of every other file, as sha256sum -c reads them
+//
+// Media is read from the storage it was saved to, its hashes are checked
+// against those it was stored with and mismatches noted in the summary
+func Bundle(w io.Writer, r *events.Record, src storage.Storage, now time.Time) error {
+	z := zip.NewWriter(w)
+	files := []bundled{}
+	add := func(name string, recorded string, data io.Reader) error {
+		f, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(f, h), data)
+		if err != nil {
+			return fmt.Errorf("could not bundle %s: %w", name, err)
+		}
+		files = append(files, bundled{name: name, size: n, sha256: hex.EncodeToString(h.Sum(nil)), recorded: recorded})
+		return nil
+	}
+	copyFile := func(name, stored, recorded string) error {
+		f, err := src.Open(stored)
+		if err != nil {
+			return fmt.Errorf("could not bundle %s: %w", stored, err)
+		}
+		defer f.Close()
+		return add(name, recorded, f)
+	}
+	for _, obj := range r.Media {
+		if err := copyFile("media/"+obj.Name, obj.Name, obj.SHA256); err != nil {
+			return err
+		}
+	}
+	segments := map[string]bool{}
+	for _, ref := range r.Recording {
+		if segments[ref.Segment] {
+			continue
+		}
+		segments[ref.Segment] = true
+		if err := copyFile("recording/"+ref.Segment, ref.Segment, ""); err != nil {
+			return err
+		}
+	}
+	record, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := add("event.json", "", bytes.NewReader(record)); err != nil {
+		return err
+	}
+	if err := add("summary.txt", "", strings.NewReader(summary(r, files, now))); err != nil {
+		return err
+	}
+	sums := &strings.Builder{}
+	for _, f := range files {
+		fmt.Fprintf(sums, "%s  %s\n", f.sha256, f.name)
+	}
+	if err := add("SHA256SUMS", "", strings.NewReader(sums.String())); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// summary returns a human readable summary of an event and the files
+// bundled for it
+func summary(r *events.Record, files []bundled, now time.Time) string {
+	s := &strings.Builder{}
+	e := r.Event
+	line := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(s, "%-14s %s\n", label+":", value)
+		}
+	}
+	fmt.Fprintf(s, "GoAway incident bundle\n\n")
+	line("Event", r.ID)
+	camera := r.Camera
+	if e.Camera != nil && e.Camera.Name != "" && e.Camera.Name != camera {
+		camera = strings.TrimSpace(camera + " (" + e.Camera.Name + ")")
+	}
+	line("Camera", camera)
+	line("Labels", cameraLabels(r))
+	line("Cameras", strings.Join(r.Cameras, ", "))
+	line("Start", e.Start.Format(time.RFC1123))
+	if !e.End.IsZero() {
+		line("End", e.End.Format(time.RFC1123))
+		line("Duration", e.End.Sub(e.Start).Round(time.Second).String())
+	}
+	line("Reason", e.Reason)
+	line("Confidence", fmt.Sprintf("%.0f%% (%s severity)", e.Confidence*100, rules.SeverityOf(e.Confidence)))
+	line("Object", string(e.Class))
+	plates := []string{}
+	for _, p := range e.Plates {
+		if p.Text != "" {
+			plates = append(plates, p.Text)
+		}
+	}
+	line("Plates", strings.Join(plates, ", "))
+	line("Motion", fmt.Sprintf("%v in a %dx%d frame", e.Bounds, e.FrameSize.X, e.FrameSize.Y))
+	if r.FalsePositive {
+		line("Feedback", "marked as a false positive")
+	}
+	if h := r.Hold; h != nil {
+		line("Legal hold", strings.TrimSpace(fmt.Sprintf("%s (placed by %s on %s)", h.Reason, h.By, h.Since.Format(time.RFC1123))))
+	}
+	for _, ref := range r.Recording {
+		line("Recording", fmt.Sprintf("recording/%s from %s for %s", ref.Segment, ref.Offset.Round(time.Second), ref.Duration.Round(time.Second)))
+	}
+	line("Exported", now.Format(time.RFC1123))
+	fmt.Fprintf(s, "\nFiles:\n")
+	for _, f := range files {
+		integrity := ""
+		switch {
+		case f.recorded == "":
+		case f.recorded == f.sha256:
+			integrity = ", matches the hash it was stored with"
+		default:
+			integrity = ", DOES NOT match the hash it was stored with " + f.recorded
+		}
+		fmt.Fprintf(s, "  %s (%d bytes%s)\n", f.name, f.size, integrity)
+	}
+	fmt.Fprintf(s, "\nThe SHA-256 hashes of all files are listed in SHA256SUMS, which `sha256sum -c SHA256SUMS` checks.\n")
+	if len(r.Media) > 0 && r.Media[0].Signature != "" {
+		fmt.Fprintf(s, "The media was signed when stored, `goaway verify -record event.json -dir media -pubkey-file <key>` checks its signatures.\n")
+	}
+	return s.String()
+}
+
+// cameraLabels returns the labels of the camera of an event, e.g. its
+// location, sorted
+func cameraLabels(r *events.Record) string {
+	if r.Event.Camera == nil {
+		return ""
+	}
+	labels := []string{}
+	for k, v := range r.Event.Camera.Labels {
+		labels = append(labels, k+"="+v)
+	}
+	sort.Strings(labels)
+	return strings.Join(labels, ", ")
+}
@@ -0,0 +1,139 @@
+// Package export copies stored events to the directory layouts of other
+// video surveillance tools, so that history is kept when migrating between
+// them and their viewers can browse GoAway footage
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+// Layout names the exported files of an event's media
+type Layout interface {
+	// Path returns the slash separated path, relative to the export
+	// directory, of the i-th media file of a record
+	Path(r *events.Record, i int) string
+}
+
+// Export writes the media of the given records to the export directory in
+// the given layout. Media is read from the storage it was saved to, so it is
+// exported decrypted
+func Export(records []*events.Record, src storage.Storage, layout Layout, dst string) error {
+	for _, r := range records {
+		for i, obj := range r.Media {
+			name := filepath.Join(dst, filepath.FromSlash(layout.Path(r, i)))
+			if err := exportFile(src, obj.Name, name); err != nil {
+				return fmt.Errorf("could not export %s of event %s: %w", obj.Name, r.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func exportFile(src storage.Storage, name, dst string) error {
+	r, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// isSnapshot returns whether a media file is a still image rather than a clip
+func isSnapshot(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// kindIndex returns the index of the i-th media file of a record among the
+// record's media of the same kind (snapshots or clips)
+func kindIndex(r *events.Record, i int) int {
+	n := 0
+	for _, obj := range r.Media[:i] {
+		if isSnapshot(obj.Name) == isSnapshot(r.Media[i].Name) {
+			n++
+		}
+	}
+	return n
+}
+
+// MotionEye lays files out as motionEye does with its default naming: a
+// directory per day holding pictures named after the time they were taken
+// and their number within the event, and movies named after their start time
+type MotionEye struct{}
+
+// Path implements Layout
+func (MotionEye) Path(r *events.Record, i int) string {
+	name, n := r.Media[i].Name, kindIndex(r, i)
+	base := r.Event.Start.Local().Format("2006-01-02/15-04-05")
+	if isSnapshot(name) {
+		return fmt.Sprintf("%s-%02d%s", base, n, path.Ext(name))
+	}
+	if n > 0 {
+		base = fmt.Sprintf("%s-%02d", base, n)
+	}
+	return base + path.Ext(name)
+}
+
+// Frigate lays files out as Frigate does: event snapshots in clips/ named
+// after the camera and event, and recordings in recordings/ by hour (UTC)
+// and camera. Frigate keeps its event history in a database, so exported
+// events only appear in its media browser
+type Frigate struct {
+	// Camera is the camera name used for records without one
+	Camera string
+}
+
+// eventID returns a Frigate style event ID (the start time as fractional
+// seconds since the epoch and a random suffix) for a record
+func eventID(r *events.Record) string {
+	suffix := r.ID
+	if i := strings.LastIndex(suffix, "-"); i >= 0 {
+		suffix = suffix[i+1:]
+	}
+	start := r.Event.Start
+	return fmt.Sprintf("%d.%06d-%s", start.Unix(), start.Nanosecond()/1000, suffix)
+}
+
+// Path implements Layout
+func (f Frigate) Path(r *events.Record, i int) string {
+	camera := r.Camera
+	if camera == "" {
+		camera = f.Camera
+	}
+	name, n := r.Media[i].Name, kindIndex(r, i)
+	if isSnapshot(name) {
+		base := fmt.Sprintf("clips/%s-%s", camera, eventID(r))
+		if n > 0 {
+			base = fmt.Sprintf("%s-%d", base, n)
+		}
+		return base + path.Ext(name)
+	}
+	start := r.Event.Start.UTC()
+	base := fmt.Sprintf("recordings/%s/%s/%s", start.Format("2006-01-02/15"), camera, start.Format("04.05"))
+	if n > 0 {
+		base = fmt.Sprintf("%s-%d", base, n)
+	}
+	return base + path.Ext(name)
+}
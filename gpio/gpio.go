@@ -0,0 +1,22 @@
+// Package gpio watches the GPIO input pins of single board computers, e.g. a
+// Raspberry Pi, for the edges of external sensors such as PIR sensors, to
+// wake sleeping detectors up or report their triggers
+package gpio
+
+import (
+	"errors"
+)
+
+// ErrUnsupported is returned when watching a pin on a platform without
+// sysfs GPIO
+var ErrUnsupported = errors.New("GPIO is only supported on Linux")
+
+// Edge is the change of a pin's value which is watched for
+type Edge string
+
+// Edges
+const (
+	Rising  Edge = "rising"
+	Falling Edge = "falling"
+	Both    Edge = "both"
+)
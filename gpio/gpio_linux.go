@@ -0,0 +1,150 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// sysfsGPIO is the sysfs GPIO interface
+	sysfsGPIO = "/sys/class/gpio"
+
+	// exportTimeout is how long udev can take to give access to the files
+	// of a pin once it is exported
+	exportTimeout = 2 * time.Second
+)
+
+// Watcher watches a GPIO input pin
+type Watcher struct {
+	value *os.File
+	epfd  int
+	// stop is written to to stop watching, done is closed once stopped
+	stop [2]int
+	done chan struct{}
+}
+
+// Watch exports a pin through sysfs as an input, and calls fn with the pin's
+// value on every edge, until the watcher is closed. Pins are numbered as by
+// the kernel, which on recent kernels can be offset from the numbers of the
+// header, e.g. see /sys/kernel/debug/gpio
+func Watch(pin int, edge Edge, fn func(value bool)) (*Watcher, error) {
+	dir := filepath.Join(sysfsGPIO, "gpio"+strconv.Itoa(pin))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.WriteFile(filepath.Join(sysfsGPIO, "export"), []byte(strconv.Itoa(pin)), 0); err != nil {
+			return nil, fmt.Errorf("could not export GPIO %d: %w", pin, err)
+		}
+	}
+	if err := writeAttr(dir, "direction", "in"); err != nil {
+		return nil, fmt.Errorf("could not make GPIO %d an input: %w", pin, err)
+	}
+	if err := writeAttr(dir, "edge", string(edge)); err != nil {
+		return nil, fmt.Errorf("could not watch GPIO %d for %s edges: %w", pin, edge, err)
+	}
+	value, err := os.Open(filepath.Join(dir, "value"))
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{value: value, epfd: -1, stop: [2]int{-1, -1}, done: make(chan struct{})}
+	if err := w.init(); err != nil {
+		w.release()
+		return nil, fmt.Errorf("could not watch GPIO %d: %w", pin, err)
+	}
+	// the value is read once before waiting, or the first wait returns
+	// straight away
+	if _, err := w.read(); err != nil {
+		w.release()
+		return nil, err
+	}
+	go w.watch(fn)
+	return w, nil
+}
+
+// writeAttr writes a pin's attribute, retrying while udev hasn't given
+// access to it yet
+func writeAttr(dir, attr, value string) error {
+	deadline := time.Now().Add(exportTimeout)
+	for {
+		err := os.WriteFile(filepath.Join(dir, attr), []byte(value), 0)
+		if err == nil || !(os.IsPermission(err) || os.IsNotExist(err)) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// init sets up the epoll instance which waits for edges, or for the watcher
+// to be closed
+func (w *Watcher) init() error {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	w.epfd = epfd
+	if err := syscall.Pipe2(w.stop[:], syscall.O_CLOEXEC); err != nil {
+		return err
+	}
+	// sysfs reports edges as priority data
+	fd := int(w.value.Fd())
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, fd, &syscall.EpollEvent{Events: syscall.EPOLLPRI | syscall.EPOLLERR, Fd: int32(fd)}); err != nil {
+		return err
+	}
+	return syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, w.stop[0], &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(w.stop[0])})
+}
+
+// watch calls fn on every edge until the watcher is closed
+func (w *Watcher) watch(fn func(value bool)) {
+	defer close(w.done)
+	events := make([]syscall.EpollEvent, 2)
+	for {
+		n, err := syscall.EpollWait(w.epfd, events, -1)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		for _, e := range events[:n] {
+			if int(e.Fd) == w.stop[0] {
+				return
+			}
+		}
+		v, err := w.read()
+		if err != nil {
+			return
+		}
+		fn(v)
+	}
+}
+
+// read reads the pin's value
+func (w *Watcher) read() (bool, error) {
+	b := make([]byte, 2)
+	if _, err := w.value.ReadAt(b, 0); err != nil {
+		return false, err
+	}
+	return b[0] == '1', nil
+}
+
+// Close stops watching the pin, waiting for fn to return, the pin stays
+// exported
+func (w *Watcher) Close() error {
+	syscall.Write(w.stop[1], []byte{0})
+	<-w.done
+	w.release()
+	return nil
+}
+
+// release closes the watcher's files
+func (w *Watcher) release() {
+	w.value.Close()
+	for _, fd := range []int{w.epfd, w.stop[0], w.stop[1]} {
+		if fd >= 0 {
+			syscall.Close(fd)
+		}
+	}
+}
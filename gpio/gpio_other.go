@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package gpio
+
+// Watcher watches a GPIO input pin
+type Watcher struct{}
+
+// Watch returns ErrUnsupported, GPIO is only supported on Linux
+func Watch(pin int, edge Edge, fn func(value bool)) (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// Close stops watching the pin
+func (w *Watcher) Close() error {
+	return nil
+}
@@ -0,0 +1,167 @@
+// Package heartbeat sends heartbeats to an external monitor, e.g.
+// healthchecks.io or an MQTT topic, while GoAway runs and its cameras
+// process frames, so that the monitor alerts when GoAway dies: a dead
+// detector otherwise looks identical to a quiet night
+package heartbeat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+)
+
+// DefaultInterval is the default interval heartbeats are sent at
+const DefaultInterval = time.Minute
+
+// Target is what heartbeats are sent to, e.g. a URL, see NewURL, or an
+// MQTT topic, see nodered.Bridge
+type Target interface {
+	// Beat sends a heartbeat, which reports a failure, described by the
+	// problem, when it isn't healthy
+	Beat(ctx context.Context, healthy bool, problem string) error
+}
+
+// Source is a camera whose health is reported, e.g. a *detector.Detector
+type Source interface {
+	Stats() detector.Stats
+	Status() string
+}
+
+// camera is a camera whose health is reported, with the frames it had
+// processed at the last heartbeat
+type camera struct {
+	source Source
+	frames int
+	beaten bool
+}
+
+// Heartbeat sends heartbeats to a target at every interval. Heartbeats are
+// healthy while every camera added processes frames, or is asleep, see
+// detector.WithSleepMode, and report a failure naming the cameras which
+// stopped otherwise. Without heartbeats, e.g. when GoAway died, the
+// target's monitor alerts by itself
+type Heartbeat struct {
+	mu       sync.Mutex
+	target   Target
+	interval time.Duration
+	cameras  map[string]*camera
+}
+
+// Option configures optional behaviour of a Heartbeat
+type Option func(*Heartbeat)
+
+// WithInterval sets the interval heartbeats are sent at, DefaultInterval
+// by default, it should be shorter than the period the monitor expects them
+// in
+func WithInterval(interval time.Duration) Option {
+	return func(h *Heartbeat) {
+		h.interval = interval
+	}
+}
+
+// NewHeartbeat is the constructor for a Heartbeat sent to a target, see Run
+func NewHeartbeat(target Target, opts ...Option) *Heartbeat {
+	h := &Heartbeat{target: target, interval: DefaultInterval, cameras: map[string]*camera{}}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// AddCamera reports the health of a camera, under its name
+func (h *Heartbeat) AddCamera(name string, s Source) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cameras[name] = &camera{source: s}
+}
+
+// Run sends heartbeats until the context is done, failures to send them are
+// logged
+func (h *Heartbeat) Run(ctx context.Context) error {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		healthy, problem := h.check()
+		if err := h.target.Beat(ctx, healthy, problem); err != nil && ctx.Err() == nil {
+			log.Printf("could not send heartbeat: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// check returns whether every camera processed frames since the last
+// heartbeat, or is asleep, and which didn't otherwise
+func (h *Heartbeat) check() (bool, string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stopped := []string{}
+	for name, c := range h.cameras {
+		stats, status := c.source.Stats(), c.source.Status()
+		frames := stats.Frames + stats.SkippedFrames
+		progressed := !c.beaten || frames > c.frames
+		c.frames, c.beaten = frames, true
+		switch {
+		case status == detector.DetectorStatusClosed:
+			stopped = append(stopped, name+" is closed")
+		case status == detector.DetectorStatusAsleep || progressed:
+		case status == detector.DetectorStatusReconnecting:
+			stopped = append(stopped, name+" is reconnecting")
+		default:
+			stopped = append(stopped, name+" processed no frames")
+		}
+	}
+	if len(stopped) == 0 {
+		return true, ""
+	}
+	sort.Strings(stopped)
+	return false, strings.Join(stopped, ", ")
+}
+
+// URL is a target which pings a URL, as healthchecks.io and similar
+// monitors expect: healthy heartbeats GET the URL, and failures POST their
+// problem to the URL with /fail appended
+type URL struct {
+	url    string
+	client *http.Client
+}
+
+// NewURL is the constructor for a URL target, e.g.
+// https://hc-ping.com/<uuid>
+func NewURL(url string) *URL {
+	return &URL{url: strings.TrimSuffix(url, "/"), client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Beat implements Target
+func (u *URL) Beat(ctx context.Context, healthy bool, problem string) error {
+	method, url, body := http.MethodGet, u.url, io.Reader(nil)
+	if !healthy {
+		method, url, body = http.MethodPost, u.url+"/fail", bytes.NewBufferString(problem)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("heartbeat to %s failed with status %s", u.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+// Package influx exports the activity of detectors to InfluxDB, or other
+// time-series databases which accept its line protocol such as
+// VictoriaMetrics, for dashboards of activity over months, e.g. in Grafana
+package influx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+)
+
+const (
+	// DefaultInterval is the default interval activity is exported at
+	DefaultInterval = time.Minute
+
+	// bufferedPoints is the number of points kept while the database can't
+	// be reached, a week of one camera at the default interval, older points
+	// are dropped
+	bufferedPoints = 7 * 24 * 60
+
+	// measurement is the name of the exported measurement
+	measurement = "goaway_activity"
+)
+
+// Source is what activity is exported from, e.g. a *detector.Detector
+type Source interface {
+	Stats() detector.Stats
+}
+
+// identified is a Source which identifies its camera, e.g. a
+// *detector.Detector, its points are also tagged with the camera's identity
+type identified interface {
+	Identity() detector.Identity
+}
+
+// tagEscaper escapes tag values for the line protocol
+var tagEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+
+// camera is a camera activity is exported for
+type camera struct {
+	source Source
+	last   detector.Stats
+	lastAt time.Time
+}
+
+// Exporter writes the activity of cameras to a time-series database, at
+// every interval, as a point of the goaway_activity measurement tagged with
+// the camera, and the ID, name and labels of cameras with an identity (see
+// detector.WithIdentity), with the fields:
+//   - fps, the frames processed per second
+//   - motion, the fraction of frames motion was reported in
+//   - frames, the number of frames processed
+//   - events, the number of events which started
+type Exporter struct {
+	// exporting serializes exports, mu guards the cameras and buffered points
+	exporting sync.Mutex
+	mu        sync.Mutex
+	url       string
+	token     string
+	client    *http.Client
+	interval  time.Duration
+	cameras   map[string]*camera
+	buffered  []string
+}
+
+// Option configures optional behaviour of an Exporter
+type Option func(*Exporter)
+
+// WithToken sets the token the exporter authenticates with, as InfluxDB 2
+// expects it
+func WithToken(token string) Option {
+	return func(e *Exporter) {
+		e.token = token
+	}
+}
+
+// WithInterval sets the interval activity is exported at
+func WithInterval(interval time.Duration) Option {
+	return func(e *Exporter) {
+		e.interval = interval
+	}
+}
+
+// WithHTTPClient sets the client used to reach the database, e.g. to
+// configure TLS
+func WithHTTPClient(client *http.Client) Option {
+	return func(e *Exporter) {
+		e.client = client
+	}
+}
+
+// NewExporter is the constructor for an Exporter writing to the given write
+// endpoint, e.g. http://influxdb:8086/api/v2/write?org=home&bucket=goaway for
+// InfluxDB 2 or http://victoriametrics:8428/write for VictoriaMetrics.
+// Timestamps are in nanoseconds, the endpoint's default precision
+func NewExporter(writeURL string, opts ...Option) *Exporter {
+	e := &Exporter{
+		url:      writeURL,
+		client:   http.DefaultClient,
+		interval: DefaultInterval,
+		cameras:  map[string]*camera{},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Add exports the activity of a camera, its activity is exported from the
+// next interval on
+func (e *Exporter) Add(name string, source Source) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cameras[name] = &camera{source: source, last: source.Stats(), lastAt: time.Now()}
+}
+
+// Run exports activity at every interval until the context is done. Points
+// which could not be written are retried at the next interval
+func (e *Exporter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			if err := e.Export(ctx, now); err != nil && ctx.Err() == nil {
+				log.Printf("could not export activity: %s", err)
+			}
+		}
+	}
+}
+
+// Export writes the activity of every camera since it was last exported, as
+// of the given time, along with points which could not be written before
+func (e *Exporter) Export(ctx context.Context, now time.Time) error {
+	e.exporting.Lock()
+	defer e.exporting.Unlock()
+	e.mu.Lock()
+	names := []string{}
+	for name := range e.cameras {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e.buffered = append(e.buffered, e.cameras[name].point(name, now))
+	}
+	if len(e.buffered) > bufferedPoints {
+		e.buffered = e.buffered[len(e.buffered)-bufferedPoints:]
+	}
+	points := e.buffered
+	e.mu.Unlock()
+	if len(points) == 0 {
+		return nil
+	}
+	if err := e.write(ctx, points); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.buffered = e.buffered[len(points):]
+	e.mu.Unlock()
+	return nil
+}
+
+// point returns the line protocol point of a camera's activity since it was
+// last exported
+func (c *camera) point(name string, now time.Time) string {
+	stats := c.source.Stats()
+	last := c.last
+	if stats.Frames < last.Frames {
+		// the source was restarted
+		last = detector.Stats{}
+	}
+	frames := stats.Frames - last.Frames
+	fps, motion := 0.0, 0.0
+	if elapsed := now.Sub(c.lastAt).Seconds(); elapsed > 0 {
+		fps = float64(frames) / elapsed
+	}
+	if frames > 0 {
+		motion = float64(stats.MotionFrames-last.MotionFrames) / float64(frames)
+	}
+	c.last, c.lastAt = stats, now
+	return fmt.Sprintf("%s,camera=%s%s fps=%g,motion=%g,frames=%di,events=%di %d",
+		measurement, tagEscaper.Replace(name), c.identityTags(), fps, motion, frames, stats.Events-last.Events, now.UnixNano())
+}
+
+// identityTags returns the tags of the camera's identity, if its source has
+// one, labels named like the other tags are left out
+func (c *camera) identityTags() string {
+	src, ok := c.source.(identified)
+	if !ok {
+		return ""
+	}
+	id := src.Identity()
+	tags := ""
+	if id.ID != "" {
+		tags += ",id=" + tagEscaper.Replace(id.ID)
+	}
+	if id.Name != "" {
+		tags += ",name=" + tagEscaper.Replace(id.Name)
+	}
+	keys := []string{}
+	for k := range id.Labels {
+		if k != "" && k != "camera" && k != "id" && k != "name" && id.Labels[k] != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		tags += "," + tagEscaper.Replace(k) + "=" + tagEscaper.Replace(id.Labels[k])
+	}
+	return tags
+}
+
+// write writes points to the database
+func (e *Exporter) write(ctx context.Context, points []string) error {
+	body := strings.Join(points, "\n") + "\n"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.token != "" {
+		req.Header.Set("Authorization", "Token "+e.token)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s responded with %s: %s", e.url, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package nodered
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/events"
+)
+
+const (
+	// DefaultPrefix is the default prefix of the bridge's topics
+	DefaultPrefix = "goaway"
+
+	// keepAlive is the keep alive interval of the MQTT connection
+	keepAlive = 30 * time.Second
+
+	// statusInterval is the interval cameras' statuses are checked for
+	// changes at
+	statusInterval = 2 * time.Second
+
+	// reconnectInterval is the time waited before reconnecting to the broker
+	reconnectInterval = 5 * time.Second
+)
+
+// ErrNotConnected is returned for events which couldn't be published as the
+// bridge isn't connected to its broker
+var ErrNotConnected = errors.New("not connected to the MQTT broker")
+
+// Bridge serves cameras over MQTT, on the topics, under its prefix:
+//   - <prefix>/availability, online or offline, retained
+//   - <prefix>/<camera>/status, the camera's status message, retained and
+//     published when it changes
+//   - <prefix>/<camera>/event, the camera's event messages
+//   - <prefix>/<camera>/set, which commands to the camera are published to,
+//     in any form ParseCommand takes
+//   - <prefix>/<camera>/ack, the acknowledgements of those commands
+//   - <prefix>/heartbeat, heartbeat messages, see Beat
+type Bridge struct {
+	broker  string
+	prefix  string
+	options connectOptions
+
+	mu      sync.Mutex
+	cameras map[string]*detector.Detector
+	conn    *mqttConn
+	// statuses are the statuses last published, by camera
+	statuses map[string]Status
+}
+
+// Option configures optional behaviour of a Bridge
+type Option func(*Bridge)
+
+// WithPrefix sets the prefix of the bridge's topics, e.g. home/goaway
+func WithPrefix(prefix string) Option {
+	return func(b *Bridge) {
+		b.prefix = strings.Trim(prefix, "/")
+	}
+}
+
+// WithCredentials sets the username and password the bridge authenticates
+// to its broker with
+func WithCredentials(username, password string) Option {
+	return func(b *Bridge) {
+		b.options.username, b.options.password = username, password
+	}
+}
+
+// WithClientID sets the bridge's MQTT client ID, which is goaway-<hostname>
+// by default
+func WithClientID(id string) Option {
+	return func(b *Bridge) {
+		b.options.clientID = id
+	}
+}
+
+// NewBridge is the constructor for a Bridge to a broker, e.g.
+// tcp://localhost:1883, or tls://broker:8883, see Run
+func NewBridge(broker string, opts ...Option) *Bridge {
+	hostname, _ := os.Hostname()
+	b := &Bridge{
+		broker:   broker,
+		prefix:   DefaultPrefix,
+		options:  connectOptions{clientID: "goaway-" + hostname, keepAlive: keepAlive},
+		cameras:  map[string]*detector.Detector{},
+		statuses: map[string]Status{},
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	b.options.willTopic, b.options.willPayload = b.prefix+"/availability", []byte("offline")
+	return b
+}
+
+// AddCamera serves a camera's detector, under its name, e.g. DefaultCamera
+func (b *Bridge) AddCamera(name string, d *detector.Detector) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cameras[name] = d
+}
+
+// Notify publishes an event's message, it implements notify.Notifier
+func (b *Bridge) Notify(ctx context.Context, r *events.Record) error {
+	m := EventMessage(r)
+	return b.publish(b.topic(m.Camera, "event"), m, false)
+}
+
+// Beat publishes a heartbeat message, it implements heartbeat.Target
+func (b *Bridge) Beat(ctx context.Context, healthy bool, problem string) error {
+	return b.publish(b.prefix+"/heartbeat", HeartbeatMessage(healthy, problem), false)
+}
+
+// Run connects to the broker and serves the cameras until the context is
+// done, reconnecting when the connection is lost
+func (b *Bridge) Run(ctx context.Context) error {
+	for {
+		err := b.session(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("MQTT connection to %s lost, reconnecting: %s", b.broker, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(reconnectInterval):
+		}
+	}
+}
+
+// session serves the cameras over one connection to the broker
+func (b *Bridge) session(ctx context.Context) error {
+	conn, err := dialMQTT(ctx, b.broker, b.options)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+	b.mu.Lock()
+	b.conn, b.statuses = conn, map[string]Status{}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.conn = nil
+		b.mu.Unlock()
+	}()
+	if err := conn.publish(b.prefix+"/availability", []byte("online"), true); err != nil {
+		return err
+	}
+	if err := conn.subscribe(1, b.prefix+"/+/set"); err != nil {
+		return err
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- b.receive(conn)
+	}()
+	b.publishStatuses()
+	statuses, pings := time.NewTicker(statusInterval), time.NewTicker(keepAlive/2)
+	defer statuses.Stop()
+	defer pings.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			conn.publish(b.prefix+"/availability", []byte("offline"), true)
+			conn.disconnect()
+			return nil
+		case err := <-errs:
+			return err
+		case <-statuses.C:
+			b.publishStatuses()
+		case <-pings.C:
+			if err := conn.ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// receive reads the packets of a connection and executes the commands
+// published to the cameras, until the connection fails
+func (b *Bridge) receive(conn *mqttConn) error {
+	for {
+		// the broker responds to the pings sent every half keep alive
+		conn.conn.SetReadDeadline(time.Now().Add(keepAlive))
+		typ, body, err := conn.read()
+		if err != nil {
+			return err
+		}
+		if typ != packetPublish {
+			continue
+		}
+		topic, payload, err := parsePublish(body)
+		if err != nil {
+			return err
+		}
+		b.command(topic, payload)
+	}
+}
+
+// command executes a command published to a camera's set topic, and
+// acknowledges it
+func (b *Bridge) command(topic string, payload []byte) {
+	parts := strings.Split(strings.TrimPrefix(topic, b.prefix+"/"), "/")
+	if len(parts) != 2 || parts[1] != "set" {
+		return
+	}
+	camera := parts[0]
+	b.mu.Lock()
+	d, ok := b.cameras[camera]
+	b.mu.Unlock()
+	c, err := ParseCommand(payload)
+	switch {
+	case !ok:
+		err = fmt.Errorf("unknown camera %q", camera)
+	case err == nil:
+		err = c.Execute(d)
+	}
+	if err := b.publish(b.topic(camera, "ack"), AckMessage(camera, c, err), false); err != nil {
+		log.Printf("could not acknowledge command to camera %s: %s", camera, err)
+	}
+	b.publishStatuses()
+}
+
+// publishStatuses publishes the statuses of the cameras which changed
+func (b *Bridge) publishStatuses() {
+	b.mu.Lock()
+	cameras := map[string]*detector.Detector{}
+	for name, d := range b.cameras {
+		cameras[name] = d
+	}
+	b.mu.Unlock()
+	for name, d := range cameras {
+		m := StatusMessage(name, d)
+		b.mu.Lock()
+		changed := b.statuses[name] != *m.Status
+		b.mu.Unlock()
+		if !changed {
+			continue
+		}
+		if err := b.publish(b.topic(name, "status"), m, true); err != nil {
+			log.Printf("could not publish the status of camera %s: %s", name, err)
+			continue
+		}
+		b.mu.Lock()
+		b.statuses[name] = *m.Status
+		b.mu.Unlock()
+	}
+}
+
+// publish publishes a message as JSON
+func (b *Bridge) publish(topic string, m Message, retain bool) error {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	conn := b.conn
+	b.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	return conn.publish(topic, payload, retain)
+}
+
+func (b *Bridge) topic(camera, name string) string {
+	return b.prefix + "/" + camera + "/" + name
+}
@@ -0,0 +1,240 @@
+// Package nodered is the JSON contract of GoAway's commands and messages,
+// and a bridge serving it over MQTT, with the topics and payloads Node-RED
+// flows and their mqtt in/out and http request nodes expect. The contract
+// is versioned, fields are only added to it within a Version
+package nodered
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/events"
+)
+
+// Version is the version of the contract, it is sent in every message
+const Version = 1
+
+// Types of messages
+const (
+	TypeEvent     = "event"
+	TypeStatus    = "status"
+	TypeAck       = "ack"
+	TypeHeartbeat = "heartbeat"
+)
+
+// Commands
+const (
+	CommandArm         = "arm"
+	CommandDisarm      = "disarm"
+	CommandSensitivity = "sensitivity"
+	CommandDryRun      = "dry_run"
+	CommandCapture     = "capture"
+	CommandTrigger     = "trigger"
+)
+
+// DefaultCamera is the camera of events recorded without one, as
+// api.DefaultCamera
+const DefaultCamera = "default"
+
+// Command is a command to a camera, e.g. {"command": "sensitivity",
+// "value": 500}. The value of sensitivity is the minimum contour area, of
+// dry_run whether it is on, of capture the reason, and of trigger the
+// sensor, see detector.Detector. Numbers and booleans may be strings, as
+// Node-RED's inject and dashboard nodes often send them
+type Command struct {
+	Command string      `json:"command"`
+	Value   interface{} `json:"value,omitempty"`
+}
+
+// ParseCommand parses a command in any of the forms Node-RED flows send
+// them in:
+//   - a Command, e.g. {"command": "arm"}
+//   - a Node-RED message, e.g. {"topic": "goaway/garage/set", "payload":
+//     "arm"}, with the command in its payload, as sent by an http request
+//     node given the whole message
+//   - text, e.g. arm or sensitivity 500, the command then its value
+//   - true or on, and false or off, which arm and disarm, as sent by a
+//     dashboard switch
+func ParseCommand(data []byte) (Command, error) {
+	data = []byte(strings.TrimSpace(string(data)))
+	if len(data) > 0 && data[0] == '{' {
+		msg := struct {
+			Command
+			Payload json.RawMessage `json:"payload"`
+		}{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return Command{}, fmt.Errorf("invalid command: %w", err)
+		}
+		if msg.Command.Command == "" && len(msg.Payload) > 0 {
+			return parsePayload(msg.Payload)
+		}
+		if msg.Command.Command == "" {
+			return Command{}, errors.New("invalid command: no command")
+		}
+		return msg.Command, nil
+	}
+	return parsePayload(data)
+}
+
+// parsePayload parses the payload of a Node-RED message, a command or text
+func parsePayload(data []byte) (Command, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		data = []byte(s)
+	} else if len(data) > 0 && data[0] == '{' {
+		return ParseCommand(data)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return Command{}, errors.New("invalid command: no command")
+	}
+	switch strings.ToLower(fields[0]) {
+	case "true", "on":
+		return Command{Command: CommandArm}, nil
+	case "false", "off":
+		return Command{Command: CommandDisarm}, nil
+	}
+	c := Command{Command: fields[0]}
+	if len(fields) > 1 {
+		c.Value = strings.Join(fields[1:], " ")
+	}
+	return c, nil
+}
+
+// Execute executes the command on a camera's detector
+func (c Command) Execute(d *detector.Detector) error {
+	switch strings.ToLower(c.Command) {
+	case CommandArm:
+		d.Arm()
+	case CommandDisarm:
+		d.Disarm()
+	case CommandSensitivity:
+		minArea, err := c.number()
+		if err != nil || minArea <= 0 {
+			return errors.New("sensitivity must be a positive number")
+		}
+		d.SetSensitivity(minArea)
+	case CommandDryRun:
+		dryRun, err := c.boolean()
+		if err != nil {
+			return errors.New("dry_run must be true or false")
+		}
+		d.SetDryRun(dryRun)
+	case CommandCapture:
+		reason := c.text()
+		if reason == "" {
+			reason = "command"
+		}
+		d.CaptureEvent(reason)
+	case CommandTrigger:
+		sensor := c.text()
+		if sensor == "" {
+			return errors.New("trigger requires the sensor")
+		}
+		d.Trigger(sensor)
+	default:
+		return fmt.Errorf("unknown command %q", c.Command)
+	}
+	return nil
+}
+
+func (c Command) number() (float64, error) {
+	switch v := c.Value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("%v is not a number", c.Value)
+}
+
+func (c Command) boolean() (bool, error) {
+	switch v := c.Value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(v)
+	}
+	return false, fmt.Errorf("%v is not true or false", c.Value)
+}
+
+func (c Command) text() string {
+	if c.Value == nil {
+		return ""
+	}
+	return fmt.Sprint(c.Value)
+}
+
+// Message is a message of the contract, of one of the Types, only the
+// fields of its type are set
+type Message struct {
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	Camera  string `json:"camera"`
+	// Time is when the message was sent, or the event started
+	Time time.Time `json:"time"`
+	// Record is an event's record
+	Record *events.Record `json:"record,omitempty"`
+	// Status is a camera's state
+	Status *Status `json:"status,omitempty"`
+	// Command and Error are the command acknowledged, and why it failed
+	Command *Command `json:"command,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	// Heartbeat is GoAway's health, see heartbeat.Heartbeat
+	Heartbeat *Heartbeat `json:"heartbeat,omitempty"`
+}
+
+// Heartbeat is whether GoAway's cameras are processing frames, and which
+// stopped when they aren't
+type Heartbeat struct {
+	Healthy bool   `json:"healthy"`
+	Problem string `json:"problem,omitempty"`
+}
+
+// Status is the state of a camera
+type Status struct {
+	Status      string  `json:"status"`
+	Armed       bool    `json:"armed"`
+	DryRun      bool    `json:"dry_run"`
+	Sensitivity float64 `json:"sensitivity"`
+}
+
+// EventMessage returns the message of an event
+func EventMessage(r *events.Record) Message {
+	camera := r.Camera
+	if camera == "" {
+		camera = DefaultCamera
+	}
+	return Message{Version: Version, Type: TypeEvent, Camera: camera, Time: r.Event.Start, Record: r}
+}
+
+// StatusMessage returns the message of a camera's state
+func StatusMessage(camera string, d *detector.Detector) Message {
+	return Message{Version: Version, Type: TypeStatus, Camera: camera, Time: time.Now(), Status: &Status{
+		Status:      d.Status(),
+		Armed:       d.Armed(),
+		DryRun:      d.DryRun(),
+		Sensitivity: d.Sensitivity(),
+	}}
+}
+
+// AckMessage returns the acknowledgement of a command, with the error it
+// failed with if any
+func AckMessage(camera string, c Command, err error) Message {
+	m := Message{Version: Version, Type: TypeAck, Camera: camera, Time: time.Now(), Command: &c}
+	if err != nil {
+		m.Error = err.Error()
+	}
+	return m
+}
+
+// HeartbeatMessage returns a heartbeat message, with the problem which made
+// it unhealthy if any
+func HeartbeatMessage(healthy bool, problem string) Message {
+	return Message{Version: Version, Type: TypeHeartbeat, Time: time.Now(), Heartbeat: &Heartbeat{Healthy: healthy, Problem: problem}}
+}
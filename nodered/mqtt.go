@@ -0,0 +1,214 @@
+package nodered
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 packet types, shifted into the first byte of their header
+const (
+	packetConnect    = 1 << 4
+	packetConnack    = 2 << 4
+	packetPublish    = 3 << 4
+	packetSubscribe  = 8 << 4
+	packetSuback     = 9 << 4
+	packetPingreq    = 12 << 4
+	packetPingresp   = 13 << 4
+	packetDisconnect = 14 << 4
+)
+
+// connectOptions are the options of an MQTT connection
+type connectOptions struct {
+	clientID           string
+	username, password string
+	keepAlive          time.Duration
+	// willTopic and willPayload are published, retained, by the broker when
+	// the connection is lost
+	willTopic   string
+	willPayload []byte
+}
+
+// mqttConn is a minimal MQTT 3.1.1 client connection, which publishes and
+// subscribes at QoS 0, all the bridge needs
+type mqttConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// mu serializes writes
+	mu sync.Mutex
+}
+
+// dialMQTT connects to a broker, e.g. tcp://localhost:1883 or
+// tls://broker:8883
+func dialMQTT(ctx context.Context, broker string, o connectOptions) (*mqttConn, error) {
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid MQTT broker %q, expected e.g. tcp://localhost:1883", broker)
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.DialContext(ctx, "tcp", u.Host)
+	case "tls", "ssl", "mqtts":
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: u.Hostname()}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", u.Host)
+	default:
+		return nil, fmt.Errorf("unsupported MQTT broker scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &mqttConn{conn: conn, r: bufio.NewReader(conn)}
+	if err := c.connect(o); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// connect sends the CONNECT packet and waits for the broker to accept it
+func (c *mqttConn) connect(o connectOptions) error {
+	flags := byte(0x02) // clean session
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, 0, 0, 0) // protocol level, flags, keep alive
+	payload := appendString(nil, o.clientID)
+	if o.willTopic != "" {
+		flags |= 0x04 | 0x20 // will, retained
+		payload = appendString(payload, o.willTopic)
+		payload = appendBytes(payload, o.willPayload)
+	}
+	if o.username != "" {
+		flags |= 0x80
+		payload = appendString(payload, o.username)
+	}
+	if o.password != "" {
+		flags |= 0x40
+		payload = appendString(payload, o.password)
+	}
+	body[7] = flags
+	binary.BigEndian.PutUint16(body[8:], uint16(o.keepAlive/time.Second))
+	if err := c.write(packetConnect, append(body, payload...)); err != nil {
+		return err
+	}
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	typ, ack, err := c.read()
+	if err != nil {
+		return err
+	}
+	if typ != packetConnack || len(ack) != 2 {
+		return errors.New("unexpected response to MQTT connect")
+	}
+	if ack[1] != 0 {
+		return fmt.Errorf("MQTT broker refused the connection, return code %d", ack[1])
+	}
+	return nil
+}
+
+// publish publishes a message at QoS 0
+func (c *mqttConn) publish(topic string, payload []byte, retain bool) error {
+	header := byte(packetPublish)
+	if retain {
+		header |= 0x01
+	}
+	return c.write(header, append(appendString(nil, topic), payload...))
+}
+
+// subscribe subscribes to a topic filter at QoS 0, the broker's SUBACK is
+// read with the other packets
+func (c *mqttConn) subscribe(id uint16, filter string) error {
+	body := []byte{byte(id >> 8), byte(id)}
+	body = append(appendString(body, filter), 0)
+	return c.write(packetSubscribe|0x02, body)
+}
+
+func (c *mqttConn) ping() error {
+	return c.write(packetPingreq, nil)
+}
+
+func (c *mqttConn) disconnect() error {
+	return c.write(packetDisconnect, nil)
+}
+
+// write writes a packet
+func (c *mqttConn) write(header byte, body []byte) error {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+// read reads a packet, and returns its type, without the flags, and body
+func (c *mqttConn) read() (byte, []byte, error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(b&0x7f) * mult
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("malformed MQTT packet length")
+		}
+		mult *= 128
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xf0, body, nil
+}
+
+// parsePublish returns the topic and payload of a PUBLISH packet's body,
+// received at QoS 0
+func parsePublish(body []byte) (string, []byte, error) {
+	if len(body) < 2 {
+		return "", nil, errors.New("malformed MQTT publish")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return "", nil, errors.New("malformed MQTT publish")
+	}
+	return string(body[2 : 2+n]), body[2+n:], nil
+}
+
+func (c *mqttConn) close() error {
+	return c.conn.Close()
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b []byte, data []byte) []byte {
+	return append(append(b, byte(len(data)>>8), byte(len(data))), data...)
+}
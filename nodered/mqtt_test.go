@@ -0,0 +1,211 @@
+package nodered
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipe returns a client connection to a fake broker, the other end of it
+func pipe(t *testing.T) (*mqttConn, net.Conn) {
+	t.Helper()
+	client, broker := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		broker.Close()
+	})
+	return &mqttConn{conn: client, r: bufio.NewReader(client)}, broker
+}
+
+// expect reads a packet of the given encoding off the broker's end
+func expect(t *testing.T, broker net.Conn, want []byte) {
+	t.Helper()
+	got := make([]byte, len(want))
+	broker.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(broker, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got packet %x, want %x", got, want)
+	}
+}
+
+func packet(parts ...string) []byte {
+	return []byte(strings.Join(parts, ""))
+}
+
+func TestMQTTConnect(t *testing.T) {
+	tests := []struct {
+		name    string
+		options connectOptions
+		want    []byte
+	}{
+		{
+			"client ID",
+			connectOptions{clientID: "cam", keepAlive: 30 * time.Second},
+			packet("\x10\x0f", "\x00\x04MQTT\x04\x02\x00\x1e", "\x00\x03cam"),
+		},
+		{
+			"will and credentials",
+			connectOptions{clientID: "cam", username: "u", password: "p", keepAlive: time.Minute, willTopic: "t/status", willPayload: []byte("offline")},
+			packet("\x10\x28", "\x00\x04MQTT\x04\xe6\x00\x3c", "\x00\x03cam", "\x00\x08t/status", "\x00\x07offline", "\x00\x01u", "\x00\x01p"),
+		},
+	}
+	for _, tt := range tests {
+		c, broker := pipe(t)
+		errs := make(chan error, 1)
+		go func() { errs <- c.connect(tt.options) }()
+		expect(t, broker, tt.want)
+		if _, err := broker.Write([]byte{packetConnack, 2, 0, 0}); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errs; err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+	}
+}
+
+func TestMQTTConnectRefused(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply []byte
+	}{
+		{"not authorized", []byte{packetConnack, 2, 0, 5}},
+		{"not a CONNACK", []byte{packetSuback, 3, 0, 1, 0}},
+		{"malformed CONNACK", []byte{packetConnack, 1, 0}},
+		{"connection closed", nil},
+	}
+	for _, tt := range tests {
+		c, broker := pipe(t)
+		errs := make(chan error, 1)
+		go func() { errs <- c.connect(connectOptions{clientID: "cam"}) }()
+		if _, err := io.ReadFull(broker, make([]byte, 2+10+5)); err != nil {
+			t.Fatal(err)
+		}
+		broker.Write(tt.reply)
+		if tt.reply == nil {
+			broker.Close()
+		}
+		if err := <-errs; err == nil {
+			t.Errorf("%s: connected", tt.name)
+		}
+	}
+}
+
+func TestMQTTPublishAndSubscribe(t *testing.T) {
+	c, broker := pipe(t)
+	tests := []struct {
+		name  string
+		write func() error
+		want  []byte
+	}{
+		{"publish", func() error { return c.publish("a/b", []byte("hi"), false) }, packet("\x30\x07", "\x00\x03a/b", "hi")},
+		{"retained publish", func() error { return c.publish("a/b", nil, true) }, packet("\x31\x05", "\x00\x03a/b")},
+		{"subscribe", func() error { return c.subscribe(258, "a/#") }, packet("\x82\x08", "\x01\x02", "\x00\x03a/#", "\x00")},
+		{"ping", c.ping, []byte{packetPingreq, 0}},
+		{"disconnect", c.disconnect, []byte{packetDisconnect, 0}},
+	}
+	for _, tt := range tests {
+		errs := make(chan error, 1)
+		go func() { errs <- tt.write() }()
+		expect(t, broker, tt.want)
+		if err := <-errs; err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+	}
+}
+
+func TestMQTTRoundTrip(t *testing.T) {
+	c, broker := pipe(t)
+	b := &mqttConn{conn: broker, r: bufio.NewReader(broker)}
+	// the remaining length takes 1 to 3 bytes for these
+	for _, size := range []int{0, 1, 127, 128, 16383, 16384, 100000} {
+		payload := bytes.Repeat([]byte{'x'}, size)
+		errs := make(chan error, 1)
+		go func() { errs <- b.publish("goaway/events", payload, false) }()
+		typ, body, err := c.read()
+		if err != nil {
+			t.Fatalf("%d bytes: %s", size, err)
+		}
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+		if typ != packetPublish {
+			t.Errorf("%d bytes: got packet type %x, want %x", size, typ, packetPublish)
+		}
+		topic, got, err := parsePublish(body)
+		if err != nil || topic != "goaway/events" || !bytes.Equal(got, payload) {
+			t.Errorf("%d bytes: got topic %q, %d bytes and error %v", size, topic, len(got), err)
+		}
+	}
+}
+
+func TestMQTTReadMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   error
+	}{
+		{"length over 4 bytes", []byte{packetPublish, 0xff, 0xff, 0xff, 0xff, 0x01}, nil},
+		{"truncated length", []byte{packetPublish, 0x80}, io.EOF},
+		{"truncated body", []byte{packetPublish, 5, 0, 1}, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		c, broker := pipe(t)
+		go func() {
+			broker.Write(tt.packet)
+			broker.Close()
+		}()
+		_, _, err := c.read()
+		if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+		}
+		if tt.want == nil && (err == nil || !strings.Contains(err.Error(), "malformed")) {
+			t.Errorf("%s: got error %v, want a malformed length", tt.name, err)
+		}
+	}
+}
+
+func TestParsePublishMalformed(t *testing.T) {
+	for _, body := range [][]byte{nil, {0}, {0, 5, 'a', 'b'}} {
+		if _, _, err := parsePublish(body); err == nil {
+			t.Errorf("%x: parsed", body)
+		}
+	}
+}
+
+func TestDialMQTTHonoursContext(t *testing.T) {
+	// a broker which accepts connections but never completes the TLS
+	// handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if _, err := dialMQTT(ctx, "tls://"+l.Addr().String(), connectOptions{clientID: "cam"}); err == nil {
+		t.Error("connected")
+	}
+	if took := time.Since(started); took > 5*time.Second {
+		t.Errorf("took %s to give up once the context was done", took)
+	}
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	default:
+	}
+}
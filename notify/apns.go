@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// APNsProduction and APNsSandbox are the hosts of the APNs API, apps
+	// built for development receive notifications from the sandbox
+	APNsProduction = "https://api.push.apple.com"
+	APNsSandbox    = "https://api.sandbox.push.apple.com"
+
+	// apnsTokenTTL is how long a provider token is used, APNs rejects tokens
+	// older than an hour and refreshed more than every 20 minutes
+	apnsTokenTTL = 50 * time.Minute
+)
+
+// APNs sends push notifications to iOS apps with the Apple Push
+// Notification service, authenticated with a token signing key
+type APNs struct {
+	keyID  string
+	teamID string
+	topic  string
+	key    *ecdsa.PrivateKey
+	host   string
+	client *http.Client
+
+	mu     sync.Mutex
+	token  string
+	issued time.Time
+}
+
+// NewAPNs is the constructor for APNs, given the token signing key (.p8)
+// created in the Apple developer account, its ID, the team ID, and the
+// app's bundle ID, the topic of its notifications. The host is
+// APNsProduction, or APNsSandbox for development builds
+func NewAPNs(p8 []byte, keyID, teamID, bundleID, host string) (*APNs, error) {
+	block, _ := pem.Decode(p8)
+	if block == nil {
+		return nil, errors.New("invalid APNs key: no private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APNs key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid APNs key: not an ECDSA key")
+	}
+	if keyID == "" || teamID == "" || bundleID == "" {
+		return nil, errors.New("the APNs key ID, team ID and bundle ID are required")
+	}
+	return &APNs{keyID: keyID, teamID: teamID, topic: bundleID, key: key, host: host, client: http.DefaultClient}, nil
+}
+
+// providerToken returns the JWT APNs requests are authenticated with,
+// signing a new one when the last one is too old
+func (a *APNs) providerToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Since(a.issued) < apnsTokenTTL {
+		return a.token, nil
+	}
+	now := time.Now()
+	header, err := jwtSegment(map[string]string{"alg": "ES256", "kid": a.keyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := jwtSegment(map[string]interface{}{"iss": a.teamID, "iat": now.Unix()})
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(header + "." + claims))
+	r, s, err := ecdsa.Sign(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWTs carry ES256 signatures as the two 32 byte integers
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	a.token, a.issued = header+"."+claims+"."+base64.RawURLEncoding.EncodeToString(sig), now
+	return a.token, nil
+}
+
+// push implements pushService
+func (a *APNs) push(ctx context.Context, token string, m pushMessage) error {
+	providerToken, err := a.providerToken()
+	if err != nil {
+		return err
+	}
+	aps := map[string]interface{}{"alert": map[string]string{"title": m.Title, "body": m.Body}, "sound": "default"}
+	payload := map[string]interface{}{"aps": aps}
+	if m.Image != "" {
+		// a notification service extension of the app downloads the image,
+		// which it is given the chance to by mutable-content
+		aps["mutable-content"] = 1
+		payload["image"] = m.Image
+	}
+	for k, v := range m.Data {
+		payload[k] = v
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.host+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+		return nil
+	case http.StatusGone:
+		// APNs responds Unregistered for tokens of uninstalled apps
+		return errUnregistered
+	case http.StatusBadRequest:
+		reason := struct {
+			Reason string `json:"reason"`
+		}{}
+		json.NewDecoder(io.LimitReader(resp.Body, 1024)).Decode(&reason)
+		if reason.Reason == "BadDeviceToken" {
+			return errUnregistered
+		}
+		return fmt.Errorf("APNs responded with %s: %s", resp.Status, reason.Reason)
+	case http.StatusForbidden:
+		a.mu.Lock()
+		a.token = ""
+		a.mu.Unlock()
+	}
+	return fmt.Errorf("APNs %s", responseError(resp))
+}
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/events"
+)
+
+// notifier is a notifier of a Dispatcher, with its rate limit, breaker and
+// statistics
+type notifier struct {
+	name     string
+	notifier Notifier
+
+	mu      sync.Mutex
+	limit   *rateLimit
+	breaker *breaker
+	counts  Stats
+	// retries and backoff are how failed notifications are retried, see
+	// WithRetries
+	retries int
+	backoff time.Duration
+}
+
+// notify delivers an event unless the notifier is over its rate limit or its
+// breaker is open, and returns the number of attempts it made
+func (n *notifier) notify(ctx context.Context, r *events.Record) (int, error) {
+	now := time.Now()
+	n.mu.Lock()
+	if n.breaker != nil && !n.breaker.allow(now) {
+		n.counts.Rejected++
+		n.mu.Unlock()
+		return 0, ErrCircuitOpen
+	}
+	if n.limit != nil && !n.limit.allow(now) {
+		n.counts.RateLimited++
+		if n.breaker != nil {
+			n.breaker.cancel()
+		}
+		n.mu.Unlock()
+		return 0, ErrRateLimited
+	}
+	n.mu.Unlock()
+
+	attempts, err := 1, n.notifier.Notify(ctx, r)
+	for backoff := n.backoff; err != nil && attempts <= n.retries && ctx.Err() == nil; backoff *= 2 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+			err = n.notifier.Notify(ctx, r)
+			attempts++
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err != nil {
+		n.counts.Failed++
+	} else {
+		n.counts.Sent++
+	}
+	if n.breaker != nil {
+		n.breaker.record(err == nil, time.Now())
+	}
+	return attempts, err
+}
+
+// stats returns the notifier's statistics
+func (n *notifier) stats() Stats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	s := n.counts
+	s.Name = n.name
+	s.Breaker = BreakerClosed
+	if n.breaker != nil {
+		s.Breaker = n.breaker.state(time.Now())
+	}
+	return s
+}
+
+// rateLimit is a token bucket holding up to max notifications, refilled over
+// the period
+type rateLimit struct {
+	max    int
+	per    time.Duration
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token if there is one
+func (l *rateLimit) allow(now time.Time) bool {
+	if l.last.IsZero() {
+		l.tokens = float64(l.max)
+	} else if l.per > 0 {
+		l.tokens += float64(l.max) * float64(now.Sub(l.last)) / float64(l.per)
+	}
+	if l.tokens > float64(l.max) {
+		l.tokens = float64(l.max)
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// breaker is a circuit breaker, it opens after a number of failures in a row
+// and lets a single trial through once its cooldown is over
+type breaker struct {
+	failures int
+	cooldown time.Duration
+
+	failed   int
+	openedAt time.Time
+	trial    bool
+}
+
+// state returns the state of the breaker
+func (b *breaker) state(now time.Time) string {
+	switch {
+	case b.failed < b.failures:
+		return BreakerClosed
+	case b.trial || now.Sub(b.openedAt) >= b.cooldown:
+		return BreakerHalfOpen
+	}
+	return BreakerOpen
+}
+
+// allow returns whether a notification may be delivered, once half open
+// only the trial is until it completes
+func (b *breaker) allow(now time.Time) bool {
+	switch b.state(now) {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return false
+}
+
+// cancel gives up on a trial which wasn't delivered
+func (b *breaker) cancel() {
+	b.trial = false
+}
+
+// record records the outcome of a delivery
+func (b *breaker) record(delivered bool, now time.Time) {
+	b.trial = false
+	if delivered {
+		b.failed = 0
+		return
+	}
+	if b.failed++; b.failed >= b.failures {
+		b.openedAt = now
+	}
+}
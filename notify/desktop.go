@@ -0,0 +1,153 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+// desktopSnapshotTTL is how long the snapshot of a desktop notification is
+// kept, for the notification to show it
+const desktopSnapshotTTL = time.Minute
+
+// windowsToast shows a toast with PowerShell, with its text and image in the
+// environment rather than the script, so that they needn't be escaped
+const windowsToast = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastImageAndText02)
+$xml.GetElementsByTagName('text').Item(0).AppendChild($xml.CreateTextNode($env:GOAWAY_TITLE)) > $null
+$xml.GetElementsByTagName('text').Item(1).AppendChild($xml.CreateTextNode($env:GOAWAY_BODY)) > $null
+if ($env:GOAWAY_IMAGE) { $xml.GetElementsByTagName('image').Item(0).SetAttribute('src', $env:GOAWAY_IMAGE) }
+$app = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($app).Show([Windows.UI.Notifications.ToastNotification]::new($xml))
+`
+
+// desktop raises native desktop notifications
+type desktop struct {
+	template *Template
+	media    storage.Storage
+	// tool is the program notifications are raised with
+	tool string
+}
+
+// Desktop returns a notifier which raises native desktop notifications on
+// the machine GoAway runs on, with the subject and body rendered by the
+// given template and the event's snapshot, read from its storage, for
+// people who sit at it. They are raised with notify-send on Linux and BSD,
+// terminal-notifier, or osascript without snapshots, on macOS, and a toast
+// on Windows. A nil template renders the defaults, and a nil storage leaves
+// snapshots out
+func Desktop(t *Template, media storage.Storage) (Notifier, error) {
+	d := &desktop{template: t, media: media}
+	for _, tool := range desktopTools(runtime.GOOS) {
+		if _, err := exec.LookPath(tool); err == nil {
+			d.tool = tool
+			break
+		}
+	}
+	if d.tool == "" {
+		return nil, fmt.Errorf("no desktop notification tool found, expected one of %v", desktopTools(runtime.GOOS))
+	}
+	if d.template == nil {
+		var err error
+		if d.template, err = NewTemplate(TemplateConfig{}); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// desktopTools are the programs which raise notifications on an OS, in
+// order of preference
+func desktopTools(goos string) []string {
+	switch goos {
+	case "darwin":
+		return []string{"terminal-notifier", "osascript"}
+	case "windows":
+		return []string{"powershell"}
+	default:
+		return []string{"notify-send"}
+	}
+}
+
+// Notify implements Notifier
+func (d *desktop) Notify(ctx context.Context, r *events.Record) error {
+	c, err := d.template.Render(r)
+	if err != nil {
+		return err
+	}
+	// the notification is still worth raising without its snapshot
+	image, _ := d.snapshot(r)
+	cmd := exec.CommandContext(ctx, d.tool, desktopArgs(d.tool, c.Subject, c.Body, image)...)
+	cmd.Env = append(os.Environ(), "GOAWAY_TITLE="+c.Subject, "GOAWAY_BODY="+c.Body)
+	if image != "" {
+		cmd.Env = append(cmd.Env, "GOAWAY_IMAGE=file:///"+filepath.ToSlash(image))
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", d.tool, err, out)
+	}
+	return nil
+}
+
+// desktopArgs returns the arguments of a notification tool
+func desktopArgs(tool, title, body, image string) []string {
+	switch tool {
+	case "terminal-notifier":
+		args := []string{"-title", "GoAway", "-subtitle", title, "-message", body, "-group", "goaway"}
+		if image != "" {
+			args = append(args, "-contentImage", image)
+		}
+		return args
+	case "osascript":
+		return []string{"-e", "on run argv", "-e", "display notification (item 2 of argv) with title (item 1 of argv)", "-e", "end run", title, body}
+	case "powershell":
+		return []string{"-NoProfile", "-NonInteractive", "-Command", windowsToast}
+	default:
+		args := []string{"--app-name=GoAway"}
+		if image != "" {
+			args = append(args, "--icon="+image)
+		}
+		return append(args, title, body)
+	}
+}
+
+// snapshot copies the event's first snapshot to a temporary file, which is
+// removed once the notification has shown it, and returns its path
+func (d *desktop) snapshot(r *events.Record) (string, error) {
+	if d.media == nil {
+		return "", nil
+	}
+	for _, obj := range r.Media {
+		if !isImage(obj.Name) {
+			continue
+		}
+		src, err := d.media.Open(obj.Name)
+		if err != nil {
+			return "", err
+		}
+		defer src.Close()
+		f, err := os.CreateTemp("", "goaway-*"+filepath.Ext(obj.Name))
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(f, src)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+		time.AfterFunc(desktopSnapshotTTL, func() { os.Remove(f.Name()) })
+		return f.Name(), nil
+	}
+	return "", nil
+}
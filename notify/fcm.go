@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// fcmScope is the OAuth 2 scope of the FCM HTTP v1 API
+	fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+	// fcmEndpoint is the FCM HTTP v1 API's send endpoint, of a project
+	fcmEndpoint = "https://fcm.googleapis.com/v1/projects/%s/messages:send"
+)
+
+// FCM sends push notifications with Firebase Cloud Messaging, to Android,
+// iOS and web apps, authenticated as a service account of the app's
+// Firebase project
+type FCM struct {
+	projectID string
+	email     string
+	key       *rsa.PrivateKey
+	tokenURL  string
+	endpoint  string
+	client    *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// NewFCM is the constructor for FCM, given the JSON key of a service
+// account of the Firebase project, as downloaded from the Firebase console
+func NewFCM(serviceAccount []byte) (*FCM, error) {
+	sa := struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}{}
+	if err := json.Unmarshal(serviceAccount, &sa); err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	if sa.ProjectID == "" || sa.ClientEmail == "" {
+		return nil, errors.New("invalid service account key: project_id and client_email are required")
+	}
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid service account key: no private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid service account key: not an RSA key")
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &FCM{
+		projectID: sa.ProjectID,
+		email:     sa.ClientEmail,
+		key:       key,
+		tokenURL:  sa.TokenURI,
+		endpoint:  fmt.Sprintf(fcmEndpoint, sa.ProjectID),
+		client:    http.DefaultClient,
+	}, nil
+}
+
+// token returns an access token for the FCM API, exchanging a JWT signed
+// with the service account's key for one when the last one expires
+func (f *FCM) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.accessToken != "" && time.Now().Before(f.expiry) {
+		return f.accessToken, nil
+	}
+	now := time.Now()
+	header, err := jwtSegment(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := jwtSegment(map[string]interface{}{
+		"iss":   f.email,
+		"scope": fcmScope,
+		"aud":   f.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(header + "." + claims))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {header + "." + claims + "." + base64.RawURLEncoding.EncodeToString(sig)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get an FCM access token, %s", responseError(resp))
+	}
+	t := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", err
+	}
+	// renew the token a minute before it expires
+	f.accessToken, f.expiry = t.AccessToken, now.Add(time.Duration(t.ExpiresIn)*time.Second-time.Minute)
+	return f.accessToken, nil
+}
+
+// push implements pushService
+func (f *FCM) push(ctx context.Context, token string, m pushMessage) error {
+	accessToken, err := f.token(ctx)
+	if err != nil {
+		return err
+	}
+	notification := map[string]string{"title": m.Title, "body": m.Body}
+	if m.Image != "" {
+		notification["image"] = m.Image
+	}
+	body, err := json.Marshal(map[string]interface{}{"message": map[string]interface{}{
+		"token":        token,
+		"notification": notification,
+		"data":         m.Data,
+	}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+		return nil
+	case http.StatusNotFound:
+		// FCM responds UNREGISTERED for tokens of uninstalled apps
+		return errUnregistered
+	case http.StatusUnauthorized:
+		f.mu.Lock()
+		f.accessToken = ""
+		f.mu.Unlock()
+	}
+	return fmt.Errorf("FCM %s", responseError(resp))
+}
+
+// responseError describes an error response of a push service, with the
+// start of its body
+func responseError(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Sprintf("responded with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
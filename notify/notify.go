@@ -0,0 +1,308 @@
+// Package notify delivers events to notifiers, e.g. email or a push service,
+// each behind its own rate limit and circuit breaker so that a failing or
+// flooded notifier doesn't hold back the others
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/events"
+)
+
+var (
+	// ErrRateLimited is returned for notifications dropped as their notifier
+	// is over its rate limit
+	ErrRateLimited = errors.New("notifier rate limit exceeded")
+
+	// ErrCircuitOpen is returned for notifications dropped as their
+	// notifier's circuit breaker is open
+	ErrCircuitOpen = errors.New("notifier circuit breaker is open")
+)
+
+// Notifier delivers the record of an event, e.g. by email
+type Notifier interface {
+	Notify(ctx context.Context, r *events.Record) error
+}
+
+// NotifierFunc is a function used as a Notifier
+type NotifierFunc func(ctx context.Context, r *events.Record) error
+
+// Notify implements Notifier
+func (f NotifierFunc) Notify(ctx context.Context, r *events.Record) error {
+	return f(ctx, r)
+}
+
+// Option configures optional behaviour of a notifier added to a Dispatcher
+type Option func(*notifier)
+
+// WithRateLimit lets the notifier deliver at most the given number of
+// notifications per period, e.g. to stay within an SMS quota during a burst
+// of events, notifications over the limit are dropped
+func WithRateLimit(notifications int, per time.Duration) Option {
+	return func(n *notifier) {
+		n.limit = &rateLimit{max: notifications, per: per}
+	}
+}
+
+// WithCircuitBreaker stops delivering to the notifier after the given number
+// of failures in a row, e.g. during an SMTP outage, rather than hammering it
+// and waiting for it to time out. After the cooldown one notification is let
+// through to try it again, the breaker closes if it is delivered
+func WithCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(n *notifier) {
+		if failures < 1 {
+			failures = 1
+		}
+		n.breaker = &breaker{failures: failures, cooldown: cooldown}
+	}
+}
+
+// WithRetries retries notifications which fail up to the given number of
+// times, waiting the backoff, doubled after each retry, in between, e.g. to
+// ride out a flaky network. Notifications dropped by the rate limit or the
+// circuit breaker aren't retried
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(n *notifier) {
+		n.retries, n.backoff = retries, backoff
+	}
+}
+
+// DeadLetterQueue keeps the notifications which failed, e.g.
+// cluster.DeadLetters, see Dispatcher.DeadLetters
+type DeadLetterQueue interface {
+	// AddNotification keeps the record of an event which the named notifiers
+	// failed to deliver, after the given number of attempts, with the error
+	// of the first
+	AddNotification(r *events.Record, notifiers []string, attempts int, err error) error
+}
+
+// Dispatcher delivers every event to all its notifiers concurrently
+type Dispatcher struct {
+	mu          sync.Mutex
+	notifiers   []*notifier
+	route       func(r *events.Record) []string
+	deadLetters DeadLetterQueue
+}
+
+// NewDispatcher is the constructor for a Dispatcher
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Add adds a notifier, named after its channel, e.g. "email", see
+// api.Subscribers
+func (d *Dispatcher) Add(name string, n Notifier, opts ...Option) {
+	nt := &notifier{name: name, notifier: n}
+	for _, opt := range opts {
+		opt(nt)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notifiers = append(d.notifiers, nt)
+}
+
+// Route restricts the notifiers each event is delivered to, to those named
+// by the given function, e.g. rules.Engine.Actions. Events are delivered to
+// all notifiers without one
+func (d *Dispatcher) Route(route func(r *events.Record) []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.route = route
+}
+
+// DeadLetters keeps the notifications which failed after their retries, see
+// WithRetries, or were dropped as their notifier's circuit breaker was open,
+// in the queue, so that none is lost silently. Each event is kept once, with
+// the notifiers which failed to deliver it, for NotifyOnly to deliver it to
+// them again, e.g. with cluster.DeadLetters.Resend. Notifications over a
+// rate limit are dropped on purpose, and aren't kept
+func (d *Dispatcher) DeadLetters(q DeadLetterQueue) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deadLetters = q
+}
+
+// Notify delivers an event to all notifiers, or those it is routed to, see
+// Route, and returns once they are done. Notifiers which fail, are over
+// their rate limit or whose breaker is open don't keep it from being
+// delivered to the others, their errors are returned together
+func (d *Dispatcher) Notify(ctx context.Context, r *events.Record) error {
+	d.mu.Lock()
+	notifiers, route := append([]*notifier{}, d.notifiers...), d.route
+	d.mu.Unlock()
+	if route == nil {
+		return d.deliver(ctx, r, notifiers)
+	}
+	return d.deliver(ctx, r, named(notifiers, route(r)))
+}
+
+// NotifyOnly delivers an event to the named notifiers, whatever its route,
+// e.g. those which failed to deliver a dead letter, see DeadLetters
+func (d *Dispatcher) NotifyOnly(ctx context.Context, r *events.Record, names ...string) error {
+	d.mu.Lock()
+	notifiers := append([]*notifier{}, d.notifiers...)
+	d.mu.Unlock()
+	return d.deliver(ctx, r, named(notifiers, names))
+}
+
+// named returns the notifiers with the given names
+func named(notifiers []*notifier, names []string) []*notifier {
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+	routed := []*notifier{}
+	for _, n := range notifiers {
+		if wanted[n.name] {
+			routed = append(routed, n)
+		}
+	}
+	return routed
+}
+
+// deliver delivers an event to the given notifiers, and keeps it in the
+// dead letters for those which failed
+func (d *Dispatcher) deliver(ctx context.Context, r *events.Record, notifiers []*notifier) error {
+	errs, attempts := make([]error, len(notifiers)), make([]int, len(notifiers))
+	wg := sync.WaitGroup{}
+	for i, n := range notifiers {
+		wg.Add(1)
+		go func(i int, n *notifier) {
+			defer wg.Done()
+			attempts[i], errs[i] = n.notify(ctx, r)
+		}(i, n)
+	}
+	wg.Wait()
+	failed, dead, tried := []string{}, []string{}, 0
+	var first, firstDead error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed = append(failed, fmt.Sprintf("%s: %s", notifiers[i].name, err))
+		if first == nil {
+			first = err
+		}
+		if errors.Is(err, ErrRateLimited) {
+			continue
+		}
+		dead = append(dead, notifiers[i].name)
+		if firstDead == nil {
+			firstDead = err
+		}
+		if attempts[i] > tried {
+			tried = attempts[i]
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	d.mu.Lock()
+	deadLetters := d.deadLetters
+	d.mu.Unlock()
+	if deadLetters != nil && len(dead) > 0 {
+		if err := deadLetters.AddNotification(r, dead, tried, firstDead); err != nil {
+			log.Printf("could not keep the notification of event %s in the dead letters: %s", r.ID, err)
+		}
+	}
+	return &Error{Failed: failed, first: first}
+}
+
+// Error is returned when an event couldn't be delivered to some notifiers
+type Error struct {
+	// Failed describes the failure of each notifier
+	Failed []string
+	first  error
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return "could not notify " + strings.Join(e.Failed, "; ")
+}
+
+// Unwrap returns the error of the first notifier which failed, e.g. to check
+// for ErrRateLimited
+func (e *Error) Unwrap() error {
+	return e.first
+}
+
+// Breaker states, as reported by Stats
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// Stats are the delivery statistics of a notifier
+type Stats struct {
+	Name string `json:"name"`
+	// Breaker is the state of its circuit breaker, always BreakerClosed
+	// without one
+	Breaker string `json:"breaker"`
+	// Sent and Failed count the notifications delivered and which failed,
+	// RateLimited and Rejected those dropped by its rate limit and by its
+	// circuit breaker
+	Sent        int `json:"sent"`
+	Failed      int `json:"failed"`
+	RateLimited int `json:"rate_limited"`
+	Rejected    int `json:"rejected"`
+}
+
+// Stats returns the delivery statistics of every notifier, sorted by name
+func (d *Dispatcher) Stats() []Stats {
+	d.mu.Lock()
+	notifiers := append([]*notifier{}, d.notifiers...)
+	d.mu.Unlock()
+	stats := []Stats{}
+	for _, n := range notifiers {
+		stats = append(stats, n.stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// SimulatedReason is the reason of the events fabricated by SimulateEvent,
+// e.g. for notifiers to mark them as tests
+const SimulatedReason = "simulated"
+
+// ReplayEvent delivers a stored event to the notifiers again, e.g. after
+// fixing one which was broken when the event was detected
+func (d *Dispatcher) ReplayEvent(ctx context.Context, store events.Store, id string) error {
+	r, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	return d.Notify(ctx, r)
+}
+
+// SimulateEvent fabricates an event of a camera, see SimulatedEvent, and
+// delivers it to the notifiers, to verify the alerting chain end to end
+func (d *Dispatcher) SimulateEvent(ctx context.Context, camera string) (*events.Record, error) {
+	r := SimulatedEvent(camera)
+	return r, d.Notify(ctx, r)
+}
+
+// SimulatedEvent fabricates the record of an event of a camera, starting
+// now, with the SimulatedReason and full confidence, e.g. to test a
+// notifier. It isn't stored, and has no media
+func SimulatedEvent(camera string) *events.Record {
+	now := time.Now()
+	return &events.Record{
+		ID:     fmt.Sprintf("simulated-%d", now.UnixNano()),
+		Camera: camera,
+		Event: detector.Event{
+			Start:      now,
+			End:        now,
+			Confidence: 1,
+			Reason:     SimulatedReason,
+		},
+	}
+}
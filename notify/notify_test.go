@@ -0,0 +1,144 @@
+package notify_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/GoAway/cluster"
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/notify"
+)
+
+// flaky is a notifier which fails until it is fixed
+type flaky struct {
+	attempts int
+	fixed    bool
+}
+
+func (f *flaky) Notify(ctx context.Context, r *events.Record) error {
+	f.attempts++
+	if !f.fixed {
+		return errors.New("SMTP server unreachable")
+	}
+	return nil
+}
+
+func TestFailedNotificationsAreDeadLettered(t *testing.T) {
+	letters, err := cluster.NewDeadLetters(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	email, push := &flaky{}, &flaky{fixed: true}
+	d := notify.NewDispatcher()
+	d.Add("email", email, notify.WithRetries(2, time.Millisecond))
+	d.Add("push", push)
+	d.DeadLetters(letters)
+
+	r := &events.Record{ID: "20240101T100000Z-1"}
+	if err := d.Notify(context.Background(), r); err == nil {
+		t.Fatal("expected the email notifier to fail")
+	}
+	if email.attempts != 3 || push.attempts != 1 {
+		t.Fatalf("expected email to be retried twice and push delivered once, got %d and %d attempts", email.attempts, push.attempts)
+	}
+	list, err := letters.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Record.ID != r.ID || len(list[0].Notifiers) != 1 || list[0].Notifiers[0] != "email" || list[0].Attempts != 3 {
+		t.Fatalf("expected the email notification to be dead lettered after 3 attempts, got %+v", list)
+	}
+	if err := letters.Replay(r.ID, nil); !errors.Is(err, cluster.ErrNotUpload) {
+		t.Fatalf("expected a notification not to be replayed as an upload, got %v", err)
+	}
+
+	// resending while it still fails keeps it in the dead letters
+	if err := letters.Resend(context.Background(), r.ID, d); err == nil {
+		t.Fatal("expected the resent notification to fail again")
+	}
+	if _, err := letters.Get(r.ID); err != nil {
+		t.Fatalf("expected the notification to be dead lettered again, got %v", err)
+	}
+
+	email.fixed, email.attempts, push.attempts = true, 0, 0
+	if err := letters.Resend(context.Background(), r.ID, d); err != nil {
+		t.Fatal(err)
+	}
+	if email.attempts != 1 || push.attempts != 0 {
+		t.Fatalf("expected the notification to be resent to email only, got %d and %d attempts", email.attempts, push.attempts)
+	}
+	if _, err := letters.Get(r.ID); !errors.Is(err, events.ErrNotFound) {
+		t.Fatalf("expected the delivered notification to leave the dead letters, got %v", err)
+	}
+}
+
+func TestFailedResendKeepsTheDeadLetter(t *testing.T) {
+	letters, err := cluster.NewDeadLetters(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &events.Record{ID: "20240101T100000Z-1"}
+	if err := letters.AddNotification(r, []string{"email"}, 3, errors.New("SMTP server unreachable")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a dispatcher which doesn't keep its dead letters, or keeps them
+	// elsewhere, still leaves the letter to resend later
+	email := &flaky{}
+	d := notify.NewDispatcher()
+	d.Add("email", email)
+	if err := letters.Resend(context.Background(), r.ID, d); err == nil {
+		t.Fatal("expected the resent notification to fail again")
+	}
+	l, err := letters.Get(r.ID)
+	if err != nil {
+		t.Fatalf("expected the dead letter to be kept, got %v", err)
+	}
+	if len(l.Notifiers) != 1 || l.Notifiers[0] != "email" || l.Attempts != 3 {
+		t.Fatalf("expected the dead letter to be unchanged, got %+v", l)
+	}
+
+	email.fixed = true
+	if err := letters.Resend(context.Background(), r.ID, d); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := letters.Get(r.ID); !errors.Is(err, events.ErrNotFound) {
+		t.Fatalf("expected the delivered notification to leave the dead letters, got %v", err)
+	}
+}
+
+func TestRateLimitedNotificationsAreNotDeadLettered(t *testing.T) {
+	letters, err := cluster.NewDeadLetters(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := notify.NewDispatcher()
+	d.Add("sms", &flaky{fixed: true}, notify.WithRateLimit(1, time.Hour))
+	d.DeadLetters(letters)
+	d.Notify(context.Background(), &events.Record{ID: "a"})
+	if err := d.Notify(context.Background(), &events.Record{ID: "b"}); !errors.Is(err, notify.ErrRateLimited) {
+		t.Fatalf("expected the second notification to be rate limited, got %v", err)
+	}
+	if list, _ := letters.List(); len(list) != 0 {
+		t.Fatalf("expected rate limited notifications to be dropped, got %+v", list)
+	}
+}
+
+func TestNotificationsRejectedByTheBreakerAreDeadLettered(t *testing.T) {
+	letters, err := cluster.NewDeadLetters(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := notify.NewDispatcher()
+	d.Add("email", &flaky{}, notify.WithCircuitBreaker(1, time.Hour))
+	d.DeadLetters(letters)
+	d.Notify(context.Background(), &events.Record{ID: "a"})
+	if err := d.Notify(context.Background(), &events.Record{ID: "b"}); !errors.Is(err, notify.ErrCircuitOpen) {
+		t.Fatalf("expected the breaker to open, got %v", err)
+	}
+	if list, _ := letters.List(); len(list) != 2 {
+		t.Fatalf("expected both notifications to be dead lettered, got %+v", list)
+	}
+}
@@ -0,0 +1,227 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/events"
+)
+
+// Platforms of devices push notifications are sent to
+const (
+	PlatformFCM  = "fcm"
+	PlatformAPNs = "apns"
+)
+
+// errUnregistered is returned by push services for device tokens which are
+// no longer valid, e.g. of an app which was uninstalled
+var errUnregistered = errors.New("device token is no longer registered")
+
+// Device is a device push notifications are sent to, e.g. a phone running a
+// mobile app which registered itself
+type Device struct {
+	// Token is the device's registration token for its platform's push
+	// service
+	Token    string `json:"token"`
+	Platform string `json:"platform"`
+	// Name describes the device, e.g. "Ana's phone"
+	Name       string    `json:"name,omitempty"`
+	Registered time.Time `json:"registered"`
+}
+
+// Devices are the devices registered for push notifications, kept in a JSON
+// file
+type Devices struct {
+	mu      sync.Mutex
+	path    string
+	devices map[string]Device
+}
+
+// NewDevices is the constructor for Devices kept in the given file, which is
+// created on the first registration
+func NewDevices(path string) (*Devices, error) {
+	d := &Devices{path: path, devices: map[string]Device{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	devices := []Device{}
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, fmt.Errorf("invalid devices file %s: %w", path, err)
+	}
+	for _, dev := range devices {
+		d.devices[dev.Token] = dev
+	}
+	return d, nil
+}
+
+// Register registers a device, or updates it if its token is registered
+func (d *Devices) Register(dev Device) error {
+	if dev.Token == "" {
+		return errors.New("device token is required")
+	}
+	if dev.Platform != PlatformFCM && dev.Platform != PlatformAPNs {
+		return fmt.Errorf("unknown platform %q, expected %s or %s", dev.Platform, PlatformFCM, PlatformAPNs)
+	}
+	if dev.Registered.IsZero() {
+		dev.Registered = time.Now().UTC()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.devices[dev.Token] = dev
+	return d.save()
+}
+
+// Unregister unregisters the device with the given token
+func (d *Devices) Unregister(token string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.devices[token]; !ok {
+		return events.ErrNotFound
+	}
+	delete(d.devices, token)
+	return d.save()
+}
+
+// List returns the registered devices, oldest first
+func (d *Devices) List() []Device {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	devices := []Device{}
+	for _, dev := range d.devices {
+		devices = append(devices, dev)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Registered.Before(devices[j].Registered) })
+	return devices
+}
+
+// save writes the devices to their file, it is called with the lock held
+func (d *Devices) save() error {
+	devices := []Device{}
+	for _, dev := range d.devices {
+		devices = append(devices, dev)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Token < devices[j].Token })
+	data, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := d.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.path)
+}
+
+// pushMessage is what is pushed to a device
+type pushMessage struct {
+	Title, Body string
+	// Image is the URL of the event's snapshot, shown as a thumbnail
+	Image string
+	// Data is passed to the app, the event's ID and camera
+	Data map[string]string
+}
+
+// pushService sends push notifications to the devices of a platform
+type pushService interface {
+	push(ctx context.Context, token string, m pushMessage) error
+}
+
+// push pushes notifications to every registered device
+type push struct {
+	devices  *Devices
+	template *Template
+	services map[string]pushService
+}
+
+// Push returns a notifier which pushes notifications, with the subject and
+// body rendered by the given template, to every device registered for the
+// given push services, e.g. the users' phones. Either service may be nil if
+// no app uses it. The event's snapshot is sent as a thumbnail when the
+// template has a MediaURL the devices can reach. Devices whose tokens the
+// services no longer accept are unregistered
+func Push(devices *Devices, t *Template, fcm *FCM, apns *APNs) (Notifier, error) {
+	if t == nil {
+		var err error
+		if t, err = NewTemplate(TemplateConfig{}); err != nil {
+			return nil, err
+		}
+	}
+	p := &push{devices: devices, template: t, services: map[string]pushService{}}
+	if fcm != nil {
+		p.services[PlatformFCM] = fcm
+	}
+	if apns != nil {
+		p.services[PlatformAPNs] = apns
+	}
+	if len(p.services) == 0 {
+		return nil, errors.New("no push service configured")
+	}
+	return p, nil
+}
+
+// Notify implements Notifier
+func (p *push) Notify(ctx context.Context, r *events.Record) error {
+	c, err := p.template.Render(r)
+	if err != nil {
+		return err
+	}
+	m := pushMessage{
+		Title: c.Subject,
+		Body:  c.Body,
+		Image: p.template.Message(r).SnapshotURL,
+		Data:  map[string]string{"event_id": r.ID, "camera": r.Camera},
+	}
+	sent, failed := 0, []string{}
+	for _, dev := range p.devices.List() {
+		service, ok := p.services[dev.Platform]
+		if !ok {
+			continue
+		}
+		err := service.push(ctx, dev.Token, m)
+		switch {
+		case errors.Is(err, errUnregistered):
+			p.devices.Unregister(dev.Token)
+		case err != nil:
+			failed = append(failed, fmt.Sprintf("%s: %s", deviceName(dev), err))
+		default:
+			sent++
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not push to %d of %d devices: %s", len(failed), sent+len(failed), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// deviceName names a device in errors, by its name or the start of its
+// token
+func deviceName(dev Device) string {
+	if dev.Name != "" {
+		return dev.Name
+	}
+	if len(dev.Token) > 8 {
+		return dev.Token[:8] + "..."
+	}
+	return dev.Token
+}
+
+// jwtSegment encodes a JSON segment of a JSON web token
+func jwtSegment(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
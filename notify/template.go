@@ -0,0 +1,229 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/events"
+)
+
+const (
+	// DefaultSubject and DefaultBody are the templates of notifications
+	// which don't set their own, digests are summarized
+	DefaultSubject = `{{if .Summary}}{{t "Digest"}}{{else}}{{t "Motion detected"}}{{end}}{{if .Camera}}: {{.Camera}}{{end}}`
+	DefaultBody    = `{{if .Summary}}{{t "Digest"}}{{if .Camera}}: {{.Camera}}{{end}}
+{{.Summary.Start.Format "2006-01-02 15:04"}} - {{.Summary.End.Format "2006-01-02 15:04"}}
+{{t "Events"}}: {{.Summary.Events}}{{range $class, $n := .Summary.Classes}}
+{{t $class}}: {{$n}}{{end}}{{range $zone, $n := .Summary.Zones}}
+{{$zone}}: {{$n}}{{end}}{{if ge .Summary.BusiestHour 0}}
+{{t "Busiest hour"}}: {{printf "%02d:00" .Summary.BusiestHour}}{{end}}{{else}}{{t "Motion detected"}}{{if .Camera}}: {{.Camera}}{{end}}` +
+		`{{if .Zones}} ({{join .Zones ", "}}){{end}}
+{{t "Time"}}: {{.Event.Start.Format "2006-01-02 15:04:05"}}{{end}}{{if .SnapshotURL}}
+{{t "Snapshot"}}: {{.SnapshotURL}}{{end}}{{if .ClipURL}}
+{{t "Clip"}}: {{.ClipURL}}{{end}}`
+	// DefaultPayload is the template of the payload of notifications which
+	// don't set their own, the message as JSON
+	DefaultPayload = `{{json .}}`
+)
+
+// TemplateConfig are the Go templates (see text/template) of the content of
+// notifications, e.g. from a configuration file. They are executed with a
+// Message, e.g. "{{.Camera}}: motion in {{join .Zones ", "}}", and can use
+// the functions json, which encodes a value as JSON, join, see strings.Join,
+// and t, which translates text, see Language. Empty templates are the
+// defaults
+type TemplateConfig struct {
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body,omitempty"`
+	Payload string `json:"payload,omitempty"`
+	// Language is the language text is translated to by the t function,
+	// e.g. {{t "Motion detected"}}, with the Catalog, then the built-in
+	// Catalogs. Text without a translation is left as it is. Further
+	// arguments of t are formatted into the text as with fmt.Sprintf
+	Language string  `json:"language,omitempty"`
+	Catalog  Catalog `json:"catalog,omitempty"`
+	// MediaURL is the URL the media of events is served under, e.g. by a
+	// reverse proxy to their storage, the links to snapshots and clips are
+	// their names joined to it. There are no links without it
+	MediaURL string `json:"media_url,omitempty"`
+}
+
+// Catalog translates the text of notifications to a language, keyed by the
+// English text
+type Catalog map[string]string
+
+// Catalogs are the built-in catalogs, by language, of the text of the
+// default templates
+var Catalogs = map[string]Catalog{
+	"de": {"Motion detected": "Bewegung erkannt", "Time": "Zeit", "Snapshot": "Bild", "Clip": "Video", "Digest": "Zusammenfassung", "Events": "Ereignisse", "Busiest hour": "Meiste Aktivität", "vehicle": "Fahrzeuge", "pedestrian": "Personen"},
+	"es": {"Motion detected": "Movimiento detectado", "Time": "Hora", "Snapshot": "Imagen", "Clip": "Video", "Digest": "Resumen", "Events": "Eventos", "Busiest hour": "Hora más activa", "vehicle": "Vehículos", "pedestrian": "Personas"},
+	"fr": {"Motion detected": "Mouvement détecté", "Time": "Heure", "Snapshot": "Image", "Clip": "Vidéo", "Digest": "Résumé", "Events": "Événements", "Busiest hour": "Heure la plus active", "vehicle": "Véhicules", "pedestrian": "Personnes"},
+	"pt": {"Motion detected": "Movimento detectado", "Time": "Hora", "Snapshot": "Imagem", "Clip": "Vídeo", "Digest": "Resumo", "Events": "Eventos", "Busiest hour": "Hora mais movimentada", "vehicle": "Veículos", "pedestrian": "Pessoas"},
+}
+
+// LoadCatalog reads a Catalog from a JSON file
+func LoadCatalog(path string) (Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := Catalog{}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid message catalog %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// translator returns the t function of templates in a language
+func translator(lang string, custom Catalog) func(text string, args ...interface{}) string {
+	base := lang
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		base = lang[:i]
+	}
+	catalogs := []Catalog{custom, Catalogs[lang], Catalogs[strings.ToLower(base)]}
+	return func(text string, args ...interface{}) string {
+		for _, c := range catalogs {
+			if t, ok := c[text]; ok {
+				text = t
+				break
+			}
+		}
+		if len(args) > 0 {
+			return fmt.Sprintf(text, args...)
+		}
+		return text
+	}
+}
+
+// Message is what templates are executed with
+type Message struct {
+	Record *events.Record `json:"record"`
+	// Event is the record's event, which is only encoded with it
+	Event  detector.Event `json:"-"`
+	Camera string         `json:"camera,omitempty"`
+	// Zones are the names of the zones the event's motion was in
+	Zones []string `json:"zones"`
+	// SnapshotURL and ClipURL link to the event's first snapshot and clip,
+	// if it has them and TemplateConfig.MediaURL is set
+	SnapshotURL string `json:"snapshot_url,omitempty"`
+	ClipURL     string `json:"clip_url,omitempty"`
+	// Summary summarizes the events of a digest, nil for other events, see
+	// the digest package
+	Summary *events.Summary `json:"summary,omitempty"`
+}
+
+// Content is the rendered content of a notification
+type Content struct {
+	Subject string
+	Body    string
+	Payload []byte
+}
+
+// Template renders the content of notifications, so that notifiers can be
+// customized without writing new ones
+type Template struct {
+	subject, body, payload *template.Template
+	mediaURL               string
+	zones                  []detector.Zone
+}
+
+// NewTemplate is the constructor for a Template, the names of the given
+// zones which events overlap are available to the templates
+func NewTemplate(c TemplateConfig, zones ...detector.Zone) (*Template, error) {
+	t := &Template{mediaURL: strings.TrimSuffix(c.MediaURL, "/"), zones: zones}
+	for _, tmpl := range []struct {
+		name, text, def string
+		t               **template.Template
+	}{
+		{"subject", c.Subject, DefaultSubject, &t.subject},
+		{"body", c.Body, DefaultBody, &t.body},
+		{"payload", c.Payload, DefaultPayload, &t.payload},
+	} {
+		if tmpl.text == "" {
+			tmpl.text = tmpl.def
+		}
+		parsed, err := template.New(tmpl.name).Funcs(templateFuncs).
+			Funcs(template.FuncMap{"t": translator(c.Language, c.Catalog)}).Parse(tmpl.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notification %s template: %w", tmpl.name, err)
+		}
+		*tmpl.t = parsed
+	}
+	return t, nil
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join": strings.Join,
+}
+
+// Message returns what the templates are executed with for an event
+func (t *Template) Message(r *events.Record) Message {
+	m := Message{Record: r, Event: r.Event, Camera: r.Camera, Zones: []string{}, Summary: r.Summary}
+	for _, z := range t.zones {
+		if z.Name != "" && z.Bounds.Overlaps(r.Event.Bounds) {
+			m.Zones = append(m.Zones, z.Name)
+		}
+	}
+	if t.mediaURL == "" {
+		return m
+	}
+	for _, obj := range r.Media {
+		link := t.mediaURL + "/" + strings.TrimPrefix(obj.Name, "/")
+		switch {
+		case isImage(obj.Name) && m.SnapshotURL == "":
+			m.SnapshotURL = link
+		case isClip(obj.Name) && m.ClipURL == "":
+			m.ClipURL = link
+		}
+	}
+	return m
+}
+
+// Render renders the content of the notification of an event
+func (t *Template) Render(r *events.Record) (Content, error) {
+	m := t.Message(r)
+	c := Content{}
+	out := &bytes.Buffer{}
+	for _, tmpl := range []struct {
+		t   *template.Template
+		set func(s string)
+	}{
+		{t.subject, func(s string) { c.Subject = strings.TrimSpace(s) }},
+		{t.body, func(s string) { c.Body = s }},
+		{t.payload, func(s string) { c.Payload = []byte(s) }},
+	} {
+		out.Reset()
+		if err := tmpl.t.Execute(out, m); err != nil {
+			return Content{}, fmt.Errorf("could not render notification %s: %w", tmpl.t.Name(), err)
+		}
+		tmpl.set(out.String())
+	}
+	return c, nil
+}
+
+// isImage and isClip return whether a media file is a snapshot or a clip
+func isImage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+func isClip(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".mp4", ".mkv", ".avi", ".webm":
+		return true
+	}
+	return false
+}
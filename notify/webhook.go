@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/adrianosela/GoAway/events"
+)
+
+// webhook posts the payload of notifications to a URL
+type webhook struct {
+	url      string
+	template *Template
+	client   *http.Client
+}
+
+// Webhook returns a notifier which POSTs the payload rendered by the given
+// template, JSON by default, to a URL, e.g. a chat service's incoming
+// webhook. A nil template renders the defaults
+func Webhook(webhookURL string, t *Template) (Notifier, error) {
+	if u, err := url.Parse(webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q, expected e.g. https://hooks.example.com/goaway", webhookURL)
+	}
+	if t == nil {
+		var err error
+		if t, err = NewTemplate(TemplateConfig{}); err != nil {
+			return nil, err
+		}
+	}
+	return &webhook{url: webhookURL, template: t, client: http.DefaultClient}, nil
+}
+
+// Notify implements Notifier
+func (w *webhook) Notify(ctx context.Context, r *events.Record) error {
+	c, err := w.template.Render(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(c.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
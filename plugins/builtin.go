@@ -0,0 +1,56 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/adrianosela/GoAway/notify"
+)
+
+// The built-in notifiers are registered as plugins, for them to be
+// configured alongside third party ones, see NotifierConfig
+const (
+	WebhookPlugin = "webhook"
+	DesktopPlugin = "desktop"
+)
+
+func init() {
+	RegisterNotifier(WebhookPlugin, func(config json.RawMessage) (notify.Notifier, error) {
+		c := struct {
+			URL      string                `json:"url"`
+			Template notify.TemplateConfig `json:"template"`
+		}{}
+		if err := unmarshalConfig(config, &c); err != nil {
+			return nil, err
+		}
+		t, err := notify.NewTemplate(c.Template)
+		if err != nil {
+			return nil, err
+		}
+		return notify.Webhook(c.URL, t)
+	})
+	RegisterNotifier(DesktopPlugin, func(config json.RawMessage) (notify.Notifier, error) {
+		c := struct {
+			Template notify.TemplateConfig `json:"template"`
+		}{}
+		if err := unmarshalConfig(config, &c); err != nil {
+			return nil, err
+		}
+		t, err := notify.NewTemplate(c.Template)
+		if err != nil {
+			return nil, err
+		}
+		return notify.Desktop(t, nil)
+	})
+}
+
+// unmarshalConfig decodes the configuration of a plugin, which may be empty
+func unmarshalConfig(config json.RawMessage, v interface{}) error {
+	if len(config) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(config, v); err != nil {
+		return fmt.Errorf("invalid plugin configuration: %w", err)
+	}
+	return nil
+}
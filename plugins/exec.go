@@ -0,0 +1,212 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+
+	"github.com/adrianosela/GoAway/classify"
+	"github.com/adrianosela/GoAway/events"
+	"github.com/adrianosela/GoAway/notify"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+// ExecPlugin is the name of the built-in plugins which run an external
+// program, see ExecConfig
+const ExecPlugin = "exec"
+
+func init() {
+	RegisterNotifier(ExecPlugin, func(config json.RawMessage) (notify.Notifier, error) {
+		p, err := startExec(config)
+		if err != nil {
+			return nil, err
+		}
+		return &execNotifier{p}, nil
+	})
+	RegisterClassifier(ExecPlugin, func(config json.RawMessage) (classify.Classifier, error) {
+		p, err := startExec(config)
+		if err != nil {
+			return nil, err
+		}
+		return &execClassifier{p}, nil
+	})
+	RegisterStorage(ExecPlugin, func(config json.RawMessage) (storage.Storage, error) {
+		p, err := startExec(config)
+		if err != nil {
+			return nil, err
+		}
+		return &execStorage{p}, nil
+	})
+}
+
+// ExecConfig is the configuration of the exec plugins, the program to run
+// and its arguments
+type ExecConfig struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+func startExec(config json.RawMessage) (*Process, error) {
+	c := ExecConfig{}
+	if err := json.Unmarshal(config, &c); err != nil || c.Command == "" {
+		return nil, fmt.Errorf("invalid exec plugin configuration, expected e.g. {\"command\": \"/usr/local/bin/goaway-matrix\"}")
+	}
+	return Start(c.Command, c.Args...)
+}
+
+// Process is a plugin program, which GoAway calls the methods of with
+// JSON-RPC 1.0 (see net/rpc/jsonrpc) over its standard input and output,
+// e.g. {"method": "Plugin.Notify", "params": [{...}], "id": 1}, to which it
+// responds {"id": 1, "result": ..., "error": null}. Its standard error is
+// GoAway's. The methods are:
+//   - Plugin.Notify, with an event record, for notifiers
+//   - Plugin.Classify, with {"jpg": <base64 image>}, for classifiers, which
+//     return a list of labels
+//   - Plugin.Put, with {"name": ..., "data": <base64 contents>},
+//     Plugin.Get, with {"name": ...}, which returns the base64 contents,
+//     Plugin.List, with {"prefix": ...}, which returns a list of names, and
+//     Plugin.Delete, with {"name": ...}, for storage
+type Process struct {
+	cmd    *exec.Cmd
+	client *rpc.Client
+}
+
+// pipe is the standard input and output of a plugin program
+type pipe struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// Start starts a plugin program
+func Start(name string, args ...string) (*Process, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start plugin %s: %w", name, err)
+	}
+	return &Process{cmd: cmd, client: jsonrpc.NewClient(pipe{stdout, stdin})}, nil
+}
+
+// Call calls a method of the program, e.g. "Plugin.Notify", and decodes its
+// result into reply. The call is abandoned when the context is done
+func (p *Process) Call(ctx context.Context, method string, args, reply interface{}) error {
+	call := p.client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-call.Done:
+		if errors.Is(call.Error, rpc.ErrShutdown) || errors.Is(call.Error, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("plugin %s exited: %w", p.cmd.Path, call.Error)
+		}
+		return call.Error
+	}
+}
+
+// Close closes the program's standard input, for it to exit, and waits for
+// it to
+func (p *Process) Close() error {
+	p.client.Close()
+	return p.cmd.Wait()
+}
+
+// execNotifier is a notifier plugin program
+type execNotifier struct {
+	*Process
+}
+
+// Notify implements notify.Notifier
+func (n *execNotifier) Notify(ctx context.Context, r *events.Record) error {
+	var ok interface{}
+	return n.Call(ctx, "Plugin.Notify", r, &ok)
+}
+
+// execClassifier is a classifier plugin program
+type execClassifier struct {
+	*Process
+}
+
+// Classify implements classify.Classifier
+func (c *execClassifier) Classify(ctx context.Context, jpg []byte) ([]classify.Label, error) {
+	labels := []classify.Label{}
+	err := c.Call(ctx, "Plugin.Classify", map[string][]byte{"jpg": jpg}, &labels)
+	return labels, err
+}
+
+// execStorage is a storage plugin program, clips are sent once closed
+type execStorage struct {
+	*Process
+}
+
+// execFile is a file being written to a storage plugin program
+type execFile struct {
+	bytes.Buffer
+	s   *execStorage
+	obj storage.Object
+}
+
+// Close sends the file to the program, after which its Object is available
+func (f *execFile) Close() error {
+	sum := sha256.Sum256(f.Bytes())
+	f.obj.Size, f.obj.SHA256 = int64(f.Len()), hex.EncodeToString(sum[:])
+	var ok interface{}
+	return f.s.Call(context.Background(), "Plugin.Put", map[string]interface{}{"name": f.obj.Name, "data": f.Bytes()}, &ok)
+}
+
+// Object implements storage.ObjectWriter
+func (f *execFile) Object() storage.Object {
+	return f.obj
+}
+
+// PutClip implements storage.Storage
+func (s *execStorage) PutClip(name string) (storage.ObjectWriter, error) {
+	return &execFile{s: s, obj: storage.Object{Name: name}}, nil
+}
+
+// PutSnapshot implements storage.Storage
+func (s *execStorage) PutSnapshot(name string, data []byte) (storage.Object, error) {
+	f := &execFile{s: s, obj: storage.Object{Name: name}}
+	f.Write(data)
+	if err := f.Close(); err != nil {
+		return storage.Object{}, err
+	}
+	return f.Object(), nil
+}
+
+// Open implements storage.Storage
+func (s *execStorage) Open(name string) (io.ReadCloser, error) {
+	data := []byte{}
+	if err := s.Call(context.Background(), "Plugin.Get", map[string]string{"name": name}, &data); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// List implements storage.Storage
+func (s *execStorage) List(prefix string) ([]string, error) {
+	names := []string{}
+	err := s.Call(context.Background(), "Plugin.List", map[string]string{"prefix": prefix}, &names)
+	return names, err
+}
+
+// Delete implements storage.Storage
+func (s *execStorage) Delete(name string) error {
+	var ok interface{}
+	return s.Call(context.Background(), "Plugin.Delete", map[string]string{"name": name}, &ok)
+}
@@ -0,0 +1,163 @@
+// Package plugins lets third parties ship notifiers, classifiers and storage
+// backends without changes to GoAway. Go packages register them by name in
+// their init function, and are compiled in with a blank import, like
+// database/sql drivers. Programs in any language can be plugged in too, with
+// the built-in "exec" plugins which talk to them over JSON-RPC, see Process
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/adrianosela/GoAway/classify"
+	"github.com/adrianosela/GoAway/notify"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+// NotifierFactory, ClassifierFactory and StorageFactory create a plugin from
+// its configuration, e.g. the JSON object given for it in a configuration
+// file, which is null when there is none
+type (
+	NotifierFactory   func(config json.RawMessage) (notify.Notifier, error)
+	ClassifierFactory func(config json.RawMessage) (classify.Classifier, error)
+	StorageFactory    func(config json.RawMessage) (storage.Storage, error)
+)
+
+var (
+	mu          sync.Mutex
+	notifiers   = map[string]NotifierFactory{}
+	classifiers = map[string]ClassifierFactory{}
+	storages    = map[string]StorageFactory{}
+)
+
+// RegisterNotifier registers a notifier plugin under a name, it panics if
+// the name is taken
+func RegisterNotifier(name string, f NotifierFactory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := notifiers[name]; ok {
+		panic(fmt.Sprintf("plugins: notifier %q registered twice", name))
+	}
+	notifiers[name] = f
+}
+
+// RegisterClassifier registers a classifier plugin under a name, it panics
+// if the name is taken
+func RegisterClassifier(name string, f ClassifierFactory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := classifiers[name]; ok {
+		panic(fmt.Sprintf("plugins: classifier %q registered twice", name))
+	}
+	classifiers[name] = f
+}
+
+// RegisterStorage registers a storage plugin under a name, it panics if the
+// name is taken
+func RegisterStorage(name string, f StorageFactory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := storages[name]; ok {
+		panic(fmt.Sprintf("plugins: storage %q registered twice", name))
+	}
+	storages[name] = f
+}
+
+// NewNotifier creates a notifier with the plugin registered under the name
+func NewNotifier(name string, config json.RawMessage) (notify.Notifier, error) {
+	mu.Lock()
+	f, ok := notifiers[name]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown notifier plugin %q, registered: %v", name, Notifiers())
+	}
+	return f(config)
+}
+
+// NewClassifier creates a classifier with the plugin registered under the
+// name
+func NewClassifier(name string, config json.RawMessage) (classify.Classifier, error) {
+	mu.Lock()
+	f, ok := classifiers[name]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown classifier plugin %q, registered: %v", name, Classifiers())
+	}
+	return f(config)
+}
+
+// NewStorage creates a storage with the plugin registered under the name
+func NewStorage(name string, config json.RawMessage) (storage.Storage, error) {
+	mu.Lock()
+	f, ok := storages[name]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage plugin %q, registered: %v", name, Storages())
+	}
+	return f(config)
+}
+
+// NotifierConfig configures a named notifier created with a plugin, e.g.
+// {"name": "team chat", "plugin": "webhook", "config": {"url": "..."}}
+type NotifierConfig struct {
+	Name   string          `json:"name"`
+	Plugin string          `json:"plugin"`
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// LoadNotifiers reads the configurations of notifiers from a JSON file, a
+// list of them, see NewNotifier
+func LoadNotifiers(path string) ([]NotifierConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	configs := []NotifierConfig{}
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("invalid notifiers %s: %w", path, err)
+	}
+	for i, c := range configs {
+		if c.Name == "" {
+			configs[i].Name = c.Plugin
+		}
+	}
+	return configs, nil
+}
+
+// Notifiers, Classifiers and Storages return the names of the registered
+// plugins, sorted
+func Notifiers() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := []string{}
+	for name := range notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Classifiers() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := []string{}
+	for name := range classifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Storages() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := []string{}
+	for name := range storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,333 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// expr is a compiled expression, evaluated with the variables of an event
+type expr func(vars map[string]interface{}) (interface{}, error)
+
+// token is a lexical token of an expression, strings are kept quoted so
+// that they are told apart from identifiers and operators
+type token struct {
+	text string
+	pos  int
+}
+
+// operators are the operators and punctuation of expressions, longest first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ","}
+
+// tokenize splits an expression into tokens
+func tokenize(src string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexRune(src[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, token{src[i : i+end+2], i})
+			i += end + 2
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '.' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{src[i:j], i})
+			i = j
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, token{op, i})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// parser is a recursive descent parser of expressions, from lowest to
+// highest precedence: ||, &&, comparisons and in, ! and operands
+type parser struct {
+	tokens []token
+	pos    int
+	vars   map[string]bool
+	// end is the length of the expression
+	end int
+}
+
+// compile compiles an expression over the given variables
+func compile(src string, vars map[string]bool) (expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, vars: vars, end: len(src)}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected %s", p.peek())
+	}
+	return e, nil
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].text
+	}
+	return ""
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	pos := p.end
+	if p.pos < len(p.tokens) {
+		pos = p.tokens[p.pos].pos
+	}
+	return fmt.Errorf("%s at %d", fmt.Sprintf(format, args...), pos)
+}
+
+func (p *parser) or() (expr, error) {
+	left, err := p.and()
+	for err == nil && p.peek() == "||" {
+		p.pos++
+		var right expr
+		if right, err = p.and(); err == nil {
+			left = logical(left, right, true)
+		}
+	}
+	return left, err
+}
+
+func (p *parser) and() (expr, error) {
+	left, err := p.comparison()
+	for err == nil && p.peek() == "&&" {
+		p.pos++
+		var right expr
+		if right, err = p.comparison(); err == nil {
+			left = logical(left, right, false)
+		}
+	}
+	return left, err
+}
+
+// logical is a short-circuit || when or is set, and && otherwise
+func logical(left, right expr, or bool) expr {
+	return func(vars map[string]interface{}) (interface{}, error) {
+		l, err := truth(left, vars)
+		if err != nil || l == or {
+			return l, err
+		}
+		return truth(right, vars)
+	}
+}
+
+func truth(e expr, vars map[string]interface{}) (bool, error) {
+	v, err := e(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%v is not true or false", v)
+	}
+	return b, nil
+}
+
+func (p *parser) comparison() (expr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peek()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "in":
+	default:
+		return left, nil
+	}
+	p.pos++
+	right, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(vars map[string]interface{}) (interface{}, error) {
+		l, err := left(vars)
+		if err != nil {
+			return nil, err
+		}
+		r, err := right(vars)
+		if err != nil {
+			return nil, err
+		}
+		return compare(op, l, r)
+	}, nil
+}
+
+// compare applies a comparison operator. Lists equal a value they contain,
+// e.g. zone == 'door' is true for an event in the door zone and others
+func compare(op string, l, r interface{}) (bool, error) {
+	if op == "in" {
+		return compare("==", r, l)
+	}
+	if list, ok := l.([]interface{}); ok && (op == "==" || op == "!=") {
+		for _, v := range list {
+			if eq, err := compare("==", v, r); err == nil && eq {
+				return op == "==", nil
+			}
+		}
+		return op == "!=", nil
+	}
+	if _, ok := r.([]interface{}); ok {
+		return compare(op, r, l)
+	}
+	var c int
+	switch l := l.(type) {
+	case float64:
+		rn, ok := r.(float64)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %v to %v", l, r)
+		}
+		switch {
+		case l < rn:
+			c = -1
+		case l > rn:
+			c = 1
+		}
+	case string:
+		rs, ok := r.(string)
+		if !ok {
+			return false, fmt.Errorf("cannot compare %q to %v", l, r)
+		}
+		c = strings.Compare(l, rs)
+	case bool:
+		rb, ok := r.(bool)
+		if !ok || (op != "==" && op != "!=") {
+			return false, fmt.Errorf("cannot compare %v %s %v", l, op, r)
+		}
+		if l != rb {
+			c = 1
+		}
+	default:
+		return false, fmt.Errorf("cannot compare %v", l)
+	}
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func (p *parser) unary() (expr, error) {
+	if p.peek() != "!" {
+		return p.operand()
+	}
+	p.pos++
+	e, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(vars map[string]interface{}) (interface{}, error) {
+		b, err := truth(e, vars)
+		return !b, err
+	}, nil
+}
+
+func (p *parser) operand() (expr, error) {
+	tok := p.peek()
+	p.pos++
+	switch {
+	case tok == "":
+		p.pos--
+		return nil, p.errorf("unexpected end of expression")
+	case tok == "(":
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, p.errorf("expected )")
+		}
+		p.pos++
+		return e, nil
+	case tok == "[":
+		return p.list()
+	case tok[0] == '\'' || tok[0] == '"':
+		return constant(tok[1 : len(tok)-1]), nil
+	case tok == "true" || tok == "false":
+		return constant(tok == "true"), nil
+	case unicode.IsDigit(rune(tok[0])) || tok[0] == '.':
+		n, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			p.pos--
+			return nil, p.errorf("invalid number %s", tok)
+		}
+		return constant(n), nil
+	case p.vars[tok]:
+		return func(vars map[string]interface{}) (interface{}, error) {
+			return vars[tok], nil
+		}, nil
+	default:
+		p.pos--
+		return nil, p.errorf("unknown variable %s", tok)
+	}
+}
+
+// list parses a list literal, e.g. ['door', 'porch'], after its [
+func (p *parser) list() (expr, error) {
+	items := []expr{}
+	for p.peek() != "]" {
+		if len(items) > 0 {
+			if p.peek() != "," {
+				return nil, p.errorf("expected , or ]")
+			}
+			p.pos++
+		}
+		e, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, e)
+	}
+	p.pos++
+	return func(vars map[string]interface{}) (interface{}, error) {
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			v, err := item(vars)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+	}, nil
+}
+
+func constant(v interface{}) expr {
+	return func(map[string]interface{}) (interface{}, error) {
+		return v, nil
+	}
+}
@@ -0,0 +1,201 @@
+package rules
+
+import (
+	"testing"
+)
+
+var testVars = map[string]bool{"label": true, "zone": true, "confidence": true, "armed": true}
+
+func eval(t *testing.T, src string, vars map[string]interface{}) (bool, error) {
+	t.Helper()
+	e, err := compile(src, testVars)
+	if err != nil {
+		t.Fatalf("%s: %s", src, err)
+	}
+	return truth(e, vars)
+}
+
+func TestExprPrecedence(t *testing.T) {
+	vars := map[string]interface{}{"label": "person", "zone": []interface{}{"door"}, "confidence": 0.8, "armed": false}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// && binds tighter than ||
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"false && false || true", true},
+		{"false && (false || true)", false},
+		// ! binds tighter than && and ||
+		{"!false && false", false},
+		{"!(false && false)", true},
+		{"!true || true", true},
+		{"!!true", true},
+		// comparisons bind tighter than && and ||, and looser than !
+		{"label == 'person' && confidence > 0.5", true},
+		{"label == 'car' || confidence > 0.5 && !armed", true},
+		{"label == 'car' || confidence > 0.9 && !armed", false},
+		{"!armed == true", true},
+	}
+	for _, tt := range tests {
+		got, err := eval(t, tt.src, vars)
+		if err != nil {
+			t.Errorf("%s: %s", tt.src, err)
+		} else if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestExprShortCircuits(t *testing.T) {
+	// the right side would fail to evaluate, as confidence isn't a string
+	vars := map[string]interface{}{"confidence": 0.5}
+	for src, want := range map[string]bool{
+		"true || confidence == 'high'":  true,
+		"false && confidence == 'high'": false,
+	} {
+		got, err := eval(t, src, vars)
+		if err != nil || got != want {
+			t.Errorf("%s: got %v, %v, want %v", src, got, err, want)
+		}
+	}
+}
+
+func TestExprIn(t *testing.T) {
+	vars := map[string]interface{}{"label": "person", "zone": []interface{}{"door", "porch"}}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"label in ['person', 'car']", true},
+		{"label in ['car', 'dog']", false},
+		{"label in []", false},
+		{"label in ['person']", true},
+		{"'porch' in zone", true},
+		{"'garden' in zone", false},
+		{"zone == 'door'", true},
+		{"zone != 'door'", false},
+		{"zone != 'garden'", true},
+		{"'door' == zone", true},
+		{"!(label in ['car'])", true},
+		{"2 in [1, 2, 3]", true},
+	}
+	for _, tt := range tests {
+		got, err := eval(t, tt.src, vars)
+		if err != nil {
+			t.Errorf("%s: %s", tt.src, err)
+		} else if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestExprComparisons(t *testing.T) {
+	vars := map[string]interface{}{"label": "person", "confidence": 0.75, "armed": true}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"confidence == 0.75", true},
+		{"confidence != 0.75", false},
+		{"confidence < 0.8", true},
+		{"confidence <= 0.75", true},
+		{"confidence > 0.75", false},
+		{"confidence >= .75", true},
+		{"confidence > 1", false},
+		{"label == 'person'", true},
+		{`label == "person"`, true},
+		{"label != 'person'", false},
+		{"label < 'zebra'", true},
+		{"label >= 'q'", false},
+		{"'apple' < 'banana'", true},
+		{"armed == true", true},
+		{"armed != false", true},
+		{"armed", true},
+	}
+	for _, tt := range tests {
+		got, err := eval(t, tt.src, vars)
+		if err != nil {
+			t.Errorf("%s: %s", tt.src, err)
+		} else if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestExprEvaluationErrors(t *testing.T) {
+	vars := map[string]interface{}{"label": "person", "confidence": 0.75, "armed": true}
+	for _, src := range []string{
+		"label == 1",
+		"confidence == 'high'",
+		"armed < true",
+		"armed == 1",
+		"label",
+		"!confidence",
+		"label && true",
+		"false || true && 1",
+		// variables without a value, e.g. no zone for the event
+		"zone == 'door'",
+	} {
+		if got, err := eval(t, src, vars); err == nil {
+			t.Errorf("%s: got %v, want an error", src, got)
+		}
+	}
+}
+
+func TestExprUnknownVariables(t *testing.T) {
+	for _, src := range []string{
+		"camera == 'garage'",
+		"label == 'person' && camera == 'garage'",
+		"label in [camera]",
+		"!camera",
+	} {
+		if _, err := compile(src, testVars); err == nil {
+			t.Errorf("%s: compiled with an unknown variable", src)
+		}
+	}
+}
+
+func TestExprMalformed(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"   ",
+		"label ==",
+		"== 'person'",
+		"label == 'person",
+		`label == "person`,
+		"(label == 'person'",
+		"label == 'person')",
+		"()",
+		"label in ['person'",
+		"label in ['person' 'car']",
+		"label in ['person',",
+		"label in [,]",
+		"label == 'person' label",
+		"label == 'person' &&",
+		"|| true",
+		"!",
+		"label = 'person'",
+		"label & true",
+		"confidence > 1.2.3",
+		"confidence > 0x10",
+		"label == 'person' ; true",
+		"label === 'person'",
+		"[[[",
+		"]",
+		"((((",
+		"'",
+		"é",
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%q: panicked: %v", src, r)
+				}
+			}()
+			if _, err := compile(src, testVars); err == nil {
+				t.Errorf("%q: compiled", src)
+			}
+		}()
+	}
+}
@@ -0,0 +1,224 @@
+// Package rules decides which actions, e.g. notifiers, are run for an event
+// with rules whose conditions are expressions over the event, e.g.
+//
+//	severity >= high && zone == 'door' && hour >= 22
+//
+// Expressions compare numbers, strings, true and false and lists, e.g.
+// ['door', 'porch'], with ==, !=, <, <=, >, >= and in, and combine them
+// with &&, || and !. The variables of an event are:
+//   - camera, the name of its camera, and cameras, those it was merged from
+//   - zone, the names of the zones it overlaps, which equals any of them,
+//     e.g. zone == 'door' is true for an event in the door and yard zones
+//   - severity, low, medium or high, see SeverityOf
+//   - confidence, from 0 to 1, and area, its largest contour's area
+//   - duration, in seconds
+//   - hour, from 0 to 23, and weekday, e.g. 'monday', in local time
+//   - reason, why it was forced, and forced, whether it was
+//   - plate, the text of the license plates read in it
+//   - class, 'vehicle' or 'pedestrian', empty when unknown, see
+//     detector.WithVehicleClassification
+//   - dry_run, whether it was detected in dry run mode
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/events"
+)
+
+// variables are the names of the variables of expressions, including the
+// severities
+var variables = map[string]bool{
+	"camera": true, "cameras": true, "zone": true, "severity": true,
+	"confidence": true, "area": true, "duration": true, "hour": true,
+	"weekday": true, "reason": true, "forced": true, "plate": true,
+	"dry_run": true, "class": true, "low": true, "medium": true,
+	"high": true,
+}
+
+// Rule runs actions for the events its condition is true for
+type Rule struct {
+	Name string `json:"name"`
+	// When is the rule's condition, an expression over the event, the rule
+	// applies to every event when it is empty
+	When string `json:"when,omitempty"`
+	// Actions are the names of the actions, e.g. the notifiers of a
+	// notify.Dispatcher
+	Actions []string `json:"actions"`
+	// Stop keeps the rules after this one from being evaluated for the
+	// events it applies to, e.g. for a catch-all rule last
+	Stop bool `json:"stop,omitempty"`
+	// Retention is the retention class the rule tags the events it applies
+	// to with, see events.Retention, the first rule's which applies wins
+	Retention string `json:"retention,omitempty"`
+}
+
+// Load reads rules from a JSON file, a list of rules
+func Load(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := []Rule{}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// SeverityOf is the severity of an event with a given confidence, low under
+// 0.5, medium under 0.8 and high otherwise
+func SeverityOf(confidence float64) detector.Severity {
+	switch {
+	case confidence < 0.5:
+		return detector.SeverityLow
+	case confidence < 0.8:
+		return detector.SeverityMedium
+	default:
+		return detector.SeverityHigh
+	}
+}
+
+// Engine evaluates rules, in order, over events
+type Engine struct {
+	mu       sync.RWMutex
+	rules    []Rule
+	compiled []expr
+	zones    []detector.Zone
+}
+
+// NewEngine is the constructor for an Engine, the names of the given zones
+// which events overlap are their zone variable
+func NewEngine(rules []Rule, zones ...detector.Zone) (*Engine, error) {
+	e := &Engine{zones: zones}
+	if err := e.Set(rules); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Set replaces the engine's rules, e.g. as edited on a dashboard. None are
+// replaced if any is invalid
+func (e *Engine) Set(rules []Rule) error {
+	compiled := make([]expr, len(rules))
+	for i, r := range rules {
+		if strings.TrimSpace(r.When) == "" {
+			compiled[i] = constant(true)
+			continue
+		}
+		c, err := compile(r.When, variables)
+		if err != nil {
+			return fmt.Errorf("invalid rule %q: %w", r.Name, err)
+		}
+		compiled[i] = c
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules, e.compiled = append([]Rule{}, rules...), compiled
+	return nil
+}
+
+// Rules returns the engine's rules
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]Rule{}, e.rules...)
+}
+
+// Match returns the rules which apply to an event. Rules whose condition
+// can't be evaluated for it, e.g. which compare a number to a string, don't
+// apply and are logged
+func (e *Engine) Match(r *events.Record) []Rule {
+	vars := e.Variables(r)
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	matched := []Rule{}
+	for i, rule := range e.rules {
+		ok, err := truth(e.compiled[i], vars)
+		if err != nil {
+			log.Printf("could not evaluate rule %q for event %s: %s", rule.Name, r.ID, err)
+			continue
+		}
+		if ok {
+			matched = append(matched, rule)
+			if rule.Stop {
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// Actions returns the actions of the rules which apply to an event, without
+// duplicates, e.g. for notify.Dispatcher.Route
+func (e *Engine) Actions(r *events.Record) []string {
+	actions := []string{}
+	seen := map[string]bool{}
+	for _, rule := range e.Match(r) {
+		for _, a := range rule.Actions {
+			if !seen[a] {
+				seen[a] = true
+				actions = append(actions, a)
+			}
+		}
+	}
+	return actions
+}
+
+// Retention returns the retention class of the first rule which applies to
+// an event and has one, e.g. to set the record's Retention before storing
+// it, empty when none does
+func (e *Engine) Retention(r *events.Record) string {
+	for _, rule := range e.Match(r) {
+		if rule.Retention != "" {
+			return rule.Retention
+		}
+	}
+	return ""
+}
+
+// Variables returns the values of the variables of expressions for an
+// event, e.g. to show why rules did or didn't apply to it
+func (e *Engine) Variables(r *events.Record) map[string]interface{} {
+	ev := r.Event
+	zones := []interface{}{}
+	for _, z := range e.zones {
+		if z.Name != "" && z.Bounds.Overlaps(ev.Bounds) {
+			zones = append(zones, z.Name)
+		}
+	}
+	cameras := []interface{}{}
+	for _, c := range r.Cameras {
+		cameras = append(cameras, c)
+	}
+	plates := []interface{}{}
+	for _, p := range ev.Plates {
+		plates = append(plates, p.Text)
+	}
+	start := ev.Start.Local()
+	return map[string]interface{}{
+		"camera":     r.Camera,
+		"cameras":    cameras,
+		"zone":       zones,
+		"severity":   float64(SeverityOf(ev.Confidence)),
+		"confidence": ev.Confidence,
+		"area":       ev.MaxArea,
+		"duration":   ev.End.Sub(ev.Start).Seconds(),
+		"hour":       float64(start.Hour()),
+		"weekday":    strings.ToLower(start.Weekday().String()),
+		"reason":     ev.Reason,
+		"forced":     ev.Reason != "",
+		"plate":      plates,
+		"dry_run":    ev.DryRun,
+		"class":      string(ev.Class),
+		"low":        float64(detector.SeverityLow),
+		"medium":     float64(detector.SeverityMedium),
+		"high":       float64(detector.SeverityHigh),
+	}
+}
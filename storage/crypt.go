@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Encrypted files start with a header of a magic string and a random nonce
+// prefix, followed by the plaintext split into chunks which are sealed with
+// AES-GCM independently. Each chunk's nonce is the prefix, the chunk's
+// index and a flag marking the last chunk, so chunks can't be reordered,
+// dropped or truncated without decryption failing
+const (
+	magic        = "goaway\x00\x01"
+	prefixSize   = 7
+	chunkSize    = 64 * 1024
+	headerSize   = len(magic) + prefixSize
+	lastChunkBit = 1
+)
+
+var (
+	// ErrEncrypted is returned when opening an encrypted file from a
+	// storage without an encryption key
+	ErrEncrypted = errors.New("file is encrypted and no key was provided")
+
+	// ErrNotEncrypted is returned when opening an unencrypted file from a
+	// storage with an encryption key, see WithPlaintextReads
+	ErrNotEncrypted = errors.New("file is not encrypted although an encryption key was provided")
+
+	// ErrDecrypt is returned when an encrypted file fails to decrypt, either
+	// because the key is wrong or because the file was tampered with
+	ErrDecrypt = errors.New("could not decrypt file, wrong key or corrupted file")
+)
+
+// ParseKey parses a hex encoded AES key, which must be 16, 24 or 32 bytes
+// long (for AES-128, AES-192 or AES-256)
+func ParseKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key encoding: %w", err)
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ReadKeyFile reads a hex encoded AES key from a file, such as one made with
+// `head -c 32 /dev/urandom | xxd -p -c 64 > goaway.key`
+func ReadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(string(data))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], index)
+	if last {
+		nonce[11] = lastChunkBit
+	}
+	return nonce
+}
+
+// encryptWriter encrypts everything written to it, it must be closed to
+// write the last chunk
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte
+}
+
+// NewEncryptWriter returns a writer which encrypts everything written to it
+// with the given key before writing it to w. It must be closed for the
+// encrypted stream to be complete, closing it doesn't close w
+func NewEncryptWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append([]byte(magic), prefix...)); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.index, last), e.buf, nil)
+	e.index++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// Write implements io.Writer
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// a full chunk is only sealed once more data arrives, as the
+		// last chunk has to be sealed as such
+		if len(e.buf) == chunkSize {
+			if err := e.flush(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(e.buf[len(e.buf):chunkSize], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p, n = p[c:], n+c
+	}
+	return n, nil
+}
+
+// Close seals the last chunk
+func (e *encryptWriter) Close() error {
+	return e.flush(true)
+}
+
+// decryptReader decrypts a stream written by an encryptWriter
+type decryptReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	chunk  []byte
+	plain  []byte
+	done   bool
+}
+
+// NewDecryptReader returns a reader which decrypts a stream written by a
+// writer returned by NewEncryptWriter with the same key
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrDecrypt
+	}
+	if !bytes.Equal(header[:len(magic)], []byte(magic)) {
+		return nil, ErrDecrypt
+	}
+	return &decryptReader{
+		r:      bufio.NewReaderSize(r, chunkSize+aead.Overhead()+1),
+		aead:   aead,
+		prefix: header[len(magic):],
+		chunk:  make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+// Read implements io.Reader
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk, it is the last one if nothing follows it
+func (d *decryptReader) next() error {
+	n, err := io.ReadFull(d.r, d.chunk)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ErrDecrypt
+	}
+	_, err = d.r.Peek(1)
+	last := err == io.EOF
+	plain, err := d.aead.Open(d.chunk[:0], chunkNonce(d.prefix, d.index, last), d.chunk[:n], nil)
+	if err != nil {
+		return ErrDecrypt
+	}
+	d.index++
+	d.plain, d.done = plain, last
+	return nil
+}
+
+// isEncrypted returns whether a stream starts with the encryption header,
+// without consuming it
+func isEncrypted(r *bufio.Reader) bool {
+	head, _ := r.Peek(len(magic))
+	return bytes.Equal(head, []byte(magic))
+}
@@ -0,0 +1,187 @@
+package storage_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/adrianosela/GoAway/storage"
+)
+
+const (
+	// chunk and sealed are the sizes of a chunk of plaintext, and of the
+	// chunk once encrypted with its authentication tag
+	chunk  = 64 * 1024
+	sealed = chunk + 16
+	// header is the size of the magic string and nonce prefix
+	header = 8 + 7
+)
+
+func key(t *testing.T) []byte {
+	t.Helper()
+	k := make([]byte, 32)
+	if _, err := rand.Read(k); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func encrypt(t *testing.T, k, plain []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w, err := storage.NewEncryptWriter(buf, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// odd sized writes, so that they straddle chunks
+	for p := plain; len(p) > 0; {
+		n := 1000
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(ciphertext, k []byte) ([]byte, error) {
+	r, err := storage.NewDecryptReader(bytes.NewReader(ciphertext), k)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	k := key(t)
+	for _, size := range []int{0, 1, chunk - 1, chunk, chunk + 1, 3 * chunk, 3*chunk + 1} {
+		plain := make([]byte, size)
+		if _, err := rand.Read(plain); err != nil {
+			t.Fatal(err)
+		}
+		ciphertext := encrypt(t, k, plain)
+		chunks := size/chunk + 1
+		if size > 0 && size%chunk == 0 {
+			chunks--
+		}
+		if want := header + size + chunks*16; len(ciphertext) != want {
+			t.Errorf("%d bytes: got %d encrypted bytes, want %d", size, len(ciphertext), want)
+		}
+		got, err := decrypt(ciphertext, k)
+		if err != nil {
+			t.Errorf("%d bytes: %s", size, err)
+		} else if !bytes.Equal(got, plain) {
+			t.Errorf("%d bytes: decrypted %d different bytes", size, len(got))
+		}
+	}
+}
+
+func TestEncryptNonceIsRandom(t *testing.T) {
+	k := key(t)
+	plain := []byte("the same clip")
+	if bytes.Equal(encrypt(t, k, plain), encrypt(t, k, plain)) {
+		t.Error("encrypting twice gave the same ciphertext")
+	}
+}
+
+func TestDecryptRejectsWrongKey(t *testing.T) {
+	ciphertext := encrypt(t, key(t), []byte("footage"))
+	if _, err := decrypt(ciphertext, key(t)); err != storage.ErrDecrypt {
+		t.Errorf("got error %v with the wrong key, want %v", err, storage.ErrDecrypt)
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	k := key(t)
+	plain := make([]byte, 3*chunk+1)
+	if _, err := rand.Read(plain); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := encrypt(t, k, plain)
+	chunks := func(c []byte) [][]byte {
+		out := [][]byte{}
+		for c = c[header:]; len(c) > sealed; c = c[sealed:] {
+			out = append(out, c[:sealed])
+		}
+		return append(out, c)
+	}(ciphertext)
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(append([][]byte{ciphertext[:header]}, parts...), nil)
+	}
+	flip := func(at int) []byte {
+		c := append([]byte{}, ciphertext...)
+		c[at] ^= 1
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{"no header", nil},
+		{"truncated header", ciphertext[:header-1]},
+		{"no chunks", ciphertext[:header]},
+		{"last chunk dropped", join(chunks[0], chunks[1], chunks[2])},
+		{"chunks dropped", join(chunks[0], chunks[3])},
+		{"first chunk dropped", join(chunks[1], chunks[2], chunks[3])},
+		{"truncated chunk", ciphertext[:header+sealed+sealed/2]},
+		{"truncated last chunk", ciphertext[:len(ciphertext)-1]},
+		{"reordered chunks", join(chunks[1], chunks[0], chunks[2], chunks[3])},
+		{"chunk repeated", join(chunks[0], chunks[0], chunks[1], chunks[2], chunks[3])},
+		{"chunk appended", join(chunks[0], chunks[1], chunks[2], chunks[3], chunks[3])},
+		{"modified magic", flip(0)},
+		{"modified nonce", flip(header - 1)},
+		{"modified first chunk", flip(header)},
+		{"modified middle chunk", flip(header + sealed + 100)},
+		{"modified tag", flip(header + sealed - 1)},
+		{"modified last chunk", flip(len(ciphertext) - 1)},
+	}
+	for _, tt := range tests {
+		got, err := decrypt(tt.ciphertext, k)
+		if err != storage.ErrDecrypt {
+			t.Errorf("%s: got %d bytes and error %v, want %v", tt.name, len(got), err, storage.ErrDecrypt)
+		}
+	}
+}
+
+func TestDirRefusesPlaintextWithKey(t *testing.T) {
+	dir := t.TempDir()
+	plain := []byte("swapped in")
+	plaintext, err := storage.NewDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(plaintext.Path("snapshot.jpg"), plain, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts []storage.Option
+		want error
+	}{
+		{"no key", nil, nil},
+		{"key", []storage.Option{storage.WithEncryptionKey(key(t))}, storage.ErrNotEncrypted},
+		{"key with plaintext reads", []storage.Option{storage.WithEncryptionKey(key(t)), storage.WithPlaintextReads()}, nil},
+	}
+	for _, tt := range tests {
+		d, err := storage.NewDir(dir, tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := d.ReadFile("snapshot.jpg")
+		if err != tt.want {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+		}
+		if tt.want == nil && !bytes.Equal(got, plain) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, plain)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	// ErrHashMismatch is returned when a file's contents don't match the
+	// hash recorded for it
+	ErrHashMismatch = errors.New("file contents don't match the recorded hash")
+
+	// ErrBadSignature is returned when a file's recorded signature isn't
+	// valid for its name and hash under the given public key
+	ErrBadSignature = errors.New("signature is not valid for the recorded name and hash")
+)
+
+// Object describes a file written to storage, along with what is needed to
+// demonstrate its integrity later on
+type Object struct {
+	// Name is the name of the file within its storage
+	Name string `json:"name"`
+	// Size is the size of the file's contents in bytes
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded SHA-256 hash of the file's contents, of the
+	// plaintext when the file is encrypted
+	SHA256 string `json:"sha256"`
+	// Signature is the base64 encoded Ed25519 signature of the name and
+	// hex encoded hash, separated by a newline, so that a signed file can't
+	// pass for another. It is only set when the storage has a signing key
+	Signature string `json:"signature,omitempty"`
+}
+
+// signed returns what the object's signature is of
+func (o Object) signed() []byte {
+	return []byte(o.Name + "\n" + o.SHA256)
+}
+
+// sign sets the object's signature, once its name and hash are set
+func (o *Object) sign(key ed25519.PrivateKey) {
+	o.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, o.signed()))
+}
+
+// Verify checks the contents of a file against the object's hash and, when
+// a public key is given, the object's signature against its name and hash
+func (o Object) Verify(r io.Reader, pub ed25519.PublicKey) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != o.SHA256 {
+		return ErrHashMismatch
+	}
+	if pub == nil {
+		return nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(o.Signature)
+	if err != nil || !ed25519.Verify(pub, o.signed(), sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded %s", path, blockType)
+	}
+	return block.Bytes, nil
+}
+
+// ReadSigningKeyFile reads a PEM encoded (PKCS #8) Ed25519 private key, such
+// as one made with `openssl genpkey -algorithm ed25519 -out signing.pem`
+func ReadSigningKeyFile(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 private key", path)
+	}
+	return priv, nil
+}
+
+// ReadPublicKeyFile reads a PEM encoded (PKIX) Ed25519 public key, such as
+// one made with `openssl pkey -in signing.pem -pubout -out public.pem`
+func ReadPublicKeyFile(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 public key", path)
+	}
+	return pub, nil
+}
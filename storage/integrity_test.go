@@ -0,0 +1,182 @@
+package storage_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/GoAway/storage"
+)
+
+func signingKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub, priv
+}
+
+func TestVerify(t *testing.T) {
+	pub, priv := signingKey(t)
+	other, _ := signingKey(t)
+	data := []byte("snapshot")
+	for _, opts := range [][]storage.Option{
+		{storage.WithSigningKey(priv)},
+		{storage.WithSigningKey(priv), storage.WithEncryptionKey(key(t))},
+	} {
+		d, err := storage.NewDir(t.TempDir(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj, err := d.WriteFile("snapshot.jpg", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.Signature == "" {
+			t.Fatal("the object wasn't signed")
+		}
+		stored, err := d.ReadFile("snapshot.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := obj.Verify(bytes.NewReader(stored), pub); err != nil {
+			t.Errorf("valid object: %s", err)
+		}
+		if err := obj.Verify(bytes.NewReader(stored), nil); err != nil {
+			t.Errorf("valid object without a public key: %s", err)
+		}
+
+		modifiedHash := obj
+		modifiedHash.SHA256 = strings.Repeat("0", len(obj.SHA256))
+		badSignature := obj
+		sig, _ := base64.StdEncoding.DecodeString(obj.Signature)
+		sig[0] ^= 1
+		badSignature.Signature = base64.StdEncoding.EncodeToString(sig)
+		invalidSignature := obj
+		invalidSignature.Signature = "not base64!"
+		unsigned := obj
+		unsigned.Signature = ""
+		renamed := obj
+		renamed.Name = "other.jpg"
+
+		tests := []struct {
+			name string
+			obj  storage.Object
+			data []byte
+			pub  ed25519.PublicKey
+			want error
+		}{
+			{"modified body", obj, []byte("snapshoT"), pub, storage.ErrHashMismatch},
+			{"modified body without a public key", obj, []byte("snapshoT"), nil, storage.ErrHashMismatch},
+			{"truncated body", obj, stored[:len(stored)-1], pub, storage.ErrHashMismatch},
+			{"modified hash", modifiedHash, stored, pub, storage.ErrHashMismatch},
+			{"wrong public key", obj, stored, other, storage.ErrBadSignature},
+			{"modified signature", badSignature, stored, pub, storage.ErrBadSignature},
+			{"invalid signature", invalidSignature, stored, pub, storage.ErrBadSignature},
+			{"no signature", unsigned, stored, pub, storage.ErrBadSignature},
+			{"signed under another name", renamed, stored, pub, storage.ErrBadSignature},
+		}
+		for _, tt := range tests {
+			if err := tt.obj.Verify(bytes.NewReader(tt.data), tt.pub); err != tt.want {
+				t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+			}
+		}
+	}
+}
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadKeyFiles(t *testing.T) {
+	pub, priv := signingKey(t)
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotPriv, err := storage.ReadSigningKeyFile(writePEM(t, "PRIVATE KEY", privDER))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotPriv.Equal(priv) {
+		t.Error("read a different signing key")
+	}
+	gotPub, err := storage.ReadPublicKeyFile(writePEM(t, "PUBLIC KEY", pubDER))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotPub.Equal(pub) {
+		t.Error("read a different public key")
+	}
+
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPrivDER, err := x509.MarshalPKCS8PrivateKey(ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPubDER, err := x509.MarshalPKIXPublicKey(&ec.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbage := filepath.Join(t.TempDir(), "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "missing.pem")},
+		{"not PEM", garbage},
+		{"wrong block type", writePEM(t, "CERTIFICATE", privDER)},
+		{"invalid DER", writePEM(t, "PRIVATE KEY", []byte("not DER"))},
+		{"public key", writePEM(t, "PUBLIC KEY", pubDER)},
+		{"ECDSA key", writePEM(t, "PRIVATE KEY", ecPrivDER)},
+	}
+	for _, tt := range tests {
+		if _, err := storage.ReadSigningKeyFile(tt.path); err == nil {
+			t.Errorf("signing key from %s: read", tt.name)
+		}
+	}
+
+	tests = []struct {
+		name string
+		path string
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "missing.pem")},
+		{"not PEM", garbage},
+		{"wrong block type", writePEM(t, "CERTIFICATE", pubDER)},
+		{"invalid DER", writePEM(t, "PUBLIC KEY", []byte("not DER"))},
+		{"private key", writePEM(t, "PRIVATE KEY", privDER)},
+		{"ECDSA key", writePEM(t, "PUBLIC KEY", ecPubDER)},
+	}
+	for _, tt := range tests {
+		if _, err := storage.ReadPublicKeyFile(tt.path); err == nil {
+			t.Errorf("public key from %s: read", tt.name)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultUploadAttempts is the default number of times remote storage
+	// attempts an upload before giving up
+	DefaultUploadAttempts = 5
+
+	// DefaultUploadBackoff is the default time remote storage waits before
+	// retrying an upload, doubled after every attempt
+	DefaultUploadBackoff = 2 * time.Second
+
+	// partSuffix is appended to the names of files being uploaded, they are
+	// renamed once complete so that partial files are never mistaken for
+	// complete ones
+	partSuffix = ".part"
+)
+
+// remote holds the settings shared by the remote storage backends
+type remote struct {
+	attempts  int
+	backoff   time.Duration
+	client    *http.Client
+	chunkSize int64
+}
+
+// RemoteOption configures optional behaviour of remote storage
+type RemoteOption func(*remote)
+
+// WithUploadAttempts sets the number of times an upload is attempted, and
+// the time waited before the first retry, e.g. for flaky Wi-Fi. Uploads
+// resume where the last attempt left off when the server supports it
+func WithUploadAttempts(attempts int, backoff time.Duration) RemoteOption {
+	return func(r *remote) {
+		r.attempts = attempts
+		r.backoff = backoff
+	}
+}
+
+// WithRemoteHTTPClient sets the client used to reach WebDAV servers, e.g. to
+// configure TLS or timeouts
+func WithRemoteHTTPClient(c *http.Client) RemoteOption {
+	return func(r *remote) {
+		r.client = c
+	}
+}
+
+// WithUploadChunks uploads files larger than the given size in chunks of
+// that size, e.g. for cameras on cellular links which drop mid-upload: an
+// interruption loses at most the chunk being sent, and attempts are only used
+// up by chunks which fail, not by the upload as a whole. Only WebDAV servers
+// which support partial PUTs can be uploaded to in chunks, uploads to others
+// fall back to whole files
+func WithUploadChunks(size int64) RemoteOption {
+	return func(r *remote) {
+		r.chunkSize = size
+	}
+}
+
+func newRemote(opts []RemoteOption) remote {
+	r := remote{attempts: DefaultUploadAttempts, backoff: DefaultUploadBackoff, client: http.DefaultClient}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	if r.attempts < 1 {
+		r.attempts = 1
+	}
+	return r
+}
+
+// retry runs an upload until it succeeds or runs out of attempts, the
+// attempt number is passed to it
+func (r remote) retry(upload func(attempt int) error) error {
+	backoff := r.backoff
+	var err error
+	for attempt := 0; attempt < r.attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = upload(attempt); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("upload failed after %d attempts: %w", r.attempts, err)
+}
+
+// spoolFile is a file being written to remote storage. It is spooled to a
+// local temporary file, as clips are written over minutes while connections
+// come and go, and uploaded once closed
+type spoolFile struct {
+	f      *os.File
+	h      hash.Hash
+	obj    Object
+	upload func(local string, size int64) error
+	err    error
+}
+
+func newSpoolFile(name string, upload func(local string, size int64) error) (*spoolFile, error) {
+	f, err := os.CreateTemp("", "goaway-upload-")
+	if err != nil {
+		return nil, err
+	}
+	return &spoolFile{f: f, h: sha256.New(), obj: Object{Name: name}, upload: upload}, nil
+}
+
+// Write implements io.Writer
+func (s *spoolFile) Write(p []byte) (int, error) {
+	n, err := s.f.Write(p)
+	s.h.Write(p[:n])
+	s.obj.Size += int64(n)
+	if err != nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// Close uploads the file, after which its Object is available. Files which
+// could not be spooled completely aren't uploaded
+func (s *spoolFile) Close() error {
+	defer os.Remove(s.f.Name())
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	if s.err != nil {
+		return s.err
+	}
+	s.obj.SHA256 = hex.EncodeToString(s.h.Sum(nil))
+	return s.upload(s.f.Name(), s.obj.Size)
+}
+
+// Object implements ObjectWriter
+func (s *spoolFile) Object() Object {
+	return s.obj
+}
+
+// putSnapshot stores a whole file through a spool file
+func putSnapshot(name string, data []byte, upload func(local string, size int64) error) (Object, error) {
+	f, err := newSpoolFile(name, upload)
+	if err != nil {
+		return Object{}, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return Object{}, err
+	}
+	if err := f.Close(); err != nil {
+		return Object{}, err
+	}
+	return f.Object(), nil
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SFTP stores files on an SFTP server, e.g. a NAS which doesn't speak S3,
+// through the OpenSSH sftp client which must be installed. It runs in batch
+// mode, so the server must accept a key or an agent, never a password
+type SFTP struct {
+	remote
+	target string
+	dir    string
+	args   []string
+}
+
+// NewSFTP is the constructor for an SFTP storage in the given directory of
+// the target, e.g. "goaway@nas.local". The given arguments are passed to
+// sftp, e.g. "-i", "/etc/goaway/id_ed25519", "-P", "2222"
+func NewSFTP(target, dir string, sftpArgs []string, opts ...RemoteOption) *SFTP {
+	return &SFTP{remote: newRemote(opts), target: target, dir: dir, args: sftpArgs}
+}
+
+// quote quotes a path for an sftp batch command
+func quote(p string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(p) + `"`
+}
+
+// remotePath returns the path of a file on the server
+func (s *SFTP) remotePath(name string) string {
+	if p := path.Join(s.dir, name); p != "" {
+		return p
+	}
+	return "."
+}
+
+// batch runs sftp commands, sftp stops at the first failing command unless
+// it is prefixed with "-"
+func (s *SFTP) batch(commands ...string) (string, error) {
+	args := append([]string{"-b", "-", "-o", "BatchMode=yes"}, s.args...)
+	cmd := exec.Command("sftp", append(args, s.target)...)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	out := &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("sftp %s: %w: %s", s.target, err, bytes.TrimSpace(out.Bytes()))
+	}
+	return out.String(), nil
+}
+
+// PutSnapshot implements Storage
+func (s *SFTP) PutSnapshot(name string, data []byte) (Object, error) {
+	return putSnapshot(name, data, s.uploader(name))
+}
+
+// PutClip implements Storage, the clip is uploaded once closed
+func (s *SFTP) PutClip(name string) (ObjectWriter, error) {
+	return newSpoolFile(name, s.uploader(name))
+}
+
+// uploader returns a function which uploads a local file to the given name,
+// retries resume the upload with reput
+func (s *SFTP) uploader(name string) func(local string, size int64) error {
+	return func(local string, size int64) error {
+		remote := s.remotePath(name)
+		part := remote + partSuffix
+		mkdirs := []string{}
+		for dir := path.Dir(remote); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			mkdirs = append([]string{"-mkdir " + quote(dir)}, mkdirs...)
+		}
+		err := s.retry(func(attempt int) error {
+			put := append(append([]string{}, mkdirs...), "put "+quote(local)+" "+quote(part))
+			if attempt == 0 {
+				_, err := s.batch(put...)
+				return err
+			}
+			if _, err := s.batch("reput " + quote(local) + " " + quote(part)); err == nil {
+				return nil
+			}
+			// nothing to resume, e.g. the connection failed before the
+			// upload started
+			_, err := s.batch(put...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		// SFTP renames don't replace existing files
+		_, err = s.batch("-rm "+quote(remote), "rename "+quote(part)+" "+quote(remote))
+		return err
+	}
+}
+
+// removeOnClose is a downloaded file which is removed once closed
+type removeOnClose struct {
+	*os.File
+}
+
+func (f removeOnClose) Close() error {
+	defer os.Remove(f.Name())
+	return f.File.Close()
+}
+
+// Open implements Storage, the file is downloaded to a temporary file first
+func (s *SFTP) Open(name string) (io.ReadCloser, error) {
+	tmp, err := os.CreateTemp("", "goaway-download-")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	if _, err := s.batch("get " + quote(s.remotePath(name)) + " " + quote(tmp.Name())); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return removeOnClose{f}, nil
+}
+
+// List implements Storage
+func (s *SFTP) List(prefix string) ([]string, error) {
+	names := []string{}
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i]
+	}
+	if err := s.list(dir, prefix, &names); err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *SFTP) list(dir, prefix string, names *[]string) error {
+	out, err := s.batch("-ls -l " + quote(s.remotePath(dir)))
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		// e.g. -rw-r--r--    1 goaway   goaway      1234 Jan  1 10:00 clips/a.mp4
+		fields := strings.Fields(line)
+		if len(fields) < 9 || strings.HasPrefix(line, "sftp>") {
+			continue
+		}
+		name := path.Join(dir, path.Base(strings.Join(fields[8:], " ")))
+		switch fields[0][0] {
+		case 'd':
+			if base := path.Base(name); base == "." || base == ".." {
+				continue
+			}
+			if strings.HasPrefix(name+"/", prefix) || strings.HasPrefix(prefix, name+"/") {
+				if err := s.list(name, prefix, names); err != nil {
+					return err
+				}
+			}
+		case '-':
+			if strings.HasPrefix(name, prefix) && !strings.HasSuffix(name, partSuffix) {
+				*names = append(*names, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete implements Storage
+func (s *SFTP) Delete(name string) error {
+	_, err := s.batch("rm " + quote(s.remotePath(name)))
+	return err
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+)
+
+var (
+	// ErrWriteOnly is returned when reading, listing or deleting files of a
+	// Sink, whatever it was written to is out of its reach
+	ErrWriteOnly = errors.New("storage is write only")
+)
+
+// Sink is a write only Storage which hands every file written to it to a
+// writer of its own, e.g. a pipe, a network connection to a remote archiver
+// or an in-memory buffer, rather than to disk
+type Sink struct {
+	open func(name string) (io.WriteCloser, error)
+}
+
+// NewSink is the constructor for a Sink, open is called with the name of
+// every file written, e.g. clips/front-door.mp4, and returns where to write
+// its contents. Closing the file closes the writer
+func NewSink(open func(name string) (io.WriteCloser, error)) *Sink {
+	return &Sink{open: open}
+}
+
+// NewWriterSink returns a Sink writing every file to the same writer, one
+// after the other, which it never closes, e.g. a bytes.Buffer or os.Stdout
+func NewWriterSink(w io.Writer) *Sink {
+	return NewSink(func(string) (io.WriteCloser, error) {
+		return nopCloser{w}, nil
+	})
+}
+
+// nopCloser is a writer whose Close does nothing
+type nopCloser struct {
+	io.Writer
+}
+
+// Close implements io.Closer
+func (nopCloser) Close() error {
+	return nil
+}
+
+// sinkFile is a file being written to a Sink, its contents are hashed as
+// they are written
+type sinkFile struct {
+	w   io.WriteCloser
+	h   hash.Hash
+	obj Object
+}
+
+// Write implements io.Writer
+func (f *sinkFile) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.h.Write(p[:n])
+	f.obj.Size += int64(n)
+	return n, err
+}
+
+// Close implements io.Closer
+func (f *sinkFile) Close() error {
+	f.obj.SHA256 = hex.EncodeToString(f.h.Sum(nil))
+	return f.w.Close()
+}
+
+// Object implements ObjectWriter
+func (f *sinkFile) Object() Object {
+	return f.obj
+}
+
+// PutClip implements Storage
+func (s *Sink) PutClip(name string) (ObjectWriter, error) {
+	w, err := s.open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sinkFile{w: w, h: sha256.New(), obj: Object{Name: name}}, nil
+}
+
+// PutSnapshot implements Storage
+func (s *Sink) PutSnapshot(name string, data []byte) (Object, error) {
+	f, err := s.PutClip(name)
+	if err != nil {
+		return Object{}, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return Object{}, err
+	}
+	if err := f.Close(); err != nil {
+		return Object{}, err
+	}
+	return f.Object(), nil
+}
+
+// Open implements Storage, it always returns ErrWriteOnly
+func (s *Sink) Open(name string) (io.ReadCloser, error) {
+	return nil, ErrWriteOnly
+}
+
+// List implements Storage, it always returns ErrWriteOnly
+func (s *Sink) List(prefix string) ([]string, error) {
+	return nil, ErrWriteOnly
+}
+
+// Delete implements Storage, it always returns ErrWriteOnly
+func (s *Sink) Delete(name string) error {
+	return ErrWriteOnly
+}
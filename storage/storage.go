@@ -0,0 +1,285 @@
+// Package storage saves snapshots and clips to disk, optionally encrypting
+// them at rest
+package storage
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Storage stores snapshots and clips. Dir stores them on local disk, other
+// backends, e.g. remote ones, are interchangeable with it. Names are slash
+// separated paths, e.g. clips/front-door.mp4
+type Storage interface {
+	// PutSnapshot stores a whole file, e.g. a snapshot, and returns its
+	// description
+	PutSnapshot(name string, data []byte) (Object, error)
+	// PutClip creates a file which is written incrementally, e.g. a clip
+	// being recorded, the file is only complete once closed
+	PutClip(name string) (ObjectWriter, error)
+	// Open opens a file for reading
+	Open(name string) (io.ReadCloser, error)
+	// List returns the names of the files whose name starts with the
+	// given prefix, sorted
+	List(prefix string) ([]string, error)
+	// Delete removes a file
+	Delete(name string) error
+}
+
+// ObjectWriter is a file being written to a Storage
+type ObjectWriter interface {
+	io.WriteCloser
+	// Object returns the description of the file, it is only complete once
+	// the file has been closed
+	Object() Object
+}
+
+// Dir stores files in a directory on disk
+type Dir struct {
+	path       string
+	key        []byte
+	signingKey ed25519.PrivateKey
+	// plaintext is whether unencrypted files are read despite the key
+	plaintext bool
+}
+
+// Option configures optional behaviour of a Dir
+type Option func(*Dir)
+
+// WithEncryptionKey encrypts every file written to the directory with
+// AES-GCM under the given key (see ParseKey), so footage isn't readable by
+// anyone who gets hold of the disk. Without the key it can't be recovered
+func WithEncryptionKey(key []byte) Option {
+	return func(d *Dir) {
+		d.key = key
+	}
+}
+
+// WithPlaintextReads reads files which were written unencrypted from a
+// directory with an encryption key, which otherwise fail to open with
+// ErrNotEncrypted, while footage from before encryption was turned on is
+// migrated
+func WithPlaintextReads() Option {
+	return func(d *Dir) {
+		d.plaintext = true
+	}
+}
+
+// WithSigningKey signs the hash of every file written to the directory with
+// the given key, so the provenance of footage can be demonstrated later
+func WithSigningKey(key ed25519.PrivateKey) Option {
+	return func(d *Dir) {
+		d.signingKey = key
+	}
+}
+
+// NewDir is the constructor for a Dir, the directory is created if it
+// doesn't exist
+func NewDir(path string, opts ...Option) (*Dir, error) {
+	d := &Dir{path: path}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.key != nil {
+		if _, err := newGCM(d.key); err != nil {
+			return nil, fmt.Errorf("invalid encryption key: %w", err)
+		}
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Path returns the path of a file in the directory
+func (d *Dir) Path(name string) string {
+	return filepath.Join(d.path, filepath.FromSlash(name))
+}
+
+// File is a file being written to a Dir, its contents are hashed as they
+// are written
+type File struct {
+	f      *os.File
+	enc    io.WriteCloser
+	h      hash.Hash
+	obj    Object
+	signer ed25519.PrivateKey
+}
+
+// Write implements io.Writer
+func (f *File) Write(p []byte) (int, error) {
+	w := io.Writer(f.f)
+	if f.enc != nil {
+		w = f.enc
+	}
+	n, err := w.Write(p)
+	f.h.Write(p[:n])
+	f.obj.Size += int64(n)
+	return n, err
+}
+
+// Close completes the file, after which its Object is available
+func (f *File) Close() error {
+	var err error
+	if f.enc != nil {
+		err = f.enc.Close()
+	}
+	if cerr := f.f.Close(); err == nil {
+		err = cerr
+	}
+	f.obj.SHA256 = hex.EncodeToString(f.h.Sum(nil))
+	if f.signer != nil {
+		f.obj.sign(f.signer)
+	}
+	return err
+}
+
+// Object returns the description of the file, with its hash and signature,
+// it is only complete once the file has been closed
+func (f *File) Object() Object {
+	return f.obj
+}
+
+// Create creates a file in the directory, e.g. for a clip being recorded,
+// the file is only complete once closed
+func (d *Dir) Create(name string) (*File, error) {
+	path := d.Path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	file := &File{f: f, h: sha256.New(), obj: Object{Name: name}, signer: d.signingKey}
+	if d.key == nil {
+		return file, nil
+	}
+	if file.enc, err = NewEncryptWriter(f, d.key); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// WriteFile writes a whole file to the directory, e.g. a snapshot, and
+// returns its description
+func (d *Dir) WriteFile(name string, data []byte) (Object, error) {
+	f, err := d.Create(name)
+	if err != nil {
+		return Object{}, err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return Object{}, err
+	}
+	if err := f.Close(); err != nil {
+		return Object{}, err
+	}
+	return f.Object(), nil
+}
+
+// PutSnapshot implements Storage
+func (d *Dir) PutSnapshot(name string, data []byte) (Object, error) {
+	return d.WriteFile(name, data)
+}
+
+// PutClip implements Storage
+func (d *Dir) PutClip(name string) (ObjectWriter, error) {
+	return d.Create(name)
+}
+
+// List implements Storage
+func (d *Dir) List(prefix string) ([]string, error) {
+	names := []string{}
+	err := filepath.Walk(d.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(d.path, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// Delete implements Storage
+func (d *Dir) Delete(name string) error {
+	return d.Remove(name)
+}
+
+// readCloser pairs a decrypting reader with the file beneath it
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Open opens a file in the directory for reading, decrypting it. Files which
+// were written unencrypted are only read without an encryption key, or with
+// WithPlaintextReads, so that a file swapped in on disk isn't taken for one
+// the directory wrote
+func (d *Dir) Open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(d.Path(name))
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(f, d.key, d.key == nil || d.plaintext)
+}
+
+// ReadFile reads a whole file from the directory
+func (d *Dir) ReadFile(name string) ([]byte, error) {
+	r, err := d.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// Remove removes a file from the directory
+func (d *Dir) Remove(name string) error {
+	return os.Remove(d.Path(name))
+}
+
+// Decrypt returns a reader of the plaintext of a file which may or may not
+// be encrypted, closing it closes the file
+func Decrypt(f io.ReadCloser, key []byte) (io.ReadCloser, error) {
+	return decrypt(f, key, true)
+}
+
+// decrypt is Decrypt, refusing unencrypted files unless plaintext is set
+func decrypt(f io.ReadCloser, key []byte, plaintext bool) (io.ReadCloser, error) {
+	br := bufio.NewReader(f)
+	if !isEncrypted(br) {
+		if !plaintext {
+			f.Close()
+			return nil, ErrNotEncrypted
+		}
+		return readCloser{Reader: br, Closer: f}, nil
+	}
+	if key == nil {
+		f.Close()
+		return nil, ErrEncrypted
+	}
+	r, err := NewDecryptReader(br, key)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return readCloser{Reader: r, Closer: f}, nil
+}
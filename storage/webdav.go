@@ -0,0 +1,359 @@
+package storage
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// propfindBody asks a WebDAV server for the properties List and uploads need
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/><getcontentlength/></prop></propfind>`
+
+// WebDAV stores files on a WebDAV server, e.g. a NAS which doesn't speak S3
+type WebDAV struct {
+	remote
+	base     *url.URL
+	user     string
+	password string
+}
+
+// NewWebDAV is the constructor for a WebDAV storage under the given URL,
+// e.g. https://nas.local/remote.php/dav/files/goaway/. The user and password
+// are sent with basic authentication when the user isn't empty
+func NewWebDAV(baseURL, user, password string, opts ...RemoteOption) (*WebDAV, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebDAV URL: %w", err)
+	}
+	if (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid WebDAV URL %q, expected e.g. https://nas.local/remote.php/dav/files/goaway/", baseURL)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	return &WebDAV{remote: newRemote(opts), base: base, user: user, password: password}, nil
+}
+
+// url returns the URL of a file or, with a trailing slash, of a collection
+func (w *WebDAV) url(name string) string {
+	u := *w.base
+	u.Path = w.base.Path + strings.TrimPrefix(name, "/")
+	return u.String()
+}
+
+// do sends a request and checks its status, the caller must close the body
+// of the response
+func (w *WebDAV) do(method, name string, body io.Reader, header http.Header, ok ...int) (*http.Response, error) {
+	req, err := http.NewRequest(method, w.url(name), body)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := body.(*io.SectionReader); ok {
+		// rather than a chunked upload, which some servers refuse
+		req.ContentLength = s.Size()
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if w.user != "" {
+		req.SetBasicAuth(w.user, w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+	return nil, &webDAVError{method: method, name: name, status: resp.StatusCode}
+}
+
+// webDAVError is an unexpected response of a WebDAV server
+type webDAVError struct {
+	method, name string
+	status       int
+}
+
+func (e *webDAVError) Error() string {
+	return fmt.Sprintf("WebDAV %s %s: %d %s", e.method, e.name, e.status, http.StatusText(e.status))
+}
+
+// PutSnapshot implements Storage
+func (w *WebDAV) PutSnapshot(name string, data []byte) (Object, error) {
+	return putSnapshot(name, data, w.uploader(name))
+}
+
+// PutClip implements Storage, the clip is uploaded once closed
+func (w *WebDAV) PutClip(name string) (ObjectWriter, error) {
+	return newSpoolFile(name, w.uploader(name))
+}
+
+// uploader returns a function which uploads a local file to the given name
+func (w *WebDAV) uploader(name string) func(local string, size int64) error {
+	return func(local string, size int64) error {
+		if err := w.mkdirs(path.Dir(name)); err != nil {
+			return err
+		}
+		part := name + partSuffix
+		chunked := false
+		if w.chunkSize > 0 && size > w.chunkSize {
+			var err error
+			if chunked, err = w.uploadChunks(local, part, size); err != nil {
+				return err
+			}
+		}
+		if !chunked {
+			if err := w.retry(func(attempt int) error { return w.upload(local, part, size, attempt > 0) }); err != nil {
+				return err
+			}
+		}
+		resp, err := w.do("MOVE", part, nil, http.Header{
+			"Destination": {w.url(name)},
+			"Overwrite":   {"T"},
+		}, http.StatusCreated, http.StatusNoContent)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+}
+
+// upload uploads a local file, resuming a previous attempt with a partial
+// PUT when the server supports it. Servers which ignore the range of a
+// partial PUT are caught by checking the size of the upload
+func (w *WebDAV) upload(local, part string, size int64, resume bool) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset := int64(0)
+	if resume {
+		if offset, err = w.size(part); err != nil || offset >= size {
+			offset = 0
+		}
+	}
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, size-1, size))
+	}
+	body := io.NewSectionReader(f, offset, size-offset)
+	resp, err := w.do(http.MethodPut, part, body, header, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		if offset > 0 {
+			// partial PUTs aren't supported, start over
+			return w.upload(local, part, size, false)
+		}
+		return err
+	}
+	resp.Body.Close()
+	if uploaded, err := w.size(part); err != nil || uploaded != size {
+		if offset > 0 {
+			return w.upload(local, part, size, false)
+		}
+		return fmt.Errorf("WebDAV upload of %s is %d bytes, expected %d", part, uploaded, size)
+	}
+	return nil
+}
+
+// uploadChunks uploads a local file in chunks, each a partial PUT retried
+// on its own, resuming from what the server has of the file. It returns
+// false when the server doesn't support partial PUTs, for the file to be
+// uploaded whole instead
+func (w *WebDAV) uploadChunks(local, part string, size int64) (bool, error) {
+	f, err := os.Open(local)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	offset := int64(0)
+	unsupported := false
+	for offset < size && !unsupported {
+		err := w.retry(func(attempt int) error {
+			if attempt > 0 {
+				// the server may have kept all, some or none of the
+				// chunk which failed
+				uploaded, err := w.size(part)
+				var dErr *webDAVError
+				if errors.As(err, &dErr) && dErr.status == http.StatusNotFound {
+					uploaded, err = 0, nil
+				}
+				if err != nil {
+					return err
+				}
+				if offset = uploaded; offset >= size {
+					offset = 0
+				}
+			}
+			end := offset + w.chunkSize
+			if end > size {
+				end = size
+			}
+			header := http.Header{"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", offset, end-1, size)}}
+			resp, err := w.do(http.MethodPut, part, io.NewSectionReader(f, offset, end-offset), header,
+				http.StatusOK, http.StatusCreated, http.StatusNoContent)
+			var dErr *webDAVError
+			if errors.As(err, &dErr) && (dErr.status == http.StatusBadRequest ||
+				dErr.status == http.StatusRequestedRangeNotSatisfiable || dErr.status == http.StatusNotImplemented) {
+				unsupported = true
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			// servers which ignore the range replace the file with the chunk
+			uploaded, err := w.size(part)
+			if err != nil {
+				return err
+			}
+			if uploaded != end {
+				unsupported = true
+				return nil
+			}
+			offset = end
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return !unsupported, nil
+}
+
+// mkdirs creates a collection and its parents, existing ones are left as
+// they are
+func (w *WebDAV) mkdirs(dir string) error {
+	if dir == "." || dir == "/" || dir == "" {
+		return nil
+	}
+	if err := w.mkdirs(path.Dir(dir)); err != nil {
+		return err
+	}
+	resp, err := w.do("MKCOL", dir+"/", nil, nil, http.StatusCreated, http.StatusMethodNotAllowed)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// multistatus is the response of a WebDAV server to PROPFIND
+type multistatus struct {
+	Responses []struct {
+		Href          string    `xml:"href"`
+		Collection    *struct{} `xml:"propstat>prop>resourcetype>collection"`
+		ContentLength string    `xml:"propstat>prop>getcontentlength"`
+	} `xml:"response"`
+}
+
+// propfind returns the properties of a resource, and of its members with
+// depth 1
+func (w *WebDAV) propfind(name string, depth int) (*multistatus, error) {
+	resp, err := w.do("PROPFIND", name, strings.NewReader(propfindBody), http.Header{
+		"Depth":        {strconv.Itoa(depth)},
+		"Content-Type": {"application/xml"},
+	}, http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	ms := &multistatus{}
+	if err := xml.NewDecoder(resp.Body).Decode(ms); err != nil {
+		return nil, fmt.Errorf("invalid WebDAV PROPFIND response: %w", err)
+	}
+	return ms, nil
+}
+
+// size returns the size of a file
+func (w *WebDAV) size(name string) (int64, error) {
+	ms, err := w.propfind(name, 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(ms.Responses) == 0 {
+		return 0, fmt.Errorf("WebDAV PROPFIND %s: no response", name)
+	}
+	return strconv.ParseInt(ms.Responses[0].ContentLength, 10, 64)
+}
+
+// Open implements Storage
+func (w *WebDAV) Open(name string) (io.ReadCloser, error) {
+	resp, err := w.do(http.MethodGet, name, nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// List implements Storage, collections are listed one level at a time as
+// servers commonly refuse infinite depth
+func (w *WebDAV) List(prefix string) ([]string, error) {
+	names := []string{}
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i+1]
+	}
+	if err := w.list(dir, prefix, &names); err != nil {
+		var dErr *webDAVError
+		if errors.As(err, &dErr) && dErr.status == http.StatusNotFound {
+			return names, nil
+		}
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (w *WebDAV) list(dir, prefix string, names *[]string) error {
+	ms, err := w.propfind(dir, 1)
+	if err != nil {
+		return err
+	}
+	for _, r := range ms.Responses {
+		// hrefs may be absolute URLs or paths
+		u, err := url.Parse(r.Href)
+		if err != nil {
+			return err
+		}
+		href := u.Path
+		name := strings.TrimPrefix(href, w.base.Path)
+		if name == href || strings.TrimSuffix(name, "/") == strings.TrimSuffix(dir, "/") {
+			// outside of the base, or the collection itself
+			continue
+		}
+		if r.Collection != nil {
+			name = strings.TrimSuffix(name, "/") + "/"
+			if strings.HasPrefix(name, prefix) || strings.HasPrefix(prefix, name) {
+				if err := w.list(name, prefix, names); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(name, prefix) && !strings.HasSuffix(name, partSuffix) {
+			*names = append(*names, name)
+		}
+	}
+	return nil
+}
+
+// Delete implements Storage
+func (w *WebDAV) Delete(name string) error {
+	resp, err := w.do(http.MethodDelete, name, nil, nil, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
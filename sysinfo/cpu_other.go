@@ -0,0 +1,14 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package sysinfo
+
+import (
+	"time"
+)
+
+// CPUTime is not supported on this platform, it returns 0 so CPU usage
+// reports as 0
+func CPUTime() time.Duration {
+	return 0
+}
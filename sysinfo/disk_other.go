@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package sysinfo
+
+// ReadDisk returns ErrUnsupported, disk usage is only read on Linux, macOS
+// and FreeBSD
+func ReadDisk(dir string) (Disk, error) {
+	return Disk{}, ErrUnsupported
+}
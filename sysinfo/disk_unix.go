@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package sysinfo
+
+import (
+	"syscall"
+)
+
+// ReadDisk returns the usage of the filesystem a directory is on
+func ReadDisk(dir string) (Disk, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return Disk{}, err
+	}
+	return Disk{Path: dir, Total: uint64(st.Blocks) * uint64(st.Bsize), Free: uint64(st.Bavail) * uint64(st.Bsize)}, nil
+}
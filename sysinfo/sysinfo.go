@@ -0,0 +1,77 @@
+// Package sysinfo reports the resources the GoAway process uses, and the
+// space free on the disks it records to, e.g. for dashboards to warn before
+// storage fills up
+package sysinfo
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ErrUnsupported is returned where disk usage can't be read on the platform
+var ErrUnsupported = errors.New("not supported on this platform")
+
+// started is when the process started, close enough
+var started = time.Now()
+
+// Process is the resource usage of the process
+type Process struct {
+	Uptime time.Duration `json:"uptime"`
+	// CPU is the number of CPU cores used on average since the previous
+	// ReadProcess, or the start of the process, e.g. 0.5 for half of a
+	// core, it is 0 on Windows and Plan 9
+	CPU float64 `json:"cpu"`
+	// Memory is the memory the Go runtime obtained from the system, and
+	// HeapAlloc that allocated on its heap. OpenCV's memory, outside of the
+	// Go heap, isn't included, see detector.MemStats
+	Memory     uint64 `json:"memory"`
+	HeapAlloc  uint64 `json:"heap_alloc"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// last is when the CPU usage was last read, and the CPU time used then
+var last struct {
+	sync.Mutex
+	at  time.Time
+	cpu time.Duration
+}
+
+// ReadProcess returns the resource usage of the process
+func ReadProcess() Process {
+	now, used := time.Now(), CPUTime()
+	last.Lock()
+	since, before := last.at, last.cpu
+	if since.IsZero() {
+		since = started
+	}
+	last.at, last.cpu = now, used
+	last.Unlock()
+	p := Process{Uptime: now.Sub(started), Goroutines: runtime.NumGoroutine()}
+	if elapsed := now.Sub(since); elapsed > 0 {
+		p.CPU = float64(used-before) / float64(elapsed)
+	}
+	var rt runtime.MemStats
+	runtime.ReadMemStats(&rt)
+	p.Memory, p.HeapAlloc = rt.Sys, rt.HeapAlloc
+	return p
+}
+
+// Disk is the usage of the filesystem a directory is on
+type Disk struct {
+	Path string `json:"path"`
+	// Total is the size of the filesystem, and Free the space available to
+	// the process, in bytes
+	Total uint64 `json:"total"`
+	Free  uint64 `json:"free"`
+}
+
+// Used returns the fraction of the filesystem which isn't available, from 0
+// to 1
+func (d Disk) Used() float64 {
+	if d.Total == 0 {
+		return 0
+	}
+	return 1 - float64(d.Free)/float64(d.Total)
+}
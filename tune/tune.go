@@ -0,0 +1,133 @@
+// Package tune suggests detector settings from the events users marked as
+// false positives, so that e.g. a zone with swaying branches can be made less
+// sensitive without missing the events which weren't false positives
+package tune
+
+import (
+	"math"
+	"sort"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/events"
+)
+
+// missedWeight is how many false positives suppressing a real event is
+// worth, missing real events is worse than alerting on false ones
+const missedWeight = 3
+
+// Suggestion is a suggested sensitivity, the minimum diff contour area, for
+// a zone of a detector
+type Suggestion struct {
+	// Zone is the name of the zone, empty for motion outside of all zones
+	// which the detector's own sensitivity applies to
+	Zone      string  `json:"zone"`
+	Current   float64 `json:"current"`
+	Suggested float64 `json:"suggested"`
+	// FalsePositives is the number of events in the zone marked as false
+	// positives, of which Suppressed would not have been detected with the
+	// suggested sensitivity
+	FalsePositives int `json:"false_positives"`
+	Suppressed     int `json:"suppressed"`
+	// Missed is the number of events in the zone which weren't false
+	// positives but would not have been detected either
+	Missed int `json:"missed"`
+}
+
+// zoneEvents are the largest contour areas of the events in a zone
+type zoneEvents struct {
+	falsePositives []float64
+	truePositives  []float64
+}
+
+// Suggest returns the sensitivities which would have suppressed the most
+// false positives among the detector's past events without missing real
+// ones, for each zone where that is less sensitive than the current setting.
+// Forced events, see detector.CaptureEvent, are ignored
+func Suggest(d *detector.Detector, records []*events.Record) []Suggestion {
+	current := map[string]float64{"": d.Sensitivity()}
+	for _, z := range d.Zones() {
+		current[z.Name] = d.Sensitivity()
+		if z.MinArea > 0 {
+			current[z.Name] = z.MinArea
+		}
+	}
+	byZone := map[string]*zoneEvents{}
+	for _, r := range records {
+		if r.Event.Reason != "" {
+			continue
+		}
+		z, _ := d.ZoneOf(r.Event)
+		if byZone[z.Name] == nil {
+			byZone[z.Name] = &zoneEvents{}
+		}
+		if r.FalsePositive {
+			byZone[z.Name].falsePositives = append(byZone[z.Name].falsePositives, r.Event.MaxArea)
+		} else {
+			byZone[z.Name].truePositives = append(byZone[z.Name].truePositives, r.Event.MaxArea)
+		}
+	}
+	suggestions := []Suggestion{}
+	for zone, evs := range byZone {
+		if s, ok := suggest(zone, current[zone], evs); ok {
+			suggestions = append(suggestions, s)
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool { return suggestions[i].Zone < suggestions[j].Zone })
+	return suggestions
+}
+
+// suggest returns the best sensitivity for a zone, if it is an improvement
+// on the current one. An event is suppressed when its largest contour area
+// is below the sensitivity, so the candidates are just above those of the
+// false positives
+func suggest(zone string, current float64, evs *zoneEvents) (Suggestion, bool) {
+	best := Suggestion{Zone: zone, Current: current, Suggested: current, FalsePositives: len(evs.falsePositives)}
+	bestScore := 0
+	for _, fp := range evs.falsePositives {
+		candidate := math.Floor(fp) + 1
+		if candidate <= current {
+			continue
+		}
+		s := Suggestion{Zone: zone, Current: current, Suggested: candidate, FalsePositives: len(evs.falsePositives)}
+		for _, area := range evs.falsePositives {
+			if area < candidate {
+				s.Suppressed++
+			}
+		}
+		for _, area := range evs.truePositives {
+			if area < candidate {
+				s.Missed++
+			}
+		}
+		score := s.Suppressed - missedWeight*s.Missed
+		if score > bestScore || (score == bestScore && score > 0 && candidate < best.Suggested) {
+			best, bestScore = s, score
+		}
+	}
+	return best, bestScore > 0
+}
+
+// Apply applies suggested sensitivities to a detector. Zones which use the
+// detector's own sensitivity keep their current one when it changes
+func Apply(d *detector.Detector, suggestions []Suggestion) error {
+	for _, s := range suggestions {
+		if s.Zone != "" {
+			continue
+		}
+		for _, z := range d.Zones() {
+			if z.MinArea == 0 {
+				d.SetZoneSensitivity(z.Name, d.Sensitivity())
+			}
+		}
+		d.SetSensitivity(s.Suggested)
+	}
+	for _, s := range suggestions {
+		if s.Zone == "" {
+			continue
+		}
+		if err := d.SetZoneSensitivity(s.Zone, s.Suggested); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package v4l2
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownDevice is returned when no connected device matches a device
+// spec, see Resolve
+var ErrUnknownDevice = errors.New("no such video device")
+
+// DeviceInfo describes a video capture device
+type DeviceInfo struct {
+	// Path is the device's node, e.g. /dev/video0, and Index its number,
+	// the camera ID OpenCV opens it by
+	Path  string `json:"path"`
+	Index int    `json:"index"`
+	// Name is the device's name, e.g. "HD Pro Webcam C920"
+	Name    string `json:"name"`
+	Driver  string `json:"driver"`
+	BusInfo string `json:"bus_info"`
+	// Serial is the USB serial number, if the device has one
+	Serial string `json:"serial,omitempty"`
+	// IDs and Paths are the device's persistent links under /dev/v4l/by-id
+	// and /dev/v4l/by-path
+	IDs   []string `json:"ids,omitempty"`
+	Paths []string `json:"paths,omitempty"`
+}
+
+// Find returns the device among the given ones which is the same device as
+// want, e.g. after it was unplugged and plugged back in, possibly into
+// another port and with another index. Devices are matched by serial number,
+// or by name when no other device has the same name, or by name and bus
+func Find(devices []DeviceInfo, want DeviceInfo) (DeviceInfo, bool) {
+	named := []DeviceInfo{}
+	for _, d := range devices {
+		if d.Name == want.Name {
+			named = append(named, d)
+		}
+	}
+	if want.Serial != "" {
+		for _, d := range named {
+			if d.Serial == want.Serial {
+				return d, true
+			}
+		}
+		return DeviceInfo{}, false
+	}
+	if len(named) == 1 {
+		return named[0], true
+	}
+	for _, d := range named {
+		if d.BusInfo == want.BusInfo {
+			return d, true
+		}
+	}
+	return DeviceInfo{}, false
+}
+
+// Resolve returns the device a spec selects, so that cameras keep their
+// identity across reboots and re-enumerations. The spec is one of:
+//   - an OpenCV camera ID, e.g. 1, which is not described
+//   - a device path, e.g. /dev/video1, or one of its persistent links, e.g.
+//     /dev/v4l/by-id/usb-046d_HD_Pro_Webcam_C920_A1B2C3D4-video-index0
+//   - the name of a link under /dev/v4l/by-id, or a USB serial number,
+//     e.g. A1B2C3D4
+func Resolve(spec string) (DeviceInfo, error) {
+	spec = strings.TrimSpace(spec)
+	if id, err := strconv.Atoi(spec); err == nil && id >= 0 {
+		return DeviceInfo{Path: DevicePath(id), Index: id}, nil
+	}
+	if strings.HasPrefix(spec, "/") {
+		return Describe(spec)
+	}
+	if spec == "" {
+		return DeviceInfo{}, fmt.Errorf("%w: empty device", ErrUnknownDevice)
+	}
+	devices, err := Devices()
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	for _, d := range devices {
+		if d.Serial == spec {
+			return d, nil
+		}
+		for _, link := range d.IDs {
+			if filepath.Base(link) == spec {
+				return d, nil
+			}
+		}
+	}
+	return DeviceInfo{}, fmt.Errorf("%w %q", ErrUnknownDevice, spec)
+}
@@ -0,0 +1,128 @@
+// Package v4l2 gets and sets the raw controls of Video4Linux2 devices, for
+// camera settings OpenCV has no property for, e.g. the power line frequency
+// or the IR-cut filter of night vision cameras
+package v4l2
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnsupported is returned when opening a device on a platform
+	// without V4L2
+	ErrUnsupported = errors.New("V4L2 is only supported on Linux")
+
+	// ErrUnknownControl is returned for controls the device doesn't have
+	ErrUnknownControl = errors.New("unknown V4L2 control")
+)
+
+// Control types
+const (
+	TypeInteger     = "int"
+	TypeBoolean     = "bool"
+	TypeMenu        = "menu"
+	TypeButton      = "button"
+	TypeInteger64   = "int64"
+	TypeString      = "string"
+	TypeBitmask     = "bitmask"
+	TypeIntegerMenu = "intmenu"
+)
+
+// Control is a control of a device, as reported by its driver
+type Control struct {
+	ID uint32 `json:"id"`
+	// Name is the control's name as v4l2-ctl lists it, e.g.
+	// power_line_frequency, and Label the driver's, e.g. "Power Line
+	// Frequency"
+	Name    string `json:"name"`
+	Label   string `json:"label"`
+	Type    string `json:"type"`
+	Min     int32  `json:"min"`
+	Max     int32  `json:"max"`
+	Step    int32  `json:"step"`
+	Default int32  `json:"default"`
+	// Menu are the values of menu controls, e.g. {0: "Disabled", 1: "50
+	// Hz", 2: "60 Hz"}
+	Menu map[int32]string `json:"menu,omitempty"`
+	// Inactive controls have no effect in the device's current mode, e.g.
+	// the exposure while auto exposure is on
+	Inactive bool `json:"inactive,omitempty"`
+	ReadOnly bool `json:"read_only,omitempty"`
+}
+
+// DevicePath returns the path of the V4L2 device of an OpenCV camera ID
+func DevicePath(camID int) string {
+	return fmt.Sprintf("/dev/video%d", camID)
+}
+
+// Control returns a control of the device by its name, e.g.
+// power_line_frequency, or its ID, e.g. 0x00980918
+func (d *Device) Control(nameOrID string) (Control, error) {
+	controls, err := d.Controls()
+	if err != nil {
+		return Control{}, err
+	}
+	id, err := strconv.ParseUint(nameOrID, 0, 32)
+	isID := err == nil
+	name := controlName(nameOrID)
+	for _, c := range controls {
+		if (isID && c.ID == uint32(id)) || c.Name == name {
+			return c, nil
+		}
+	}
+	return Control{}, fmt.Errorf("%w %q on %s", ErrUnknownControl, nameOrID, d.path)
+}
+
+// Get returns the value of a control by its name or ID, see Control
+func (d *Device) Get(nameOrID string) (int32, error) {
+	c, err := d.Control(nameOrID)
+	if err != nil {
+		return 0, err
+	}
+	return d.get(c.ID)
+}
+
+// Set sets a control by its name or ID, see Control. Values outside of the
+// control's range are rejected by the driver
+func (d *Device) Set(nameOrID string, value int32) error {
+	c, err := d.Control(nameOrID)
+	if err != nil {
+		return err
+	}
+	if c.ReadOnly {
+		return fmt.Errorf("V4L2 control %s is read only", c.Name)
+	}
+	if err := d.set(c.ID, value); err != nil {
+		return fmt.Errorf("could not set V4L2 control %s to %d: %w", c.Name, value, err)
+	}
+	return nil
+}
+
+// Path returns the path of the device
+func (d *Device) Path() string {
+	return d.path
+}
+
+// controlName turns the label of a control into its name as v4l2-ctl lists
+// it: lowercase, with runs of other characters than letters and digits
+// replaced by an underscore, e.g. "White Balance, Auto" becomes
+// white_balance_auto
+func controlName(label string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(strings.TrimSpace(label)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if underscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			underscore = false
+			continue
+		}
+		underscore = true
+	}
+	return b.String()
+}
@@ -0,0 +1,290 @@
+package v4l2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// ioctl requests, _IOR and _IOWR('V', nr, size) of linux/videodev2.h
+const (
+	vidiocQueryCap  = 0x80685600
+	vidiocGCtrl     = 0xc008561b
+	vidiocSCtrl     = 0xc008561c
+	vidiocQueryCtrl = 0xc0445624
+	vidiocQueryMenu = 0xc02c5625
+)
+
+// control flags of linux/videodev2.h
+const (
+	ctrlFlagDisabled = 0x0001
+	ctrlFlagReadOnly = 0x0004
+	ctrlFlagInactive = 0x0010
+	ctrlFlagNextCtrl = 0x80000000
+)
+
+// capabilities of linux/videodev2.h
+const (
+	capVideoCapture = 0x00000001
+	capDeviceCaps   = 0x80000000
+)
+
+// controlTypes are the names of the control types of linux/videodev2.h
+var controlTypes = map[uint32]string{
+	1: TypeInteger,
+	2: TypeBoolean,
+	3: TypeMenu,
+	4: TypeButton,
+	5: TypeInteger64,
+	7: TypeString,
+	8: TypeBitmask,
+	9: TypeIntegerMenu,
+}
+
+// v4l2Control is struct v4l2_control
+type v4l2Control struct {
+	id    uint32
+	value int32
+}
+
+// v4l2QueryCtrl is struct v4l2_queryctrl
+type v4l2QueryCtrl struct {
+	id           uint32
+	typ          uint32
+	name         [32]byte
+	minimum      int32
+	maximum      int32
+	step         int32
+	defaultValue int32
+	flags        uint32
+	reserved     [2]uint32
+}
+
+// v4l2QueryMenu is the packed struct v4l2_querymenu, its name or value union
+// is read as the name, or as the little endian value of integer menus
+type v4l2QueryMenu struct {
+	id       uint32
+	index    uint32
+	name     [32]byte
+	reserved uint32
+}
+
+// v4l2Capability is struct v4l2_capability
+type v4l2Capability struct {
+	driver       [16]byte
+	card         [32]byte
+	busInfo      [32]byte
+	version      uint32
+	capabilities uint32
+	deviceCaps   uint32
+	reserved     [3]uint32
+}
+
+// Devices returns the video capture devices, by index. Other nodes, e.g.
+// the metadata nodes of UVC cameras, are left out
+func Devices() ([]DeviceInfo, error) {
+	paths, err := filepath.Glob("/dev/video*")
+	if err != nil {
+		return nil, err
+	}
+	devices := []DeviceInfo{}
+	for _, path := range paths {
+		info, err := Describe(path)
+		if err != nil {
+			// devices can disappear while listing them, or be in use
+			continue
+		}
+		devices = append(devices, info)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Index < devices[j].Index })
+	return devices, nil
+}
+
+// Describe returns the description of a video capture device, given its
+// node or one of its persistent links
+func Describe(path string) (DeviceInfo, error) {
+	node, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	index, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(node), "video"))
+	if err != nil {
+		return DeviceInfo{}, fmt.Errorf("%s is not a video device", path)
+	}
+	d, err := Open(node)
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	defer d.Close()
+	c := v4l2Capability{}
+	if err := d.ioctl(vidiocQueryCap, unsafe.Pointer(&c)); err != nil {
+		return DeviceInfo{}, fmt.Errorf("could not query the capabilities of %s: %w", node, err)
+	}
+	caps := c.capabilities
+	if caps&capDeviceCaps != 0 {
+		caps = c.deviceCaps
+	}
+	if caps&capVideoCapture == 0 {
+		return DeviceInfo{}, fmt.Errorf("%s is not a video capture device", node)
+	}
+	return DeviceInfo{
+		Path:    node,
+		Index:   index,
+		Name:    cString(c.card[:]),
+		Driver:  cString(c.driver[:]),
+		BusInfo: cString(c.busInfo[:]),
+		Serial:  usbSerial(node),
+		IDs:     links("/dev/v4l/by-id", node),
+		Paths:   links("/dev/v4l/by-path", node),
+	}, nil
+}
+
+// usbSerial returns the serial number of the USB device of a video node, from
+// sysfs, where the node's device is an interface of the USB device
+func usbSerial(node string) string {
+	dev, err := filepath.EvalSymlinks(filepath.Join("/sys/class/video4linux", filepath.Base(node), "device"))
+	if err != nil {
+		return ""
+	}
+	serial, err := os.ReadFile(filepath.Join(filepath.Dir(dev), "serial"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(serial))
+}
+
+// links returns the links in dir which point to the node
+func links(dir, node string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	found := []string{}
+	for _, e := range entries {
+		link := filepath.Join(dir, e.Name())
+		if target, err := filepath.EvalSymlinks(link); err == nil && target == node {
+			found = append(found, link)
+		}
+	}
+	return found
+}
+
+// Device is an open V4L2 device
+type Device struct {
+	f    *os.File
+	path string
+}
+
+// Open opens a V4L2 device, e.g. /dev/video0, see DevicePath. Devices can be
+// opened while OpenCV captures from them
+func Open(path string) (*Device, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Device{f: f, path: path}, nil
+}
+
+// Close closes the device
+func (d *Device) Close() error {
+	return d.f.Close()
+}
+
+// ioctl makes an ioctl request on the device, retrying when interrupted
+func (d *Device) ioctl(req uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.f.Fd(), req, uintptr(arg))
+		switch errno {
+		case 0:
+			return nil
+		case syscall.EINTR:
+			continue
+		}
+		return errno
+	}
+}
+
+// Controls returns the controls of the device
+func (d *Device) Controls() ([]Control, error) {
+	controls := []Control{}
+	q := v4l2QueryCtrl{id: ctrlFlagNextCtrl}
+	for {
+		if err := d.ioctl(vidiocQueryCtrl, unsafe.Pointer(&q)); err != nil {
+			if errors.Is(err, syscall.EINVAL) {
+				// the last control was reached
+				return controls, nil
+			}
+			return nil, fmt.Errorf("could not list the V4L2 controls of %s: %w", d.path, err)
+		}
+		typ, ok := controlTypes[q.typ]
+		if ok && q.flags&ctrlFlagDisabled == 0 {
+			label := cString(q.name[:])
+			c := Control{
+				ID:       q.id,
+				Name:     controlName(label),
+				Label:    label,
+				Type:     typ,
+				Min:      q.minimum,
+				Max:      q.maximum,
+				Step:     q.step,
+				Default:  q.defaultValue,
+				Inactive: q.flags&ctrlFlagInactive != 0,
+				ReadOnly: q.flags&ctrlFlagReadOnly != 0,
+			}
+			if typ == TypeMenu || typ == TypeIntegerMenu {
+				c.Menu = d.menu(q)
+			}
+			controls = append(controls, c)
+		}
+		q = v4l2QueryCtrl{id: q.id | ctrlFlagNextCtrl}
+	}
+}
+
+// menu returns the items of a menu control, menus can skip indexes
+func (d *Device) menu(q v4l2QueryCtrl) map[int32]string {
+	menu := map[int32]string{}
+	for i := q.minimum; i <= q.maximum && i >= 0; i++ {
+		m := v4l2QueryMenu{id: q.id, index: uint32(i)}
+		if err := d.ioctl(vidiocQueryMenu, unsafe.Pointer(&m)); err != nil {
+			continue
+		}
+		if controlTypes[q.typ] == TypeIntegerMenu {
+			v := int64(0)
+			for j := 7; j >= 0; j-- {
+				v = v<<8 | int64(m.name[j])
+			}
+			menu[i] = fmt.Sprint(v)
+			continue
+		}
+		menu[i] = cString(m.name[:])
+	}
+	return menu
+}
+
+func (d *Device) get(id uint32) (int32, error) {
+	c := v4l2Control{id: id}
+	if err := d.ioctl(vidiocGCtrl, unsafe.Pointer(&c)); err != nil {
+		return 0, err
+	}
+	return c.value, nil
+}
+
+func (d *Device) set(id uint32, value int32) error {
+	c := v4l2Control{id: id, value: value}
+	return d.ioctl(vidiocSCtrl, unsafe.Pointer(&c))
+}
+
+// cString returns the NUL terminated string in b
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,42 @@
+//go:build !linux
+// +build !linux
+
+package v4l2
+
+// Device is an open V4L2 device
+type Device struct {
+	path string
+}
+
+// Devices returns ErrUnsupported, V4L2 is only supported on Linux
+func Devices() ([]DeviceInfo, error) {
+	return nil, ErrUnsupported
+}
+
+// Describe returns ErrUnsupported
+func Describe(path string) (DeviceInfo, error) {
+	return DeviceInfo{}, ErrUnsupported
+}
+
+// Open returns ErrUnsupported, V4L2 is only supported on Linux
+func Open(path string) (*Device, error) {
+	return nil, ErrUnsupported
+}
+
+// Close closes the device
+func (d *Device) Close() error {
+	return nil
+}
+
+// Controls returns ErrUnsupported
+func (d *Device) Controls() ([]Control, error) {
+	return nil, ErrUnsupported
+}
+
+func (d *Device) get(id uint32) (int32, error) {
+	return 0, ErrUnsupported
+}
+
+func (d *Device) set(id uint32, value int32) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,181 @@
+package wildlife
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/GoAway/detector"
+	"github.com/adrianosela/GoAway/storage"
+)
+
+const (
+	// DefaultBurstCount is the default number of stills of a burst
+	DefaultBurstCount = 5
+
+	// DefaultBurstInterval is the default interval between the stills of a
+	// burst
+	DefaultBurstInterval = 500 * time.Millisecond
+
+	// DefaultBurstCooldown is the default least time between the start of
+	// two bursts
+	DefaultBurstCooldown = 30 * time.Second
+)
+
+// Still is a still of a burst which was stored
+type Still struct {
+	storage.Object
+	Metadata Metadata
+}
+
+// Burst takes bursts of stills when motion starts, as trail cameras do, so
+// that there are sharp full resolution stills of an animal even when the
+// clip of its event is long or of a lower quality. Stills are tagged with
+// EXIF metadata, see TagJPEG, and stored as
+// stills/<camera>/<time of the burst>-<n>.jpg
+type Burst struct {
+	mu       sync.Mutex
+	detector *detector.Detector
+	store    storage.Storage
+	camera   string
+	count    int
+	interval time.Duration
+	cooldown time.Duration
+	snapshot detector.SnapshotOptions
+	hooks    []MetadataHook
+	onStill  func(Still)
+	onError  func(error)
+	last     time.Time
+	running  bool
+}
+
+// BurstOption configures optional behaviour of a Burst
+type BurstOption func(*Burst)
+
+// WithBurstSize sets the number of stills of a burst and the interval
+// between them
+func WithBurstSize(count int, interval time.Duration) BurstOption {
+	return func(b *Burst) {
+		b.count, b.interval = count, interval
+	}
+}
+
+// WithCooldown sets the least time between the start of two bursts, motion
+// meanwhile doesn't start another burst
+func WithCooldown(cooldown time.Duration) BurstOption {
+	return func(b *Burst) {
+		b.cooldown = cooldown
+	}
+}
+
+// WithSnapshotOptions crops or scales the stills down, they are full
+// resolution frames by default
+func WithSnapshotOptions(opts detector.SnapshotOptions) BurstOption {
+	return func(b *Burst) {
+		b.snapshot = opts
+	}
+}
+
+// WithMetadataHooks adds metadata to every still, e.g. MoonPhaseHook and a
+// TemperatureHook
+func WithMetadataHooks(hooks ...MetadataHook) BurstOption {
+	return func(b *Burst) {
+		b.hooks = append(b.hooks, hooks...)
+	}
+}
+
+// WithStillHandler sets a function to be called with every still stored
+func WithStillHandler(onStill func(Still)) BurstOption {
+	return func(b *Burst) {
+		b.onStill = onStill
+	}
+}
+
+// WithErrorHandler sets a function to be called with the errors of bursts,
+// which are otherwise logged. A still whose metadata hooks fail is stored
+// without their metadata
+func WithErrorHandler(onError func(error)) BurstOption {
+	return func(b *Burst) {
+		b.onError = onError
+	}
+}
+
+// NewBurst is the constructor for a Burst of stills of the detector's
+// frames, stored in the given storage
+func NewBurst(d *detector.Detector, store storage.Storage, camera string, opts ...BurstOption) *Burst {
+	b := &Burst{
+		detector: d,
+		store:    store,
+		camera:   camera,
+		count:    DefaultBurstCount,
+		interval: DefaultBurstInterval,
+		cooldown: DefaultBurstCooldown,
+		onError:  func(err error) { log.Printf("wildlife burst: %s", err) },
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Trigger starts a burst, unless one is being taken or the last one started
+// within the cooldown. It returns straight away, so it can be the detector's
+// on-detect function
+func (b *Burst) Trigger() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if b.running || now.Sub(b.last) < b.cooldown {
+		return
+	}
+	b.running, b.last = true, now
+	go b.take(now)
+}
+
+// take takes the stills of a burst started at the given time
+func (b *Burst) take(start time.Time) {
+	defer func() {
+		b.mu.Lock()
+		b.running = false
+		b.mu.Unlock()
+	}()
+	for i := 1; i <= b.count; i++ {
+		if i > 1 {
+			time.Sleep(b.interval)
+		}
+		if err := b.still(start, i); err != nil {
+			b.onError(err)
+		}
+	}
+}
+
+// still takes, tags and stores the n-th still of a burst
+func (b *Burst) still(start time.Time, n int) error {
+	jpg, err := b.detector.Snapshot(b.snapshot)
+	if err != nil {
+		return fmt.Errorf("could not take still: %w", err)
+	}
+	m := Metadata{Time: time.Now(), Camera: b.camera}
+	if info := b.detector.FrameInfo(); !info.Captured.IsZero() {
+		m.Time = info.Captured
+	}
+	for _, hook := range b.hooks {
+		if err := hook(&m); err != nil {
+			b.onError(err)
+		}
+	}
+	if jpg, err = TagJPEG(jpg, m); err != nil {
+		return err
+	}
+	name := path.Join("stills", b.camera, fmt.Sprintf("%s-%d.jpg", start.UTC().Format("20060102T150405Z"), n))
+	obj, err := b.store.PutSnapshot(name, jpg)
+	if err != nil {
+		return fmt.Errorf("could not store still %s: %w", name, err)
+	}
+	if b.onStill != nil {
+		b.onStill(Still{Object: obj, Metadata: m})
+	}
+	return nil
+}
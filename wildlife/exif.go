@@ -0,0 +1,212 @@
+package wildlife
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EXIF tags
+const (
+	tagMake               = 0x010f
+	tagModel              = 0x0110
+	tagSoftware           = 0x0131
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOrig     = 0x9011
+	tagUserComment        = 0x9286
+	tagAmbientTemperature = 0x9400
+)
+
+// EXIF value types
+const (
+	typeASCII     = 2
+	typeLong      = 4
+	typeUndefined = 7
+	typeSRational = 10
+)
+
+// exifDateTime is the layout of EXIF dates
+const exifDateTime = "2006:01:02 15:04:05"
+
+// ErrNotJPEG is returned when tagging data which isn't a jpg
+var ErrNotJPEG = errors.New("not a jpg image")
+
+// Metadata is the metadata a still is tagged with
+type Metadata struct {
+	// Time is when the still was taken
+	Time time.Time
+	// Camera is the name of the camera, the EXIF model
+	Camera string
+	// Temperature is the ambient temperature in degrees Celsius, nil if
+	// unknown, see TemperatureHook
+	Temperature *float64
+	// MoonPhase is the name of the phase of the moon, see MoonPhaseHook
+	MoonPhase string
+	// Tags are any other metadata, e.g. a humidity or a battery level
+	Tags map[string]string
+}
+
+// MetadataHook adds metadata to that of a still, e.g. the reading of a
+// sensor, it is called for every still
+type MetadataHook func(m *Metadata) error
+
+// MoonPhaseHook sets the phase of the moon at the time the still was taken
+func MoonPhaseHook(m *Metadata) error {
+	m.MoonPhase = MoonPhaseName(MoonPhase(m.Time))
+	return nil
+}
+
+// TemperatureHook sets the ambient temperature read by the given function,
+// e.g. from a DS18B20 sensor's sysfs file, in degrees Celsius
+func TemperatureHook(read func() (float64, error)) MetadataHook {
+	return func(m *Metadata) error {
+		t, err := read()
+		if err != nil {
+			return fmt.Errorf("could not read the temperature: %w", err)
+		}
+		m.Temperature = &t
+		return nil
+	}
+}
+
+// comment returns the metadata which EXIF has no tags for, as "key=value"
+// pairs separated by semicolons, sorted by key
+func (m Metadata) comment() string {
+	pairs := []string{}
+	if m.MoonPhase != "" {
+		pairs = append(pairs, "moon_phase="+m.MoonPhase)
+	}
+	if m.Temperature != nil {
+		pairs = append(pairs, fmt.Sprintf("temperature=%.1f", *m.Temperature))
+	}
+	for k, v := range m.Tags {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "; ")
+}
+
+// TagJPEG returns a copy of a jpg with an EXIF segment holding the
+// metadata: the time in DateTimeOriginal, the camera as the model, the
+// temperature in AmbientTemperature, and the moon phase and tags in the user
+// comment, which is what most photo managers show
+func TagJPEG(jpg []byte, m Metadata) ([]byte, error) {
+	if len(jpg) < 4 || jpg[0] != 0xff || jpg[1] != 0xd8 {
+		return nil, ErrNotJPEG
+	}
+	exif := exifSegment(m)
+	if len(exif) > math.MaxUint16 {
+		return nil, fmt.Errorf("EXIF segment of %d bytes is too large", len(exif))
+	}
+	// the EXIF segment goes after the SOI, and after the JFIF segment if
+	// there is one
+	at := 2
+	if jpg[2] == 0xff && jpg[3] == 0xe0 && len(jpg) >= 6 {
+		at = 4 + int(binary.BigEndian.Uint16(jpg[4:]))
+		if at > len(jpg) {
+			return nil, ErrNotJPEG
+		}
+	}
+	tagged := make([]byte, 0, len(jpg)+len(exif)+4)
+	tagged = append(tagged, jpg[:at]...)
+	tagged = append(tagged, 0xff, 0xe1, 0, 0)
+	binary.BigEndian.PutUint16(tagged[len(tagged)-2:], uint16(len(exif)+2))
+	tagged = append(tagged, exif...)
+	return append(tagged, jpg[at:]...), nil
+}
+
+// ifdEntry is an entry of a TIFF image file directory
+type ifdEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+}
+
+func asciiEntry(tag uint16, s string) ifdEntry {
+	b := append([]byte(s), 0)
+	return ifdEntry{tag: tag, typ: typeASCII, count: uint32(len(b)), value: b}
+}
+
+func longEntry(tag uint16, v uint32) ifdEntry {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return ifdEntry{tag: tag, typ: typeLong, count: 1, value: b}
+}
+
+// exifSegment returns the payload of the APP1 segment of the metadata, a
+// little endian TIFF structure with IFD0 followed by the EXIF IFD
+func exifSegment(m Metadata) []byte {
+	t := m.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	ifd0 := []ifdEntry{
+		asciiEntry(tagMake, "GoAway"),
+		asciiEntry(tagSoftware, "GoAway wildlife mode"),
+		asciiEntry(tagDateTime, t.Format(exifDateTime)),
+	}
+	if m.Camera != "" {
+		ifd0 = append(ifd0, asciiEntry(tagModel, m.Camera))
+	}
+	_, offset := t.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	exif := []ifdEntry{
+		asciiEntry(tagDateTimeOriginal, t.Format(exifDateTime)),
+		asciiEntry(tagOffsetTimeOrig, fmt.Sprintf("%c%02d:%02d", sign, offset/3600, offset%3600/60)),
+	}
+	if c := m.comment(); c != "" {
+		exif = append(exif, ifdEntry{tag: tagUserComment, typ: typeUndefined, count: uint32(8 + len(c)), value: append([]byte("ASCII\x00\x00\x00"), c...)})
+	}
+	if m.Temperature != nil {
+		// a signed rational in tenths of a degree
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint32(b, uint32(int32(math.Round(*m.Temperature*10))))
+		binary.LittleEndian.PutUint32(b[4:], 10)
+		exif = append(exif, ifdEntry{tag: tagAmbientTemperature, typ: typeSRational, count: 1, value: b})
+	}
+	// IFD0 starts after the 8 bytes of the header, and the EXIF IFD after
+	// IFD0, whose size doesn't depend on the offset it points to
+	exifOffset := 8 + uint32(len(encodeIFD(append(ifd0, longEntry(tagExifIFD, 0)), 8)))
+	tiff := []byte("Exif\x00\x00II\x2a\x00\x08\x00\x00\x00")
+	tiff = append(tiff, encodeIFD(append(ifd0, longEntry(tagExifIFD, exifOffset)), 8)...)
+	return append(tiff, encodeIFD(exif, exifOffset)...)
+}
+
+// encodeIFD encodes an IFD, without a next IFD, at the given offset from
+// the start of the TIFF header, followed by its values which don't fit in
+// its entries
+func encodeIFD(entries []ifdEntry, offset uint32) []byte {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+	values := offset + uint32(2+12*len(entries)+4)
+	ifd := make([]byte, 2+12*len(entries)+4)
+	le := binary.LittleEndian
+	le.PutUint16(ifd, uint16(len(entries)))
+	extra := []byte{}
+	for i, e := range entries {
+		entry := ifd[2+12*i:]
+		le.PutUint16(entry, e.tag)
+		le.PutUint16(entry[2:], e.typ)
+		le.PutUint32(entry[4:], e.count)
+		if len(e.value) <= 4 {
+			copy(entry[8:12], e.value)
+			continue
+		}
+		le.PutUint32(entry[8:], values+uint32(len(extra)))
+		extra = append(extra, e.value...)
+		// values start on word boundaries
+		if len(extra)%2 == 1 {
+			extra = append(extra, 0)
+		}
+	}
+	// the next IFD's offset is left 0
+	return append(ifd, extra...)
+}
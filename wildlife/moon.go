@@ -0,0 +1,50 @@
+package wildlife
+
+import (
+	"math"
+	"time"
+)
+
+// synodicMonth is the mean time between new moons, in days
+const synodicMonth = 29.530588853
+
+// newMoon is a reference new moon
+var newMoon = time.Date(2000, time.January, 6, 18, 14, 0, 0, time.UTC)
+
+// moonPhases are the names of the phases of the moon, every eighth of the
+// synodic month from the new moon
+var moonPhases = []string{
+	"new moon",
+	"waxing crescent",
+	"first quarter",
+	"waxing gibbous",
+	"full moon",
+	"waning gibbous",
+	"last quarter",
+	"waning crescent",
+}
+
+// MoonPhase returns the phase of the moon at the given time, as the fraction
+// of the synodic month since the last new moon: 0 is the new moon and 0.5
+// the full moon. It is accurate to within about a day, which is enough to
+// relate animal activity to moonlight
+func MoonPhase(t time.Time) float64 {
+	days := t.Sub(newMoon).Hours() / 24
+	phase := math.Mod(days/synodicMonth, 1)
+	if phase < 0 {
+		phase++
+	}
+	return phase
+}
+
+// MoonPhaseName returns the name of a phase of the moon, e.g.
+// "waxing gibbous"
+func MoonPhaseName(phase float64) string {
+	return moonPhases[int(math.Floor(phase*8+0.5))%8]
+}
+
+// MoonIllumination returns the fraction of the moon's disc which is lit at
+// a phase of the moon
+func MoonIllumination(phase float64) float64 {
+	return (1 - math.Cos(2*math.Pi*phase)) / 2
+}
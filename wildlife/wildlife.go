@@ -0,0 +1,67 @@
+// Package wildlife tunes motion detectors for outdoor wildlife monitoring,
+// as trail cameras are: long events which animals resting or grazing don't
+// split, bursts of stills when they arrive, day and night profiles, and
+// stills tagged with EXIF metadata such as the temperature and the phase of
+// the moon
+package wildlife
+
+import (
+	"github.com/adrianosela/GoAway/detector"
+)
+
+// DefaultEventGap is the default number of consecutive frames without
+// motion after which an event ends in wildlife mode, 20s at 15 frames per
+// second, so that an animal which pauses stays in one long event and clip
+const DefaultEventGap = 300
+
+// Config configures wildlife mode, zero values use the defaults
+type Config struct {
+	// EventGap is the number of frames without motion after which an event
+	// ends, DefaultEventGap when 0
+	EventGap int
+	// Sensitivity is the minimum diff contour area, the day profile's when 0
+	Sensitivity float64
+}
+
+// Day and Night are the profiles of wildlife mode, they can be switched
+// between at civil twilight with a daynight.Scheduler given the camera's
+// location. Without one, wildlife mode switches to the night processing
+// whenever the camera's IR illuminator is on, see detector.NightAuto
+var (
+	Day = detector.Profile{
+		Name:        "wildlife-day",
+		Sensitivity: detector.VerySensitive,
+		Threshold:   detector.DefaultThreshold,
+		NightMode:   detector.NightAuto,
+	}
+	Night = detector.Profile{
+		Name:        "wildlife-night",
+		Sensitivity: detector.DefaultSensitive,
+		Threshold:   detector.DefaultNightThreshold,
+		NightMode:   detector.NightOn,
+	}
+)
+
+// Options returns the detector options of wildlife mode, which can be
+// followed by options of the caller's to override them:
+//   - events end after EventGap frames without motion rather than
+//     detector.DefaultEventGap
+//   - slow and resting subjects stay in the foreground longer, see
+//     detector.WithSlowSubjects
+//   - the Day profile's settings, switching to the night processing when
+//     the camera switches to IR
+func Options(c Config) []detector.Option {
+	if c.EventGap <= 0 {
+		c.EventGap = DefaultEventGap
+	}
+	if c.Sensitivity <= 0 {
+		c.Sensitivity = Day.Sensitivity
+	}
+	return []detector.Option{
+		detector.WithEventGap(c.EventGap),
+		detector.WithSlowSubjects(),
+		detector.WithSensitivity(c.Sensitivity),
+		detector.WithThreshold(Day.Threshold),
+		detector.WithNightMode(Day.NightMode),
+	}
+}